@@ -35,18 +35,51 @@ var errors = map[string]map[string]string{
 		"e021": "currency has enough votes",
 		"e022": "vote session not active",
 		"e023": "user already added a vote",
-
-		"Fullname: non zero.*":    "full_name:fullname is required",
-		"Email: non zero.*":       "email:email is required",
-		"Email:.*as email":        "email:email is not valid",
-		"PhotoURL: non zero.*":    "photo_url:photo_url is required",
-		"Provider: non zero.*":    "provider:provider is required",
-		"ProviderId: non zero.*":  "provider_id:provider_id is required",
-		"AccessToken: non zero.*": "user_token:user_token is required",
-		"Password: non zero.*":    "password:password is required",
-		".*isValidPassword":       "password:password must have atleast 6 characters",
-		"CurrencyId: non zero.*":  "currency_id:currency id is required",
-		"VoteId: non zero.*":      "vote_id:vote id is required",
+		"e024": "user cannot vote on own currency",
+		"e025": "daily vote limit reached",
+		"e026": "vote rejected due to correlated voting activity",
+		"e027": "webhook not found",
+		"e028": "webhook url is invalid",
+		"e029": "webhook event is not supported",
+		"e030": "refresh token is invalid",
+		"e031": "auth provider is not supported",
+		"e032": "an account with this email exists. log in with a linked provider to link this provider",
+		"e033": "the only identity of a user cannot be unlinked",
+		"e034": "identity not found",
+		"e035": "api key is invalid",
+		"e036": "rate limit exceeded",
+		"e037": "api key does not have the required scope",
+		"e038": "api key not found",
+		"e039": "api key scope is not supported",
+		"e040": "api key rate limit is invalid",
+		"e041": "user account is banned",
+		"e042": "permission denied",
+		"e043": "currency status is not valid",
+		"e044": "role is not valid",
+		"e045": "currency code, denomination and serial are required",
+		"e046": "too many notes in lookup",
+		"e047": "location is not valid",
+		"e048": "cursor is invalid",
+		"e049": "collection not found",
+		"e050": "collection limit reached",
+		"e051": "watchlist not found",
+		"e052": "watchlist limit reached",
+		"e053": "currency is not held for a risk review",
+		"e054": "counterfeit serial not found",
+
+		"Fullname: non zero.*":       "full_name:fullname is required",
+		"Email: non zero.*":          "email:email is required",
+		"Email:.*as email":           "email:email is not valid",
+		"PhotoURL: non zero.*":       "photo_url:photo_url is required",
+		"Provider: non zero.*":       "provider:provider is required",
+		"ProviderId: non zero.*":     "provider_id:provider_id is required",
+		"ProviderUserId: non zero.*": "provider_id:provider_id is required",
+		"AccessToken: non zero.*":    "user_token:user_token is required",
+		"Password: non zero.*":       "password:password is required",
+		".*isValidPassword":          "password:password must have atleast 6 characters",
+		"CurrencyId: non zero.*":     "currency_id:currency id is required",
+		"VoteId: non zero.*":         "vote_id:vote id is required",
+		"RefreshToken: non zero.*":   "refresh_token:refresh token is required",
 	},
 }
 
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"io"
 	"errors"
+	"net"
+	"strings"
 	
 	"github.com/ellcrys/util"
 	"github.com/labstack/echo"
@@ -126,6 +128,51 @@ func (c *Context) GetSignature() string {
 	return c.Request().Header().Get("x-signature")
 }
 
+// Get x-device-fingerprint header value. The fingerprint is chosen by the
+// client, so it can only add to the signals that tie requests together and
+// must never be the only thing a check relies on.
+func (c *Context) GetDeviceFingerprint() string {
+	return strings.TrimSpace(c.Request().Header().Get("x-device-fingerprint"))
+}
+
+// Get the IP address of the client. The x-forwarded-for and x-real-ip
+// headers are only used when the request came through a trusted proxy,
+// otherwise the address the request was received from is used.
+func (c *Context) RealIP() string {
+	remoteIP, _, err := net.SplitHostPort(c.Request().RemoteAddress())
+	if err != nil {
+		remoteIP = c.Request().RemoteAddress()
+	}
+	if !IsTrustedProxy(remoteIP) {
+		return remoteIP
+	}
+
+	// the client is the last address that was not added by a trusted proxy
+	if forwardedFor := c.Request().Header().Get("x-forwarded-for"); forwardedFor != "" {
+		addresses := strings.Split(forwardedFor, ",")
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := strings.TrimSpace(addresses[i])
+			if net.ParseIP(address) == nil {
+				break
+			}
+			if i == 0 || !IsTrustedProxy(address) {
+				return address
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(c.Request().Header().Get("x-real-ip")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return remoteIP
+}
+
+// Get x-api-key header value
+func (c *Context) GetAPIKey() string {
+	return strings.TrimSpace(c.Request().Header().Get("x-api-key"))
+}
+
 // Get 'Authorization' header value
 func (c *Context)  GetAuthorization() string {
 	return c.Request().Header().Get("authorization")
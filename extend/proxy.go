@@ -0,0 +1,54 @@
+package extend
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// The networks of the proxies allowed to set the client address headers
+var trustedProxies []*net.IPNet
+
+// Set the proxies allowed to set the client address headers. Each
+// proxy is an IP address or a network in CIDR notation.
+func SetTrustedProxies(proxies []string) error {
+	networks := []*net.IPNet{}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return errors.New("trusted proxy " + proxy + " is not a valid ip address")
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return errors.New("trusted proxy " + proxy + " is not a valid network")
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies = networks
+	return nil
+}
+
+// Check whether an address belongs to a trusted proxy
+func IsTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package lib
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/labstack/echo/engine/standard"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// What happens to the currencies of a deleted account
+const (
+	DeleteCurrencies    = "delete"
+	AnonymizeCurrencies = "anonymize"
+)
+
+// A currency in a data archive. Includes the ip address and device
+// of the uploader but not the identity of other voters.
+type archivedCurrency struct {
+	models.CurrencyModel
+	UploaderIP          string `json:"uploader_ip"`
+	UploaderFingerprint string `json:"uploader_fingerprint"`
+}
+
+// A vote cast by the user in a data archive
+type archivedVote struct {
+	CurrencyId   bson.ObjectId `json:"currency_id" bson:"currency_id"`
+	CurrencyCode string        `json:"currency_code" bson:"currency_code"`
+	Denomination string        `json:"denomination" bson:"denomination"`
+	Serial       string        `json:"serial" bson:"serial"`
+	Decision     int           `json:"decision" bson:"decision"`
+	IP           string        `json:"ip" bson:"ip"`
+	Fingerprint  string        `json:"fingerprint" bson:"fingerprint"`
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+}
+
+// A sighting in a data archive
+type archivedSighting struct {
+	models.SightingModel
+	IP          string `json:"ip"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Delete a currency of a deleted account along with its images and sightings
+func (self *UserController) deleteCurrency(currency *models.CurrencyModel) error {
+
+	if err := models.Currency.Delete(self.mongoSession, currency.Id.Hex()); err != nil {
+		return err
+	}
+
+	if err := models.RemoveFromVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode); err != nil {
+		util.Println("Failed to remove currency from vote queue. ", err.Error())
+	}
+
+	if err := models.Sighting.DeleteByCurrency(self.mongoSession, currency.Id.Hex()); err != nil {
+		return err
+	}
+
+	go self.mint.DeleteImage(path.Base(currency.ImageURL))
+	go self.mint.DeleteImage(path.Base(currency.OriginalImageURL))
+	return nil
+}
+
+// @API: DELETE /v1/users/me
+//
+// @Description:
+// 	Delete the account of the authenticated user. Sessions and API keys are revoked, webhooks,
+// 	collections, watchlists, notifications, sightings and leaderboard positions are removed
+// 	and the user's votes are anonymized. The user's currencies are deleted along with their
+// 	images or, if requested, kept and anonymized. Audit log entries are kept as they are immutable
+// 	but the user's id and ip address are erased from the entries made by the user.
+//
+// @Query Params:
+// 	currencies 	String: What to do with the user's currencies (delete or anonymize). Default: delete
+//
+// @Response 200:
+// 	id 			String: The id of the deleted user
+// 	currencies 	String: What happened to the user's currencies
+func (self *UserController) DeleteAccount(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+
+	currencies := c.Echo().QueryParam("currencies")
+	if currencies == "" {
+		currencies = DeleteCurrencies
+	} else if currencies != DeleteCurrencies && currencies != AnonymizeCurrencies {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("currencies must be delete or anonymize").SetCode("invalid_parameter").SetParam("currencies")
+	}
+
+	user, err := models.User.FindById(self.mongoSession, authUserId)
+	if err != nil && err == mgo.ErrNotFound {
+		return config.NewHTTPError(c.Lang(), 404, "e011")
+	} else if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	// revoke all sessions first so the account cannot be used while it is being deleted
+	if err = models.RefreshToken.RevokeAllForUser(self.mongoSession, authUserId); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.RevokeUserTokens(self.redisPool, authUserId, AccessTokenTTL()); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.APIKey.RevokeAllForUser(self.mongoSession, authUserId); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.Webhook.DeleteByUser(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to delete webhooks. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.Collection.DeleteByUser(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to delete collections. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.Watchlist.DeleteByUser(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to delete watchlists. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.Notification.DeleteByUser(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to delete notifications. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if currencies == DeleteCurrencies {
+		iter := models.Currency.Iter(self.mongoSession, &models.CurrencyFilter{UserId: authUserId})
+		var currency models.CurrencyModel
+		for iter.Next(&currency) {
+			if err = self.deleteCurrency(&currency); err != nil {
+				break
+			}
+			currency = models.CurrencyModel{}
+		}
+		if closeErr := iter.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			util.Println("Failed to delete currencies. ", err.Error())
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+	} else if err = models.Currency.CoarsenUserLocations(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to coarsen currency locations. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	// moves remaining currencies and the user's votes to the deleted user
+	if err = models.Currency.AnonymizeUser(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to anonymize currencies. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.Sighting.DeleteByUser(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to delete sightings. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.RemoveFromLeaderboards(self.redisPool, authUserId); err != nil {
+		util.Println("Failed to remove user from leaderboards. ", err.Error())
+	}
+
+	if err = models.AuditLog.EraseActor(self.mongoSession, authUserId); err != nil {
+		util.Println("Failed to erase user from audit log. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	// recorded as a system action so the entry holds no personal data
+	recordAudit(self.mongoSession, nil, models.AuditUserDelete, models.AuditTargetUser, authUserId, map[string]interface{}{
+		"provider":   user.Provider,
+		"currencies": currencies,
+	}, "")
+
+	if err = models.User.Delete(self.mongoSession, authUserId); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"id": authUserId, "currencies": currencies})
+}
+
+// Write a value to a JSON file of an archive
+func writeArchiveFile(archive *zip.Writer, name string, value interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Write the items of an iterator to a newline delimited JSON file of an
+// archive. Each item is decoded with next and transformed before it is written.
+func writeArchiveIter(archive *zip.Writer, name string, iter *mgo.Iter, next func(iter *mgo.Iter) (interface{}, bool)) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		iter.Close()
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for {
+		item, ok := next(iter)
+		if !ok {
+			break
+		}
+		if err = encoder.Encode(item); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+// @API: GET /v1/users/me/data
+//
+// @Description:
+// 	Download a zip archive of everything stored about the authenticated user.
+// 	The archive contains the user's profile, currencies, votes, sightings,
+// 	API keys, webhooks, collections, watchlists, notifications and audit log entries.
+//
+// @Response 200: A zip archive
+func (self *UserController) GetData(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+
+	user, err := models.User.FindById(self.mongoSession, authUserId)
+	if err != nil && err == mgo.ErrNotFound {
+		return config.NewHTTPError(c.Lang(), 404, "e011")
+	} else if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	apiKeys, err := models.APIKey.FindByUser(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	webhooks, err := models.Webhook.FindByUser(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	collections, err := models.Collection.FindByUser(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	watchlists, err := models.Watchlist.FindByOwner(self.mongoSession, authUserId, "")
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	user.AccessToken = ""
+	user.AccessSecret = ""
+
+	// archives can take a while, use a dedicated connection
+	ses := self.mongoSession.Copy()
+	defer ses.Close()
+
+	res := c.Response().(*standard.Response)
+	res.Header().Set("Content-Type", "application/zip")
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="openmint-data-%s.zip"`, authUserId))
+	res.WriteHeader(200)
+
+	archive := zip.NewWriter(res)
+
+	files := []func() error{
+		func() error { return writeArchiveFile(archive, "user.json", user) },
+		func() error { return writeArchiveFile(archive, "api_keys.json", apiKeys) },
+		func() error { return writeArchiveFile(archive, "webhooks.json", webhooks) },
+		func() error { return writeArchiveFile(archive, "collections.json", collections) },
+		func() error { return writeArchiveFile(archive, "watchlists.json", watchlists) },
+		func() error {
+			iter := models.Currency.Iter(ses, &models.CurrencyFilter{UserId: authUserId})
+			return writeArchiveIter(archive, "currencies.ndjson", iter, func(iter *mgo.Iter) (interface{}, bool) {
+				var currency models.CurrencyModel
+				if !iter.Next(&currency) {
+					return nil, false
+				}
+				for i := range currency.Votes {
+					currency.Votes[i].UserId = ""
+				}
+				return archivedCurrency{currency, currency.UploaderIP, currency.UploaderFingerprint}, true
+			})
+		},
+		func() error {
+			iter := models.Currency.IterVotesByUser(ses, authUserId)
+			return writeArchiveIter(archive, "votes.ndjson", iter, func(iter *mgo.Iter) (interface{}, bool) {
+				var vote archivedVote
+				if !iter.Next(&vote) {
+					return nil, false
+				}
+				return vote, true
+			})
+		},
+		func() error {
+			iter := models.Sighting.IterByUser(ses, authUserId)
+			return writeArchiveIter(archive, "sightings.ndjson", iter, func(iter *mgo.Iter) (interface{}, bool) {
+				var sighting models.SightingModel
+				if !iter.Next(&sighting) {
+					return nil, false
+				}
+				return archivedSighting{sighting, sighting.IP, sighting.Fingerprint}, true
+			})
+		},
+		func() error {
+			iter := models.Notification.IterByUser(ses, authUserId)
+			return writeArchiveIter(archive, "notifications.ndjson", iter, func(iter *mgo.Iter) (interface{}, bool) {
+				var notification models.NotificationModel
+				if !iter.Next(&notification) {
+					return nil, false
+				}
+				return notification, true
+			})
+		},
+		func() error {
+			iter := models.AuditLog.IterByUser(ses, authUserId)
+			return writeArchiveIter(archive, "audit_log.ndjson", iter, func(iter *mgo.Iter) (interface{}, bool) {
+				var entry models.AuditLogModel
+				if !iter.Next(&entry) {
+					return nil, false
+				}
+				return entry, true
+			})
+		},
+	}
+
+	// the response has started, errors end the archive early
+	for _, writeFile := range files {
+		if err = writeFile(); err != nil {
+			util.Println("Failed to write data archive. ", err.Error())
+			return nil
+		}
+	}
+
+	if err = archive.Close(); err != nil {
+		util.Println("Failed to close data archive. ", err.Error())
+	}
+
+	return nil
+}
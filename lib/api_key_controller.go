@@ -0,0 +1,151 @@
+// This controller manages API keys used by partner systems
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// API keys start with this marker so they can be told apart from session tokens
+const API_KEY_MARKER = "omk_"
+
+// The length of the part of a key stored in plain text
+const API_KEY_PREFIX_LENGTH = len(API_KEY_MARKER) + 8
+
+type createAPIKeyBody struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	RateLimit int      `json:"rate_limit"`
+}
+
+type APIKeyController struct {
+	mongoSession *mgo.Session
+}
+
+// Create a new controller instance
+func NewAPIKeyController(mongoSession *mgo.Session) *APIKeyController {
+	return &APIKeyController{mongoSession}
+}
+
+// Generate a new API key. Returns the key and its prefix.
+func NewAPIKey() (string, string) {
+	key := API_KEY_MARKER + randomHex(4) + NewSecret()
+	return key, key[:API_KEY_PREFIX_LENGTH]
+}
+
+// Check whether a credential looks like an API key
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, API_KEY_MARKER) && len(credential) > API_KEY_PREFIX_LENGTH
+}
+
+// Hash an API key for storage
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// @API: POST /v1/api_keys
+//
+// @Description:
+// 	Create an API key that acts on behalf of the authenticated user. The key is
+// 	only returned once. Requests authenticate by sending the key in the `x-api-key`
+// 	header or as a bearer token. Keys can only access endpoints allowed by their scopes.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	name 		{string}: A name describing the key
+// 	scopes 		{Array[string]}: The scopes granted to the key (mint:create, mint:read, vote)
+// 	rate_limit 	{int}: The maximum number of requests per minute (optional)
+//
+// @Response 201: Returns models.APIKeyModel instance including the key
+func (self *APIKeyController) Create(c *extend.Context) error {
+
+	var body createAPIKeyBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if len(body.Scopes) == 0 {
+		return config.NewHTTPError(c.Lang(), 400, "e039").SetCode("invalid_parameter").SetParam("scopes")
+	}
+
+	for _, scope := range body.Scopes {
+		if !util.InStringSlice(models.APIKeyScopes, scope) {
+			return config.NewHTTPError(c.Lang(), 400, "e039").SetCode("invalid_parameter").SetParam("scopes").SetHint(scope)
+		}
+	}
+
+	maxRateLimit := config.C.GetInt("api_key_max_rate_limit")
+	if body.RateLimit == 0 {
+		body.RateLimit = config.C.GetInt("api_key_rate_limit")
+	} else if body.RateLimit < 0 || body.RateLimit > maxRateLimit {
+		return config.NewHTTPError(c.Lang(), 400, "e040").SetCode("invalid_parameter").SetParam("rate_limit")
+	}
+
+	key, prefix := NewAPIKey()
+	apiKey := &models.APIKeyModel{
+		Id:        models.NewId(),
+		UserId:    bson.ObjectIdHex(c.Get("auth_user")),
+		Name:      strings.TrimSpace(body.Name),
+		Prefix:    prefix,
+		KeyHash:   HashAPIKey(key),
+		Scopes:    body.Scopes,
+		RateLimit: body.RateLimit,
+	}
+
+	if err := models.APIKey.Create(self.mongoSession, apiKey); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	apiKey.Key = key
+	return c.JSON(201, apiKey)
+}
+
+// @API: GET /v1/api_keys
+// @Description: Get the API keys of the authenticated user. Keys are identified by their prefix.
+func (self *APIKeyController) List(c *extend.Context) error {
+
+	apiKeys, err := models.APIKey.FindByUser(self.mongoSession, c.Get("auth_user"))
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, apiKeys)
+}
+
+// @API: DELETE /v1/api_keys/:id
+// @Description: Revoke an API key
+func (self *APIKeyController) Revoke(c *extend.Context) error {
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return config.NewHTTPError(c.Lang(), 404, "e038")
+	}
+
+	apiKey, err := models.APIKey.FindById(self.mongoSession, id)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 404, "e038")
+		}
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if apiKey.UserId.Hex() != c.Get("auth_user") {
+		return config.NewHTTPError(c.Lang(), 404, "e038")
+	}
+
+	if err = models.APIKey.Revoke(self.mongoSession, id); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"id": id})
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The pool of the queue holding entries that could not be appended
+var auditQueuePool *redis.Pool
+
+// Queue the audit log entries that cannot be appended in a redis list
+// and append them every interval until the queue is empty.
+func StartAuditLogQueue(mongoSession *mgo.Session, redisPool *redis.Pool, interval time.Duration) {
+	auditQueuePool = redisPool
+	go func() {
+		for range time.Tick(interval) {
+			if _, err := FlushAuditLogQueue(mongoSession, redisPool); err != nil {
+				util.Println("Failed to append queued audit log entries. ", err.Error())
+			}
+		}
+	}()
+}
+
+// Append the queued audit log entries. Returns the number of entries
+// appended. An entry that still cannot be appended is put back.
+func FlushAuditLogQueue(mongoSession *mgo.Session, redisPool *redis.Pool) (int, error) {
+	count := 0
+	for {
+		entry, err := models.PopAuditEntry(redisPool)
+		if err != nil || entry == nil {
+			return count, err
+		}
+		if err = models.AuditLog.Create(mongoSession, entry); err != nil {
+			if qErr := models.RequeueAuditEntry(redisPool, entry); qErr != nil {
+				util.Println("Audit log entry lost. ", qErr.Error())
+			}
+			return count, err
+		}
+		count++
+	}
+}
+
+// Append an entry to the audit log. The actor is the authenticated user of the
+// request. Pass a nil context for actions performed by the system. Entries
+// that cannot be appended are queued so the mutation they record is never
+// left out of the log.
+func recordAudit(ses *mgo.Session, c *extend.Context, action, targetType, targetId string, changes map[string]interface{}, reason string) {
+
+	entry := &models.AuditLogModel{
+		Id:         models.NewId(),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Changes:    changes,
+		Reason:     strings.TrimSpace(reason),
+		CreatedAt:  time.Now(),
+	}
+
+	if c != nil {
+		if actorId := c.Get("auth_user"); models.IsId(actorId) {
+			entry.ActorId = bson.ObjectIdHex(actorId)
+		}
+		entry.IP = c.RealIP()
+	}
+
+	err := models.AuditLog.Create(ses, entry)
+	if err == nil {
+		return
+	}
+
+	util.Println("Failed to create audit log entry, queueing it. ", err.Error())
+	if auditQueuePool == nil {
+		util.Println("Audit log entry lost: no queue is configured")
+	} else if err = models.QueueAuditEntry(auditQueuePool, entry); err != nil {
+		util.Println("Audit log entry lost. ", err.Error())
+	}
+}
+
+// Describe the change of a field for the audit log
+func change(from, to interface{}) map[string]interface{} {
+	return map[string]interface{}{"from": from, "to": to}
+}
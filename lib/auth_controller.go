@@ -2,44 +2,63 @@
 package lib
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/dghubble/oauth1"
-	"github.com/dghubble/oauth1/twitter"
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/ellcrys/openmint/config"
 	"github.com/ellcrys/openmint/extend"
 	"github.com/ellcrys/openmint/models"
 	"github.com/ellcrys/util"
-	"github.com/franela/goreq"
+	"github.com/garyburd/redigo/redis"
 	"github.com/labstack/echo/engine/standard"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-const TWITTER_CB_URL = "http://192.168.1.3:4001/v1/auth/twitter/cb"
+type refreshTokenBody struct {
+	RefreshToken string `json:"refresh_token" valid:"required"`
+}
+
+type linkIdentityBody struct {
+	Provider       string `json:"provider" valid:"required"`
+	ProviderUserId string `json:"provider_id" valid:"required"`
+	AccessToken    string `json:"access_token"`
+	AccessSecret   string `json:"access_secret"`
+	IdToken        string `json:"id_token"`
+	Nonce          string `json:"nonce"`
+}
+
+type logoutBody struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"`
+}
 
 type AuthController struct {
 	mongoSession *mgo.Session
-	twitterOAuth *oauth1.Config
+	redisPool    *redis.Pool
+	providers    *AuthProviderRegistry
 }
 
-func NewAuthController(mongoSession *mgo.Session) *AuthController {
+func NewAuthController(mongoSession *mgo.Session, redisPool *redis.Pool, providers *AuthProviderRegistry) *AuthController {
 	return &AuthController{
 		mongoSession: mongoSession,
-		twitterOAuth: &oauth1.Config{
-			ConsumerKey:    config.C.GetString("twitter_con_key"),
-			ConsumerSecret: config.C.GetString("twitter_con_secret"),
-			CallbackURL:    TWITTER_CB_URL,
-			Endpoint:       twitter.AuthorizeEndpoint,
-		},
+		redisPool:    redisPool,
+		providers:    providers,
 	}
 }
 
+// Get the twitter provider. Returns nil if twitter is not configured.
+func (self *AuthController) twitterProvider() *TwitterProvider {
+	provider, ok := self.providers.Get("twitter")
+	if !ok {
+		return nil
+	}
+	return provider.(*TwitterProvider)
+}
+
 // @API: POST /v1/auth/me
 //
 // @Description:
@@ -66,46 +85,152 @@ func (self *AuthController) GetUser(c *extend.Context) error {
 	return c.JSON(200, user)
 }
 
-// Given a facebook access token, it uses the facebook
-// token debug endpoint to determine whether the token
-// was generated for a user and by our application.
-func (self *AuthController) CheckFBToken(userId, token string) (bool, error) {
+// Create a new session for a user. Sets the access token
+// and a refresh token starting a new token family on the user.
+func (self *AuthController) createSession(user *models.UserModel) error {
 
+	accessToken, _, err := NewAccessToken(user.Id.Hex())
+	if err != nil {
+		return err
+	}
+
+	refreshToken, _, err := NewRefreshToken(self.mongoSession, user.Id.Hex(), "")
+	if err != nil {
+		return err
+	}
+
+	user.TokenString = accessToken
+	user.RefreshToken = refreshToken
+	return nil
+}
+
+// Get the url a completed twitter login is redirected to
+func sessionRedirectURL(user *models.UserModel) string {
 	qs := url.Values{}
-	qs.Set("input_token", token)
-	qs.Set("access_token", config.C.GetString("fb_app_token"))
+	qs.Set("session_token", user.TokenString)
+	qs.Set("refresh_token", user.RefreshToken)
+	return "/v1/auth/twitter/done?" + qs.Encode()
+}
+
+// @API: POST /v1/auth/token/refresh
+//
+// @Description:
+// 	Exchange a refresh token for a new access token and refresh token.
+// 	The refresh token used is revoked. Using a revoked refresh token
+// 	revokes every refresh token created from the same login.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	refresh_token 	{string}: The refresh token
+//
+// @Response 200:
+// 	session_token 	{string}: The new access token
+// 	refresh_token 	{string}: The new refresh token
+// 	expires_in 		{int}: The number of seconds the access token is valid for
+func (self *AuthController) RefreshSession(c *extend.Context) error {
+
+	var body refreshTokenBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if _, err := govalidator.ValidateStruct(body); err != nil {
+		return config.ValidationError(c, err)
+	}
 
-	res, err := goreq.Request{
-		Uri:         "https://graph.facebook.com/debug_token",
-		QueryString: qs,
-		Timeout:     15 * time.Second,
-	}.Do()
+	newRefreshToken, refreshToken, err := RotateRefreshToken(self.mongoSession, body.RefreshToken)
+	if err != nil {
+		if err == ErrInvalidRefreshToken || err == ErrRefreshTokenReused {
+			util.Println("Refresh rejected. ", err.Error())
+			return config.NewHTTPError(c.Lang(), 401, "e030")
+		}
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
 
+	accessToken, _, err := NewAccessToken(refreshToken.UserId.Hex())
 	if err != nil {
-		return false, err
+		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
-	var fbResp map[string]interface{}
-	res.Body.FromJsonTo(&fbResp)
-	fbResp = fbResp["data"].(map[string]interface{})
+	return c.JSON(200, extend.H{
+		"session_token": accessToken,
+		"refresh_token": newRefreshToken,
+		"expires_in":    int64(AccessTokenTTL() / time.Second),
+	})
+}
+
+// @API: POST /v1/auth/logout
+//
+// @Description:
+// 	Revoke the access token used to make the request and
+// 	optionally the refresh token of the session or every session of the user.
+//
+// @Header.Authorization:
+// 	Provide the user's jwt session token. e.g "Bearer Abxhsgggaa"
+//
+// @Body Params:
+// 	refresh_token 	{string}: The refresh token of the session to revoke (optional)
+// 	all 			{bool}: Revoke every session of the user (optional)
+//
+// @Response 200:
+func (self *AuthController) Logout(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
 
-	util.Println("Token Debug:", fbResp)
+	var body logoutBody
+	if c.Request().ContentLength() > 0 && c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
 
-	// token is invalid
-	if fbResp["is_valid"] == nil || fbResp["is_valid"].(bool) == false {
-		return false, nil
+	// revoke the access token until it expires
+	if jti := c.Get("auth_token_id"); jti != "" {
+		exp, _ := strconv.ParseInt(c.Get("auth_token_exp"), 10, 64)
+		if err := models.DenyToken(self.redisPool, jti, util.UnixToTime(exp).Sub(time.Now())); err != nil {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
 	}
 
-	// token not generated by this app
-	if fbResp["app_id"] == nil || fbResp["app_id"].(string) != config.C.GetString("fb_app_id") {
-		return false, nil
+	if body.All {
+		if err := models.RefreshToken.RevokeAllForUser(self.mongoSession, authUserId); err != nil {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		if err := models.RevokeUserTokens(self.redisPool, authUserId, AccessTokenTTL()); err != nil {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		return c.JSON(200, extend.H{})
 	}
 
-	if fbResp["user_id"] == nil || fbResp["user_id"].(string) != userId {
-		return false, nil
+	if body.RefreshToken != "" {
+		refreshToken, err := models.RefreshToken.FindByHash(self.mongoSession, HashRefreshToken(body.RefreshToken))
+		if err != nil && err != mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		if err == nil && refreshToken.UserId.Hex() == authUserId {
+			if err = models.RefreshToken.RevokeFamily(self.mongoSession, refreshToken.FamilyId); err != nil {
+				return config.NewHTTPError(c.Lang(), 500, "e500")
+			}
+		}
 	}
 
-	return true, nil
+	return c.JSON(200, extend.H{})
+}
+
+// @API: GET /.well-known/jwks.json
+//
+// @Description:
+// 	Get the public keys that verify session tokens as a JSON Web Key Set.
+// 	Keys scheduled for rotation are published before they sign tokens and
+// 	retired keys are published until the tokens they signed expire.
+//
+// @Response 200: A JSON Web Key Set
+func (self *AuthController) JWKS(c *extend.Context) error {
+	jwks := extend.H{"keys": []interface{}{}}
+	if kr := GetKeyRing(); kr != nil {
+		jwks = kr.JWKS(time.Now().UTC(), AccessTokenTTL())
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(200, jwks)
 }
 
 // @API: POST /v1/auth/social
@@ -115,21 +240,26 @@ func (self *AuthController) CheckFBToken(userId, token string) (bool, error) {
 //  no matching user exists for the social login provider
 //  used and returns a the new user and a session access token.
 //  If user exists, the user is returned along with a session access token.
+//  The user token is verified by the provider. Unknown providers are rejected.
+//  For OpenID Connect providers, the ID token is sent in `id_token` (or `user_token`).
 //
 // @Content-Type: 	application/json
 //
 // @Body Params:
 // 	full_name 	{string}: The full name of the user
-// 	email 		{string}: The email address of the user
+// 	email 		{string}: The email address of the user (optional). Only emails verified by the provider are stored
 // 	photo_url   {string}: Photo URL
 // 	provider 	{string}: The social login provider
 //	provider_id {string}: The id of the user on the provider's platform
 // 	user_token 	{string}: The user access token generated by the provider
+// 	id_token 	{string}: The ID token generated by an OpenID Connect provider (optional)
+// 	nonce 		{string}: The nonce sent in the OpenID Connect sign in request (optional)
 //
 // @Response 200:
 // 	id 			{string}: The id of the user
 // 	full_name 	{string}: The full name of the user
 // 	email 		{string}: The email address of the user
+// 	email_verified {bool}: Whether the email was verified by the provider
 // 	photo_url	{string}: Photo url of user
 // 	provider 	{string}: The social login provider
 //	provider_id {string}: The id of the user on the provider's platform
@@ -148,70 +278,422 @@ func (self *AuthController) SocialAuth(c *extend.Context) error {
 		return config.ValidationError(c, err)
 	}
 
-	// verify user token for facebook provider
-	if body.Provider == "facebook" {
-		if valid, err := self.CheckFBToken(body.ProviderUserId, body.AccessToken); err != nil || !valid {
-			if err != nil {
-				util.Println("Failed to check fb token. ", err.Error())
-				return config.NewHTTPError(c.Lang(), 500, "e500")
-			}
-			return config.NewHTTPError(c.Lang(), 401, "e010")
-		}
+	identity, err := self.verifyCredential(c, body.Provider, &ProviderCredential{
+		ProviderUserId: body.ProviderUserId,
+		AccessToken:    body.AccessToken,
+		AccessSecret:   body.AccessSecret,
+		IdToken:        body.IdToken,
+		Nonce:          body.Nonce,
+	})
+	if err != nil {
+		return err
+	}
+
+	// prefer the details verified by the provider. Emails are only
+	// kept when the provider verified them (facebook and twitter do not
+	// return one), the email sent by the client is never trusted.
+	body.ProviderUserId = identity.ProviderUserId
+	body.Email, body.EmailVerified = "", false
+	if identity.Email != "" && identity.EmailVerified {
+		body.Email, body.EmailVerified = identity.Email, true
 	}
+	if identity.Fullname != "" {
+		body.Fullname = identity.Fullname
+	}
+	if identity.PhotoURL != "" {
+		body.PhotoURL = identity.PhotoURL
+	}
+
+	// find the user the identity is linked to.
+	// If found, return new access token.
+	user, err := models.User.FindByIdentity(self.mongoSession, body.Provider, body.ProviderUserId)
+	if err == nil {
 
-	// find existing user with matching email.
-	// If found and the provider name and id matches, return new access token.
-	user, err := models.User.FindByField(self.mongoSession, "email", body.Email)
-	if err == nil && user.Provider == body.Provider && user.ProviderUserId == body.ProviderUserId {
+		// complete an interrupted merge of the user
+		if user, err = self.resumeMerge(user); err != nil {
+			util.Println("Failed to resume merge. ", err.Error())
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
 
 		// update user token
 		if err = models.User.UpdateField(self.mongoSession, user.Id.Hex(), "access_token", body.AccessToken); err != nil {
 			return config.NewHTTPError(c.Lang(), 500, "e500")
 		}
 
-		// create access token
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":  user.Id.Hex(),
-			"iat": time.Now().Unix(),
-		})
+		// credentials are secret, only the changed fields are recorded
+		recordAudit(self.mongoSession, c, models.AuditUserCredentials, models.AuditTargetUser, user.Id.Hex(), map[string]interface{}{
+			"fields": []string{"access_token"},
+		}, body.Provider)
 
+		// create access and refresh token
 		user.AccessToken = ""
-		user.TokenString, err = token.SignedString([]byte(config.C.GetString("hmac_key")))
-		if err != nil {
+		if err = self.createSession(user); err != nil {
 			return config.NewHTTPError(c.Lang(), 500, "e500")
 		}
 
 		return c.JSON(200, user)
 	}
 
-	if err != nil && err != mgo.ErrNotFound {
+	if err != mgo.ErrNotFound {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
+	// an account with the same verified email exists. The identity must
+	// be linked from that account rather than creating a duplicate.
+	if body.EmailVerified {
+		if _, err := models.User.FindByVerifiedEmail(self.mongoSession, body.Email); err == nil {
+			return config.NewHTTPError(c.Lang(), 409, "e032").SetCode("account_exists")
+		} else if err != mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+	}
+
+	body.Identities = []models.Identity{{
+		Provider:       body.Provider,
+		ProviderUserId: body.ProviderUserId,
+		Email:          body.Email,
+		EmailVerified:  body.EmailVerified,
+		LinkedAt:       time.Now().UTC(),
+	}}
+
 	body.Id = models.NewId()
 	if err = models.User.Create(self.mongoSession, &body); err != nil {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":  body.Id.Hex(),
-		"iat": time.Now().Unix(),
-	})
+	recordAudit(self.mongoSession, c, models.AuditUserCreate, models.AuditTargetUser, body.Id.Hex(), map[string]interface{}{
+		"provider": body.Provider,
+	}, "")
 
 	body.AccessToken = ""
-	body.TokenString, err = token.SignedString([]byte(config.C.GetString("hmac_key")))
-	if err != nil {
+	body.IdToken, body.Nonce = "", ""
+	if err = self.createSession(&body); err != nil {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
 	return c.JSON(201, body)
 }
 
+// Verify a credential with a provider. Returns an HTTP error
+// if the provider is unknown or the credential is invalid.
+func (self *AuthController) verifyCredential(c *extend.Context, providerName string, credential *ProviderCredential) (*ProviderIdentity, error) {
+
+	provider, ok := self.providers.Get(providerName)
+	if !ok {
+		return nil, config.NewHTTPError(c.Lang(), 400, "e031").SetCode("invalid_parameter").SetParam("provider")
+	}
+
+	identity, err := provider.Verify(credential)
+	if err != nil {
+		if err == ErrInvalidProviderCredential {
+			return nil, config.NewHTTPError(c.Lang(), 401, "e010")
+		}
+		util.Println("Failed to verify "+providerName+" token. ", err.Error())
+		return nil, config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return identity, nil
+}
+
+// Merge a user into another user. The identities, currencies, votes and webhooks
+// of the source user are moved to the target user. The sessions and API keys of the
+// source user are revoked and the source user is deleted. The merge is recorded on
+// the source user first and the source user is deleted last so an interrupted merge
+// is resumed by merging again.
+func (self *AuthController) mergeUsers(target, source *models.UserModel) error {
+
+	sourceId, targetId := source.Id.Hex(), target.Id.Hex()
+
+	if err := models.User.StartMerge(self.mongoSession, sourceId, targetId); err != nil {
+		return err
+	}
+
+	// the source must not be used while it is merged
+	if err := models.RefreshToken.RevokeAllForUser(self.mongoSession, sourceId); err != nil {
+		return err
+	}
+
+	if err := models.RevokeUserTokens(self.redisPool, sourceId, AccessTokenTTL()); err != nil {
+		return err
+	}
+
+	if err := models.APIKey.RevokeAllForUser(self.mongoSession, sourceId); err != nil {
+		return err
+	}
+
+	if err := models.Currency.ReassignUser(self.mongoSession, sourceId, targetId); err != nil {
+		return err
+	}
+
+	if err := models.Sighting.ReassignUser(self.mongoSession, sourceId, targetId); err != nil {
+		return err
+	}
+
+	if err := models.Webhook.ReassignUser(self.mongoSession, sourceId, targetId); err != nil {
+		return err
+	}
+
+	if err := models.Collection.ReassignUser(self.mongoSession, sourceId, targetId); err != nil {
+		return err
+	}
+
+	if err := models.Watchlist.ReassignUser(self.mongoSession, sourceId, targetId); err != nil {
+		return err
+	}
+
+	if err := models.Notification.ReassignUser(self.mongoSession, sourceId, targetId); err != nil {
+		return err
+	}
+
+	for _, achievement := range source.Achievements {
+		if _, err := models.User.AddAchievement(self.mongoSession, targetId, achievement); err != nil {
+			return err
+		}
+	}
+
+	// identities are unique so the source releases them before
+	// they are linked to the target. Released identities are held
+	// by the source in case the merge is interrupted.
+	moved := source.HeldIdentities
+	if len(moved) == 0 {
+		moved = source.LinkedIdentities()
+		if err := models.User.ReleaseIdentities(self.mongoSession, sourceId, moved); err != nil {
+			return err
+		}
+	}
+
+	identities := target.LinkedIdentities()
+	for _, identity := range moved {
+		if !hasIdentity(identities, identity) {
+			identity.LinkedAt = time.Now().UTC()
+			identities = append(identities, identity)
+		}
+	}
+
+	if err := models.User.SetIdentities(self.mongoSession, targetId, identities); err != nil {
+		return err
+	}
+
+	target.Identities = identities
+
+	return models.User.Delete(self.mongoSession, sourceId)
+}
+
+// Complete the merge of a user found in the middle of being merged into
+// another user. Returns the user the identities of the user belong to.
+func (self *AuthController) resumeMerge(user *models.UserModel) (*models.UserModel, error) {
+
+	if user.MergedInto == "" {
+		return user, nil
+	}
+
+	target, err := models.User.FindById(self.mongoSession, user.MergedInto.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = self.mergeUsers(target, user); err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// Check whether an identity is in a list of identities
+func hasIdentity(identities []models.Identity, identity models.Identity) bool {
+	for _, i := range identities {
+		if i.Provider == identity.Provider && i.ProviderUserId == identity.ProviderUserId {
+			return true
+		}
+	}
+	return false
+}
+
+// @API: POST /v1/auth/identities
+//
+// @Description:
+// 	Link a social login identity to the authenticated user. If the identity
+// 	belongs to another user, the other user is merged into the authenticated
+// 	user: its identities, currencies, votes and webhooks are moved and it is deleted.
+// 	Banned users and users with roles are not merged.
+//
+// @Header.Authorization:
+// 	Provide the user's jwt session token. e.g "Bearer Abxhsgggaa"
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	provider 		{string}: The social login provider
+//	provider_id 	{string}: The id of the user on the provider's platform
+// 	access_token 	{string}: The user access token generated by the provider
+// 	access_secret 	{string}: The user access secret (twitter only)
+// 	id_token 		{string}: The ID token generated by an OpenID Connect provider (optional)
+// 	nonce 			{string}: The nonce sent in the OpenID Connect sign in request (optional)
+//
+// @Response 200: Returns models.UserModel instance
+func (self *AuthController) LinkIdentity(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+
+	var body linkIdentityBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if _, err := govalidator.ValidateStruct(body); err != nil {
+		return config.ValidationError(c, err)
+	}
+
+	identity, err := self.verifyCredential(c, body.Provider, &ProviderCredential{
+		ProviderUserId: body.ProviderUserId,
+		AccessToken:    body.AccessToken,
+		AccessSecret:   body.AccessSecret,
+		IdToken:        body.IdToken,
+		Nonce:          body.Nonce,
+	})
+	if err != nil {
+		return err
+	}
+
+	user, err := models.User.FindById(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	owner, err := models.User.FindByIdentity(self.mongoSession, body.Provider, identity.ProviderUserId)
+	if err != nil && err != mgo.ErrNotFound {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	} else if err == nil {
+		if owner, err = self.resumeMerge(owner); err != nil {
+			util.Println("Failed to resume merge. ", err.Error())
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+	}
+
+	switch {
+
+	// identity is already linked to the user
+	case err == nil && owner.Id == user.Id:
+
+	// banned and staff accounts are not merged, a ban could be escaped
+	// and roles gained by linking the identity of another account
+	case err == nil && (user.Banned || owner.Banned || len(user.Roles) > 0 || len(owner.Roles) > 0):
+		recordAudit(self.mongoSession, c, models.AuditUserMergeRefused, models.AuditTargetUser, user.Id.Hex(), map[string]interface{}{
+			"merged_user_id": owner.Id.Hex(),
+			"provider":       body.Provider,
+		}, "banned or staff account")
+		return config.NewHTTPError(c.Lang(), 403, "e042")
+
+	// identity belongs to another user
+	case err == nil:
+		if err = self.mergeUsers(user, owner); err != nil {
+			util.Println("Failed to merge users. ", err.Error())
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		recordAudit(self.mongoSession, c, models.AuditUserMerge, models.AuditTargetUser, user.Id.Hex(), map[string]interface{}{
+			"merged_user_id": owner.Id.Hex(),
+			"provider":       body.Provider,
+		}, "")
+
+	default:
+		linked := models.Identity{
+			Provider:       body.Provider,
+			ProviderUserId: identity.ProviderUserId,
+			LinkedAt:       time.Now().UTC(),
+		}
+		if identity.EmailVerified {
+			linked.Email, linked.EmailVerified = identity.Email, true
+		}
+		identities := append(user.LinkedIdentities(), linked)
+		if err = models.User.SetIdentities(self.mongoSession, authUserId, identities); err != nil {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		recordAudit(self.mongoSession, c, models.AuditUserIdentities, models.AuditTargetUser, authUserId, map[string]interface{}{
+			"linked": body.Provider,
+		}, "")
+		user.Identities = identities
+	}
+
+	user.AccessToken = ""
+	user.AccessSecret = ""
+
+	return c.JSON(200, user)
+}
+
+// @API: DELETE /v1/auth/identities/:provider
+//
+// @Description:
+// 	Unlink the identity of a provider from the authenticated user.
+// 	The only identity of a user cannot be unlinked.
+//
+// @Header.Authorization:
+// 	Provide the user's jwt session token. e.g "Bearer Abxhsgggaa"
+//
+// @Response 200: Returns models.UserModel instance
+func (self *AuthController) UnlinkIdentity(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+	provider := c.Param("provider")
+
+	user, err := models.User.FindById(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	linked := user.LinkedIdentities()
+	identities := []models.Identity{}
+	for _, identity := range linked {
+		if identity.Provider != provider {
+			identities = append(identities, identity)
+		}
+	}
+
+	if len(identities) == len(linked) {
+		return config.NewHTTPError(c.Lang(), 404, "e034")
+	}
+
+	if len(identities) == 0 {
+		return config.NewHTTPError(c.Lang(), 400, "e033")
+	}
+
+	update := bson.M{"identities": identities}
+
+	// the primary identity is replaced by the oldest remaining identity
+	if user.Provider == provider {
+		update["provider"] = identities[0].Provider
+		update["provider_id"] = identities[0].ProviderUserId
+		update["access_token"] = ""
+		update["access_secret"] = ""
+		user.Provider = identities[0].Provider
+		user.ProviderUserId = identities[0].ProviderUserId
+	}
+
+	if err = models.User.Update(self.mongoSession, authUserId, bson.M{"$set": update}); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	recordAudit(self.mongoSession, c, models.AuditUserIdentities, models.AuditTargetUser, authUserId, map[string]interface{}{
+		"unlinked":         provider,
+		"primary_provider": user.Provider,
+	}, "")
+
+	user.Identities = identities
+	user.AccessToken = ""
+	user.AccessSecret = ""
+
+	return c.JSON(200, user)
+}
+
 // @API: GET /v1/auth/twitter/request_token
 // @Description: Get twitter request token
 func (self *AuthController) GetTwitterRequestToken(c *extend.Context) error {
 
-	requestToken, requestSecret, err := self.twitterOAuth.RequestToken()
+	twitterProvider := self.twitterProvider()
+	if twitterProvider == nil {
+		return config.NewHTTPError(c.Lang(), 400, "e031")
+	}
+
+	requestToken, requestSecret, err := twitterProvider.OAuth.RequestToken()
 	if err != nil {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
@@ -226,7 +708,7 @@ func (self *AuthController) GetTwitterRequestToken(c *extend.Context) error {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
-	authUrl, err := self.twitterOAuth.AuthorizationURL(requestToken)
+	authUrl, err := twitterProvider.OAuth.AuthorizationURL(requestToken)
 	if err != nil {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
@@ -245,6 +727,11 @@ func (self *AuthController) Blank(c *extend.Context) error {
 // @Description: Handle twitter oauth callback
 func (self *AuthController) TwitterCallback(c *extend.Context) error {
 
+	twitterProvider := self.twitterProvider()
+	if twitterProvider == nil {
+		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
+	}
+
 	req := c.Request().(*standard.Request).Request
 	requestToken, verifier, err := oauth1.ParseAuthorizationCallback(req)
 	if err != nil {
@@ -261,38 +748,21 @@ func (self *AuthController) TwitterCallback(c *extend.Context) error {
 		models.TwitterAuth.Delete(self.mongoSession, twitterAuth.Id.Hex())
 	}()
 
-	accessToken, accessSecret, err := self.twitterOAuth.AccessToken(requestToken, twitterAuth.OauthTokenSecret, verifier)
+	accessToken, accessSecret, err := twitterProvider.OAuth.AccessToken(requestToken, twitterAuth.OauthTokenSecret, verifier)
 	if err != nil {
 		util.Println("Failed to exchange token for access token")
 		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
 	}
 
 	// get basic user information
-	token := oauth1.NewToken(accessToken, accessSecret)
-	httpClient := self.twitterOAuth.Client(oauth1.NoContext, token)
-	path := "https://api.twitter.com/1.1/account/verify_credentials.json"
-	resp, err := httpClient.Get(path)
-	defer resp.Body.Close()
-	if err != nil {
-		util.Println("Failed to verify access token")
-		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
+	identity, err := twitterProvider.Verify(&ProviderCredential{AccessToken: accessToken, AccessSecret: accessSecret})
 	if err != nil {
-		util.Println("Failed to read access token info response body")
-		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
-	}
-
-	decodedBody, err := util.JSONToMap(string(body))
-	if err != nil {
-		util.Println("Failed to decode response body from twitter")
+		util.Println("Failed to verify access token. ", err.Error())
 		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
 	}
 
 	// find existing user
-	providerUserId := decodedBody["id"].(json.Number).String()
-	user, err := models.User.FindByField(self.mongoSession, "provider_id", providerUserId)
+	user, err := models.User.FindByIdentity(self.mongoSession, "twitter", identity.ProviderUserId)
 	if err != nil && err != mgo.ErrNotFound {
 		util.Println("Failed to complete `find` for existing twitter user")
 		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
@@ -301,47 +771,58 @@ func (self *AuthController) TwitterCallback(c *extend.Context) error {
 	// user exists
 	if err == nil {
 
+		// complete an interrupted merge of the user
+		if user, err = self.resumeMerge(user); err != nil {
+			util.Println("Failed to resume merge. ", err.Error())
+			return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
+		}
+
 		// update access token and secret token
 		newUpdate := bson.M{"access_token": accessToken, "access_secret": accessSecret}
 		if err = models.User.Update(self.mongoSession, user.Id.Hex(), bson.M{"$set": newUpdate}); err != nil {
 			return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
 		}
 
-		// create session token
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"id":  user.Id.Hex(),
-			"iat": time.Now().Unix(),
-		})
+		recordAudit(self.mongoSession, c, models.AuditUserCredentials, models.AuditTargetUser, user.Id.Hex(), map[string]interface{}{
+			"fields": []string{"access_token", "access_secret"},
+		}, "twitter")
 
-		user.TokenString, err = token.SignedString([]byte(config.C.GetString("hmac_key")))
-		if err != nil {
+		// create session token
+		if err = self.createSession(user); err != nil {
 			return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
 		}
 
-		return c.Echo().Redirect(301, "/v1/auth/twitter/done?session_token="+user.TokenString)
+		return c.Echo().Redirect(301, sessionRedirectURL(user))
 	}
 
 	newUser := &models.UserModel{
 		Id:             models.NewId(),
-		Fullname:       decodedBody["name"].(string),
-		PhotoURL:       decodedBody["profile_image_url_https"].(string),
+		Fullname:       identity.Fullname,
+		PhotoURL:       identity.PhotoURL,
 		Provider:       "twitter",
-		ProviderUserId: decodedBody["id"].(json.Number).String(),
+		ProviderUserId: identity.ProviderUserId,
 		AccessToken:    accessToken,
 		AccessSecret:   accessSecret,
+		Identities: []models.Identity{{
+			Provider:       "twitter",
+			ProviderUserId: identity.ProviderUserId,
+			LinkedAt:       time.Now().UTC(),
+		}},
 	}
 
-	// create session token
-	sessionToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":  newUser.Id.Hex(),
-		"iat": time.Now().Unix(),
-	})
-
-	newUser.TokenString, _ = sessionToken.SignedString([]byte(config.C.GetString("hmac_key")))
 	if err = models.User.Create(self.mongoSession, newUser); err != nil {
 		util.Println("Failed to create new twitter user")
 		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
 	}
 
-	return c.Echo().Redirect(301, "/v1/auth/twitter/done?session_token="+newUser.TokenString)
+	recordAudit(self.mongoSession, c, models.AuditUserCreate, models.AuditTargetUser, newUser.Id.Hex(), map[string]interface{}{
+		"provider": "twitter",
+	}, "")
+
+	// create session token
+	if err = self.createSession(newUser); err != nil {
+		return c.Echo().Redirect(301, "/v1/auth/twitter/done?error=server_error")
+	}
+
+	return c.Echo().Redirect(301, sessionRedirectURL(newUser))
 }
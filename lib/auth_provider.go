@@ -0,0 +1,570 @@
+// Auth providers verify the credentials clients obtain
+// from social login providers and return the identity they belong to
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dghubble/oauth1"
+	"github.com/dghubble/oauth1/twitter"
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/util"
+	"github.com/franela/goreq"
+)
+
+// Returned when a provider credential is invalid or does not belong to the claimed user
+var ErrInvalidProviderCredential = errors.New("provider credential is invalid")
+
+// The credential a client obtained from a provider
+type ProviderCredential struct {
+	ProviderUserId string
+	AccessToken    string
+	AccessSecret   string
+	IdToken        string
+	Nonce          string
+}
+
+// A user identity verified by a provider
+type ProviderIdentity struct {
+	ProviderUserId string
+	Email          string
+	EmailVerified  bool
+	Fullname       string
+	PhotoURL       string
+}
+
+// A social login provider
+type AuthProvider interface {
+
+	// The name clients use to select the provider
+	Name() string
+
+	// Verify a credential and return the identity it belongs to.
+	// Returns ErrInvalidProviderCredential if the credential is not valid.
+	Verify(credential *ProviderCredential) (*ProviderIdentity, error)
+}
+
+// A collection of auth providers
+type AuthProviderRegistry struct {
+	providers map[string]AuthProvider
+}
+
+// Create a registry
+func NewAuthProviderRegistry(providers ...AuthProvider) *AuthProviderRegistry {
+	registry := &AuthProviderRegistry{map[string]AuthProvider{}}
+	for _, p := range providers {
+		registry.Register(p)
+	}
+	return registry
+}
+
+// Add a provider. A provider with the same name is replaced.
+func (r *AuthProviderRegistry) Register(provider AuthProvider) {
+	r.providers[provider.Name()] = provider
+}
+
+// Get a provider by name
+func (r *AuthProviderRegistry) Get(name string) (AuthProvider, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Get the names of the registered providers
+func (r *AuthProviderRegistry) Names() []string {
+	names := []string{}
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The providers file configures providers other than facebook and twitter.
+//
+// Example:
+// 	{ "providers": [
+// 		{ "name": "google", "type": "oidc", "issuer": "https://accounts.google.com", "client_ids": ["xxx.apps.googleusercontent.com"] },
+// 		{ "name": "apple", "type": "oidc", "issuer": "https://appleid.apple.com", "client_ids": ["com.example.openmint"] },
+// 		{ "name": "acme", "type": "oauth2", "userinfo_url": "https://sso.example.com/userinfo",
+// 		  "introspection_url": "https://sso.example.com/introspect", "client_id": "openmint", "client_secret": "xxx" },
+// 		{ "name": "github", "type": "oauth2", "token_verifier": "github", "userinfo_url": "https://api.github.com/user",
+// 		  "client_id": "xxx", "client_secret": "xxx", "photo_field": "avatar_url" }
+// 	]}
+type authProvidersFile struct {
+	Providers []struct {
+		Name        string   `json:"name"`
+		Type        string   `json:"type"`
+		Issuer      string   `json:"issuer"`
+		ClientIds   []string `json:"client_ids"`
+		UserInfoURL string   `json:"userinfo_url"`
+		// oauth2 providers verify access tokens with an RFC 7662 introspection
+		// endpoint unless another token verifier is set (e.g "github")
+		TokenVerifier      string `json:"token_verifier"`
+		IntrospectionURL   string `json:"introspection_url"`
+		ClientId           string `json:"client_id"`
+		ClientSecret       string `json:"client_secret"`
+		IdField            string `json:"id_field"`
+		EmailField         string `json:"email_field"`
+		EmailVerifiedField string `json:"email_verified_field"`
+		NameField          string `json:"name_field"`
+		PhotoField         string `json:"photo_field"`
+	} `json:"providers"`
+}
+
+// Create a registry of the configured providers. Facebook and twitter are
+// registered when their app credentials are set. Other providers are
+// loaded from the providers file if set.
+func LoadAuthProviders(providersFile string) (*AuthProviderRegistry, error) {
+
+	registry := NewAuthProviderRegistry()
+
+	if config.C.GetString("fb_app_id") != "" {
+		registry.Register(NewFacebookProvider(config.C.GetString("fb_app_id"), config.C.GetString("fb_app_token")))
+	}
+
+	if config.C.GetString("twitter_con_key") != "" {
+		registry.Register(NewTwitterProvider(
+			config.C.GetString("twitter_con_key"),
+			config.C.GetString("twitter_con_secret"),
+			config.C.GetString("twitter_callback_url"),
+		))
+	}
+
+	if providersFile == "" {
+		return registry, nil
+	}
+
+	data, err := ioutil.ReadFile(providersFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var file authProvidersFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse providers file: %s", err)
+	}
+
+	for _, p := range file.Providers {
+		if p.Name == "" {
+			return nil, errors.New("providers file: name is required")
+		}
+		switch p.Type {
+		case "oidc":
+			if p.Issuer == "" || len(p.ClientIds) == 0 {
+				return nil, fmt.Errorf("provider %s: issuer and client_ids are required", p.Name)
+			}
+			registry.Register(NewOIDCProvider(p.Name, p.Issuer, p.ClientIds))
+		case "oauth2":
+			if p.UserInfoURL == "" || p.ClientId == "" {
+				return nil, fmt.Errorf("provider %s: userinfo_url and client_id are required", p.Name)
+			}
+			var verifier OAuth2TokenVerifier
+			switch p.TokenVerifier {
+			case "", "introspection":
+				if p.IntrospectionURL == "" {
+					return nil, fmt.Errorf("provider %s: introspection_url is required", p.Name)
+				}
+				verifier = &IntrospectionVerifier{URL: p.IntrospectionURL, ClientId: p.ClientId, ClientSecret: p.ClientSecret}
+			case "github":
+				if p.ClientSecret == "" {
+					return nil, fmt.Errorf("provider %s: client_secret is required", p.Name)
+				}
+				verifier = NewGitHubTokenVerifier(p.ClientId, p.ClientSecret)
+			default:
+				return nil, fmt.Errorf("provider %s: unsupported token verifier %q", p.Name, p.TokenVerifier)
+			}
+			provider := NewOAuth2Provider(p.Name, p.UserInfoURL, verifier)
+			if p.IdField != "" {
+				provider.IdField = p.IdField
+			}
+			if p.EmailField != "" {
+				provider.EmailField = p.EmailField
+			}
+			if p.EmailVerifiedField != "" {
+				provider.EmailVerifiedField = p.EmailVerifiedField
+			}
+			if p.NameField != "" {
+				provider.NameField = p.NameField
+			}
+			if p.PhotoField != "" {
+				provider.PhotoField = p.PhotoField
+			}
+			registry.Register(provider)
+		default:
+			return nil, fmt.Errorf("provider %s: unsupported type %q", p.Name, p.Type)
+		}
+	}
+
+	return registry, nil
+}
+
+// Get a string field of a decoded json object. Numbers are formatted without exponents.
+func jsonStringField(m map[string]interface{}, field string) string {
+	switch v := m[field].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+// Facebook verifies user access tokens using the token debug endpoint
+type FacebookProvider struct {
+	appId    string
+	appToken string
+}
+
+// Create a facebook provider
+func NewFacebookProvider(appId, appToken string) *FacebookProvider {
+	return &FacebookProvider{appId, appToken}
+}
+
+func (p *FacebookProvider) Name() string {
+	return "facebook"
+}
+
+// Check that the access token is valid, was generated
+// by our application and belongs to the claimed user.
+func (p *FacebookProvider) Verify(credential *ProviderCredential) (*ProviderIdentity, error) {
+
+	qs := url.Values{}
+	qs.Set("input_token", credential.AccessToken)
+	qs.Set("access_token", p.appToken)
+
+	res, err := goreq.Request{
+		Uri:         "https://graph.facebook.com/debug_token",
+		QueryString: qs,
+		Timeout:     15 * time.Second,
+	}.Do()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	var fbResp map[string]interface{}
+	res.Body.FromJsonTo(&fbResp)
+	data, ok := fbResp["data"].(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	// token is invalid
+	if valid, _ := data["is_valid"].(bool); !valid {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	// token not generated by this app
+	if appId, _ := data["app_id"].(string); appId != p.appId {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	if userId, _ := data["user_id"].(string); userId == "" || userId != credential.ProviderUserId {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	return &ProviderIdentity{ProviderUserId: credential.ProviderUserId}, nil
+}
+
+// Twitter verifies OAuth1 access tokens and secrets
+type TwitterProvider struct {
+	OAuth *oauth1.Config
+}
+
+// Create a twitter provider
+func NewTwitterProvider(consumerKey, consumerSecret, callbackURL string) *TwitterProvider {
+	return &TwitterProvider{
+		OAuth: &oauth1.Config{
+			ConsumerKey:    consumerKey,
+			ConsumerSecret: consumerSecret,
+			CallbackURL:    callbackURL,
+			Endpoint:       twitter.AuthorizeEndpoint,
+		},
+	}
+}
+
+func (p *TwitterProvider) Name() string {
+	return "twitter"
+}
+
+// Get the account of the access token. The account must
+// match the claimed user if a provider user id is given.
+func (p *TwitterProvider) Verify(credential *ProviderCredential) (*ProviderIdentity, error) {
+
+	token := oauth1.NewToken(credential.AccessToken, credential.AccessSecret)
+	httpClient := p.OAuth.Client(oauth1.NoContext, token)
+	resp, err := httpClient.Get("https://api.twitter.com/1.1/account/verify_credentials.json")
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == 401 {
+		return nil, ErrInvalidProviderCredential
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected response status: %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := util.JSONToMap(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &ProviderIdentity{
+		ProviderUserId: jsonStringField(account, "id_str"),
+		Fullname:       jsonStringField(account, "name"),
+		PhotoURL:       jsonStringField(account, "profile_image_url_https"),
+	}
+
+	if identity.ProviderUserId == "" {
+		identity.ProviderUserId = jsonStringField(account, "id")
+	}
+
+	if credential.ProviderUserId != "" && credential.ProviderUserId != identity.ProviderUserId {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	return identity, nil
+}
+
+// Verifies that an OAuth2 access token is active and was issued to our
+// client. Returns ErrInvalidProviderCredential if it is not.
+type OAuth2TokenVerifier interface {
+	VerifyToken(client *http.Client, accessToken string) error
+}
+
+// Introspection verifies access tokens with an RFC 7662 introspection endpoint
+type IntrospectionVerifier struct {
+	URL          string
+	ClientId     string
+	ClientSecret string
+}
+
+// Check that the access token is active and was issued to our client
+func (v *IntrospectionVerifier) VerifyToken(client *http.Client, accessToken string) error {
+
+	form := url.Values{}
+	form.Set("token", accessToken)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequest("POST", v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(v.ClientId, v.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected introspection response status: %d", resp.StatusCode)
+	}
+
+	var result map[string]interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	if active, _ := result["active"].(bool); !active {
+		return ErrInvalidProviderCredential
+	}
+
+	if jsonStringField(result, "client_id") == v.ClientId || jsonStringField(result, "azp") == v.ClientId {
+		return nil
+	}
+
+	// aud may be a string or a list of strings
+	switch aud := result["aud"].(type) {
+	case string:
+		if aud == v.ClientId {
+			return nil
+		}
+	case []interface{}:
+		for _, a := range aud {
+			if a == v.ClientId {
+				return nil
+			}
+		}
+	}
+
+	return ErrInvalidProviderCredential
+}
+
+// GitHub does not support token introspection. Tokens of an OAuth app
+// are checked with the app's check token endpoint instead.
+type GitHubTokenVerifier struct {
+	APIURL       string
+	ClientId     string
+	ClientSecret string
+}
+
+// Create a verifier of the tokens of a GitHub OAuth app
+func NewGitHubTokenVerifier(clientId, clientSecret string) *GitHubTokenVerifier {
+	return &GitHubTokenVerifier{"https://api.github.com", clientId, clientSecret}
+}
+
+// Check that the access token is valid and was issued to our app.
+// GitHub responds with 404 when the token is not valid for the app.
+func (v *GitHubTokenVerifier) VerifyToken(client *http.Client, accessToken string) error {
+
+	body, err := json.Marshal(map[string]string{"access_token": accessToken})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", v.APIURL+"/applications/"+url.PathEscape(v.ClientId)+"/token", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(v.ClientId, v.ClientSecret)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 || resp.StatusCode == 422 {
+		return ErrInvalidProviderCredential
+	} else if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected check token response status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		App struct {
+			ClientId string `json:"client_id"`
+		} `json:"app"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	if result.App.ClientId != v.ClientId {
+		return ErrInvalidProviderCredential
+	}
+
+	return nil
+}
+
+// OAuth2 verifies access tokens of providers that do not support OpenID
+// Connect. The token is checked by a token verifier to be active and issued
+// to our client, then the user is fetched from the user info endpoint.
+type OAuth2Provider struct {
+	name               string
+	userInfoURL        string
+	verifier           OAuth2TokenVerifier
+	client             *http.Client
+	IdField            string
+	EmailField         string
+	EmailVerifiedField string
+	NameField          string
+	PhotoField         string
+}
+
+// Create an OAuth2 provider. User fields default to the OpenID Connect claim names.
+func NewOAuth2Provider(name, userInfoURL string, verifier OAuth2TokenVerifier) *OAuth2Provider {
+	return &OAuth2Provider{
+		name:               name,
+		userInfoURL:        userInfoURL,
+		verifier:           verifier,
+		client:             &http.Client{Timeout: 15 * time.Second},
+		IdField:            "id",
+		EmailField:         "email",
+		EmailVerifiedField: "email_verified",
+		NameField:          "name",
+		PhotoField:         "picture",
+	}
+}
+
+func (p *OAuth2Provider) Name() string {
+	return p.name
+}
+
+// Fetch the user of the access token once the token is known to be issued
+// to our client. The user must match the claimed user if a provider user id is given.
+func (p *OAuth2Provider) Verify(credential *ProviderCredential) (*ProviderIdentity, error) {
+
+	if err := p.verifier.VerifyToken(p.client, credential.AccessToken); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", p.userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+credential.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		return nil, ErrInvalidProviderCredential
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected response status: %d", resp.StatusCode)
+	}
+
+	var userInfo map[string]interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err = decoder.Decode(&userInfo); err != nil {
+		return nil, err
+	}
+
+	identity := &ProviderIdentity{
+		ProviderUserId: jsonStringField(userInfo, p.IdField),
+		Email:          jsonStringField(userInfo, p.EmailField),
+		Fullname:       jsonStringField(userInfo, p.NameField),
+		PhotoURL:       jsonStringField(userInfo, p.PhotoField),
+	}
+
+	// an email is only verified if the provider says so
+	switch v := userInfo[p.EmailVerifiedField].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string:
+		identity.EmailVerified = v == "true"
+	}
+
+	if identity.ProviderUserId == "" {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	if credential.ProviderUserId != "" && credential.ProviderUserId != identity.ProviderUserId {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	return identity, nil
+}
+
@@ -0,0 +1,420 @@
+// This controller manages collections of a user's currencies
+package lib
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The maximum number of collections of a user
+const COLLECTION_MAX_PER_USER = 100
+
+// The maximum length of the name of a collection
+const COLLECTION_NAME_MAX_LENGTH = 100
+
+// The maximum length of the description of a collection
+const COLLECTION_DESCRIPTION_MAX_LENGTH = 1000
+
+// The maximum number of currencies added to a collection in a request
+const COLLECTION_MAX_CURRENCIES = 100
+
+type collectionBody struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+type collectionCurrenciesBody struct {
+	CurrencyIds []string `json:"currency_ids"`
+}
+
+type collectionSharingBody struct {
+	Public bool `json:"public"`
+}
+
+type CollectionController struct {
+	mongoSession *mgo.Session
+}
+
+// Create a new controller instance
+func NewCollectionController(mongoSession *mgo.Session) *CollectionController {
+	return &CollectionController{mongoSession}
+}
+
+// Find a collection owned by the authenticated user
+func (self *CollectionController) findOwnCollection(c *extend.Context) (*models.CollectionModel, error) {
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e049")
+	}
+
+	collection, err := models.Collection.FindById(self.mongoSession, id)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, config.NewHTTPError(c.Lang(), 404, "e049")
+		}
+		return nil, config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if collection.UserId.Hex() != c.Get("auth_user") {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e049")
+	}
+
+	return collection, nil
+}
+
+// Validate the name and description of a collection
+func validateCollectionBody(c *extend.Context, body *collectionBody) error {
+	if body.Name != nil {
+		*body.Name = strings.TrimSpace(*body.Name)
+		if *body.Name == "" || len(*body.Name) > COLLECTION_NAME_MAX_LENGTH {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("name must be between 1 and " + strconv.Itoa(COLLECTION_NAME_MAX_LENGTH) + " characters").SetCode("invalid_parameter").SetParam("name")
+		}
+	}
+	if body.Description != nil {
+		*body.Description = strings.TrimSpace(*body.Description)
+		if len(*body.Description) > COLLECTION_DESCRIPTION_MAX_LENGTH {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("description must not be longer than " + strconv.Itoa(COLLECTION_DESCRIPTION_MAX_LENGTH) + " characters").SetCode("invalid_parameter").SetParam("description")
+		}
+	}
+	return nil
+}
+
+// @API: POST /v1/collections
+//
+// @Description:
+// 	Create a collection. Collections are private until they are shared.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	name 			{string}: The name of the collection
+// 	description 	{string}: A description of the collection (optional)
+//
+// @Response 201: Returns models.CollectionModel instance
+func (self *CollectionController) Create(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+
+	var body collectionBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if body.Name == nil {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("name is required").SetCode("invalid_parameter").SetParam("name")
+	}
+
+	if err := validateCollectionBody(c, &body); err != nil {
+		return err
+	}
+
+	count, err := models.Collection.CountByUser(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	} else if count >= COLLECTION_MAX_PER_USER {
+		return config.NewHTTPError(c.Lang(), 400, "e050")
+	}
+
+	collection := &models.CollectionModel{
+		Id:     models.NewId(),
+		UserId: bson.ObjectIdHex(authUserId),
+		Name:   *body.Name,
+	}
+
+	if body.Description != nil {
+		collection.Description = *body.Description
+	}
+
+	if err = models.Collection.Create(self.mongoSession, collection); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(201, collection)
+}
+
+// @API: GET /v1/collections
+// @Description: Get the collections of the authenticated user, most recent first
+func (self *CollectionController) List(c *extend.Context) error {
+
+	collections, err := models.Collection.FindByUser(self.mongoSession, c.Get("auth_user"))
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, collections)
+}
+
+// @API: GET /v1/collections/:id
+//
+// @Description:
+// 	Get a collection of the authenticated user. Use `GET /v1/users/currencies?collection=:id`
+// 	to get the currencies in the collection.
+//
+// @Response 200:
+// 	collection 		Object: models.CollectionModel instance
+// 	currency_count 	Int: The number of currencies in the collection
+func (self *CollectionController) Get(c *extend.Context) error {
+
+	collection, err := self.findOwnCollection(c)
+	if err != nil {
+		return err
+	}
+
+	count, err := models.Currency.Count(self.mongoSession, &models.CurrencyFilter{UserId: c.Get("auth_user"), CollectionId: collection.Id.Hex()})
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{
+		"collection":     collection,
+		"currency_count": count,
+	})
+}
+
+// @API: PATCH /v1/collections/:id
+//
+// @Description:
+// 	Update the name or description of a collection
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	name 			{string}: The name of the collection (optional)
+// 	description 	{string}: A description of the collection (optional)
+//
+// @Response 200: Returns models.CollectionModel instance
+func (self *CollectionController) Update(c *extend.Context) error {
+
+	collection, err := self.findOwnCollection(c)
+	if err != nil {
+		return err
+	}
+
+	var body collectionBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if err = validateCollectionBody(c, &body); err != nil {
+		return err
+	}
+
+	update := bson.M{"updated_at": time.Now().UTC()}
+	if body.Name != nil {
+		update["name"] = *body.Name
+		collection.Name = *body.Name
+	}
+	if body.Description != nil {
+		update["description"] = *body.Description
+		collection.Description = *body.Description
+	}
+
+	if err = models.Collection.Update(self.mongoSession, collection.Id.Hex(), bson.M{"$set": update}); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	collection.UpdatedAt = update["updated_at"].(time.Time)
+	return c.JSON(200, collection)
+}
+
+// @API: DELETE /v1/collections/:id
+// @Description: Delete a collection. The currencies in the collection are not deleted.
+func (self *CollectionController) Delete(c *extend.Context) error {
+
+	collection, err := self.findOwnCollection(c)
+	if err != nil {
+		return err
+	}
+
+	if err = models.Currency.RemoveFromCollection(self.mongoSession, collection.Id.Hex(), nil); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.Collection.Delete(self.mongoSession, collection.Id.Hex()); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"id": collection.Id.Hex()})
+}
+
+// @API: POST /v1/collections/:id/currencies
+//
+// @Description:
+// 	Add currencies to a collection. Only currencies indexed by
+// 	the authenticated user can be added.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	currency_ids 	{Array[string]}: The ids of the currencies. Max: 100
+//
+// @Response 200:
+// 	added 	Int: The number of currencies in the request that are now in the collection
+func (self *CollectionController) AddCurrencies(c *extend.Context) error {
+
+	collection, err := self.findOwnCollection(c)
+	if err != nil {
+		return err
+	}
+
+	var body collectionCurrenciesBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if len(body.CurrencyIds) == 0 || len(body.CurrencyIds) > COLLECTION_MAX_CURRENCIES {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("currency_ids must contain between 1 and " + strconv.Itoa(COLLECTION_MAX_CURRENCIES) + " ids").SetCode("invalid_parameter").SetParam("currency_ids")
+	}
+
+	ids := []bson.ObjectId{}
+	for _, id := range body.CurrencyIds {
+		if !models.IsId(id) {
+			return config.NewHTTPError(c.Lang(), 400, "e020").SetCode("invalid_parameter").SetParam("currency_ids").SetHint(id)
+		}
+		ids = append(ids, bson.ObjectIdHex(id))
+	}
+
+	added, err := models.Currency.AddToCollection(self.mongoSession, c.Get("auth_user"), collection.Id.Hex(), ids)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"added": added})
+}
+
+// @API: DELETE /v1/collections/:id/currencies/:currency_id
+// @Description: Remove a currency from a collection
+func (self *CollectionController) RemoveCurrency(c *extend.Context) error {
+
+	collection, err := self.findOwnCollection(c)
+	if err != nil {
+		return err
+	}
+
+	currencyId := c.Param("currency_id")
+	if !models.IsId(currencyId) {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
+	if err = models.Currency.RemoveFromCollection(self.mongoSession, collection.Id.Hex(), []bson.ObjectId{bson.ObjectIdHex(currencyId)}); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"id": currencyId})
+}
+
+// @API: PUT /v1/collections/:id/sharing
+//
+// @Description:
+// 	Make a collection public or private. A public collection can be viewed by anyone
+// 	with its share token at `GET /v1/collections/shared/:token`. A new token is
+// 	created every time a collection is made public.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	public 	{bool}: Whether the collection is public
+//
+// @Response 200: Returns models.CollectionModel instance
+func (self *CollectionController) SetSharing(c *extend.Context) error {
+
+	collection, err := self.findOwnCollection(c)
+	if err != nil {
+		return err
+	}
+
+	var body collectionSharingBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	update := bson.M{"$set": bson.M{"public": false, "updated_at": time.Now().UTC()}, "$unset": bson.M{"share_token": ""}}
+	collection.Public, collection.ShareToken = false, ""
+
+	if body.Public {
+		collection.Public, collection.ShareToken = true, NewSecret()
+		update = bson.M{"$set": bson.M{"public": true, "share_token": collection.ShareToken, "updated_at": time.Now().UTC()}}
+	}
+
+	if err = models.Collection.Update(self.mongoSession, collection.Id.Hex(), update); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, collection)
+}
+
+// @API: GET /v1/collections/shared/:token
+//
+// @Description:
+// 	Get a public collection and its currencies, most recent first. The owner of the
+// 	collection is not included. If there are more currencies, the cursor of the
+// 	next page is returned in the `X-Next-Cursor` header.
+//
+// @Query Params:
+// 	limit 	Int: The number of currencies to return. Default: 20, Max: 100
+// 	cursor 	String: The cursor of the page to return
+//
+// @Response 200:
+// 	collection 	Object: The name and description of the collection
+// 	currencies 	Array: The currencies in the collection
+func (self *CollectionController) GetShared(c *extend.Context) error {
+
+	limit, _, err := paginationParams(c, 20, CURRENCY_PAGE_MAX_SIZE)
+	if err != nil {
+		return err
+	}
+
+	collection, err := models.Collection.FindByShareToken(self.mongoSession, c.Param("token"))
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 404, "e049")
+		}
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	filter := &models.CurrencyFilter{
+		UserId:        collection.UserId.Hex(),
+		CollectionId:  collection.Id.Hex(),
+		ExcludeHidden: true,
+	}
+
+	currencies, next, err := models.Currency.FindPage(self.mongoSession, filter, c.Echo().QueryParam("cursor"), limit)
+	if err == models.ErrInvalidCursor {
+		return config.NewHTTPError(c.Lang(), 400, "e048").SetCode("invalid_parameter").SetParam("cursor")
+	} else if err != nil {
+		util.Println("Failed to fetch currencies. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	results := []extend.H{}
+	for i := range currencies {
+		result := publicCurrency(&currencies[i])
+		result["image_url"] = currencies[i].ImageURL
+		result["tags"] = currencies[i].Tags
+		results = append(results, result)
+	}
+
+	if next != "" {
+		c.Response().Header().Set("X-Next-Cursor", next)
+	}
+
+	return c.JSON(200, extend.H{
+		"collection": extend.H{
+			"id":          collection.Id.Hex(),
+			"name":        collection.Name,
+			"description": collection.Description,
+			"created_at":  collection.CreatedAt,
+			"updated_at":  collection.UpdatedAt,
+		},
+		"currencies": results,
+	})
+}
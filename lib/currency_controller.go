@@ -0,0 +1,480 @@
+// This controller provides public information about indexed currencies
+package lib
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The maximum number of notes in a bulk lookup
+const CURRENCY_LOOKUP_MAX_BULK = 100
+
+// The maximum radius of a near query in meters
+const CURRENCY_NEAR_MAX_RADIUS = 100000
+
+type lookupNote struct {
+	CurrencyCode string `json:"code"`
+	Denomination string `json:"denom"`
+	Serial       string `json:"serial"`
+}
+
+type bulkLookupBody struct {
+	Notes []lookupNote `json:"notes"`
+}
+
+type CurrencyController struct {
+	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+}
+
+// Create a new controller instance
+func NewCurrencyController(mongoSession *mgo.Session, redisPool *redis.Pool) *CurrencyController {
+	return &CurrencyController{mongoSession, redisPool}
+}
+
+// Normalize a note and get its key. Returns false if a field is missing.
+func (n lookupNote) key() (models.CurrencyKey, bool) {
+	key := models.CurrencyKey{
+		CurrencyCode: strings.ToUpper(strings.TrimSpace(n.CurrencyCode)),
+		Denomination: strings.TrimSpace(n.Denomination),
+		Serial:       strings.ToUpper(strings.TrimSpace(n.Serial)),
+	}
+	return key, key.CurrencyCode != "" && key.Denomination != "" && key.Serial != ""
+}
+
+// Describe whether a note has been seen. The uploader is never included.
+func lookupResult(key models.CurrencyKey, currency *models.CurrencyModel) extend.H {
+	result := extend.H{
+		"code":   key.CurrencyCode,
+		"denom":  key.Denomination,
+		"serial": key.Serial,
+		"found":  currency != nil,
+	}
+	if currency != nil {
+		result["status"] = currency.Status
+		result["first_seen"] = currency.CreatedAt
+	}
+	return result
+}
+
+// Count the notes looked up by a request against the
+// per minute limit of the client's ip address
+func (self *CurrencyController) checkLookupRateLimit(c *extend.Context, notes int) error {
+
+	limit := config.C.GetInt("lookup_rate_limit")
+	count, resetAt, err := models.IncrRateCounterBy(self.redisPool, "lookup_"+c.RealIP(), notes, time.Minute)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	remaining := limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	header := c.Response().Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+
+	if count > limit {
+		return config.NewHTTPError(c.Lang(), 429, "e036")
+	}
+
+	return nil
+}
+
+// @API: GET /v1/currencies/lookup
+//
+// @Description:
+// 	Check whether a note has been indexed. Lookups are
+// 	rate limited per ip address.
+//
+// @Query Params:
+// 	code 	String: The currency code
+// 	denom 	String: The denomination
+// 	serial 	String: The serial number
+//
+// @Response 200:
+// 	code 		String: The currency code
+// 	denom 		String: The denomination
+// 	serial 		String: The serial number
+// 	found 		Bool: Whether the note has been indexed
+// 	status 		String: The status of the note (if found)
+// 	first_seen 	Date: When the note was first indexed (if found)
+func (self *CurrencyController) Lookup(c *extend.Context) error {
+
+	if err := self.checkLookupRateLimit(c, 1); err != nil {
+		return err
+	}
+
+	key, ok := lookupNote{
+		CurrencyCode: c.Echo().QueryParam("code"),
+		Denomination: c.Echo().QueryParam("denom"),
+		Serial:       c.Echo().QueryParam("serial"),
+	}.key()
+	if !ok {
+		return config.NewHTTPError(c.Lang(), 400, "e045")
+	}
+
+	currency, err := models.Currency.FindCurrency(self.mongoSession, key.CurrencyCode, key.Denomination, key.Serial)
+	if err != nil && err != mgo.ErrNotFound {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	} else if err == mgo.ErrNotFound || currency.Hidden {
+		currency = nil
+	}
+
+	return c.JSON(200, lookupResult(key, currency))
+}
+
+// @API: POST /v1/currencies/lookup
+//
+// @Description:
+// 	Check whether notes have been indexed. Each note counts
+// 	as one lookup against the rate limit of the ip address.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	notes 	{array}: Up to 100 notes. e.g [{ "code": "NGN", "denom": "500", "serial": "AB1234567" }]
+//
+// @Response 200: Array of lookup results in the order of the notes. See GET /v1/currencies/lookup
+func (self *CurrencyController) BulkLookup(c *extend.Context) error {
+
+	var body bulkLookupBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if len(body.Notes) == 0 {
+		return config.NewHTTPError(c.Lang(), 400, "e045").SetParam("notes")
+	}
+
+	if len(body.Notes) > CURRENCY_LOOKUP_MAX_BULK {
+		return config.NewHTTPError(c.Lang(), 400, "e046").SetHint(strconv.Itoa(CURRENCY_LOOKUP_MAX_BULK))
+	}
+
+	if err := self.checkLookupRateLimit(c, len(body.Notes)); err != nil {
+		return err
+	}
+
+	keys := []models.CurrencyKey{}
+	for i, note := range body.Notes {
+		key, ok := note.key()
+		if !ok {
+			return config.NewHTTPError(c.Lang(), 400, "e045").SetParam("notes." + strconv.Itoa(i))
+		}
+		keys = append(keys, key)
+	}
+
+	currencies, err := models.Currency.FindByKeys(self.mongoSession, keys)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	found := map[models.CurrencyKey]*models.CurrencyModel{}
+	for i := range currencies {
+		found[models.CurrencyKey{
+			CurrencyCode: currencies[i].CurrencyCode,
+			Denomination: currencies[i].Denomination,
+			Serial:       currencies[i].Serial,
+		}] = &currencies[i]
+	}
+
+	results := []extend.H{}
+	for _, key := range keys {
+		results = append(results, lookupResult(key, found[key]))
+	}
+
+	return c.JSON(200, results)
+}
+
+// @API: GET /v1/currencies/:id/sightings
+//
+// @Description:
+// 	Get the timeline of sightings of a currency, most recent first.
+// 	The users who scanned the currency are not included.
+//
+// @Query Params:
+// 	limit 	Int: The number of sightings to return. Default: 50, Max: 200
+// 	skip 	Int: The number of sightings to skip
+//
+// @Response 200:
+// 	currency_id 	String: The currency id
+// 	first_seen 		Date: When the currency was indexed
+// 	last_seen_at 	Date: When the currency was last sighted
+// 	sighting_count 	Int: The number of sightings
+// 	sightings 		Array: models.SightingModel
+func (self *CurrencyController) GetSightings(c *extend.Context) error {
+
+	limit, skip, err := paginationParams(c, 50, 200)
+	if err != nil {
+		return err
+	}
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
+	currency, err := models.Currency.FindById(self.mongoSession, id)
+	if err != nil && err != mgo.ErrNotFound {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	} else if err == mgo.ErrNotFound || currency.Hidden {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
+	sightings, err := models.Sighting.FindByCurrency(self.mongoSession, id, limit, skip)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{
+		"currency_id":    currency.Id.Hex(),
+		"first_seen":     currency.CreatedAt,
+		"last_seen_at":   currency.LastSeenAt,
+		"sighting_count": currency.SightingCount,
+		"sightings":      sightings,
+	})
+}
+
+// Describe a currency without its uploader
+func publicCurrency(currency *models.CurrencyModel) extend.H {
+	return extend.H{
+		"id":              currency.Id.Hex(),
+		"currency_code":   currency.CurrencyCode,
+		"denomination":    currency.Denomination,
+		"serial":          currency.Serial,
+		"status":          currency.Status,
+		"location":        currency.Location,
+		"sighting_count":  currency.SightingCount,
+		"serial_patterns": currency.SerialPatterns,
+		"created_at":      currency.CreatedAt,
+	}
+}
+
+// Describe currencies without their uploaders
+func publicCurrencies(currencies []models.CurrencyModel) []extend.H {
+	results := []extend.H{}
+	for i := range currencies {
+		results = append(results, publicCurrency(&currencies[i]))
+	}
+	return results
+}
+
+// Parse a float query parameter. Returns the default value if the parameter is not set.
+func floatParam(c *extend.Context, name string, defaultValue float64) (float64, error) {
+	value := c.Echo().QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, config.NewHTTPError(c.Lang(), 400, "").SetMsg(name + " must be a number").SetCode("invalid_parameter").SetParam(name)
+	}
+	return f, nil
+}
+
+// @API: GET /v1/currencies/search
+//
+// @Description:
+// 	Find currencies with a collectible serial number, most recent first. The uploader
+// 	is not included. If there are more currencies, the cursor of the next page is
+// 	returned in the `X-Next-Cursor` header.
+//
+// @Query Params:
+// 	serial_pattern 	String: The serial pattern (e.g radar, repeater, ladder, solid, low)
+// 	currency_code 	String: Filter by currency code
+// 	denomination 	String: Filter by denomination
+// 	limit 			Int: The number of currencies to return. Default: 20, Max: 100
+// 	cursor 			String: The cursor of the page to return
+//
+// @Response 200: Array of currencies
+func (self *CurrencyController) Search(c *extend.Context) error {
+
+	limit, _, err := paginationParams(c, 20, CURRENCY_PAGE_MAX_SIZE)
+	if err != nil {
+		return err
+	}
+
+	filter := &models.CurrencyFilter{
+		CurrencyCode:  strings.ToUpper(strings.TrimSpace(c.Echo().QueryParam("currency_code"))),
+		Denomination:  strings.TrimSpace(c.Echo().QueryParam("denomination")),
+		SerialPattern: strings.ToLower(strings.TrimSpace(c.Echo().QueryParam("serial_pattern"))),
+		ExcludeHidden: true,
+	}
+
+	if filter.SerialPattern == "" {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("serial_pattern is required").SetCode("invalid_parameter").SetParam("serial_pattern")
+	}
+
+	currencies, next, err := models.Currency.FindPage(self.mongoSession, filter, c.Echo().QueryParam("cursor"), limit)
+	if err == models.ErrInvalidCursor {
+		return config.NewHTTPError(c.Lang(), 400, "e048").SetCode("invalid_parameter").SetParam("cursor")
+	} else if err != nil {
+		util.Println("Failed to search currencies. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if next != "" {
+		c.Response().Header().Set("X-Next-Cursor", next)
+	}
+
+	return c.JSON(200, publicCurrencies(currencies))
+}
+
+// @API: GET /v1/currencies/near
+//
+// @Description:
+// 	Get currencies indexed within a distance of a location, nearest first.
+//
+// @Query Params:
+// 	lat 	Float: The latitude
+// 	lng 	Float: The longitude
+// 	radius 	Float: The distance in meters. Default: 5000, Max: 100000
+// 	limit 	Int: The number of currencies to return. Default: 50, Max: 200
+// 	skip 	Int: The number of currencies to skip
+//
+// @Response 200: Array of currencies
+func (self *CurrencyController) GetNear(c *extend.Context) error {
+
+	limit, skip, err := paginationParams(c, 50, 200)
+	if err != nil {
+		return err
+	}
+
+	if c.Echo().QueryParam("lat") == "" || c.Echo().QueryParam("lng") == "" {
+		return config.NewHTTPError(c.Lang(), 400, "e047")
+	}
+
+	lat, err := floatParam(c, "lat", 0)
+	if err != nil {
+		return err
+	}
+
+	lng, err := floatParam(c, "lng", 0)
+	if err != nil {
+		return err
+	}
+
+	if !models.IsValidCoordinate(lat, lng) {
+		return config.NewHTTPError(c.Lang(), 400, "e047")
+	}
+
+	radius, err := floatParam(c, "radius", 5000)
+	if err != nil {
+		return err
+	} else if radius <= 0 || radius > CURRENCY_NEAR_MAX_RADIUS {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("radius must be between 0 and " + strconv.Itoa(CURRENCY_NEAR_MAX_RADIUS)).SetCode("invalid_parameter").SetParam("radius")
+	}
+
+	currencies, err := models.Currency.FindNear(self.mongoSession, models.NewGeoPoint(lat, lng), radius, limit, skip)
+	if err != nil {
+		util.Println("Failed to find currencies near location. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, publicCurrencies(currencies))
+}
+
+// @API: GET /v1/currencies/within
+//
+// @Description:
+// 	Get currencies indexed within a bounding box, most recent first.
+//
+// @Query Params:
+// 	bbox 	String: The south west and north east corners. e.g "min_lng,min_lat,max_lng,max_lat"
+// 	limit 	Int: The number of currencies to return. Default: 50, Max: 200
+// 	skip 	Int: The number of currencies to skip
+//
+// @Response 200: Array of currencies
+func (self *CurrencyController) GetWithin(c *extend.Context) error {
+
+	limit, skip, err := paginationParams(c, 50, 200)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(c.Echo().QueryParam("bbox"), ",")
+	if len(parts) != 4 {
+		return config.NewHTTPError(c.Lang(), 400, "e047").SetParam("bbox")
+	}
+
+	var bbox [4]float64
+	for i, part := range parts {
+		if bbox[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			return config.NewHTTPError(c.Lang(), 400, "e047").SetParam("bbox")
+		}
+	}
+
+	minLng, minLat, maxLng, maxLat := bbox[0], bbox[1], bbox[2], bbox[3]
+	if !models.IsValidCoordinate(minLat, minLng) || !models.IsValidCoordinate(maxLat, maxLng) || minLng >= maxLng || minLat >= maxLat {
+		return config.NewHTTPError(c.Lang(), 400, "e047").SetParam("bbox")
+	}
+
+	currencies, err := models.Currency.FindWithinBox(self.mongoSession, minLng, minLat, maxLng, maxLat, limit, skip)
+	if err != nil {
+		util.Println("Failed to find currencies within bounding box. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, publicCurrencies(currencies))
+}
+
+// @API: GET /v1/currencies/regions
+//
+// @Description:
+// 	Count indexed currencies per region. Regions are cells of a grid
+// 	and are identified by their south west corner.
+//
+// @Query Params:
+// 	cell_size 		Float: The size of a cell in degrees. Default: 1, Min: 0.1, Max: 10
+// 	currency_code 	String: Filter by currency code
+// 	status 			String: Filter by status
+// 	limit 			Int: The number of regions to return. Default: 100, Max: 1000
+//
+// @Response 200: Array of models.RegionCount
+func (self *CurrencyController) GetRegionCounts(c *extend.Context) error {
+
+	limit, _, err := paginationParams(c, 100, 1000)
+	if err != nil {
+		return err
+	}
+
+	cellSize, err := floatParam(c, "cell_size", 1)
+	if err != nil {
+		return err
+	} else if cellSize < 0.1 || cellSize > 10 {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("cell_size must be between 0.1 and 10").SetCode("invalid_parameter").SetParam("cell_size")
+	}
+
+	query := bson.M{}
+
+	if curCode := c.Echo().QueryParam("currency_code"); curCode != "" {
+		query["currency_code"] = strings.ToUpper(curCode)
+	}
+
+	if status := c.Echo().QueryParam("status"); status != "" {
+		if !util.InStringSlice(models.CurrencyStatuses, status) {
+			return config.NewHTTPError(c.Lang(), 400, "e043").SetCode("invalid_parameter").SetParam("status")
+		}
+		query["status"] = status
+	}
+
+	regions, err := models.Currency.CountByRegion(self.mongoSession, query, cellSize, limit)
+	if err != nil {
+		util.Println("Failed to count currencies by region. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, regions)
+}
@@ -0,0 +1,214 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/labstack/echo/engine/standard"
+	"gopkg.in/mgo.v2"
+)
+
+// Export formats
+const (
+	ExportCSV    = "csv"
+	ExportJSON   = "json"
+	ExportNDJSON = "ndjson"
+)
+
+var ExportFormats = []string{ExportCSV, ExportJSON, ExportNDJSON}
+
+// The number of exported currencies after which the response is flushed
+const EXPORT_FLUSH_INTERVAL = 100
+
+// An exported currency
+type exportedCurrency struct {
+	Id               string    `json:"id"`
+	UserId           string    `json:"user_id,omitempty"`
+	Serial           string    `json:"serial"`
+	CurrencyCode     string    `json:"currency_code"`
+	Denomination     string    `json:"denomination"`
+	Status           string    `json:"status"`
+	ImageURL         string    `json:"image_url"`
+	OriginalImageURL string    `json:"original_image_url"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Writes exported currencies in a format one at a time
+type CurrencyExportWriter struct {
+	w           io.Writer
+	format      string
+	includeUser bool
+	csv         *csv.Writer
+	count       int
+}
+
+// Create a new export writer. The uploader of each currency is only
+// included if includeUser is true.
+func NewCurrencyExportWriter(w io.Writer, format string, includeUser bool) *CurrencyExportWriter {
+	writer := &CurrencyExportWriter{w: w, format: format, includeUser: includeUser}
+	if format == ExportCSV {
+		writer.csv = csv.NewWriter(w)
+	}
+	return writer
+}
+
+// Get the content type of the export
+func (self *CurrencyExportWriter) ContentType() string {
+	switch self.format {
+	case ExportCSV:
+		return "text/csv; charset=utf-8"
+	case ExportNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// Write the header of the export
+func (self *CurrencyExportWriter) Begin() error {
+	switch self.format {
+	case ExportCSV:
+		header := []string{"id", "serial", "currency_code", "denomination", "status", "image_url", "original_image_url", "created_at"}
+		if self.includeUser {
+			header = append(header[:1], append([]string{"user_id"}, header[1:]...)...)
+		}
+		return self.csv.Write(header)
+	case ExportJSON:
+		_, err := io.WriteString(self.w, "[")
+		return err
+	}
+	return nil
+}
+
+// Write a currency
+func (self *CurrencyExportWriter) Write(currency *models.CurrencyModel) error {
+
+	exported := exportedCurrency{
+		Id:               currency.Id.Hex(),
+		Serial:           currency.Serial,
+		CurrencyCode:     currency.CurrencyCode,
+		Denomination:     currency.Denomination,
+		Status:           currency.Status,
+		ImageURL:         currency.ImageURL,
+		OriginalImageURL: currency.OriginalImageURL,
+		CreatedAt:        currency.CreatedAt.UTC(),
+	}
+	if self.includeUser {
+		exported.UserId = currency.UserId.Hex()
+	}
+
+	self.count++
+
+	if self.format == ExportCSV {
+		record := []string{exported.Id, exported.Serial, exported.CurrencyCode, exported.Denomination, exported.Status, exported.ImageURL, exported.OriginalImageURL, exported.CreatedAt.Format(time.RFC3339)}
+		if self.includeUser {
+			record = append(record[:1], append([]string{exported.UserId}, record[1:]...)...)
+		}
+		return self.csv.Write(record)
+	}
+
+	data, err := json.Marshal(exported)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case self.format == ExportNDJSON:
+		data = append(data, '\n')
+	case self.count > 1:
+		data = append([]byte(","), data...)
+	}
+
+	_, err = self.w.Write(data)
+	return err
+}
+
+// Write buffered data to the underlying writer
+func (self *CurrencyExportWriter) Flush() error {
+	if self.csv != nil {
+		self.csv.Flush()
+		return self.csv.Error()
+	}
+	return nil
+}
+
+// Write the end of the export
+func (self *CurrencyExportWriter) End() error {
+	if self.format == ExportJSON {
+		if _, err := io.WriteString(self.w, "]"); err != nil {
+			return err
+		}
+	}
+	return self.Flush()
+}
+
+// Get the export format from the format query parameter. Default: csv
+func exportFormatParam(c *extend.Context) (string, error) {
+	format := c.Echo().QueryParam("format")
+	if format == "" {
+		return ExportCSV, nil
+	} else if !util.InStringSlice(ExportFormats, format) {
+		return "", config.NewHTTPError(c.Lang(), 400, "").SetMsg("format must be csv, json or ndjson").SetCode("invalid_parameter").SetParam("format")
+	}
+	return format, nil
+}
+
+// Stream the currencies matching a filter as an attachment. Currencies
+// are read from a cursor and written as they are read so the response
+// is never held in memory. Once streaming has started, errors can only
+// be reported by ending the response early.
+func streamCurrencyExport(c *extend.Context, mongoSession *mgo.Session, filter *models.CurrencyFilter, format string, includeUser bool) error {
+
+	res := c.Response().(*standard.Response)
+	flusher, ok := res.ResponseWriter.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming not supported")
+	}
+
+	// exports can take a while, use a dedicated connection
+	ses := mongoSession.Copy()
+	defer ses.Close()
+
+	iter := models.Currency.Iter(ses, filter)
+	writer := NewCurrencyExportWriter(res, format, includeUser)
+
+	res.Header().Set("Content-Type", writer.ContentType())
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="currencies-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+	res.WriteHeader(200)
+
+	if err := writer.Begin(); err != nil {
+		iter.Close()
+		return nil
+	}
+
+	var currency models.CurrencyModel
+	for iter.Next(&currency) {
+		if err := writer.Write(&currency); err != nil {
+			util.Println("Failed to write currency export. ", err.Error())
+			iter.Close()
+			return nil
+		}
+		if writer.count%EXPORT_FLUSH_INTERVAL == 0 {
+			writer.Flush()
+			flusher.Flush()
+		}
+		currency = models.CurrencyModel{}
+	}
+
+	if err := iter.Close(); err != nil {
+		util.Println("Failed to read currencies for export. ", err.Error())
+		return nil
+	}
+
+	writer.End()
+	flusher.Flush()
+	return nil
+}
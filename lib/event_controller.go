@@ -0,0 +1,88 @@
+// This controller streams events to clients
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ellcrys/openmint/extend"
+	"github.com/labstack/echo/engine/standard"
+)
+
+type EventController struct {
+	hub *EventHub
+}
+
+// Create a new controller instance
+func NewEventController(hub *EventHub) *EventController {
+	return &EventController{hub}
+}
+
+// @API: GET /v1/events
+//
+// @Description:
+// 	Stream events using Server-Sent Events. The authenticated user receives
+// 	events about currencies they submitted (new votes, status changes) and
+// 	events about new currencies entering the vote queue.
+//
+// @Query Params:
+// 	types 	String: Comma separated list of event types to receive (optional)
+//
+// @Response 200: A text/event-stream of events
+func (self *EventController) Stream(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+
+	var types []string
+	if _types := c.Echo().QueryParam("types"); _types != "" {
+		for _, t := range strings.Split(_types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+
+	res := c.Response().(*standard.Response)
+	flusher, ok := res.ResponseWriter.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming not supported")
+	}
+
+	closeNotifier, ok := res.ResponseWriter.(http.CloseNotifier)
+	if !ok {
+		return fmt.Errorf("close notification not supported")
+	}
+
+	events := self.hub.Subscribe(authUserId, types)
+	defer self.hub.Unsubscribe(events)
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(200)
+	fmt.Fprint(res, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(res, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-closeNotifier.CloseNotify():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// The event hub receives events published by any server
+// instance and fans them out to the clients connected to this instance
+package lib
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+)
+
+type eventClient struct {
+	userId string
+	types  []string
+}
+
+type EventHub struct {
+	redisPool *redis.Pool
+	mu        sync.Mutex
+	clients   map[chan *models.Event]*eventClient
+}
+
+// Create a new event hub
+func NewEventHub(redisPool *redis.Pool) *EventHub {
+	return &EventHub{
+		redisPool: redisPool,
+		clients:   make(map[chan *models.Event]*eventClient),
+	}
+}
+
+// Subscribe to the redis events channel and deliver received
+// events to connected clients. Reconnects if the subscription is lost.
+func (self *EventHub) Run() {
+	for {
+		conn := self.redisPool.Get()
+		psc := redis.PubSubConn{Conn: conn}
+		if err := psc.Subscribe(models.EVENTS_CHANNEL); err != nil {
+			util.Println("Failed to subscribe to events channel. ", err.Error())
+			conn.Close()
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+	receive:
+		for {
+			switch v := psc.Receive().(type) {
+			case redis.Message:
+				var event models.Event
+				if err := json.Unmarshal(v.Data, &event); err != nil {
+					util.Println("Failed to decode event. ", err.Error())
+					continue
+				}
+				self.broadcast(&event)
+			case error:
+				util.Println("Events subscription lost. ", v.Error())
+				break receive
+			}
+		}
+
+		conn.Close()
+		time.Sleep(time.Second)
+	}
+}
+
+// Register a client. The client receives events addressed to the
+// given user and events addressed to everyone. If types is not empty,
+// only events of those types are delivered.
+func (self *EventHub) Subscribe(userId string, types []string) chan *models.Event {
+	ch := make(chan *models.Event, 16)
+	self.mu.Lock()
+	self.clients[ch] = &eventClient{userId, types}
+	self.mu.Unlock()
+	return ch
+}
+
+// Remove a client
+func (self *EventHub) Unsubscribe(ch chan *models.Event) {
+	self.mu.Lock()
+	delete(self.clients, ch)
+	self.mu.Unlock()
+}
+
+// Deliver an event to all interested clients. Clients that
+// are too slow to receive the event miss it.
+func (self *EventHub) broadcast(event *models.Event) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for ch, client := range self.clients {
+		if event.UserId != "" && event.UserId != client.userId {
+			continue
+		}
+		if len(client.types) > 0 && !util.InStringSlice(client.types, event.Type) {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Returned when an image has no EXIF GPS position
+var ErrNoEXIFLocation = errors.New("image has no exif location")
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// EXIF tags
+const (
+	exifTagGPSIFD       = 0x8825
+	exifTagGPSLatRef    = 0x0001
+	exifTagGPSLatitude  = 0x0002
+	exifTagGPSLngRef    = 0x0003
+	exifTagGPSLongitude = 0x0004
+)
+
+// A JPEG segment. Start and end include the marker.
+type jpegSegment struct {
+	marker     byte
+	start, end int
+	payload    []byte
+}
+
+// Get the segments of a JPEG image that precede the image data
+func jpegSegments(data []byte) ([]jpegSegment, int, error) {
+
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errors.New("not a jpeg image")
+	}
+
+	segments := []jpegSegment{}
+	i := 2
+	for i+4 <= len(data) {
+
+		if data[i] != 0xFF {
+			return nil, 0, errors.New("invalid jpeg marker")
+		}
+
+		marker := data[i+1]
+
+		// fill bytes
+		if marker == 0xFF {
+			i++
+			continue
+		}
+
+		// start of scan and end of image are followed by image data
+		if marker == 0xDA || marker == 0xD9 {
+			return segments, i, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, 0, errors.New("invalid jpeg segment length")
+		}
+
+		segments = append(segments, jpegSegment{marker, i, i + 2 + length, data[i+4 : i+2+length]})
+		i += 2 + length
+	}
+
+	return segments, i, nil
+}
+
+// Check whether a segment holds EXIF data
+func (s jpegSegment) isEXIF() bool {
+	return s.marker == 0xE1 && bytes.HasPrefix(s.payload, exifHeader)
+}
+
+// A TIFF structure as found in EXIF data
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// An IFD entry. Value holds the raw value or offset field.
+type tiffEntry struct {
+	tag, kind uint16
+	count     uint32
+	value     []byte
+}
+
+// Read the entries of the IFD at offset
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]tiffEntry, error) {
+	if int(offset)+2 > len(t.data) {
+		return nil, errors.New("invalid ifd offset")
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(t.data) {
+		return nil, errors.New("invalid ifd size")
+	}
+	entries := map[uint16]tiffEntry{}
+	for i := 0; i < n; i++ {
+		e := t.data[start+i*12:]
+		entries[t.order.Uint16(e)] = tiffEntry{
+			tag:   t.order.Uint16(e),
+			kind:  t.order.Uint16(e[2:]),
+			count: t.order.Uint32(e[4:]),
+			value: e[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// Read a degrees, minutes, seconds coordinate stored as three rationals
+func (t *tiffReader) readCoordinate(e tiffEntry) (float64, error) {
+	const rationalType = 5
+	if e.kind != rationalType || e.count != 3 {
+		return 0, errors.New("invalid coordinate")
+	}
+	offset := int(t.order.Uint32(e.value))
+	if offset+24 > len(t.data) {
+		return 0, errors.New("invalid coordinate offset")
+	}
+	var parts [3]float64
+	for i := range parts {
+		num := t.order.Uint32(t.data[offset+i*8:])
+		den := t.order.Uint32(t.data[offset+i*8+4:])
+		if den == 0 {
+			return 0, errors.New("invalid coordinate")
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, nil
+}
+
+// Read the GPS position of a JPEG image from its EXIF data.
+// Returns ErrNoEXIFLocation if the image has no position.
+func ReadEXIFLocation(data []byte) (lat, lng float64, err error) {
+
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, segment := range segments {
+
+		if !segment.isEXIF() {
+			continue
+		}
+
+		tiff := &tiffReader{data: segment.payload[len(exifHeader):]}
+		if len(tiff.data) < 8 {
+			return 0, 0, ErrNoEXIFLocation
+		}
+
+		switch string(tiff.data[:2]) {
+		case "II":
+			tiff.order = binary.LittleEndian
+		case "MM":
+			tiff.order = binary.BigEndian
+		default:
+			return 0, 0, errors.New("invalid tiff byte order")
+		}
+
+		ifd0, err := tiff.readIFD(tiff.order.Uint32(tiff.data[4:]))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		gpsPointer, ok := ifd0[exifTagGPSIFD]
+		if !ok {
+			return 0, 0, ErrNoEXIFLocation
+		}
+
+		gps, err := tiff.readIFD(tiff.order.Uint32(gpsPointer.value))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		latEntry, hasLat := gps[exifTagGPSLatitude]
+		lngEntry, hasLng := gps[exifTagGPSLongitude]
+		if !hasLat || !hasLng {
+			return 0, 0, ErrNoEXIFLocation
+		}
+
+		if lat, err = tiff.readCoordinate(latEntry); err != nil {
+			return 0, 0, err
+		}
+		if lng, err = tiff.readCoordinate(lngEntry); err != nil {
+			return 0, 0, err
+		}
+
+		// the reference is an inline ASCII value (N, S, E or W)
+		if ref, ok := gps[exifTagGPSLatRef]; ok && ref.value[0] == 'S' {
+			lat = -lat
+		}
+		if ref, ok := gps[exifTagGPSLngRef]; ok && ref.value[0] == 'W' {
+			lng = -lng
+		}
+
+		// cameras without a fix often write zeros
+		if lat == 0 && lng == 0 {
+			return 0, 0, ErrNoEXIFLocation
+		}
+
+		return lat, lng, nil
+	}
+
+	return 0, 0, ErrNoEXIFLocation
+}
+
+// Check whether an image may hold EXIF data. The EXIF header is searched
+// for in the whole image so EXIF data is found even if the image cannot be parsed.
+func HasEXIF(data []byte) bool {
+	return bytes.Contains(data, exifHeader)
+}
+
+// Remove the EXIF segments of a JPEG image
+func RemoveEXIF(data []byte) ([]byte, error) {
+
+	segments, imageStart, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(data))
+	result = append(result, data[:2]...)
+	for _, segment := range segments {
+		if !segment.isEXIF() {
+			result = append(result, data[segment.start:segment.end]...)
+		}
+	}
+
+	return append(result, data[imageStart:]...), nil
+}
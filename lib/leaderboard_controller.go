@@ -0,0 +1,177 @@
+// This controller provides contributor leaderboards
+package lib
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type LeaderboardController struct {
+	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+}
+
+// Create a new controller instance
+func NewLeaderboardController(mongoSession *mgo.Session, redisPool *redis.Pool) *LeaderboardController {
+	return &LeaderboardController{mongoSession, redisPool}
+}
+
+// Award an achievement to a user and let the user know.
+// Nothing happens if the user already has the achievement.
+func awardAchievement(mongoSession *mgo.Session, redisPool *redis.Pool, userId, name string) {
+	achievement := models.Achievement{Name: name, AwardedAt: time.Now().UTC()}
+	awarded, err := models.User.AddAchievement(mongoSession, userId, achievement)
+	if err != nil {
+		util.Println("Failed to award achievement. ", name, err.Error())
+		return
+	} else if !awarded {
+		return
+	}
+	if err = models.PublishEvent(redisPool, models.NewEvent(models.EventAchievement, userId, achievement)); err != nil {
+		util.Println("Failed to publish event. ", err.Error())
+	}
+}
+
+// Update the notes leaderboard and the achievements of the uploader of a new currency
+func (self *MintController) recordNoteContribution(currency *models.CurrencyModel) {
+
+	userId := currency.UserId.Hex()
+	if _, err := models.IncrLeaderboard(self.redisPool, models.LeaderboardNotes, userId, 1, currency.CreatedAt); err != nil {
+		util.Println("Failed to update notes leaderboard. ", err.Error())
+	}
+
+	awardAchievement(self.mongoSession, self.redisPool, userId, models.AchievementFirstNote)
+
+	// the first note of a currency code introduces a new currency
+	count, err := models.Currency.Count(self.mongoSession, &models.CurrencyFilter{CurrencyCode: currency.CurrencyCode})
+	if err != nil {
+		util.Println("Failed to count currencies. ", err.Error())
+	} else if count == 1 {
+		awardAchievement(self.mongoSession, self.redisPool, userId, models.AchievementNewCurrency)
+	}
+}
+
+// Update the votes leaderboard and the achievements of a voter
+func (self *MintController) recordVoteContribution(vote models.Vote) {
+	userId := vote.UserId.Hex()
+	numVotes, err := models.IncrLeaderboard(self.redisPool, models.LeaderboardVotes, userId, 1, vote.CreatedAt)
+	if err != nil {
+		util.Println("Failed to update votes leaderboard. ", err.Error())
+	} else if numVotes >= models.ACHIEVEMENT_VOTES {
+		awardAchievement(self.mongoSession, self.redisPool, userId, models.AchievementVotes100)
+	}
+}
+
+// Update the accuracy leaderboard of the voters of a currency whose
+// status has been decided. Votes on disputed currencies and votes of
+// deleted users are not counted.
+func (self *MintController) recordVoteAccuracy(currency *models.CurrencyModel) {
+	if currency.Status != "verified" && currency.Status != "rejected" {
+		return
+	}
+	now := time.Now().UTC()
+	minVotes := config.C.GetInt("leaderboard_min_accuracy_votes")
+	for _, vote := range currency.Votes {
+		if vote.UserId.Hex() == models.DELETED_USER_ID {
+			continue
+		}
+		correct := (vote.Decision == 1) == (currency.Status == "verified")
+		if err := models.RecordVoteAccuracy(self.redisPool, vote.UserId.Hex(), correct, minVotes, now); err != nil {
+			util.Println("Failed to update accuracy leaderboard. ", err.Error())
+		}
+	}
+}
+
+// @API: GET /v1/leaderboards/:board
+//
+// @Description:
+// 	Get the top contributors of a leaderboard. The `notes` leaderboard ranks users
+// 	by currencies indexed, `votes` by votes cast and `accuracy` by the share of
+// 	votes matching the decided status of currencies.
+//
+// @Query Params:
+// 	window 	String: The time window (weekly, monthly or all_time). Default: weekly
+// 	limit 	Int: The number of users to return. Default: 10, Max: 100
+//
+// @Response 200:
+// 	board 		String: The leaderboard
+// 	window 		String: The time window
+// 	period 		String: The current period of the window (e.g 2016-W18 or 2016-05)
+// 	entries 	Array: The top users with their rank, score, full name and photo
+// 	me 			Object: The rank and score of the authenticated user (if ranked)
+func (self *LeaderboardController) GetLeaderboard(c *extend.Context) error {
+
+	board := c.Param("board")
+	if !util.InStringSlice(models.Leaderboards, board) {
+		return config.NewHTTPError(c.Lang(), 404, "").SetMsg("leaderboard not found").SetCode("invalid_parameter").SetParam("board")
+	}
+
+	window := c.Echo().QueryParam("window")
+	if window == "" {
+		window = models.LeaderboardWeekly
+	} else if !util.InStringSlice(models.LeaderboardWindows, window) {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("window must be weekly, monthly or all_time").SetCode("invalid_parameter").SetParam("window")
+	}
+
+	limit, _, err := paginationParams(c, 10, 100)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	entries, err := models.GetLeaderboard(self.redisPool, board, window, now, limit)
+	if err != nil {
+		util.Println("Failed to get leaderboard. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	ids := []bson.ObjectId{}
+	for _, entry := range entries {
+		if bson.IsObjectIdHex(entry.UserId) {
+			ids = append(ids, bson.ObjectIdHex(entry.UserId))
+		}
+	}
+
+	users, err := models.User.FindByIds(self.mongoSession, ids)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	results := []extend.H{}
+	for _, entry := range entries {
+		result := extend.H{"rank": entry.Rank, "user_id": entry.UserId, "score": entry.Score}
+		for _, user := range users {
+			if user.Id.Hex() == entry.UserId {
+				result["full_name"] = user.Fullname
+				result["photo_url"] = user.PhotoURL
+			}
+		}
+		results = append(results, result)
+	}
+
+	response := extend.H{
+		"board":   board,
+		"window":  window,
+		"period":  models.LeaderboardPeriod(window, now),
+		"entries": results,
+	}
+
+	if authUserId := c.Get("auth_user"); authUserId != "" {
+		me, err := models.GetLeaderboardEntry(self.redisPool, board, window, now, authUserId)
+		if err != nil {
+			util.Println("Failed to get leaderboard entry. ", err.Error())
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		} else if me != nil {
+			response["me"] = me
+		}
+	}
+
+	return c.JSON(200, response)
+}
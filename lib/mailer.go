@@ -0,0 +1,21 @@
+// Mailers send emails to users
+package lib
+
+import (
+	"github.com/ellcrys/util"
+)
+
+type Mailer interface {
+
+	// Send an email
+	Send(to, subject, body string) error
+}
+
+// A mailer that logs emails instead of sending them.
+// Used until an email provider is configured.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	util.Println("Email to " + to + ": " + subject)
+	return nil
+}
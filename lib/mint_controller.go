@@ -6,11 +6,13 @@ import (
 	"image"
 	_ "image/jpeg"
 	"io"
+	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -40,6 +42,10 @@ type MintController struct {
 	redisPool      *redis.Pool
 	storageService *storage.Service
 	visionService  *vision.Service
+	webhooks       *WebhookDispatcher
+	serials        *SerialDetectorRegistry
+	watchlists     *WatchlistAlerter
+	risk           *RiskScorer
 }
 
 // Create storage service.
@@ -61,10 +67,10 @@ func createVisionService(client *http.Client) *vision.Service {
 }
 
 // Create a new controller instance
-func NewMintController(mongoSession *mgo.Session, redisPool *redis.Pool, storageClient *http.Client, visionClient *http.Client) *MintController {
+func NewMintController(mongoSession *mgo.Session, redisPool *redis.Pool, storageClient *http.Client, visionClient *http.Client, webhooks *WebhookDispatcher, serials *SerialDetectorRegistry, watchlists *WatchlistAlerter, risk *RiskScorer) *MintController {
 	storageService := createStorageService(storageClient)
 	visionService := createVisionService(visionClient)
-	return &MintController{mongoSession, redisPool, storageService, visionService}
+	return &MintController{mongoSession, redisPool, storageService, visionService, webhooks, serials, watchlists, risk}
 }
 
 // Store image in google cloud storage.
@@ -154,6 +160,13 @@ func (self *MintController) AnalyzeCurrency(curCode, curDenom, imageName string)
 	return result, nil
 }
 
+// Publish an event. Failures are logged and otherwise ignored.
+func (self *MintController) publishEvent(event *models.Event) {
+	if err := models.PublishEvent(self.redisPool, event); err != nil {
+		util.Println("Failed to publish event. ", err.Error())
+	}
+}
+
 // Resize image
 func (self *MintController) ResizeImg(currencyImg *multipart.FileHeader, newWidth int) (*os.File, error) {
 
@@ -194,12 +207,30 @@ func (self *MintController) ResizeImg(currencyImg *multipart.FileHeader, newWidt
 // 	currency_image 		File: 		The image of the currency
 // 	currency_denom 		String:		The expected denomination on currency
 // 	currency_code 		String:		The currency code (NGN, USD etc)
+// 	latitude 			Float:		Where the currency was scanned (optional)
+// 	longitude 			Float:		Where the currency was scanned (optional)
 //
-// @Response 200:
+// The location is read from the EXIF GPS position of JPEG images when not given. The EXIF
+// data is removed from the stored image. Locations read from EXIF data are always coarsened
+// since users may not know their images have a position. Given locations of users who opted
+// out of precise locations are coarsened.
+//
+// @Response 201:
 // 	id 		string: The open mint id of the currency
 // 	status 	string: The open mint status
 // 	name 	string: The name of the currency image
 // 	link 	string: The public link to the currency image
+// 	serial_patterns 	[]string: The collectible patterns of the serial (radar, repeater, ladder, solid, low)
+//
+// @Response 200: The currency had already been indexed and the scan was recorded as a sighting.
+// A user's repeat scans within the repeat window are not recorded again.
+// 	id 				string: The open mint id of the currency
+// 	status 			string: The open mint status
+// 	sighting 		object: models.SightingModel
+// 	sighting_count 	int: The number of sightings of the currency
+// 	serial_patterns []string: The collectible patterns of the serial
+//
+// @Response 404: The currency is not available
 func (self *MintController) Process(c *extend.Context) error {
 
 	authUserId := c.Get("auth_user")
@@ -214,19 +245,20 @@ func (self *MintController) Process(c *extend.Context) error {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
-	// get currency code and ensure it is valid
-	curCode := c.Echo().FormValue("currency_code")
-	if len(strings.TrimSpace(curCode)) == 0 {
+	// get currency code and ensure it is valid. Codes are stored
+	// in upper case so lookups by code find every indexed currency.
+	curCode := strings.ToUpper(strings.TrimSpace(c.Echo().FormValue("currency_code")))
+	if len(curCode) == 0 {
 		return config.NewHTTPError(c.Lang(), 400, "e003")
 	}
 
 	// currency code must be known
-	if !IsValidCode(strings.ToUpper(curCode)) {
+	if !IsValidCode(curCode) {
 		return config.NewHTTPError(c.Lang(), 400, "e004")
 	}
 
 	// currency code must have meta definition
-	if !util.InStringSlice(GetDefinedCurrencies(), strings.ToUpper(curCode)) {
+	if !util.InStringSlice(GetDefinedCurrencies(), curCode) {
 		return config.NewHTTPError(c.Lang(), 400, "e009")
 	}
 
@@ -236,6 +268,12 @@ func (self *MintController) Process(c *extend.Context) error {
 		return config.NewHTTPError(c.Lang(), 400, "e005")
 	}
 
+	// scan location (optional)
+	location, err := parseLocation(c)
+	if err != nil {
+		return err
+	}
+
 	// resize image for display in applications
 	smallerImg, err := self.ResizeImg(currencyImg, 350)
 	if err != nil {
@@ -253,8 +291,38 @@ func (self *MintController) Process(c *extend.Context) error {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
+	// remove the position of the original image since images are public
+	originalImg, exifLocation, err := self.removeImageLocation(currencyImg)
+	if err != nil {
+		util.Println(err)
+		go self.DeleteImage(smallerImgObj.Name)
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if tempFile, isTempFile := originalImg.(*os.File); isTempFile {
+		defer func() {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+		}()
+	}
+
+	var locationSource string
+	if location == nil && exifLocation != nil {
+		location, locationSource = exifLocation.Coarsen(), models.LocationSourceEXIF
+	} else if location != nil {
+		locationSource = models.LocationSourceForm
+		user, err := models.User.FindById(self.mongoSession, authUserId)
+		if err != nil {
+			go self.DeleteImage(smallerImgObj.Name)
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		if user.CoarseLocation {
+			location = location.Coarsen()
+		}
+	}
+
 	// save original currency image
-	originalImageObj, err := self.SaveImage(currencyImg)
+	originalImageObj, err := self.SaveImage(originalImg)
 	if err != nil {
 		go self.DeleteImage(smallerImgObj.Name)
 		return config.NewHTTPError(c.Lang(), 500, "e500")
@@ -287,7 +355,7 @@ func (self *MintController) Process(c *extend.Context) error {
 	}
 
 	// find matching currency
-	_, err = models.Currency.FindCurrency(self.mongoSession, curCode, analysisResult["denomination"], analysisResult["serial"])
+	existing, err := models.Currency.FindCurrency(self.mongoSession, curCode, analysisResult["denomination"], analysisResult["serial"])
 	if err != nil && err != mgo.ErrNotFound {
 		go self.DeleteImage(smallerImgObj.Name)
 		go self.DeleteImage(originalImageObj.Name)
@@ -295,20 +363,29 @@ func (self *MintController) Process(c *extend.Context) error {
 	} else if err == nil {
 		go self.DeleteImage(smallerImgObj.Name)
 		go self.DeleteImage(originalImageObj.Name)
-		return config.NewHTTPError(c.Lang(), 400, "e017")
+		return self.addSighting(c, existing, location, locationSource)
 	}
 
 	// create currency entry
 	currency := &models.CurrencyModel{
-		Id:               models.NewId(),
-		UserId:           bson.ObjectIdHex(authUserId),
-		ImageURL:         fmt.Sprintf("http://storage.googleapis.com/%s/%s", smallerImgObj.Bucket, smallerImgObj.Name),
-		OriginalImageURL: fmt.Sprintf("http://storage.googleapis.com/%s/%s", originalImageObj.Bucket, originalImageObj.Name),
-		CurrencyCode:     curCode,
-		Denomination:     analysisResult["denomination"],
-		Serial:           analysisResult["serial"],
-		Status:           "awaiting_votes",
-	}
+		Id:                  models.NewId(),
+		UserId:              bson.ObjectIdHex(authUserId),
+		ImageURL:            fmt.Sprintf("http://storage.googleapis.com/%s/%s", smallerImgObj.Bucket, smallerImgObj.Name),
+		OriginalImageURL:    fmt.Sprintf("http://storage.googleapis.com/%s/%s", originalImageObj.Bucket, originalImageObj.Name),
+		CurrencyCode:        curCode,
+		Denomination:        analysisResult["denomination"],
+		Serial:              analysisResult["serial"],
+		Status:              "awaiting_votes",
+		UploaderIP:          c.RealIP(),
+		UploaderFingerprint: c.GetDeviceFingerprint(),
+		Analysis:            analysisResult,
+		Location:            location,
+		LocationSource:      locationSource,
+		SerialPatterns:      self.serials.Classify(analysisResult["serial"]),
+	}
+
+	// risky currencies are held out of the vote queue for a moderator review
+	held := self.risk.Assess(currency)
 
 	if err = models.Currency.Create(self.mongoSession, currency); err != nil {
 		go self.DeleteImage(smallerImgObj.Name)
@@ -317,11 +394,44 @@ func (self *MintController) Process(c *extend.Context) error {
 	}
 
 	// add currency to the vote queue
-	if err = models.AddToVoteQueue(self.redisPool, currency.Id.Hex()); err != nil {
-		go self.DeleteImage(smallerImgObj.Name)
-		go self.DeleteImage(originalImageObj.Name)
-		go models.Currency.Delete(self.mongoSession, currency.Id.Hex())
-		return config.NewHTTPError(c.Lang(), 500, "e500")
+	if !held {
+		if err = models.AddToVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode, currency.CreatedAt, 0); err != nil {
+			go self.DeleteImage(smallerImgObj.Name)
+			go self.DeleteImage(originalImageObj.Name)
+			go models.Currency.Delete(self.mongoSession, currency.Id.Hex())
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+	}
+
+	recordAudit(self.mongoSession, c, models.AuditCurrencyCreate, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+		"currency_code": currency.CurrencyCode,
+		"denomination":  currency.Denomination,
+		"serial":        currency.Serial,
+		"status":        currency.Status,
+	}, "")
+
+	if held {
+		recordAudit(self.mongoSession, c, models.AuditCurrencyRiskHold, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+			"risk_score": currency.RiskScore,
+		}, "")
+	}
+
+	go self.webhooks.Dispatch(authUserId, models.WebhookCurrencyIndexed, currency)
+	go self.recordNoteContribution(currency)
+	go self.watchlists.Check(currency, nil)
+
+	// the other notes indexed with the serial may now be risky too
+	if currency.HasRiskReason(models.RiskDuplicateSerial) {
+		go self.rescoreSerials(currency.CurrencyCode, currency.Serial)
+	}
+
+	// let voters know a new currency is waiting for votes
+	if !held {
+		self.publishEvent(models.NewEvent(models.EventVoteQueueItem, "", extend.H{
+			"currency_id":   currency.Id.Hex(),
+			"currency_code": currency.CurrencyCode,
+			"denomination":  currency.Denomination,
+		}))
 	}
 
 	return c.JSON(201, extend.H{
@@ -333,9 +443,162 @@ func (self *MintController) Process(c *extend.Context) error {
 		"status":             currency.Status,
 		"serial":             analysisResult["serial"],
 		"denomination":       analysisResult["denomination"],
+		"serial_patterns":    currency.SerialPatterns,
 	})
 }
 
+// Record a scan of an indexed currency as a sighting. Hidden currencies
+// are reported as not found. Scans by a user who sighted the currency
+// within the repeat window return the earlier sighting.
+func (self *MintController) addSighting(c *extend.Context, currency *models.CurrencyModel, location *models.GeoPoint, locationSource string) error {
+
+	if currency.Hidden {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
+	authUserId := c.Get("auth_user")
+	window := time.Duration(config.C.GetInt("sighting_repeat_window")) * time.Second
+	first, err := models.Throttle(self.redisPool, "sighting_"+currency.Id.Hex()+"_"+authUserId, window)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if !first {
+		sighting, err := models.Sighting.FindLatestByUser(self.mongoSession, currency.Id.Hex(), authUserId)
+		if err != nil && err != mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		} else if err == mgo.ErrNotFound {
+			sighting = nil
+		}
+		return c.JSON(200, self.sightingResult(currency, sighting))
+	}
+
+	sighting := &models.SightingModel{
+		Id:             models.NewId(),
+		CurrencyId:     currency.Id,
+		UserId:         bson.ObjectIdHex(authUserId),
+		IP:             c.RealIP(),
+		Fingerprint:    c.GetDeviceFingerprint(),
+		Location:       location,
+		LocationSource: locationSource,
+	}
+
+	if err := models.Sighting.Create(self.mongoSession, sighting); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err := models.Currency.AddSighting(self.mongoSession, currency.Id.Hex(), sighting.CreatedAt); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	currency.SightingCount++
+	currency.LastSeenAt = sighting.CreatedAt
+
+	go self.watchlists.Check(currency, sighting)
+	go self.rescore(currency)
+
+	recordAudit(self.mongoSession, c, models.AuditCurrencySighted, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+		"sighting_id":    sighting.Id.Hex(),
+		"sighting_count": change(currency.SightingCount-1, currency.SightingCount),
+	}, "")
+
+	// let the uploader know where their note travelled
+	self.publishEvent(models.NewEvent(models.EventSighting, currency.UserId.Hex(), extend.H{
+		"currency_id":    currency.Id.Hex(),
+		"sighting_count": currency.SightingCount,
+	}))
+
+	return c.JSON(200, self.sightingResult(currency, sighting))
+}
+
+// Describe a sighted currency
+func (self *MintController) sightingResult(currency *models.CurrencyModel, sighting *models.SightingModel) extend.H {
+	return extend.H{
+		"id":              currency.Id.Hex(),
+		"currency_code":   currency.CurrencyCode,
+		"denomination":    currency.Denomination,
+		"serial":          currency.Serial,
+		"serial_patterns": self.serials.Classify(currency.Serial),
+		"status":          currency.Status,
+		"first_seen":      currency.CreatedAt,
+		"sighting":        sighting,
+		"sighting_count":  currency.SightingCount,
+	}
+}
+
+// Get the optional location of a scan from the latitude and longitude form values
+func parseLocation(c *extend.Context) (*models.GeoPoint, error) {
+
+	_lat, _lng := c.Echo().FormValue("latitude"), c.Echo().FormValue("longitude")
+	if _lat == "" && _lng == "" {
+		return nil, nil
+	}
+
+	lat, err := strconv.ParseFloat(_lat, 64)
+	if err != nil {
+		return nil, config.NewHTTPError(c.Lang(), 400, "e047").SetParam("latitude")
+	}
+
+	lng, err := strconv.ParseFloat(_lng, 64)
+	if err != nil {
+		return nil, config.NewHTTPError(c.Lang(), 400, "e047").SetParam("longitude")
+	}
+
+	if !models.IsValidCoordinate(lat, lng) {
+		return nil, config.NewHTTPError(c.Lang(), 400, "e047")
+	}
+
+	return models.NewGeoPoint(lat, lng), nil
+}
+
+// Read the EXIF GPS position of an uploaded JPEG image. If the image has EXIF data,
+// a copy without it is returned for saving, otherwise the upload is returned. EXIF
+// data is removed even if its position cannot be read since it may still be public.
+func (self *MintController) removeImageLocation(img *multipart.FileHeader) (interface{}, *models.GeoPoint, error) {
+
+	file, err := img.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !HasEXIF(data) {
+		return img, nil, nil
+	}
+
+	var location *models.GeoPoint
+	if lat, lng, err := ReadEXIFLocation(data); err == nil && models.IsValidCoordinate(lat, lng) {
+		location = models.NewGeoPoint(lat, lng)
+	}
+
+	stripped, err := RemoveEXIF(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tempFile, err := NewTempFile(os.TempDir(), "openming_img"+util.RandString(32), ".jpg")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err = tempFile.Write(stripped); err != nil {
+		tempFile.Close()
+		return nil, nil, err
+	}
+
+	if _, err = tempFile.Seek(0, 0); err != nil {
+		tempFile.Close()
+		return nil, nil, err
+	}
+
+	return tempFile, location, nil
+}
+
 // @API: 				GET /v1/mint/supported_currencies
 // @Description: 		Get a map of supported currencies and thier denominations
 // @Response 200:
@@ -350,75 +613,139 @@ func (self *MintController) GetSupportedCurrencies(c *extend.Context) error {
 	return c.JSON(200, supportedCurrencies)
 }
 
+// Check whether a user has added a vote to a currency
+func hasVoted(currency *models.CurrencyModel, userId string) bool {
+	for _, vote := range currency.Votes {
+		if vote.UserId.Hex() == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether a vote comes from the same ip address and device fingerprint
+// as the uploader or an existing vote on the currency. A shared ip address alone
+// is common behind NATs and the fingerprint is chosen by the client, so both
+// must match. Votes sharing only one of them are listed by GetSuspiciousVoteClusters.
+func isCorrelatedVote(currency *models.CurrencyModel, ip, fingerprint string) bool {
+	if ip == "" || fingerprint == "" {
+		return false
+	}
+	if ip == currency.UploaderIP && fingerprint == currency.UploaderFingerprint {
+		return true
+	}
+	for _, vote := range currency.Votes {
+		if vote.IP == ip && vote.Fingerprint == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
 // @API: 		 	GET /v1/mint/vote
 //
 // @Description: 	Request a vote session. This endpoint will return a currency to
-// 	to vote on and a vote session id. The vote session id allows vote responses to be accepted by `AddVote()`
+// 	to vote on and a vote session id. The vote session id allows vote responses to be accepted by `AddVote()`.
+// 	Currencies are served oldest (or highest priority) first. Currencies submitted by the
+// 	authenticated user or already voted on by the user are skipped.
+//
+// @Query Params:
+// 	currency_code 	String: Only return currencies of this currency code (optional)
 //
 // @Response 200:
 // 	currency 	Object: 	The currency to vote on
 // 	vote_id 	String:		The vote id
 func (self *MintController) GetVoteSession(c *extend.Context) error {
 
-	var maxRepeat = 3
-	var countRepeat = 0
-
-	for {
-
-		// exist loop if maxRepeat threshold is reached
-		if maxRepeat == countRepeat {
-			break
-		}
+	authUserId := c.Get("auth_user")
+	maxVotes := config.C.GetInt("max_votes")
 
-		countRepeat++
+	// currency code of the sub-queue to read from (optional)
+	curCode := strings.ToUpper(strings.TrimSpace(c.Echo().QueryParam("currency_code")))
+	if curCode != "" && !IsValidCode(curCode) {
+		return config.NewHTTPError(c.Lang(), 400, "e004")
+	}
 
-		// fetch a currency to vote on
-		currencyId, err := models.GetFromVoteQueue(self.redisPool)
+	var batchSize = 20
+	var maxScan = 100
+	var offset = 0
+	var scanned = 0
 
-		// no currency found
-		if err != nil && err == redis.ErrNil {
-			continue
-		} else if err != nil {
-			return config.NewHTTPError(c.Lang(), 500, "e500")
-		}
+	for scanned < maxScan {
 
-		currency, err := models.Currency.FindById(self.mongoSession, currencyId)
+		// fetch a batch of currencies to vote on
+		currencyIds, err := models.GetFromVoteQueue(self.redisPool, curCode, offset, batchSize)
 		if err != nil {
 			return config.NewHTTPError(c.Lang(), 500, "e500")
 		}
 
-		// if current votes is equal to max vote, remove currency from queue
-		if len(currency.Votes) == config.C.GetInt("max_votes") {
-			if err = models.RemoveFromVoteQueue(self.redisPool, currencyId); err != nil {
-				return config.NewHTTPError(c.Lang(), 500, "e500")
-			}
-			continue
+		// queue exhausted
+		if len(currencyIds) == 0 {
+			break
 		}
 
-		// count the number of active voting sessions for this currency.
-		// if number of active session is greater or equal to the number of votes remaining,
-		// continue to next iteration
-		numActiveSessions, err := models.CountActiveSessions(self.redisPool, currencyId)
+		currencies, err := models.Currency.FindByIds(self.mongoSession, currencyIds)
 		if err != nil {
 			return config.NewHTTPError(c.Lang(), 500, "e500")
 		}
 
-		if numActiveSessions >= (config.C.GetInt("max_votes") - len(currency.Votes)) {
-			util.Println("Max session reached")
-			continue
+		currencyMap := make(map[string]*models.CurrencyModel)
+		for i := range currencies {
+			currencyMap[currencies[i].Id.Hex()] = &currencies[i]
 		}
 
-		// add new session
-		voteSessionId := util.Sha1(util.RandString(32))
-		err = models.AddNewSession(self.redisPool, currencyId, voteSessionId)
-		if err != nil {
-			return config.NewHTTPError(c.Lang(), 500, "e500")
+		var removed = 0
+		for _, currencyId := range currencyIds {
+
+			scanned++
+			currency, found := currencyMap[currencyId]
+
+			// remove currencies that no longer exist, are no longer awaiting votes, are
+			// hidden, are held for review or have reached the maximum number of votes
+			if !found || currency.Status != "awaiting_votes" || currency.Hidden || currency.HeldForReview() || len(currency.Votes) >= maxVotes {
+				var queueCode = curCode
+				if found {
+					queueCode = currency.CurrencyCode
+				}
+				if err = models.RemoveFromVoteQueue(self.redisPool, currencyId, queueCode); err != nil {
+					return config.NewHTTPError(c.Lang(), 500, "e500")
+				}
+				removed++
+				continue
+			}
+
+			// skip the user's own currencies and currencies the user has voted on
+			if currency.UserId.Hex() == authUserId || hasVoted(currency, authUserId) {
+				continue
+			}
+
+			// count the number of active voting sessions for this currency.
+			// if number of active session is greater or equal to the number of votes remaining,
+			// continue to the next currency
+			numActiveSessions, err := models.CountActiveSessions(self.redisPool, currencyId)
+			if err != nil {
+				return config.NewHTTPError(c.Lang(), 500, "e500")
+			}
+
+			if numActiveSessions >= (maxVotes - len(currency.Votes)) {
+				continue
+			}
+
+			// add new session
+			voteSessionId := util.Sha1(util.RandString(32))
+			err = models.AddNewSession(self.redisPool, currencyId, voteSessionId)
+			if err != nil {
+				return config.NewHTTPError(c.Lang(), 500, "e500")
+			}
+
+			return c.JSON(200, extend.H{
+				"currency": currency,
+				"vote_id":  voteSessionId,
+			})
 		}
 
-		return c.JSON(200, extend.H{
-			"currency": currency,
-			"vote_id":  voteSessionId,
-		})
+		// removed currencies shift the remaining queue members to lower ranks
+		offset += len(currencyIds) - removed
 	}
 
 	return config.NewHTTPError(c.Lang(), 400, "e018")
@@ -452,39 +779,145 @@ func (self *MintController) AddVote(c *extend.Context) error {
 		return config.NewHTTPError(c.Lang(), 404, "e020")
 	}
 
+	// hidden currencies and currencies held for review cannot receive votes
+	if currency.Hidden || currency.HeldForReview() {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
 	// ensure maximum number of vote hasn't been reached or (passed, if ever)
-	if len(currency.Votes) >= 3 {
+	if len(currency.Votes) >= config.C.GetInt("max_votes") {
 		return config.NewHTTPError(c.Lang(), 400, "e021")
 	}
 
+	// uploader cannot vote on own currency
+	if currency.UserId.Hex() == authUserId {
+		return config.NewHTTPError(c.Lang(), 400, "e024")
+	}
+
 	// ensure authenticated user hasn't added a vote to this currency
-	for _, vote := range currency.Votes {
-		if vote.UserId.Hex() == authUserId {
-			return config.NewHTTPError(c.Lang(), 400, "e023")
+	if hasVoted(currency, authUserId) {
+		return config.NewHTTPError(c.Lang(), 400, "e023")
+	}
+
+	// take a vote from the daily vote limit. The counter is incremented before
+	// the vote is added so parallel requests cannot pass the limit together.
+	dailyVotes, err := models.IncrDailyVoteCount(self.redisPool, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	// give the vote back to the daily vote limit when the vote is not added
+	releaseVote := func() {
+		if _, err := models.DecrDailyVoteCount(self.redisPool, authUserId); err != nil {
+			util.Println("Failed to decrement daily vote count. ", err.Error())
 		}
 	}
 
+	if dailyVotes > config.C.GetInt("max_daily_votes") {
+		releaseVote()
+		return config.NewHTTPError(c.Lang(), 400, "e025")
+	}
+
+	// reject votes coming from the same ip and device as the
+	// uploader or as a vote already added by another user
+	ip, fingerprint := c.RealIP(), c.GetDeviceFingerprint()
+	if isCorrelatedVote(currency, ip, fingerprint) {
+		releaseVote()
+		util.Println("Correlated vote rejected. ", currency.Id.Hex(), authUserId, ip, fingerprint)
+		return config.NewHTTPError(c.Lang(), 400, "e026")
+	}
+
 	// check if vote id is valid and is still active
 	active, err := models.IsActiveSession(self.redisPool, body.CurrencyId, body.VoteId)
 	if err != nil {
+		releaseVote()
 		return config.NewHTTPError(c.Lang(), 400, "e022")
 	}
 
 	if !active {
+		releaseVote()
 		return config.NewHTTPError(c.Lang(), 400, "e019")
 	}
 
 	// append votes
 	currency.Votes = append(currency.Votes, models.Vote{
-		Decision:  body.Decision,
-		UserId:    bson.ObjectIdHex(authUserId),
-		CreatedAt: time.Now().UTC(),
+		Decision:    body.Decision,
+		UserId:      bson.ObjectIdHex(authUserId),
+		IP:          ip,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now().UTC(),
 	})
 
 	// update votes
 	if err = models.Currency.UpdateVotes(self.mongoSession, currency.Id.Hex(), currency.Votes); err != nil {
+		releaseVote()
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	recordAudit(self.mongoSession, c, models.AuditCurrencyVote, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+		"decision":  body.Decision,
+		"num_votes": change(len(currency.Votes)-1, len(currency.Votes)),
+	}, "")
+
+	go self.recordVoteContribution(currency.Votes[len(currency.Votes)-1])
+
+	// notify the uploader
+	self.publishEvent(models.NewEvent(models.EventVoteAdded, currency.UserId.Hex(), extend.H{
+		"currency_id": currency.Id.Hex(),
+		"num_votes":   len(currency.Votes),
+	}))
+
+	// decide the status of the currency once the maximum number of votes is reached
+	if err = self.finalizeVotes(currency); err != nil {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
 	return c.JSON(200, currency)
 }
+
+// @API: 		 	GET /v1/mint/vote/suspicious
+// @Description: 	List groups of votes cast by different users from
+// 	the same ip address or device fingerprint. Requires the `vote:review` permission.
+//
+// @Query Params:
+// 	min_users 	Int: The minimum number of distinct users in a cluster. Default: 2
+// 	limit 		Int: The maximum number of clusters per source. Default: 50
+//
+// @Response 200:
+// 	ip 				Array: Clusters of votes sharing an ip address
+// 	fingerprint 	Array: Clusters of votes sharing a device fingerprint
+func (self *MintController) GetSuspiciousVoteClusters(c *extend.Context) error {
+
+	var err error
+	var minUsers = 2
+	var limit = 50
+
+	if _minUsers := c.Echo().QueryParam("min_users"); _minUsers != "" {
+		if minUsers, err = strconv.Atoi(_minUsers); err != nil || minUsers < 2 {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("min_users must be a number greater than 1").SetCode("invalid_parameter").SetParam("min_users")
+		}
+	}
+
+	if _limit := c.Echo().QueryParam("limit"); _limit != "" {
+		if limit, err = strconv.Atoi(_limit); err != nil || limit < 1 {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("limit must be a positive number").SetCode("invalid_parameter").SetParam("limit")
+		}
+	}
+
+	ipClusters, err := models.Currency.FindVoteClusters(self.mongoSession, "ip", minUsers, limit)
+	if err != nil {
+		util.Println("Failed to find ip vote clusters. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	fingerprintClusters, err := models.Currency.FindVoteClusters(self.mongoSession, "fingerprint", minUsers, limit)
+	if err != nil {
+		util.Println("Failed to find fingerprint vote clusters. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{
+		"ip":          ipClusters,
+		"fingerprint": fingerprintClusters,
+	})
+}
@@ -0,0 +1,744 @@
+// This controller contains moderation actions
+// available to moderators and admins
+package lib
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type setCurrencyStatusBody struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type editCurrencyBody struct {
+	Serial       *string `json:"serial"`
+	Denomination *string `json:"denomination"`
+	Reason       string  `json:"reason"`
+}
+
+type setCurrencyHiddenBody struct {
+	Hidden bool   `json:"hidden"`
+	Reason string `json:"reason"`
+}
+
+type banUserBody struct {
+	Reason string `json:"reason"`
+}
+
+type setRolesBody struct {
+	Roles []string `json:"roles"`
+}
+
+type ModerationController struct {
+	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+	mint         *MintController
+}
+
+// Create a new controller instance
+func NewModerationController(mongoSession *mgo.Session, redisPool *redis.Pool, mint *MintController) *ModerationController {
+	return &ModerationController{mongoSession, redisPool, mint}
+}
+
+// Record an action in the audit log
+func (self *ModerationController) audit(c *extend.Context, action, targetType, targetId string, changes map[string]interface{}, reason string) {
+	recordAudit(self.mongoSession, c, action, targetType, targetId, changes, reason)
+}
+
+// Get the limit and skip query parameters
+func paginationParams(c *extend.Context, defaultLimit, maxLimit int) (int, int, error) {
+
+	var err error
+	var limit = defaultLimit
+	var skip = 0
+
+	if _limit := c.Echo().QueryParam("limit"); _limit != "" {
+		if limit, err = strconv.Atoi(_limit); err != nil || limit < 1 || limit > maxLimit {
+			return 0, 0, config.NewHTTPError(c.Lang(), 400, "").SetMsg("limit must be a number between 1 and " + strconv.Itoa(maxLimit)).SetCode("invalid_parameter").SetParam("limit")
+		}
+	}
+
+	if _skip := c.Echo().QueryParam("skip"); _skip != "" {
+		if skip, err = strconv.Atoi(_skip); err != nil || skip < 0 {
+			return 0, 0, config.NewHTTPError(c.Lang(), 400, "").SetMsg("skip must be a positive number").SetCode("invalid_parameter").SetParam("skip")
+		}
+	}
+
+	return limit, skip, nil
+}
+
+// Find the currency referenced by the `id` route parameter
+func (self *ModerationController) findCurrency(c *extend.Context) (*models.CurrencyModel, error) {
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
+	currency, err := models.Currency.FindById(self.mongoSession, id)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, config.NewHTTPError(c.Lang(), 404, "e020")
+		}
+		return nil, config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return currency, nil
+}
+
+// Find the user referenced by the `id` route parameter
+func (self *ModerationController) findUser(c *extend.Context) (*models.UserModel, error) {
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e011")
+	}
+
+	user, err := models.User.FindById(self.mongoSession, id)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, config.NewHTTPError(c.Lang(), 404, "e011")
+		}
+		return nil, config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return user, nil
+}
+
+// @API: GET /v1/moderation/currencies
+//
+// @Description:
+// 	List currencies for review, most recent first. Requires the `currency:moderate` permission.
+//
+// @Query Params:
+// 	status 			String: Filter by status (e.g disputed)
+// 	currency_code 	String: Filter by currency code
+// 	denomination 	String: Filter by denomination
+// 	user_id 		String: Filter by uploader
+// 	hidden 			Bool: Filter by visibility
+// 	limit 			Int: The number of currencies to return. Default: 20, Max: 100
+// 	skip 			Int: The number of currencies to skip
+//
+// @Response 200: Array of models.CurrencyModel
+func (self *ModerationController) ListCurrencies(c *extend.Context) error {
+
+	limit, skip, err := paginationParams(c, 20, 100)
+	if err != nil {
+		return err
+	}
+
+	query := bson.M{}
+
+	if status := c.Echo().QueryParam("status"); status != "" {
+		if !util.InStringSlice(models.CurrencyStatuses, status) {
+			return config.NewHTTPError(c.Lang(), 400, "e043").SetCode("invalid_parameter").SetParam("status")
+		}
+		query["status"] = status
+	}
+
+	if curCode := c.Echo().QueryParam("currency_code"); curCode != "" {
+		query["currency_code"] = strings.ToUpper(curCode)
+	}
+
+	if denomination := c.Echo().QueryParam("denomination"); denomination != "" {
+		query["denomination"] = denomination
+	}
+
+	if userId := c.Echo().QueryParam("user_id"); userId != "" {
+		if !models.IsId(userId) {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("user_id is not valid").SetCode("invalid_parameter").SetParam("user_id")
+		}
+		query["user_id"] = bson.ObjectIdHex(userId)
+	}
+
+	if hidden := c.Echo().QueryParam("hidden"); hidden != "" {
+		query["hidden"] = hidden == "true"
+	}
+
+	currencies, err := models.Currency.Find(self.mongoSession, query, "-created_at", limit, skip)
+	if err != nil {
+		util.Println("Failed to fetch currencies. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, currencies)
+}
+
+// @API: GET /v1/moderation/currencies/:id
+//
+// @Description:
+// 	Get a currency with the details staff need to review it: the image analysis
+// 	result, votes including their source and the audit log of the currency.
+// 	Requires the `currency:moderate` permission.
+//
+// @Response 200:
+// 	currency 	Object: models.CurrencyModel
+// 	analysis 	Object: The values extracted from the currency image
+// 	votes 		Array: The votes including their ip and device fingerprint
+// 	uploader 	Object: The uploader's ip and device fingerprint
+// 	risk 		Object: The counterfeit risk score, its reasons and the review state
+// 	audit_log 	Array: Actions performed on the currency
+func (self *ModerationController) GetCurrency(c *extend.Context) error {
+
+	currency, err := self.findCurrency(c)
+	if err != nil {
+		return err
+	}
+
+	votes := []extend.H{}
+	for _, vote := range currency.Votes {
+		votes = append(votes, extend.H{
+			"user_id":     vote.UserId,
+			"decision":    vote.Decision,
+			"ip":          vote.IP,
+			"fingerprint": vote.Fingerprint,
+			"created_at":  vote.CreatedAt,
+		})
+	}
+
+	auditLog, err := models.AuditLog.Find(self.mongoSession, bson.M{
+		"target_type": models.AuditTargetCurrency,
+		"target_id":   currency.Id.Hex(),
+	}, 100, 0)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{
+		"currency": currency,
+		"analysis": currency.Analysis,
+		"votes":    votes,
+		"uploader": extend.H{
+			"ip":          currency.UploaderIP,
+			"fingerprint": currency.UploaderFingerprint,
+		},
+		"risk": extend.H{
+			"score":   currency.RiskScore,
+			"reasons": currency.RiskReasons,
+			"review":  currency.RiskReview,
+		},
+		"audit_log": auditLog,
+	})
+}
+
+// @API: PATCH /v1/moderation/currencies/:id
+//
+// @Description:
+// 	Correct the serial or denomination of a currency. The risk of the
+// 	corrected currency is scored again and it is checked against watchlists.
+// 	Requires the `currency:moderate` permission.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	serial 			{string}: The serial number (optional)
+// 	denomination 	{string}: The denomination (optional)
+// 	reason 			{string}: The reason for the change (optional)
+//
+// @Response 200: Returns models.CurrencyModel instance
+func (self *ModerationController) EditCurrency(c *extend.Context) error {
+
+	var body editCurrencyBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	currency, err := self.findCurrency(c)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{}
+	changes := map[string]interface{}{}
+	prevSerial := currency.Serial
+
+	if body.Serial != nil {
+		serial := strings.ToUpper(strings.TrimSpace(*body.Serial))
+		if serial == "" {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("serial is required").SetCode("invalid_parameter").SetParam("serial")
+		}
+		if serial != currency.Serial {
+			update["serial"] = serial
+			changes["serial"] = change(currency.Serial, serial)
+			currency.Serial = serial
+			currency.SerialPatterns = self.mint.serials.Classify(serial)
+			update["serial_patterns"] = currency.SerialPatterns
+		}
+	}
+
+	if body.Denomination != nil && *body.Denomination != currency.Denomination {
+		if !util.InStringSlice(GetCurrencyDenoms(currency.CurrencyCode), *body.Denomination) {
+			return config.NewHTTPError(c.Lang(), 400, "e005").SetCode("invalid_parameter").SetParam("denomination")
+		}
+		update["denomination"] = *body.Denomination
+		changes["denomination"] = change(currency.Denomination, *body.Denomination)
+		currency.Denomination = *body.Denomination
+	}
+
+	if len(update) == 0 {
+		return c.JSON(200, currency)
+	}
+
+	// the corrected currency must not have been indexed already
+	existing, err := models.Currency.FindCurrency(self.mongoSession, currency.CurrencyCode, currency.Denomination, currency.Serial)
+	if err != nil && err != mgo.ErrNotFound {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	} else if err == nil && existing.Id != currency.Id {
+		return config.NewHTTPError(c.Lang(), 400, "e017").SetHint(existing.Id.Hex())
+	}
+
+	if err = models.Currency.Update(self.mongoSession, currency.Id.Hex(), bson.M{"$set": update}); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditCurrencyEdit, models.AuditTargetCurrency, currency.Id.Hex(), changes, body.Reason)
+
+	// the corrected currency may match counterfeit lists, serial rules and
+	// watchlists the original did not. Currencies with the previous or the
+	// corrected serial may gain or lose a duplicate serial risk.
+	self.mint.rescore(currency)
+	go self.mint.watchlists.Check(currency, nil)
+	go self.mint.rescoreSerials(currency.CurrencyCode, prevSerial, currency.Serial)
+
+	return c.JSON(200, currency)
+}
+
+// @API: PUT /v1/moderation/currencies/:id/hidden
+//
+// @Description:
+// 	Hide or show an abusive upload. Hidden currencies are removed
+// 	from the vote queue. Requires the `currency:moderate` permission.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	hidden 	{bool}: Whether the currency is hidden
+// 	reason 	{string}: The reason for the change (optional)
+//
+// @Response 200: Returns models.CurrencyModel instance
+func (self *ModerationController) SetCurrencyHidden(c *extend.Context) error {
+
+	var body setCurrencyHiddenBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	currency, err := self.findCurrency(c)
+	if err != nil {
+		return err
+	}
+
+	if currency.Hidden == body.Hidden {
+		return c.JSON(200, currency)
+	}
+
+	if err = models.Currency.Update(self.mongoSession, currency.Id.Hex(), bson.M{"$set": bson.M{"hidden": body.Hidden}}); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	currency.Hidden = body.Hidden
+	if currency.Hidden {
+		err = models.RemoveFromVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode)
+	} else if currency.Status == "awaiting_votes" && !currency.HeldForReview() {
+		err = models.AddToVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode, currency.CreatedAt, 0)
+	}
+	if err != nil {
+		util.Println("Failed to update vote queue. ", err.Error())
+	}
+
+	action := models.AuditCurrencyUnhide
+	if currency.Hidden {
+		action = models.AuditCurrencyHide
+	}
+
+	self.audit(c, action, models.AuditTargetCurrency, currency.Id.Hex(), nil, body.Reason)
+
+	return c.JSON(200, currency)
+}
+
+// @API: PUT /v1/moderation/currencies/:id/status
+//
+// @Description:
+// 	Override the status of a currency. A currency set to `awaiting_votes`
+// 	is added back to the vote queue, any other status removes it from the queue.
+// 	Requires the `currency:moderate` permission.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	status 	{string}: The new status (awaiting_votes, verified, rejected, disputed)
+// 	reason 	{string}: The reason for the override (optional)
+//
+// @Response 200: Returns models.CurrencyModel instance
+func (self *ModerationController) SetCurrencyStatus(c *extend.Context) error {
+
+	var body setCurrencyStatusBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if !util.InStringSlice(models.CurrencyStatuses, body.Status) {
+		return config.NewHTTPError(c.Lang(), 400, "e043").SetCode("invalid_parameter").SetParam("status")
+	}
+
+	currency, err := self.findCurrency(c)
+	if err != nil {
+		return err
+	}
+
+	if currency.Status == body.Status {
+		return c.JSON(200, currency)
+	}
+
+	if err = self.changeStatus(c, currency, body.Status, body.Reason); err != nil {
+		return err
+	}
+
+	return c.JSON(200, currency)
+}
+
+// Change the status of a currency, update the vote queue and
+// let the uploader know about the change
+func (self *ModerationController) changeStatus(c *extend.Context, currency *models.CurrencyModel, status, reason string) error {
+
+	prevStatus := currency.Status
+	currency.Status = status
+	if err := models.Currency.UpdateStatus(self.mongoSession, currency.Id.Hex(), currency.Status); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditCurrencyStatus, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+		"status": change(prevStatus, currency.Status),
+	}, reason)
+
+	var err error
+	if currency.Status == "awaiting_votes" && !currency.Hidden && !currency.HeldForReview() {
+		err = models.AddToVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode, currency.CreatedAt, 0)
+	} else {
+		err = models.RemoveFromVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode)
+	}
+	if err != nil {
+		util.Println("Failed to update vote queue. ", err.Error())
+	}
+
+	self.mint.publishEvent(models.NewEvent(models.EventStatusChanged, currency.UserId.Hex(), extend.H{
+		"currency_id":     currency.Id.Hex(),
+		"previous_status": prevStatus,
+		"status":          currency.Status,
+		"reason":          reason,
+	}))
+
+	if event := "currency." + currency.Status; util.InStringSlice(models.WebhookEvents, event) {
+		go self.mint.webhooks.Dispatch(currency.UserId.Hex(), event, currency)
+	}
+
+	return nil
+}
+
+// @API: DELETE /v1/moderation/currencies/:id
+//
+// @Description:
+// 	Delete a currency, its images and remove it from the vote queue.
+// 	Requires the `currency:delete` permission.
+//
+// @Query Params:
+// 	reason 	String: The reason for the deletion (optional)
+//
+// @Response 200:
+func (self *ModerationController) DeleteCurrency(c *extend.Context) error {
+
+	currency, err := self.findCurrency(c)
+	if err != nil {
+		return err
+	}
+
+	if err = models.Currency.Delete(self.mongoSession, currency.Id.Hex()); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.RemoveFromVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode); err != nil {
+		util.Println("Failed to remove currency from vote queue. ", err.Error())
+	}
+
+	if err = models.Sighting.DeleteByCurrency(self.mongoSession, currency.Id.Hex()); err != nil {
+		util.Println("Failed to delete currency sightings. ", err.Error())
+	}
+
+	go self.mint.DeleteImage(path.Base(currency.ImageURL))
+	go self.mint.DeleteImage(path.Base(currency.OriginalImageURL))
+
+	self.audit(c, models.AuditCurrencyDelete, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+		"user_id":       currency.UserId.Hex(),
+		"currency_code": currency.CurrencyCode,
+		"denomination":  currency.Denomination,
+		"serial":        currency.Serial,
+		"status":        currency.Status,
+	}, c.Echo().QueryParam("reason"))
+
+	return c.JSON(200, extend.H{"id": currency.Id.Hex()})
+}
+
+// @API: PUT /v1/moderation/users/:id/ban
+//
+// @Description:
+// 	Ban a user. Banned users cannot authenticate and their sessions are revoked.
+// 	Requires the `user:ban` permission. Admins cannot be banned and banning
+// 	a user with a role also requires the `user:roles` permission.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	reason 	{string}: The reason for the ban (optional)
+//
+// @Response 200: Returns models.UserModel instance
+func (self *ModerationController) BanUser(c *extend.Context) error {
+
+	var body banUserBody
+	if c.Request().ContentLength() > 0 && c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	user, err := self.findUser(c)
+	if err != nil {
+		return err
+	}
+
+	if user.Id.Hex() == c.Get("auth_user") || util.InStringSlice(user.Roles, models.RoleAdmin) {
+		return config.NewHTTPError(c.Lang(), 403, "e042")
+	}
+
+	// staff can only be banned by those who can change their roles
+	if len(user.Roles) > 0 && !models.RolesHavePermission(strings.Split(c.Get("auth_roles"), ","), models.PermManageRoles) {
+		return config.NewHTTPError(c.Lang(), 403, "e042")
+	}
+
+	body.Reason = strings.TrimSpace(body.Reason)
+	if err = models.User.SetBanned(self.mongoSession, user.Id.Hex(), true, body.Reason); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.RefreshToken.RevokeAllForUser(self.mongoSession, user.Id.Hex()); err != nil {
+		util.Println("Failed to revoke refresh tokens of banned user. ", err.Error())
+	}
+
+	if err = models.RevokeUserTokens(self.redisPool, user.Id.Hex(), AccessTokenTTL()); err != nil {
+		util.Println("Failed to revoke access tokens of banned user. ", err.Error())
+	}
+
+	self.audit(c, models.AuditUserBan, models.AuditTargetUser, user.Id.Hex(), nil, body.Reason)
+
+	user.Banned = true
+	user.BanReason = body.Reason
+	user.AccessToken = ""
+	user.AccessSecret = ""
+
+	return c.JSON(200, user)
+}
+
+// @API: DELETE /v1/moderation/users/:id/ban
+// @Description: Lift the ban of a user. Requires the `user:ban` permission.
+func (self *ModerationController) UnbanUser(c *extend.Context) error {
+
+	user, err := self.findUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err = models.User.SetBanned(self.mongoSession, user.Id.Hex(), false, ""); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditUserUnban, models.AuditTargetUser, user.Id.Hex(), nil, "")
+
+	user.Banned = false
+	user.BanReason = ""
+	user.AccessToken = ""
+	user.AccessSecret = ""
+
+	return c.JSON(200, user)
+}
+
+// @API: PUT /v1/admin/users/:id/roles
+//
+// @Description:
+// 	Set the roles of a user. Requires the `user:roles` permission.
+// 	Admins cannot remove their own admin role.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	roles 	{Array[string]}: The roles of the user (admin, moderator)
+//
+// @Response 200: Returns models.UserModel instance
+func (self *ModerationController) SetUserRoles(c *extend.Context) error {
+
+	var body setRolesBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	roles := []string{}
+	for _, role := range body.Roles {
+		if !util.InStringSlice(models.Roles, role) {
+			return config.NewHTTPError(c.Lang(), 400, "e044").SetCode("invalid_parameter").SetParam("roles").SetHint(role)
+		}
+		if !util.InStringSlice(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	user, err := self.findUser(c)
+	if err != nil {
+		return err
+	}
+
+	if user.Id.Hex() == c.Get("auth_user") && !util.InStringSlice(roles, models.RoleAdmin) {
+		return config.NewHTTPError(c.Lang(), 403, "e042")
+	}
+
+	if err = models.User.SetRoles(self.mongoSession, user.Id.Hex(), roles); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditUserRoles, models.AuditTargetUser, user.Id.Hex(), map[string]interface{}{
+		"roles": change(user.Roles, roles),
+	}, "")
+
+	user.Roles = roles
+	user.AccessToken = ""
+	user.AccessSecret = ""
+
+	return c.JSON(200, user)
+}
+
+// Grant a role to a user. Used to create the first admin
+// from the command line. Returns false if the user has the role.
+func GrantRole(mongoSession *mgo.Session, userId, role string) (bool, error) {
+
+	if !util.InStringSlice(models.Roles, role) {
+		return false, fmt.Errorf("unknown role %q", role)
+	}
+
+	if !models.IsId(userId) {
+		return false, fmt.Errorf("invalid user id %q", userId)
+	}
+
+	user, err := models.User.FindById(mongoSession, userId)
+	if err != nil {
+		return false, err
+	}
+
+	if util.InStringSlice(user.Roles, role) {
+		return false, nil
+	}
+
+	roles := append(append([]string{}, user.Roles...), role)
+	if err = models.User.SetRoles(mongoSession, userId, roles); err != nil {
+		return false, err
+	}
+
+	recordAudit(mongoSession, nil, models.AuditUserRoles, models.AuditTargetUser, userId, map[string]interface{}{
+		"roles": change(user.Roles, roles),
+	}, "granted from the command line")
+
+	return true, nil
+}
+
+// @API: GET /v1/moderation/audit_log
+//
+// @Description:
+// 	Get the audit log, most recent first. Requires the `currency:moderate` permission.
+//
+// @Query Params:
+// 	target_type 	String: Filter by target type (currency, user)
+// 	target_id 		String: Filter by target id
+// 	actor_id 		String: Filter by the staff member who performed the action
+// 	action 			String: Filter by action (e.g currency.status)
+// 	limit 			Int: The number of entries to return. Default: 50, Max: 200
+// 	skip 			Int: The number of entries to skip
+//
+// @Response 200: Array of models.AuditLogModel
+func (self *ModerationController) GetAuditLog(c *extend.Context) error {
+
+	limit, skip, err := paginationParams(c, 50, 200)
+	if err != nil {
+		return err
+	}
+
+	query := bson.M{}
+	for _, field := range []string{"target_type", "target_id", "action"} {
+		if value := c.Echo().QueryParam(field); value != "" {
+			query[field] = value
+		}
+	}
+
+	if actorId := c.Echo().QueryParam("actor_id"); actorId != "" {
+		if !models.IsId(actorId) {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("actor_id is not valid").SetCode("invalid_parameter").SetParam("actor_id")
+		}
+		query["actor_id"] = bson.ObjectIdHex(actorId)
+	}
+
+	entries, err := models.AuditLog.Find(self.mongoSession, query, limit, skip)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, entries)
+}
+
+// @API: GET /v1/admin/currencies/export
+//
+// @Description:
+// 	Export the currencies of all users as an attachment. Currencies are streamed
+// 	oldest first. Requires the `currency:export` permission.
+//
+// @Query Params:
+// 	format 			String: The export format (csv, json or ndjson). Default: csv
+// 	user_id 		String: Filter by uploader
+// 	currency_code 	String: Filter by currency code
+// 	denomination 	String: Filter by denomination
+// 	status 			String: Filter by status
+// 	tag 			String: Filter by tag
+// 	collection 		String: Filter by collection id
+// 	serial_pattern 	String: Filter by serial pattern (e.g radar, repeater, ladder, solid, low)
+// 	from 			Date: Only export currencies indexed on or after the date
+// 	to 				Date: Only export currencies indexed before the date
+//
+// @Response 200: The currencies in the requested format
+func (self *ModerationController) ExportCurrencies(c *extend.Context) error {
+
+	format, err := exportFormatParam(c)
+	if err != nil {
+		return err
+	}
+
+	userId := c.Echo().QueryParam("user_id")
+	if userId != "" && !bson.IsObjectIdHex(userId) {
+		return config.NewHTTPError(c.Lang(), 400, "e011").SetCode("invalid_parameter").SetParam("user_id")
+	}
+
+	filter, err := currencyFilterParams(c, userId)
+	if err != nil {
+		return err
+	}
+
+	self.audit(c, models.AuditCurrencyExport, models.AuditTargetCurrency, "", map[string]interface{}{
+		"format":  format,
+		"user_id": userId,
+	}, "")
+
+	return streamCurrencyExport(c, self.mongoSession, filter, format, true)
+}
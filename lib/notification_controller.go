@@ -0,0 +1,95 @@
+// This controller provides the in-app notification feed of a user
+package lib
+
+import (
+	"strconv"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type markNotificationsReadBody struct {
+	Ids []string `json:"ids"`
+}
+
+type NotificationController struct {
+	mongoSession *mgo.Session
+}
+
+// Create a new controller instance
+func NewNotificationController(mongoSession *mgo.Session) *NotificationController {
+	return &NotificationController{mongoSession}
+}
+
+// @API: GET /v1/users/notifications
+//
+// @Description:
+// 	Get the notifications of the authenticated user, most recent first.
+// 	The number of unread notifications is returned in the `X-Unread-Count` header.
+//
+// @Query Params:
+// 	unread 	Bool: Only return unread notifications
+// 	limit 	Int: The number of notifications to return. Default: 20, Max: 100
+// 	skip 	Int: The number of notifications to skip
+//
+// @Response 200: Array of models.NotificationModel
+func (self *NotificationController) List(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+
+	limit, skip, err := paginationParams(c, 20, 100)
+	if err != nil {
+		return err
+	}
+
+	notifications, err := models.Notification.FindByUser(self.mongoSession, authUserId, c.Echo().QueryParam("unread") == "true", limit, skip)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	unread, err := models.Notification.CountUnread(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	c.Response().Header().Set("X-Unread-Count", strconv.Itoa(unread))
+	return c.JSON(200, notifications)
+}
+
+// @API: PUT /v1/users/notifications/read
+//
+// @Description:
+// 	Mark notifications of the authenticated user as read
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	ids 	{Array[string]}: The ids of the notifications. All notifications are marked as read if not set (optional)
+//
+// @Response 200:
+// 	updated 	Int: The number of notifications marked as read
+func (self *NotificationController) MarkRead(c *extend.Context) error {
+
+	var body markNotificationsReadBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	ids := []bson.ObjectId{}
+	for _, id := range body.Ids {
+		if !models.IsId(id) {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("ids must be notification ids").SetCode("invalid_parameter").SetParam("ids")
+		}
+		ids = append(ids, bson.ObjectIdHex(id))
+	}
+
+	updated, err := models.Notification.MarkRead(self.mongoSession, c.Get("auth_user"), ids)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"updated": updated})
+}
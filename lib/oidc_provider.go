@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var errUnknownSigningKey = errors.New("unknown signing key")
+
+// The minimum time between JWKS refreshes caused by unknown key ids
+const OIDC_JWKS_MIN_REFRESH_INTERVAL = 5 * time.Minute
+
+// OIDC verifies ID tokens issued by an OpenID Connect provider (e.g Google, Apple).
+// The provider's keys are found using OpenID Connect discovery.
+type OIDCProvider struct {
+	name          string
+	issuer        string
+	clientIds     []string
+	client        *http.Client
+	mtx           sync.Mutex
+	jwksURI       string
+	keys          map[string]interface{}
+	lastRefreshed time.Time
+}
+
+type oidcDiscoveryDocument struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// Create an OIDC provider. ID tokens must be issued by
+// the issuer to one of the client ids.
+func NewOIDCProvider(name, issuer string, clientIds []string) *OIDCProvider {
+	return &OIDCProvider{
+		name:      name,
+		issuer:    strings.TrimRight(issuer, "/"),
+		clientIds: clientIds,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		keys:      map[string]interface{}{},
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+// Decode a json response
+func (p *OIDCProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected response status from %s: %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Fetch the discovery document and the provider's keys
+func (p *OIDCProvider) refreshKeys() error {
+
+	if p.jwksURI == "" {
+		var doc oidcDiscoveryDocument
+		if err := p.getJSON(p.issuer+"/.well-known/openid-configuration", &doc); err != nil {
+			return err
+		}
+		if strings.TrimRight(doc.Issuer, "/") != p.issuer {
+			return fmt.Errorf("discovery document issuer %q does not match %q", doc.Issuer, p.issuer)
+		}
+		if doc.JWKSURI == "" {
+			return errors.New("discovery document has no jwks_uri")
+		}
+		p.jwksURI = doc.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := p.getJSON(p.jwksURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range jwks.Keys {
+		kid, _ := jwk["kid"].(string)
+		if use, _ := jwk["use"].(string); use != "" && use != "sig" {
+			continue
+		}
+		if key, err := ParsePublicJWK(jwk); err == nil {
+			keys[kid] = key
+		}
+	}
+
+	p.keys = keys
+	p.lastRefreshed = time.Now()
+	return nil
+}
+
+// Get the key with the given id. The keys are refreshed when the key is
+// unknown since providers rotate their keys.
+func (p *OIDCProvider) getKey(kid string) (interface{}, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.lastRefreshed) < OIDC_JWKS_MIN_REFRESH_INTERVAL {
+		return nil, errUnknownSigningKey
+	}
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errUnknownSigningKey
+}
+
+// Check whether the audience of a token includes one of the client ids
+func (p *OIDCProvider) isValidAudience(aud interface{}) bool {
+	var audiences []string
+	switch v := aud.(type) {
+	case string:
+		audiences = []string{v}
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	for _, a := range audiences {
+		for _, clientId := range p.clientIds {
+			if a == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Verify an ID token. The token is taken from the credential's
+// IdToken or from its AccessToken if no ID token is given. The
+// token's nonce must match the credential's nonce if one is given.
+func (p *OIDCProvider) Verify(credential *ProviderCredential) (*ProviderIdentity, error) {
+
+	idToken := credential.IdToken
+	if idToken == "" {
+		idToken = credential.AccessToken
+	}
+
+	// errors fetching the provider's keys are not credential errors
+	var fetchErr error
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.getKey(kid)
+		if err != nil && err != errUnknownSigningKey {
+			fetchErr = err
+		}
+		return key, err
+	})
+
+	if fetchErr != nil {
+		return nil, fetchErr
+	} else if err != nil {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != p.issuer {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	if !p.isValidAudience(claims["aud"]) {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	if _, hasExp := claims["exp"]; !hasExp {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	// the nonce binds the token to the client's sign in request
+	if credential.Nonce != "" {
+		if nonce, _ := claims["nonce"].(string); nonce != credential.Nonce {
+			return nil, ErrInvalidProviderCredential
+		}
+	}
+
+	identity := &ProviderIdentity{
+		ProviderUserId: jsonStringField(claims, "sub"),
+		Email:          jsonStringField(claims, "email"),
+		Fullname:       jsonStringField(claims, "name"),
+		PhotoURL:       jsonStringField(claims, "picture"),
+	}
+
+	// some providers (e.g Apple) send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string:
+		identity.EmailVerified = v == "true"
+	}
+
+	if identity.ProviderUserId == "" {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	if credential.ProviderUserId != "" && credential.ProviderUserId != identity.ProviderUserId {
+		return nil, ErrInvalidProviderCredential
+	}
+
+	return identity, nil
+}
+
+// Decode a base64url encoded JWK field
+func decodeJWKField(jwk map[string]interface{}, field string) (*big.Int, error) {
+	s, _ := jwk[field].(string)
+	if s == "" {
+		return nil, fmt.Errorf("jwk: %s is required", field)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("jwk: invalid %s", field)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Parse an RSA or P-256 EC public key from a JSON Web Key
+func ParsePublicJWK(jwk map[string]interface{}) (interface{}, error) {
+	switch jwk["kty"] {
+	case "RSA":
+		n, err := decodeJWKField(jwk, "n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKField(jwk, "e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk["crv"] != "P-256" {
+			return nil, errors.New("jwk: unsupported curve")
+		}
+		x, err := decodeJWKField(jwk, "x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKField(jwk, "y")
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("jwk: point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, errors.New("jwk: unsupported key type")
+}
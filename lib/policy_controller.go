@@ -3,33 +3,40 @@
 package lib
 
 import (
-	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/ellcrys/openmint/config"
 	"github.com/ellcrys/openmint/extend"
 	"github.com/ellcrys/openmint/models"
 	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
 	"gopkg.in/mgo.v2"
 )
 
 type PolicyController struct {
 	mongoSession *mgo.Session
+	redisPool    *redis.Pool
 }
 
 // Create a new controller instance
-func NewPolicyController(mgoSession *mgo.Session) *PolicyController {
-	return &PolicyController{mgoSession}
+func NewPolicyController(mgoSession *mgo.Session, redisPool *redis.Pool) *PolicyController {
+	return &PolicyController{mgoSession, redisPool}
 }
 
 // Authenticate policy.
-// Ensures a valid bear/session token is included in the request.
+// Ensures a valid bear/session token or API key is included in the request.
 // If token is valid, `auth_user` context data storage will hold
-// the authenticated user id.
+// the authenticated user id, `auth_roles` the user's roles
+// and `auth_token_id` will hold the token id. Banned users are rejected.
+// For API keys, `auth_api_key` holds the key id and `auth_scopes` its scopes.
 func (self *PolicyController) Authenticate(c *extend.Context) error {
 
+	if apiKey := c.GetAPIKey(); apiKey != "" {
+		return self.authenticateAPIKey(c, apiKey)
+	}
+
 	authorization := c.GetAuthorization()
 	if authorization == "" {
 		return config.NewHTTPError(c.Lang(), 401, "e012")
@@ -40,33 +47,45 @@ func (self *PolicyController) Authenticate(c *extend.Context) error {
 		return config.NewHTTPError(c.Lang(), 401, "e013")
 	}
 
-	token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return []byte(config.C.GetString("hmac_key")), nil
-	})
+	if IsAPIKey(parts[1]) {
+		return self.authenticateAPIKey(c, parts[1])
+	}
 
+	claims, err := ParseAccessToken(parts[1])
 	if err != nil {
 		return config.NewHTTPError(c.Lang(), 401, "e014")
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return config.NewHTTPError(c.Lang(), 401, "e014")
+	id := claims["id"].(string)
+	jti, _ := claims["jti"].(string)
+	iat := AccessTokenIssuedAt(claims)
+
+	// check if the token has been revoked
+	if jti != "" {
+		denied, err := models.IsTokenDenied(self.redisPool, jti)
+		if err != nil {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		if denied {
+			return config.NewHTTPError(c.Lang(), 401, "e014")
+		}
 	}
 
-	iat := claims["iat"].(float64)
-	id := claims["id"].(string)
+	// check if all tokens of the user issued before this token were revoked
+	revokedAt, err := models.GetUserTokensRevokedAt(self.redisPool, id)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
 
-	// check if expired
-	iatExpiryTime := util.UnixToTime(util.ToInt64(iat)).AddDate(0, 3, 0).UTC()
-	if iatExpiryTime.Before(time.Now().UTC()) {
+	if models.IsTokenRevokedAt(iat, revokedAt) {
 		return config.NewHTTPError(c.Lang(), 401, "e014")
 	}
 
 	// fetch user
+	if !models.IsId(id) {
+		return config.NewHTTPError(c.Lang(), 401, "e014")
+	}
+
 	user, err := models.User.FindById(self.mongoSession, id)
 	if err != nil {
 		if err == mgo.ErrNotFound {
@@ -76,7 +95,129 @@ func (self *PolicyController) Authenticate(c *extend.Context) error {
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
+	if user.Banned {
+		return config.NewHTTPError(c.Lang(), 403, "e041")
+	}
+
 	c.Set("auth_user", user.Id.Hex())
+	c.Set("auth_roles", strings.Join(user.Roles, ","))
+	c.Set("auth_token_id", jti)
+	c.Set("auth_token_exp", strconv.FormatInt(time.Now().Add(AccessTokenTimeLeft(claims)).Unix(), 10))
+	c.Set("auth_api_key", "")
+	c.Set("auth_scopes", "")
+
+	return nil
+}
+
+// Authenticate a request made with an API key. Requests are
+// counted against the key's per minute rate limit.
+func (self *PolicyController) authenticateAPIKey(c *extend.Context, key string) error {
+
+	apiKey, err := models.APIKey.FindByHash(self.mongoSession, HashAPIKey(key))
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 401, "e035")
+		}
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if apiKey.Revoked {
+		return config.NewHTTPError(c.Lang(), 401, "e035")
+	}
+
+	count, resetAt, err := models.IncrRateCounter(self.redisPool, "api_key_"+apiKey.Id.Hex(), time.Minute)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	remaining := apiKey.RateLimit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	header := c.Response().Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(apiKey.RateLimit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+
+	if count > apiKey.RateLimit {
+		return config.NewHTTPError(c.Lang(), 429, "e036")
+	}
+
+	user, err := models.User.FindById(self.mongoSession, apiKey.UserId.Hex())
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 401, "e035")
+		}
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if user.Banned {
+		return config.NewHTTPError(c.Lang(), 403, "e041")
+	}
+
+	// last use is recorded at most once a minute
+	if time.Since(apiKey.LastUsedAt) > time.Minute {
+		go func(id, ip string) {
+			if err := models.APIKey.UpdateLastUsed(self.mongoSession, id, ip, time.Now().UTC()); err != nil {
+				util.Println("Failed to update api key last use. ", err.Error())
+			}
+		}(apiKey.Id.Hex(), c.RealIP())
+	}
+
+	c.Set("auth_user", apiKey.UserId.Hex())
+	c.Set("auth_roles", "")
+	c.Set("auth_token_id", "")
+	c.Set("auth_token_exp", "")
+	c.Set("auth_api_key", apiKey.Id.Hex())
+	c.Set("auth_scopes", strings.Join(apiKey.Scopes, ","))
 
 	return nil
 }
+
+// Scope policy.
+// Requests authenticated with an API key must have one of the scopes.
+// API keys are rejected when no scope is given. Session tokens have every scope.
+func (self *PolicyController) RequireScope(scopes ...string) extend.HandlerFunc {
+	return func(c *extend.Context) error {
+		if c.Get("auth_api_key") == "" {
+			return nil
+		}
+		granted := strings.Split(c.Get("auth_scopes"), ",")
+		for _, scope := range scopes {
+			if util.InStringSlice(granted, scope) {
+				return nil
+			}
+		}
+		return config.NewHTTPError(c.Lang(), 403, "e037")
+	}
+}
+
+// Role policy.
+// Requires the authenticated user to have one of the roles.
+// Roles are not granted to requests made with API keys.
+func (self *PolicyController) RequireRole(roles ...string) extend.HandlerFunc {
+	return func(c *extend.Context) error {
+		userRoles := strings.Split(c.Get("auth_roles"), ",")
+		for _, role := range roles {
+			if util.InStringSlice(userRoles, role) {
+				return nil
+			}
+		}
+		return config.NewHTTPError(c.Lang(), 403, "e042")
+	}
+}
+
+// Permission policy.
+// Requires one of the roles of the authenticated user to grant all the permissions.
+func (self *PolicyController) RequirePermission(permissions ...string) extend.HandlerFunc {
+	return func(c *extend.Context) error {
+		userRoles := strings.Split(c.Get("auth_roles"), ",")
+		for _, permission := range permissions {
+			if !models.RolesHavePermission(userRoles, permission) {
+				return config.NewHTTPError(c.Lang(), 403, "e042")
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,428 @@
+// This file contains the moderation actions for currencies held
+// for a counterfeit risk review and the admin actions that manage
+// the known counterfeit serials and serial rules of a currency
+package lib
+
+import (
+	"strings"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The maximum number of serials in a counterfeit import
+const MAX_COUNTERFEIT_IMPORT = 1000
+
+// Risk review decisions
+const (
+	RiskDecisionClear       = "clear"
+	RiskDecisionCounterfeit = "counterfeit"
+)
+
+type reviewRiskBody struct {
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+}
+
+type counterfeitSerialBody struct {
+	Serial       string `json:"serial"`
+	Denomination string `json:"denomination"`
+}
+
+type importCounterfeitsBody struct {
+	Source  string                  `json:"source"`
+	Serials []counterfeitSerialBody `json:"serials"`
+}
+
+type serialRuleBody struct {
+	Denomination string               `json:"denomination"`
+	Format       string               `json:"format"`
+	Ranges       []models.SerialRange `json:"ranges"`
+}
+
+type setSerialRulesBody struct {
+	Rules []serialRuleBody `json:"rules"`
+}
+
+// Get the currency code referenced by the `currency_code` route parameter
+func riskCurrencyCode(c *extend.Context) (string, error) {
+	curCode := strings.ToUpper(c.Param("currency_code"))
+	if !util.InStringSlice(GetDefinedCurrencies(), curCode) {
+		return "", config.NewHTTPError(c.Lang(), 400, "e009")
+	}
+	return curCode, nil
+}
+
+// @API: GET /v1/moderation/risk
+//
+// @Description:
+// 	List currencies held for a counterfeit risk review, riskiest first.
+// 	Requires the `currency:moderate` permission.
+//
+// @Query Params:
+// 	currency_code 	String: Filter by currency code
+// 	limit 			Int: The number of currencies to return. Default: 20, Max: 100
+// 	skip 			Int: The number of currencies to skip
+//
+// @Response 200: Array of objects
+// 	currency 		Object: models.CurrencyModel
+// 	risk_score 		Int: The risk score of the currency (0 - 100)
+// 	risk_reasons 	Array: The reasons the currency may be counterfeit
+func (self *ModerationController) ListRiskReview(c *extend.Context) error {
+
+	limit, skip, err := paginationParams(c, 20, 100)
+	if err != nil {
+		return err
+	}
+
+	query := bson.M{"risk_review": models.RiskReviewPending}
+	if curCode := c.Echo().QueryParam("currency_code"); curCode != "" {
+		query["currency_code"] = strings.ToUpper(curCode)
+	}
+
+	currencies, err := models.Currency.Find(self.mongoSession, query, "-risk_score", limit, skip)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	results := []extend.H{}
+	for _, currency := range currencies {
+		results = append(results, extend.H{
+			"currency":     currency,
+			"risk_score":   currency.RiskScore,
+			"risk_reasons": currency.RiskReasons,
+		})
+	}
+
+	return c.JSON(200, results)
+}
+
+// @API: PUT /v1/moderation/currencies/:id/risk
+//
+// @Description:
+// 	Review a currency held for a counterfeit risk review. A cleared currency
+// 	returns to the vote queue if it is awaiting votes. A counterfeit currency is
+// 	rejected and its serial is added to the known counterfeit serials.
+// 	Requires the `currency:moderate` permission.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	decision 	{string}: The decision (clear, counterfeit)
+// 	reason 		{string}: The reason for the decision (optional)
+//
+// @Response 200: Returns models.CurrencyModel instance
+func (self *ModerationController) ReviewRisk(c *extend.Context) error {
+
+	var body reviewRiskBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if body.Decision != RiskDecisionClear && body.Decision != RiskDecisionCounterfeit {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("decision must be clear or counterfeit").SetCode("invalid_parameter").SetParam("decision")
+	}
+
+	currency, err := self.findCurrency(c)
+	if err != nil {
+		return err
+	}
+
+	if !currency.HeldForReview() {
+		return config.NewHTTPError(c.Lang(), 400, "e053")
+	}
+
+	review := models.RiskReviewCleared
+	if body.Decision == RiskDecisionCounterfeit {
+		review = models.RiskReviewConfirmed
+	}
+
+	if err = models.Currency.SetRisk(self.mongoSession, currency.Id.Hex(), currency.RiskScore, currency.RiskReasons, review); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditCurrencyRiskReview, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+		"risk_review": change(currency.RiskReview, review),
+	}, body.Reason)
+
+	currency.RiskReview = review
+
+	if body.Decision == RiskDecisionClear {
+		if currency.Status == "awaiting_votes" && !currency.Hidden {
+			if err = models.AddToVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode, currency.CreatedAt, 0); err != nil {
+				util.Println("Failed to update vote queue. ", err.Error())
+			}
+		}
+		return c.JSON(200, currency)
+	}
+
+	if _, err = models.CounterfeitSerial.Import(self.mongoSession, []models.CounterfeitSerialModel{{
+		CurrencyCode: currency.CurrencyCode,
+		Denomination: currency.Denomination,
+		Serial:       currency.Serial,
+		Source:       "moderation",
+		ImportedBy:   bson.ObjectIdHex(c.Get("auth_user")),
+	}}); err != nil {
+		util.Println("Failed to add counterfeit serial. ", err.Error())
+	}
+
+	if currency.Status != "rejected" {
+		if err = self.changeStatus(c, currency, "rejected", body.Reason); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(200, currency)
+}
+
+// @API: POST /v1/admin/counterfeits/:currency_code
+//
+// @Description:
+// 	Import known counterfeit serials of a currency. Serials already known are
+// 	ignored. Indexed currencies with an imported serial are scored again.
+// 	Requires the `risk:manage` permission.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	source 		{string}: Where the serials come from (optional)
+// 	serials 	{Array[Object]}: The serials (max 1000)
+// 		serial 			{string}: The serial
+// 		denomination 	{string}: The denomination. Applies to every denomination if not set
+//
+// @Response 200:
+// 	received 	Int: The number of serials received
+// 	added 		Int: The number of serials added to the list
+func (self *ModerationController) ImportCounterfeits(c *extend.Context) error {
+
+	curCode, err := riskCurrencyCode(c)
+	if err != nil {
+		return err
+	}
+
+	var body importCounterfeitsBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if len(body.Serials) == 0 || len(body.Serials) > MAX_COUNTERFEIT_IMPORT {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("serials must contain between 1 and 1000 serials").SetCode("invalid_parameter").SetParam("serials")
+	}
+
+	denoms := GetCurrencyDenoms(curCode)
+	source := strings.TrimSpace(body.Source)
+	importedBy := bson.ObjectIdHex(c.Get("auth_user"))
+	serials := []models.CounterfeitSerialModel{}
+	numbers := []string{}
+
+	for _, s := range body.Serials {
+		serial := strings.ToUpper(strings.TrimSpace(s.Serial))
+		if serial == "" {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("serial is required").SetCode("invalid_parameter").SetParam("serials")
+		}
+		denomination := strings.TrimSpace(s.Denomination)
+		if denomination != "" && !util.InStringSlice(denoms, denomination) {
+			return config.NewHTTPError(c.Lang(), 400, "e005").SetCode("invalid_parameter").SetParam("serials")
+		}
+		serials = append(serials, models.CounterfeitSerialModel{
+			CurrencyCode: curCode,
+			Denomination: denomination,
+			Serial:       serial,
+			Source:       source,
+			ImportedBy:   importedBy,
+		})
+		numbers = append(numbers, serial)
+	}
+
+	added, err := models.CounterfeitSerial.Import(self.mongoSession, serials)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditCounterfeitImport, models.AuditTargetCurrencyCode, curCode, map[string]interface{}{
+		"source":   source,
+		"received": len(serials),
+		"added":    added,
+	}, "")
+
+	if added > 0 {
+		go func() {
+			if _, err := self.mint.risk.RescoreSerials(curCode, numbers); err != nil {
+				util.Println("Failed to score currency risk. ", err.Error())
+			}
+		}()
+	}
+
+	return c.JSON(200, extend.H{
+		"received": len(serials),
+		"added":    added,
+	})
+}
+
+// @API: GET /v1/admin/counterfeits/:currency_code
+//
+// @Description:
+// 	List the known counterfeit serials of a currency, most recent first.
+// 	Requires the `risk:manage` permission.
+//
+// @Query Params:
+// 	limit 	Int: The number of serials to return. Default: 50, Max: 500
+// 	skip 	Int: The number of serials to skip
+//
+// @Response 200: Array of models.CounterfeitSerialModel
+func (self *ModerationController) ListCounterfeits(c *extend.Context) error {
+
+	curCode, err := riskCurrencyCode(c)
+	if err != nil {
+		return err
+	}
+
+	limit, skip, err := paginationParams(c, 50, 500)
+	if err != nil {
+		return err
+	}
+
+	serials, err := models.CounterfeitSerial.FindByCurrency(self.mongoSession, curCode, limit, skip)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, serials)
+}
+
+// @API: DELETE /v1/admin/counterfeits/:currency_code/:id
+//
+// @Description:
+// 	Remove a serial from the known counterfeit serials of a currency. The risk of
+// 	indexed currencies is kept. Requires the `risk:manage` permission.
+//
+// @Response 200:
+func (self *ModerationController) DeleteCounterfeit(c *extend.Context) error {
+
+	curCode, err := riskCurrencyCode(c)
+	if err != nil {
+		return err
+	}
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return config.NewHTTPError(c.Lang(), 404, "e054")
+	}
+
+	if err = models.CounterfeitSerial.Delete(self.mongoSession, curCode, id); err != nil {
+		if err == mgo.ErrNotFound {
+			return config.NewHTTPError(c.Lang(), 404, "e054")
+		}
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditCounterfeitDelete, models.AuditTargetCurrencyCode, curCode, map[string]interface{}{
+		"id": id,
+	}, "")
+
+	return c.JSON(200, extend.H{"id": id})
+}
+
+// @API: GET /v1/admin/serial_rules/:currency_code
+// @Description: Get the serial rules of a currency. Requires the `risk:manage` permission.
+// @Response 200: Array of models.SerialRuleModel
+func (self *ModerationController) GetSerialRules(c *extend.Context) error {
+
+	curCode, err := riskCurrencyCode(c)
+	if err != nil {
+		return err
+	}
+
+	rules, err := models.SerialRule.FindByCurrency(self.mongoSession, curCode)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, rules)
+}
+
+// @API: PUT /v1/admin/serial_rules/:currency_code
+//
+// @Description:
+// 	Replace the serial rules of a currency. Serials of newly indexed or sighted
+// 	currencies that do not match the format of their denomination, or fall outside
+// 	its ranges, raise the risk score of the currency. Requires the `risk:manage` permission.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	rules 	{Array[Object]}: One rule per denomination
+// 		denomination 	{string}: The denomination
+// 		format 			{string}: A regular expression the whole serial must match (optional)
+// 		ranges 			{Array[Object]}: The issued serial ranges (optional)
+// 			prefix 		{string}: The prefix of the serials
+// 			from 		{int}: The lowest number
+// 			to 			{int}: The highest number
+//
+// @Response 200: Array of models.SerialRuleModel
+func (self *ModerationController) SetSerialRules(c *extend.Context) error {
+
+	curCode, err := riskCurrencyCode(c)
+	if err != nil {
+		return err
+	}
+
+	var body setSerialRulesBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	denoms := GetCurrencyDenoms(curCode)
+	seen := []string{}
+	rules := []models.SerialRuleModel{}
+
+	for _, r := range body.Rules {
+		denomination := strings.TrimSpace(r.Denomination)
+		if !util.InStringSlice(denoms, denomination) {
+			return config.NewHTTPError(c.Lang(), 400, "e005").SetCode("invalid_parameter").SetParam("rules")
+		} else if util.InStringSlice(seen, denomination) {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("denomination " + denomination + " has more than one rule").SetCode("invalid_parameter").SetParam("rules")
+		}
+		seen = append(seen, denomination)
+
+		format := strings.TrimSpace(r.Format)
+		if format != "" {
+			if _, err := compileSerialFormat(format); err != nil {
+				return config.NewHTTPError(c.Lang(), 400, "").SetMsg("format of denomination " + denomination + " is not a valid regular expression").SetCode("invalid_parameter").SetParam("rules")
+			}
+		}
+
+		ranges := []models.SerialRange{}
+		for _, rng := range r.Ranges {
+			if rng.From > rng.To {
+				return config.NewHTTPError(c.Lang(), 400, "").SetMsg("range from must not be greater than to").SetCode("invalid_parameter").SetParam("rules")
+			}
+			rng.Prefix = strings.ToUpper(strings.TrimSpace(rng.Prefix))
+			ranges = append(ranges, rng)
+		}
+
+		if format == "" && len(ranges) == 0 {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("rule of denomination " + denomination + " needs a format or ranges").SetCode("invalid_parameter").SetParam("rules")
+		}
+
+		rules = append(rules, models.SerialRuleModel{
+			Denomination: denomination,
+			Format:       format,
+			Ranges:       ranges,
+		})
+	}
+
+	if err = models.SerialRule.Replace(self.mongoSession, curCode, rules); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	self.audit(c, models.AuditSerialRules, models.AuditTargetCurrencyCode, curCode, map[string]interface{}{
+		"denominations": seen,
+	}, "")
+
+	return c.JSON(200, rules)
+}
@@ -0,0 +1,274 @@
+// The risk scorer estimates how likely an indexed currency is
+// counterfeit and holds risky currencies for a moderator review
+package lib
+
+import (
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The scores of risk reasons
+const (
+	RISK_SCORE_KNOWN_COUNTERFEIT     = 100
+	RISK_SCORE_SERIAL_FORMAT         = 40
+	RISK_SCORE_SERIAL_RANGE          = 30
+	RISK_SCORE_DENOMINATION_MISMATCH = 50
+	RISK_SCORE_DUPLICATE_SERIAL      = 40
+	RISK_SCORE_IMPOSSIBLE_TRAVEL     = 20
+)
+
+// The fastest a note can travel between two scans in meters per second (about 1000km/h)
+const RISK_MAX_TRAVEL_SPEED = 280.0
+
+// The distance between two scans below which travel is not checked.
+// Covers inaccurate and coarsened locations.
+const RISK_MIN_TRAVEL_DISTANCE = 50000.0
+
+type RiskScorer struct {
+	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+	threshold    int
+}
+
+// Create a new scorer. Currencies with a risk score of at
+// least the threshold are held for a moderator review.
+func NewRiskScorer(mongoSession *mgo.Session, redisPool *redis.Pool, threshold int) *RiskScorer {
+	return &RiskScorer{mongoSession, redisPool, threshold}
+}
+
+// Compile the format of a serial rule. The format must match the whole serial.
+func compileSerialFormat(format string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + format + ")$")
+}
+
+// Check a serial against the serial rules of its currency
+func CheckSerialRules(rules []models.SerialRuleModel, denomination, serial string) []models.RiskReason {
+
+	reasons := []models.RiskReason{}
+	hasRanges, inRange := false, false
+
+	for _, rule := range rules {
+		if rule.Denomination != denomination {
+			continue
+		}
+		if rule.Format != "" {
+			if rx, err := compileSerialFormat(rule.Format); err == nil && !rx.MatchString(serial) {
+				reasons = append(reasons, models.RiskReason{Code: models.RiskSerialFormat, Score: RISK_SCORE_SERIAL_FORMAT, Detail: "serial does not match the format of the denomination"})
+			}
+		}
+		for _, r := range rule.Ranges {
+			hasRanges = true
+			inRange = inRange || r.Contains(serial)
+		}
+	}
+
+	if inRange {
+		return reasons
+	}
+
+	for _, rule := range rules {
+		if rule.Denomination == denomination {
+			continue
+		}
+		for _, r := range rule.Ranges {
+			if r.Contains(serial) {
+				reasons = append(reasons, models.RiskReason{Code: models.RiskDenominationMix, Score: RISK_SCORE_DENOMINATION_MISMATCH, Detail: "serial is in a range issued for the " + rule.Denomination + " denomination"})
+				return reasons
+			}
+		}
+	}
+
+	if hasRanges {
+		reasons = append(reasons, models.RiskReason{Code: models.RiskSerialRange, Score: RISK_SCORE_SERIAL_RANGE, Detail: "serial is outside the ranges issued for the denomination"})
+	}
+
+	return reasons
+}
+
+// Check whether two scans of a note are too far apart for the time between them
+func IsImpossibleTravel(from *models.GeoPoint, fromAt time.Time, to *models.GeoPoint, toAt time.Time) bool {
+	if from == nil || to == nil {
+		return false
+	}
+	distance := from.DistanceTo(to)
+	return distance > RISK_MIN_TRAVEL_DISTANCE && distance > math.Abs(toAt.Sub(fromAt).Seconds())*RISK_MAX_TRAVEL_SPEED
+}
+
+// Get the location of a scan if it can be used to check travel. Form
+// locations are chosen by the client and are not trusted.
+func TravelLocation(location *models.GeoPoint, source string) *models.GeoPoint {
+	if source != models.LocationSourceEXIF {
+		return nil
+	}
+	return location
+}
+
+// Find the reasons a currency may be counterfeit
+func (self *RiskScorer) Score(currency *models.CurrencyModel) ([]models.RiskReason, error) {
+
+	reasons := []models.RiskReason{}
+
+	counterfeit, err := models.CounterfeitSerial.FindMatching(self.mongoSession, currency.CurrencyCode, currency.Denomination, currency.Serial)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	} else if err == nil {
+		detail := "serial is on the known counterfeit list"
+		if counterfeit.Source != "" {
+			detail += " (" + counterfeit.Source + ")"
+		}
+		reasons = append(reasons, models.RiskReason{Code: models.RiskKnownCounterfeit, Score: RISK_SCORE_KNOWN_COUNTERFEIT, Detail: detail})
+	}
+
+	rules, err := models.SerialRule.FindByCurrency(self.mongoSession, currency.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+	reasons = append(reasons, CheckSerialRules(rules, currency.Denomination, currency.Serial)...)
+
+	// the same serial indexed from an image of another denomination
+	duplicates, err := models.Currency.Find(self.mongoSession, bson.M{
+		"currency_code": currency.CurrencyCode,
+		"serial":        currency.Serial,
+		"denomination":  bson.M{"$ne": currency.Denomination},
+	}, "-created_at", 10, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, duplicate := range duplicates {
+		reasons = append(reasons, models.RiskReason{Code: models.RiskDuplicateSerial, Score: RISK_SCORE_DUPLICATE_SERIAL, Detail: "serial was indexed as a " + duplicate.Denomination + " note"})
+	}
+
+	// the two most recent scans of the note with trusted locations were too far apart
+	sightings, err := models.Sighting.FindByCurrency(self.mongoSession, currency.Id.Hex(), 10, 0)
+	if err != nil {
+		return nil, err
+	}
+	locations, times := []*models.GeoPoint{}, []time.Time{}
+	for _, sighting := range sightings {
+		if location := TravelLocation(sighting.Location, sighting.LocationSource); location != nil && len(locations) < 2 {
+			locations, times = append(locations, location), append(times, sighting.CreatedAt)
+		}
+	}
+	if location := TravelLocation(currency.Location, currency.LocationSource); location != nil && len(locations) == 1 {
+		locations, times = append(locations, location), append(times, currency.CreatedAt)
+	}
+	if len(locations) == 2 && IsImpossibleTravel(locations[1], times[1], locations[0], times[0]) {
+		reasons = append(reasons, models.RiskReason{Code: models.RiskImpossibleTravel, Score: RISK_SCORE_IMPOSSIBLE_TRAVEL, Detail: "note was scanned in places too far apart for the time between the scans"})
+	}
+
+	return reasons, nil
+}
+
+// Add reasons to the risk of a currency and hold the currency for review if
+// its score reaches the threshold. Currencies cleared by a moderator are only
+// held again if new reasons are found. Returns whether reasons were added and
+// whether the currency was held.
+func (self *RiskScorer) apply(currency *models.CurrencyModel, reasons []models.RiskReason) (bool, bool) {
+
+	merged, added := models.MergeRiskReasons(currency.RiskReasons, reasons)
+	currency.RiskReasons = merged
+	currency.RiskScore = models.RiskScore(merged)
+
+	if currency.RiskScore < self.threshold || currency.RiskReview == models.RiskReviewPending || currency.RiskReview == models.RiskReviewConfirmed {
+		return added > 0, false
+	}
+
+	if currency.RiskReview == models.RiskReviewCleared && added == 0 {
+		return false, false
+	}
+
+	currency.RiskReview = models.RiskReviewPending
+	return true, true
+}
+
+// Score a currency that is about to be indexed. Failures are logged and
+// the currency is indexed without a score. Returns whether the currency is held.
+func (self *RiskScorer) Assess(currency *models.CurrencyModel) bool {
+
+	reasons, err := self.Score(currency)
+	if err != nil {
+		util.Println("Failed to score currency risk. ", err.Error())
+		return false
+	}
+
+	_, held := self.apply(currency, reasons)
+	return held
+}
+
+// Score an indexed currency again, for example after it was sighted or a
+// counterfeit list was imported. A newly held currency is removed from the
+// vote queue. Returns whether the currency was held.
+func (self *RiskScorer) Rescore(currency *models.CurrencyModel) (bool, error) {
+
+	reasons, err := self.Score(currency)
+	if err != nil {
+		return false, err
+	}
+
+	changed, held := self.apply(currency, reasons)
+	if !changed {
+		return false, nil
+	}
+
+	if err = models.Currency.SetRisk(self.mongoSession, currency.Id.Hex(), currency.RiskScore, currency.RiskReasons, currency.RiskReview); err != nil {
+		return false, err
+	}
+
+	if held {
+		if err = models.RemoveFromVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode); err != nil {
+			util.Println("Failed to remove currency from vote queue. ", err.Error())
+		}
+		recordAudit(self.mongoSession, nil, models.AuditCurrencyRiskHold, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+			"risk_score": currency.RiskScore,
+		}, "")
+	}
+
+	return held, nil
+}
+
+// Score the indexed currencies with one of the serials of a currency again.
+// Returns the number of currencies held.
+func (self *RiskScorer) RescoreSerials(currencyCode string, serials []string) (int, error) {
+
+	currencies, err := models.Currency.Find(self.mongoSession, bson.M{
+		"currency_code": currencyCode,
+		"serial":        bson.M{"$in": serials},
+	}, "-created_at", 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range currencies {
+		held, err := self.Rescore(&currencies[i])
+		if err != nil {
+			return count, err
+		}
+		if held {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Score a sighted currency again
+func (self *MintController) rescore(currency *models.CurrencyModel) {
+	if _, err := self.risk.Rescore(currency); err != nil {
+		util.Println("Failed to score currency risk. ", err.Error())
+	}
+}
+
+// Score the currencies indexed with one of a set of serials again
+func (self *MintController) rescoreSerials(currencyCode string, serials ...string) {
+	if _, err := self.risk.RescoreSerials(currencyCode, serials); err != nil {
+		util.Println("Failed to score currency risk. ", err.Error())
+	}
+}
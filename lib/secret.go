@@ -0,0 +1,32 @@
+// Secrets are random values that grant access to a resource
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// The number of random bytes in a secret
+const SECRET_BYTES = 32
+
+// Read random bytes from the operating system. Panics
+// if the system cannot provide secure random bytes.
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to read random bytes: " + err.Error())
+	}
+	return b
+}
+
+// Generate a secret safe to use in urls and headers. Used for API
+// keys, refresh tokens, webhook secrets and share tokens.
+func NewSecret() string {
+	return base64.RawURLEncoding.EncodeToString(randomBytes(SECRET_BYTES))
+}
+
+// Generate a random lowercase hex string of n bytes
+func randomHex(n int) string {
+	return hex.EncodeToString(randomBytes(n))
+}
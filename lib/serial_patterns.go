@@ -0,0 +1,221 @@
+// Serial detectors classify serial numbers collectors look out for
+package lib
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ellcrys/openmint/models"
+	"gopkg.in/mgo.v2"
+)
+
+// Serial classifications
+const (
+	SerialRadar    = "radar"
+	SerialRepeater = "repeater"
+	SerialLadder   = "ladder"
+	SerialSolid    = "solid"
+	SerialLow      = "low"
+)
+
+// The minimum number of digits a serial must have to match
+// a pattern. Shorter serials match patterns by chance.
+const SERIAL_PATTERN_MIN_DIGITS = 4
+
+// The highest serial number considered low
+const LOW_SERIAL_MAX = 100
+
+// A serial pattern detector
+type SerialDetector interface {
+
+	// The name of the classification
+	Name() string
+
+	// Check whether the digits of a serial match the pattern
+	Detect(digits string) bool
+}
+
+// An ordered collection of serial detectors
+type SerialDetectorRegistry struct {
+	detectors []SerialDetector
+}
+
+// Create a registry
+func NewSerialDetectorRegistry(detectors ...SerialDetector) *SerialDetectorRegistry {
+	registry := &SerialDetectorRegistry{}
+	for _, d := range detectors {
+		registry.Register(d)
+	}
+	return registry
+}
+
+// Create a registry of the built in detectors
+func DefaultSerialDetectors() *SerialDetectorRegistry {
+	return NewSerialDetectorRegistry(
+		RadarDetector{},
+		RepeaterDetector{},
+		LadderDetector{},
+		SolidDetector{},
+		LowSerialDetector{Max: LOW_SERIAL_MAX},
+	)
+}
+
+// Add a detector. A detector with the same name is replaced.
+func (r *SerialDetectorRegistry) Register(detector SerialDetector) {
+	for i, d := range r.detectors {
+		if d.Name() == detector.Name() {
+			r.detectors[i] = detector
+			return
+		}
+	}
+	r.detectors = append(r.detectors, detector)
+}
+
+// Get the names of the registered detectors
+func (r *SerialDetectorRegistry) Names() []string {
+	names := []string{}
+	for _, d := range r.detectors {
+		names = append(names, d.Name())
+	}
+	return names
+}
+
+// Get the classifications of a serial. Only the digits of the
+// serial are classified, prefix and suffix letters are ignored.
+func (r *SerialDetectorRegistry) Classify(serial string) []string {
+	digits := SerialDigits(serial)
+	classifications := []string{}
+	if digits == "" {
+		return classifications
+	}
+	for _, d := range r.detectors {
+		if d.Detect(digits) {
+			classifications = append(classifications, d.Name())
+		}
+	}
+	return classifications
+}
+
+// Classify the serials of all indexed currencies. Only currencies whose
+// classifications changed are updated. Returns the number of updated currencies.
+func (r *SerialDetectorRegistry) ClassifyAll(ses *mgo.Session) (int, error) {
+	updated := 0
+	iter := models.Currency.Iter(ses, &models.CurrencyFilter{})
+	var currency models.CurrencyModel
+	for iter.Next(&currency) {
+		patterns := r.Classify(currency.Serial)
+		if strings.Join(patterns, ",") != strings.Join(currency.SerialPatterns, ",") {
+			if err := models.Currency.SetSerialPatterns(ses, currency.Id.Hex(), patterns); err != nil {
+				iter.Close()
+				return updated, err
+			}
+			updated++
+		}
+		currency = models.CurrencyModel{}
+	}
+	return updated, iter.Close()
+}
+
+// Get the digits of a serial
+func SerialDigits(serial string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, serial)
+}
+
+// Matches serials that read the same backwards (e.g 12344321)
+type RadarDetector struct{}
+
+func (RadarDetector) Name() string {
+	return SerialRadar
+}
+
+func (RadarDetector) Detect(digits string) bool {
+	if len(digits) < SERIAL_PATTERN_MIN_DIGITS {
+		return false
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		if digits[i] != digits[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches serials made of a repeated block of at least two digits (e.g 12341234)
+type RepeaterDetector struct{}
+
+func (RepeaterDetector) Name() string {
+	return SerialRepeater
+}
+
+func (RepeaterDetector) Detect(digits string) bool {
+	if len(digits) < SERIAL_PATTERN_MIN_DIGITS {
+		return false
+	}
+	for size := 2; size <= len(digits)/2; size++ {
+		if len(digits)%size != 0 {
+			continue
+		}
+		block := digits[:size]
+		if strings.Repeat(block, len(digits)/size) == digits && strings.Count(block, block[:1]) != size {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches serials of consecutive ascending or descending digits (e.g 12345678)
+type LadderDetector struct{}
+
+func (LadderDetector) Name() string {
+	return SerialLadder
+}
+
+func (LadderDetector) Detect(digits string) bool {
+	if len(digits) < SERIAL_PATTERN_MIN_DIGITS {
+		return false
+	}
+	step := int(digits[1]) - int(digits[0])
+	if step != 1 && step != -1 {
+		return false
+	}
+	for i := 2; i < len(digits); i++ {
+		if int(digits[i])-int(digits[i-1]) != step {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches serials of a single repeated digit (e.g 77777777)
+type SolidDetector struct{}
+
+func (SolidDetector) Name() string {
+	return SerialSolid
+}
+
+func (SolidDetector) Detect(digits string) bool {
+	return len(digits) >= SERIAL_PATTERN_MIN_DIGITS && strings.Count(digits, digits[:1]) == len(digits)
+}
+
+// Matches serials with a number between 1 and Max (e.g 00000042)
+type LowSerialDetector struct {
+	Max int
+}
+
+func (LowSerialDetector) Name() string {
+	return SerialLow
+}
+
+func (d LowSerialDetector) Detect(digits string) bool {
+	trimmed := strings.TrimLeft(digits, "0")
+	if trimmed == "" || len(trimmed) > len(strconv.Itoa(d.Max)) {
+		return false
+	}
+	n, err := strconv.Atoi(trimmed)
+	return err == nil && n >= 1 && n <= d.Max
+}
@@ -0,0 +1,219 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrInvalidRefreshToken = errors.New("refresh token is invalid")
+var ErrRefreshTokenReused = errors.New("refresh token has been reused")
+
+// Get the lifetime of access tokens
+func AccessTokenTTL() time.Duration {
+	return time.Duration(config.C.GetInt("access_token_ttl")) * time.Second
+}
+
+// Get the lifetime of refresh tokens
+func RefreshTokenTTL() time.Duration {
+	return time.Duration(config.C.GetInt("refresh_token_ttl")) * time.Second
+}
+
+// Create a signed access token for a user. Tokens are signed with the
+// active key of the key ring and fall back to HS256 when no key is active
+// and legacy tokens are accepted. Returns the token and its id.
+func NewAccessToken(userId string) (string, string, error) {
+
+	now := time.Now().UTC()
+	jti := util.Sha1(util.RandString(32))
+	claims := jwt.MapClaims{
+		"id":     userId,
+		"jti":    jti,
+		"iat":    now.Unix(),
+		"iat_ms": models.UnixMilli(now),
+		"exp":    now.Add(AccessTokenTTL()).Unix(),
+	}
+
+	if kr := GetKeyRing(); kr != nil {
+		if key := kr.SigningKey(now); key != nil {
+			token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+			token.Header["kid"] = key.Id
+			signed, err := token.SignedString(key.PrivateKey)
+			return signed, jti, err
+		}
+	}
+
+	// HS256 tokens are rejected when legacy tokens are not accepted
+	hmacKey := config.C.GetString("hmac_key")
+	if hmacKey == "" || config.C.GetString("accept_legacy_tokens") != "true" {
+		return "", "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(hmacKey))
+	return signed, jti, err
+}
+
+// Find the key that verifies a token. RS256 and ES256 tokens are verified with
+// the key ring key identified by `kid`. HS256 tokens are only accepted while
+// legacy tokens are allowed.
+func accessTokenKey(token *jwt.Token) (interface{}, error) {
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		kid, _ := token.Header["kid"].(string)
+		kr := GetKeyRing()
+		if kid == "" || kr == nil {
+			return nil, errors.New("unknown signing key")
+		}
+		key := kr.VerificationKey(kid, time.Now().UTC(), AccessTokenTTL())
+		if key == nil || key.Algorithm != token.Method.Alg() {
+			return nil, errors.New("unknown signing key")
+		}
+		return key.PublicKey, nil
+	case *jwt.SigningMethodHMAC:
+		hmacKey := config.C.GetString("hmac_key")
+		if hmacKey == "" || config.C.GetString("accept_legacy_tokens") != "true" {
+			return nil, errors.New("legacy tokens are no longer accepted")
+		}
+		return []byte(hmacKey), nil
+	default:
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+}
+
+// Parse and validate an access token. Tokens issued before
+// expiry claims were introduced expire an access token lifetime after `iat`.
+func ParseAccessToken(tokenString string) (jwt.MapClaims, error) {
+
+	token, err := jwt.Parse(tokenString, accessTokenKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if _, ok := claims["id"].(string); !ok {
+		return nil, errors.New("invalid token: id is required")
+	}
+
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, errors.New("invalid token: iat is required")
+	}
+
+	if _, hasExp := claims["exp"]; !hasExp {
+		expiryTime := util.UnixToTime(util.ToInt64(iat)).Add(AccessTokenTTL()).UTC()
+		if expiryTime.Before(time.Now().UTC()) {
+			return nil, errors.New("token has expired")
+		}
+	}
+
+	return claims, nil
+}
+
+// Get the time an access token was issued at. Tokens issued before
+// `iat_ms` was introduced fall back to the whole second of `iat`.
+func AccessTokenIssuedAt(claims jwt.MapClaims) time.Time {
+	if iatMs, ok := claims["iat_ms"].(float64); ok {
+		return models.FromUnixMilli(int64(iatMs))
+	}
+	iat, _ := claims["iat"].(float64)
+	return util.UnixToTime(util.ToInt64(iat)).UTC()
+}
+
+// Get the time remaining before an access token expires
+func AccessTokenTimeLeft(claims jwt.MapClaims) time.Duration {
+	if exp, ok := claims["exp"].(float64); ok {
+		return util.UnixToTime(util.ToInt64(exp)).Sub(time.Now())
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		return util.UnixToTime(util.ToInt64(iat)).Add(AccessTokenTTL()).Sub(time.Now())
+	}
+	return 0
+}
+
+// Hash a refresh token for storage
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create and store a new refresh token for a user. A new
+// token family is started if familyId is empty.
+func NewRefreshToken(ses *mgo.Session, userId, familyId string) (string, *models.RefreshTokenModel, error) {
+
+	token := NewSecret()
+	if familyId == "" {
+		familyId = util.Sha1(util.RandString(32))
+	}
+
+	refreshToken := &models.RefreshTokenModel{
+		Id:        models.NewId(),
+		UserId:    bson.ObjectIdHex(userId),
+		TokenHash: HashRefreshToken(token),
+		FamilyId:  familyId,
+		ExpiresAt: time.Now().UTC().Add(RefreshTokenTTL()),
+	}
+
+	if err := models.RefreshToken.Create(ses, refreshToken); err != nil {
+		return "", nil, err
+	}
+
+	return token, refreshToken, nil
+}
+
+// Exchange a refresh token for a new one. The old token is revoked.
+// If a revoked token is presented, it is assumed to have been stolen and
+// every token of its family is revoked.
+func RotateRefreshToken(ses *mgo.Session, token string) (string, *models.RefreshTokenModel, error) {
+
+	current, err := models.RefreshToken.FindByHash(ses, HashRefreshToken(token))
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return "", nil, ErrInvalidRefreshToken
+		}
+		return "", nil, err
+	}
+
+	if current.Revoked {
+		if err = models.RefreshToken.RevokeFamily(ses, current.FamilyId); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrRefreshTokenReused
+	}
+
+	if current.ExpiresAt.Before(time.Now().UTC()) {
+		return "", nil, ErrInvalidRefreshToken
+	}
+
+	newToken, refreshToken, err := NewRefreshToken(ses, current.UserId.Hex(), current.FamilyId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// another request rotated the token first
+	if err = models.RefreshToken.Revoke(ses, current.Id.Hex(), refreshToken.Id.Hex()); err != nil {
+		if err == mgo.ErrNotFound {
+			if err = models.RefreshToken.RevokeFamily(ses, current.FamilyId); err != nil {
+				return "", nil, err
+			}
+			return "", nil, ErrRefreshTokenReused
+		}
+		return "", nil, err
+	}
+
+	return newToken, refreshToken, nil
+}
@@ -0,0 +1,251 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// A key used to sign session tokens. A key signs new tokens
+// between NotBefore and NotAfter and is published (and accepted)
+// from when it is added until tokens it signed can no longer be valid.
+type SigningKey struct {
+	Id         string
+	Algorithm  string
+	NotBefore  time.Time
+	NotAfter   time.Time
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+// A collection of signing keys
+type KeyRing struct {
+	keys []*SigningKey
+}
+
+// The key manifest lists the signing keys and their rotation schedule.
+// Private key paths are relative to the directory of the manifest.
+//
+// Example:
+// 	{ "keys": [
+// 		{ "kid": "2016-06", "private_key": "2016-06.pem", "not_before": "2016-06-01T00:00:00Z", "not_after": "2016-07-01T00:00:00Z" },
+// 		{ "kid": "2016-07", "private_key": "2016-07.pem", "not_before": "2016-07-01T00:00:00Z" }
+// 	]}
+type keyManifest struct {
+	Keys []struct {
+		Id         string `json:"kid"`
+		PrivateKey string `json:"private_key"`
+		NotBefore  string `json:"not_before"`
+		NotAfter   string `json:"not_after"`
+	} `json:"keys"`
+}
+
+// The key ring used to sign and verify session tokens.
+// Tokens are signed with HS256 when no key ring is set.
+var keyRing *KeyRing
+
+// Set the key ring used to sign and verify session tokens
+func SetKeyRing(kr *KeyRing) {
+	keyRing = kr
+}
+
+// Get the key ring used to sign and verify session tokens
+func GetKeyRing() *KeyRing {
+	return keyRing
+}
+
+// Create a signing key from an RSA or ECDSA (P-256) private key.
+// RSA keys sign with RS256 and ECDSA keys sign with ES256.
+func NewSigningKey(kid string, privateKey interface{}, notBefore, notAfter time.Time) (*SigningKey, error) {
+	key := &SigningKey{Id: kid, NotBefore: notBefore, NotAfter: notAfter, PrivateKey: privateKey}
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = "RS256"
+		key.PublicKey = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ecdsa keys are supported")
+		}
+		key.Algorithm = "ES256"
+		key.PublicKey = &k.PublicKey
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+	return key, nil
+}
+
+// Create a key ring
+func NewKeyRing(keys ...*SigningKey) *KeyRing {
+	return &KeyRing{keys}
+}
+
+// Parse a PEM encoded RSA or ECDSA private key
+func ParsePrivateKeyPEM(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+// Load a key ring from a key manifest file
+func LoadKeyRing(manifestPath string) (*KeyRing, error) {
+
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest keyManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse key manifest: %s", err)
+	}
+
+	kr := NewKeyRing()
+	for _, k := range manifest.Keys {
+
+		if k.Id == "" {
+			return nil, errors.New("key manifest: kid is required")
+		}
+
+		var notBefore, notAfter time.Time
+		if k.NotBefore != "" {
+			if notBefore, err = time.Parse(time.RFC3339, k.NotBefore); err != nil {
+				return nil, fmt.Errorf("key %s: invalid not_before", k.Id)
+			}
+		}
+		if k.NotAfter != "" {
+			if notAfter, err = time.Parse(time.RFC3339, k.NotAfter); err != nil {
+				return nil, fmt.Errorf("key %s: invalid not_after", k.Id)
+			}
+		}
+
+		keyPath := k.PrivateKey
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(filepath.Dir(manifestPath), keyPath)
+		}
+
+		pemData, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %s", k.Id, err)
+		}
+
+		privateKey, err := ParsePrivateKeyPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %s", k.Id, err)
+		}
+
+		key, err := NewSigningKey(k.Id, privateKey, notBefore, notAfter)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %s", k.Id, err)
+		}
+
+		kr.keys = append(kr.keys, key)
+	}
+
+	return kr, nil
+}
+
+// Get the key that signs new tokens at the given time. This is the most
+// recently activated key that has not been retired. Returns nil if no key is active.
+func (kr *KeyRing) SigningKey(now time.Time) *SigningKey {
+	var active *SigningKey
+	for _, key := range kr.keys {
+		if key.NotBefore.After(now) || (!key.NotAfter.IsZero() && !now.Before(key.NotAfter)) {
+			continue
+		}
+		if active == nil || key.NotBefore.After(active.NotBefore) {
+			active = key
+		}
+	}
+	return active
+}
+
+// Get a key that can verify tokens at the given time. Retired keys remain
+// valid for maxTokenAge so tokens signed just before retirement can be verified.
+func (kr *KeyRing) VerificationKey(kid string, now time.Time, maxTokenAge time.Duration) *SigningKey {
+	for _, key := range kr.keys {
+		if key.Id != kid {
+			continue
+		}
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter.Add(maxTokenAge)) {
+			return nil
+		}
+		return key
+	}
+	return nil
+}
+
+// Get the JSON Web Key Set of the keys that are not retired at the given time.
+// Keys scheduled for future activation are included so verifiers can fetch them
+// before they are used.
+func (kr *KeyRing) JWKS(now time.Time, maxTokenAge time.Duration) map[string]interface{} {
+	keys := []map[string]interface{}{}
+	sorted := make([]*SigningKey, len(kr.keys))
+	copy(sorted, kr.keys)
+	sort.Sort(byNotBefore(sorted))
+	for _, key := range sorted {
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter.Add(maxTokenAge)) {
+			continue
+		}
+		keys = append(keys, key.PublicJWK())
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// Get the public part of the key as a JSON Web Key
+func (key *SigningKey) PublicJWK() map[string]interface{} {
+	jwk := map[string]interface{}{
+		"kid": key.Id,
+		"alg": key.Algorithm,
+		"use": "sig",
+	}
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk["kty"] = "EC"
+		jwk["crv"] = "P-256"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(padBytes(pub.X.Bytes(), 32))
+		jwk["y"] = base64.RawURLEncoding.EncodeToString(padBytes(pub.Y.Bytes(), 32))
+	}
+	return jwk
+}
+
+// Left pad a byte slice with zeros to the given size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+type byNotBefore []*SigningKey
+
+func (k byNotBefore) Len() int           { return len(k) }
+func (k byNotBefore) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+func (k byNotBefore) Less(i, j int) bool { return k[i].NotBefore.Before(k[j].NotBefore) }
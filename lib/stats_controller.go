@@ -0,0 +1,220 @@
+// This controller provides statistics about indexed currencies
+package lib
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+)
+
+type StatsController struct {
+	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+}
+
+// Create a new controller instance
+func NewStatsController(mongoSession *mgo.Session, redisPool *redis.Pool) *StatsController {
+	return &StatsController{mongoSession, redisPool}
+}
+
+// Get the filter of a statistics request from the currency_code, from and to query parameters
+func statsFilter(c *extend.Context) (*models.StatsFilter, error) {
+
+	from, err := dateParam(c, "from")
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := dateParam(c, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.StatsFilter{
+		CurrencyCode: strings.ToUpper(c.Echo().QueryParam("currency_code")),
+		From:         from,
+		To:           to,
+	}, nil
+}
+
+// Get the cache key of a statistic computed with a filter and other parameters
+func StatsCacheKey(name string, filter *models.StatsFilter, params ...string) string {
+	parts := []string{name, filter.CurrencyCode, "", ""}
+	if !filter.From.IsZero() {
+		parts[2] = filter.From.Format(time.RFC3339)
+	}
+	if !filter.To.IsZero() {
+		parts[3] = filter.To.Format(time.RFC3339)
+	}
+	return strings.Join(append(parts, params...), "|")
+}
+
+// Parse a comma separated list of the fields indexed currency counts are
+// grouped by. Counts are grouped by currency if the list is empty.
+// Returns false if the list includes an unknown field.
+func ParseStatsGroupBy(value string) ([]string, bool) {
+	if value == "" {
+		return []string{"currency"}, true
+	}
+	groupBy := []string{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if !util.InStringSlice(models.StatsGroupFields, field) {
+			return nil, false
+		}
+		if !util.InStringSlice(groupBy, field) {
+			groupBy = append(groupBy, field)
+		}
+	}
+	return groupBy, true
+}
+
+// Respond with a cached statistic. If the statistic is not cached,
+// it is computed and cached for the configured duration.
+// The `X-Cache` header tells whether the response came from the cache.
+func (self *StatsController) cached(c *extend.Context, key string, compute func() (interface{}, error)) error {
+
+	cachedValue, err := models.GetCachedStats(self.redisPool, key)
+	if err != nil {
+		util.Println("Failed to get cached statistics. ", err.Error())
+	}
+
+	if cachedValue != "" {
+		var result interface{}
+		if err = json.Unmarshal([]byte(cachedValue), &result); err == nil {
+			c.Response().Header().Set("X-Cache", "HIT")
+			return c.JSON(200, result)
+		}
+	}
+
+	result, err := compute()
+	if err != nil {
+		util.Println("Failed to compute statistics. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	value, _ := json.Marshal(result)
+	ttl := time.Duration(config.C.GetInt("stats_cache_ttl")) * time.Second
+	if err = models.CacheStats(self.redisPool, key, string(value), ttl); err != nil {
+		util.Println("Failed to cache statistics. ", err.Error())
+	}
+
+	c.Response().Header().Set("X-Cache", "MISS")
+	return c.JSON(200, result)
+}
+
+// @API: GET /v1/stats/indexed
+//
+// @Description:
+// 	Count indexed currencies. Counts can be grouped by currency code,
+// 	denomination and day of indexing.
+//
+// @Query Params:
+// 	group_by 		String: Comma separated list of currency, denomination and day. Default: currency
+// 	currency_code 	String: Filter by currency code
+// 	from 			Date: Only count currencies indexed on or after the date
+// 	to 				Date: Only count currencies indexed before the date
+//
+// @Response 200: Array of models.IndexedCount
+func (self *StatsController) GetIndexed(c *extend.Context) error {
+
+	filter, err := statsFilter(c)
+	if err != nil {
+		return err
+	}
+
+	groupBy, ok := ParseStatsGroupBy(c.Echo().QueryParam("group_by"))
+	if !ok {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("group_by must only include " + strings.Join(models.StatsGroupFields, ", ")).SetCode("invalid_parameter").SetParam("group_by")
+	}
+
+	return self.cached(c, StatsCacheKey("indexed", filter, groupBy...), func() (interface{}, error) {
+		return models.Currency.CountIndexed(self.mongoSession, filter, groupBy)
+	})
+}
+
+// @API: GET /v1/stats/verification
+//
+// @Description:
+// 	Get the number of currencies per status and the verification rate
+// 	of each currency code. The verification rate is the share of
+// 	currencies with a decided status that were verified.
+//
+// @Query Params:
+// 	currency_code 	String: Filter by currency code
+// 	from 			Date: Only include currencies indexed on or after the date
+// 	to 				Date: Only include currencies indexed before the date
+//
+// @Response 200: Array of models.VerificationStats
+func (self *StatsController) GetVerification(c *extend.Context) error {
+
+	filter, err := statsFilter(c)
+	if err != nil {
+		return err
+	}
+
+	return self.cached(c, StatsCacheKey("verification", filter), func() (interface{}, error) {
+		return models.Currency.VerificationStats(self.mongoSession, filter)
+	})
+}
+
+// @API: GET /v1/stats/consensus
+//
+// @Description:
+// 	Get the average number of votes and the average time it took
+// 	to decide the status of currencies of each currency code.
+//
+// @Query Params:
+// 	currency_code 	String: Filter by currency code
+// 	from 			Date: Only include currencies indexed on or after the date
+// 	to 				Date: Only include currencies indexed before the date
+//
+// @Response 200: Array of models.ConsensusStats
+func (self *StatsController) GetConsensus(c *extend.Context) error {
+
+	filter, err := statsFilter(c)
+	if err != nil {
+		return err
+	}
+
+	return self.cached(c, StatsCacheKey("consensus", filter), func() (interface{}, error) {
+		return models.Currency.ConsensusStats(self.mongoSession, filter)
+	})
+}
+
+// @API: GET /v1/stats/contributors
+//
+// @Description:
+// 	Get the users who indexed the most currencies
+//
+// @Query Params:
+// 	limit 			Int: The number of users to return. Default: 10, Max: 100
+// 	currency_code 	String: Filter by currency code
+// 	from 			Date: Only count currencies indexed on or after the date
+// 	to 				Date: Only count currencies indexed before the date
+//
+// @Response 200: Array of models.ContributorStats
+func (self *StatsController) GetContributors(c *extend.Context) error {
+
+	limit, _, err := paginationParams(c, 10, 100)
+	if err != nil {
+		return err
+	}
+
+	filter, err := statsFilter(c)
+	if err != nil {
+		return err
+	}
+
+	return self.cached(c, StatsCacheKey("contributors", filter, strconv.Itoa(limit)), func() (interface{}, error) {
+		return models.Currency.TopContributors(self.mongoSession, filter, limit)
+	})
+}
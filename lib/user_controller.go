@@ -3,52 +3,302 @@ package lib
 
 import (
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ellcrys/openmint/config"
 	"github.com/ellcrys/openmint/extend"
 	"github.com/ellcrys/openmint/models"
 	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
 	"gopkg.in/mgo.v2"
 )
 
+type updateSettingsBody struct {
+	CoarseLocation *bool `json:"coarse_location"`
+}
+
+type setTagsBody struct {
+	Tags []string `json:"tags"`
+}
+
 type UserController struct {
 	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+	mint         *MintController
+}
+
+func NewUserController(mongoSession *mgo.Session, redisPool *redis.Pool, mint *MintController) *UserController {
+	return &UserController{mongoSession, redisPool, mint}
 }
 
-func NewUserController(mongoSession *mgo.Session) *UserController {
-	return &UserController{mongoSession}
+// The maximum number of currencies in a page of a listing
+const CURRENCY_PAGE_MAX_SIZE = 100
+
+// The maximum number of tags of a currency
+const CURRENCY_MAX_TAGS = 20
+
+// The maximum length of a tag
+const TAG_MAX_LENGTH = 32
+
+// Normalize a tag. Tags are lowercase and inner whitespace is collapsed.
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+}
+
+// Parse a date query parameter. Dates are in RFC 3339 format or YYYY-MM-DD.
+func dateParam(c *extend.Context, name string) (time.Time, error) {
+	value := c.Echo().QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, config.NewHTTPError(c.Lang(), 400, "").SetMsg(name + " must be a date (e.g 2016-05-01 or 2016-05-01T10:00:00Z)").SetCode("invalid_parameter").SetParam(name)
+}
+
+// Get a currency filter of a user's currencies from the currency_code,
+// denomination, status, tag, collection, from and to query parameters
+func currencyFilterParams(c *extend.Context, userId string) (*models.CurrencyFilter, error) {
+
+	var err error
+	filter := &models.CurrencyFilter{
+		UserId:        userId,
+		CurrencyCode:  strings.ToUpper(strings.TrimSpace(c.Echo().QueryParam("currency_code"))),
+		Denomination:  strings.TrimSpace(c.Echo().QueryParam("denomination")),
+		Status:        c.Echo().QueryParam("status"),
+		Tag:           normalizeTag(c.Echo().QueryParam("tag")),
+		CollectionId:  c.Echo().QueryParam("collection"),
+		SerialPattern: strings.ToLower(strings.TrimSpace(c.Echo().QueryParam("serial_pattern"))),
+	}
+
+	if filter.Status != "" && !util.InStringSlice(models.CurrencyStatuses, filter.Status) {
+		return nil, config.NewHTTPError(c.Lang(), 400, "e043").SetCode("invalid_parameter").SetParam("status")
+	}
+
+	if filter.CollectionId != "" && !models.IsId(filter.CollectionId) {
+		return nil, config.NewHTTPError(c.Lang(), 400, "e049").SetCode("invalid_parameter").SetParam("collection")
+	}
+
+	if filter.From, err = dateParam(c, "from"); err != nil {
+		return nil, err
+	}
+
+	if filter.To, err = dateParam(c, "to"); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
 }
 
 // @API: GET /v1/users/currencies
-// @Description: Get currencies belonging to the authenticated user
+//
+// @Description:
+// 	Get currencies belonging to the authenticated user, most recent first.
+// 	The total number of matching currencies is returned in the `X-Total-Count` header.
+// 	If there are more currencies, the cursor of the next page is returned in the `X-Next-Cursor` header.
+//
+// @Query Params:
+// 	limit 			Int: The number of currencies to return. Default: 20, Max: 100
+// 	cursor 			String: The cursor of the page to return
+// 	currency_code 	String: Filter by currency code
+// 	denomination 	String: Filter by denomination
+// 	status 			String: Filter by status
+// 	tag 			String: Filter by tag
+// 	collection 		String: Filter by collection id
+// 	serial_pattern 	String: Filter by serial pattern (e.g radar, repeater, ladder, solid, low)
+// 	from 			Date: Only return currencies indexed on or after the date
+// 	to 				Date: Only return currencies indexed before the date
+//
+// @Response 200: Array of models.CurrencyModel
 func (self *UserController) GetCurrencies(c *extend.Context) error {
 
 	var authUserId = c.Get("auth_user")
 	var err error
-	var skip = 0
-	var limit = 10
+	var limit = 20
 
 	if _limit := c.Echo().QueryParam("limit"); _limit != "" {
-		limit, err = strconv.Atoi(_limit)
-		if err != nil {
-			return config.NewHTTPError(c.Lang(), 500, "e500")
+		if limit, err = strconv.Atoi(_limit); err != nil || limit < 1 || limit > CURRENCY_PAGE_MAX_SIZE {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("limit must be a number between 1 and " + strconv.Itoa(CURRENCY_PAGE_MAX_SIZE)).SetCode("invalid_parameter").SetParam("limit")
 		}
 	}
 
-	if _skip := c.Echo().QueryParam("skip"); _skip != "" {
-		skip, err = strconv.Atoi(_skip)
-		if err != nil {
-			return config.NewHTTPError(c.Lang(), 500, "e500")
-		}
+	filter, err := currencyFilterParams(c, authUserId)
+	if err != nil {
+		return err
 	}
 
-	skip = skip * limit
+	currencies, next, err := models.Currency.FindPage(self.mongoSession, filter, c.Echo().QueryParam("cursor"), limit)
+	if err == models.ErrInvalidCursor {
+		return config.NewHTTPError(c.Lang(), 400, "e048").SetCode("invalid_parameter").SetParam("cursor")
+	} else if err != nil {
+		util.Println("Failed to fetch currencies. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
 
-	currencies, err := models.Currency.FindWithDateSortAndSkip(self.mongoSession, authUserId, "-created_at", limit, skip)
+	total, err := models.Currency.Count(self.mongoSession, filter)
 	if err != nil {
-		util.Println("Failed to fetch currencies. ", err.Error())
+		util.Println("Failed to count currencies. ", err.Error())
 		return config.NewHTTPError(c.Lang(), 500, "e500")
 	}
 
+	header := c.Response().Header()
+	header.Set("X-Total-Count", strconv.Itoa(total))
+	if next != "" {
+		header.Set("X-Next-Cursor", next)
+	}
+
 	return c.JSON(200, currencies)
 }
+
+// @API: GET /v1/users/currencies/export
+//
+// @Description:
+// 	Export all currencies of the authenticated user as an attachment.
+// 	Currencies are streamed oldest first.
+//
+// @Query Params:
+// 	format 			String: The export format (csv, json or ndjson). Default: csv
+// 	currency_code 	String: Filter by currency code
+// 	denomination 	String: Filter by denomination
+// 	status 			String: Filter by status
+// 	tag 			String: Filter by tag
+// 	collection 		String: Filter by collection id
+// 	serial_pattern 	String: Filter by serial pattern (e.g radar, repeater, ladder, solid, low)
+// 	from 			Date: Only export currencies indexed on or after the date
+// 	to 				Date: Only export currencies indexed before the date
+//
+// @Response 200: The currencies in the requested format
+func (self *UserController) ExportCurrencies(c *extend.Context) error {
+
+	format, err := exportFormatParam(c)
+	if err != nil {
+		return err
+	}
+
+	filter, err := currencyFilterParams(c, c.Get("auth_user"))
+	if err != nil {
+		return err
+	}
+
+	return streamCurrencyExport(c, self.mongoSession, filter, format, false)
+}
+
+// @API: PUT /v1/users/currencies/:id/tags
+//
+// @Description:
+// 	Replace the tags of a currency indexed by the authenticated user.
+// 	Tags are lowercased and duplicates are removed.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	tags 	{Array[string]}: The tags of the currency. Max: 20 tags of up to 32 characters
+//
+// @Response 200:
+// 	id 		String: The currency id
+// 	tags 	Array: The tags of the currency
+func (self *UserController) SetCurrencyTags(c *extend.Context) error {
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
+	var body setTagsBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	tags := []string{}
+	for _, tag := range body.Tags {
+		tag = normalizeTag(tag)
+		if tag == "" || len(tag) > TAG_MAX_LENGTH {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("tags must be between 1 and " + strconv.Itoa(TAG_MAX_LENGTH) + " characters").SetCode("invalid_parameter").SetParam("tags").SetHint(tag)
+		}
+		if !util.InStringSlice(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) > CURRENCY_MAX_TAGS {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("a currency cannot have more than " + strconv.Itoa(CURRENCY_MAX_TAGS) + " tags").SetCode("invalid_parameter").SetParam("tags")
+	}
+
+	currency, err := models.Currency.FindById(self.mongoSession, id)
+	if err != nil && err == mgo.ErrNotFound {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	} else if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if currency.UserId.Hex() != c.Get("auth_user") {
+		return config.NewHTTPError(c.Lang(), 404, "e020")
+	}
+
+	if err = models.Currency.SetTags(self.mongoSession, id, tags); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"id": id, "tags": tags})
+}
+
+// @API: PUT /v1/users/settings
+//
+// @Description:
+// 	Update the privacy settings of the authenticated user. When coarse locations
+// 	are enabled, the locations of the user's existing scans are coarsened too.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	coarse_location 	{bool}: Store scan locations with a precision of about 11km (optional)
+//
+// @Response 200: Returns models.UserModel instance
+func (self *UserController) UpdateSettings(c *extend.Context) error {
+
+	var authUserId = c.Get("auth_user")
+
+	var body updateSettingsBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	user, err := models.User.FindById(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if body.CoarseLocation != nil && *body.CoarseLocation != user.CoarseLocation {
+
+		if err = models.User.SetCoarseLocation(self.mongoSession, authUserId, *body.CoarseLocation); err != nil {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+
+		if *body.CoarseLocation {
+			if err = models.Currency.CoarsenUserLocations(self.mongoSession, authUserId); err != nil {
+				util.Println("Failed to coarsen currency locations. ", err.Error())
+				return config.NewHTTPError(c.Lang(), 500, "e500")
+			}
+			if err = models.Sighting.CoarsenUserLocations(self.mongoSession, authUserId); err != nil {
+				util.Println("Failed to coarsen sighting locations. ", err.Error())
+				return config.NewHTTPError(c.Lang(), 500, "e500")
+			}
+		}
+
+		recordAudit(self.mongoSession, c, models.AuditUserSettings, models.AuditTargetUser, authUserId, map[string]interface{}{
+			"coarse_location": change(user.CoarseLocation, *body.CoarseLocation),
+		}, "")
+
+		user.CoarseLocation = *body.CoarseLocation
+	}
+
+	user.AccessToken = ""
+	user.AccessSecret = ""
+
+	return c.JSON(200, user)
+}
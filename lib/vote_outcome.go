@@ -0,0 +1,65 @@
+// The vote outcome decides the status of a currency
+// once it has received the maximum number of votes
+package lib
+
+import (
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+)
+
+// Set the status of a currency that has received the maximum number of votes
+// from the majority of its votes and remove it from the vote queue. Currencies
+// with fewer votes or no longer awaiting votes are not changed. Returns the
+// previous status and whether the status was set.
+func FinalizeVoteOutcome(mongoSession *mgo.Session, redisPool *redis.Pool, currency *models.CurrencyModel, maxVotes int) (string, bool, error) {
+
+	prevStatus := currency.Status
+	if prevStatus != "awaiting_votes" || len(currency.Votes) < maxVotes {
+		return prevStatus, false, nil
+	}
+
+	status := models.DetermineVoteOutcome(currency.Votes)
+	if err := models.Currency.FinalizeStatus(mongoSession, currency.Id.Hex(), status); err != nil {
+		if err == mgo.ErrNotFound {
+			return prevStatus, false, nil
+		}
+		return prevStatus, false, err
+	}
+	currency.Status = status
+
+	// the outcome is decided by the system, not the last voter
+	recordAudit(mongoSession, nil, models.AuditCurrencyStatus, models.AuditTargetCurrency, currency.Id.Hex(), map[string]interface{}{
+		"status": change(prevStatus, currency.Status),
+	}, "vote outcome")
+
+	if err := models.RemoveFromVoteQueue(redisPool, currency.Id.Hex(), currency.CurrencyCode); err != nil {
+		util.Println("Failed to remove currency from vote queue. ", err.Error())
+	}
+
+	return prevStatus, true, nil
+}
+
+// Decide the status of a currency after a vote and let the uploader know
+func (self *MintController) finalizeVotes(currency *models.CurrencyModel) error {
+
+	prevStatus, finalized, err := FinalizeVoteOutcome(self.mongoSession, self.redisPool, currency, config.C.GetInt("max_votes"))
+	if err != nil || !finalized {
+		return err
+	}
+
+	go self.recordVoteAccuracy(currency)
+
+	self.publishEvent(models.NewEvent(models.EventStatusChanged, currency.UserId.Hex(), extend.H{
+		"currency_id":     currency.Id.Hex(),
+		"previous_status": prevStatus,
+		"status":          currency.Status,
+	}))
+
+	go self.webhooks.Dispatch(currency.UserId.Hex(), "currency."+currency.Status, currency)
+
+	return nil
+}
@@ -0,0 +1,268 @@
+// This worker keeps the redis vote queue in
+// sync with the state of currencies in mongo
+package lib
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+)
+
+// Counters describing the work done by the reconciler.
+// Published at /debug/vars under `vote_queue_reconciler`.
+var voteQueueMetrics = expvar.NewMap("vote_queue_reconciler")
+
+// The result of a single reconciliation run
+type ReconcileResult struct {
+	RemovedMissing   int `json:"removed_missing"`
+	RemovedFinalized int `json:"removed_finalized"`
+	RemovedMaxVotes  int `json:"removed_max_votes"`
+	Finalized        int `json:"finalized"`
+	RemovedOrphaned  int `json:"removed_orphaned"`
+	Requeued         int `json:"requeued"`
+	PrunedSessions   int `json:"pruned_sessions"`
+	QueueLength      int `json:"queue_length"`
+}
+
+type VoteQueueReconciler struct {
+	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+	interval     time.Duration
+	stop         chan bool
+}
+
+// Create a new reconciler that runs every interval
+func NewVoteQueueReconciler(mongoSession *mgo.Session, redisPool *redis.Pool, interval time.Duration) *VoteQueueReconciler {
+	return &VoteQueueReconciler{mongoSession, redisPool, interval, make(chan bool)}
+}
+
+// Start reconciling the vote queue in the background
+func (self *VoteQueueReconciler) Start() {
+	go func() {
+		ticker := time.NewTicker(self.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := self.Reconcile(); err != nil {
+					util.Println("Vote queue reconciliation failed. ", err.Error())
+				}
+			case <-self.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the background reconciliation
+func (self *VoteQueueReconciler) Stop() {
+	close(self.stop)
+}
+
+// Run a single reconciliation pass. Removes currencies that no longer
+// exist, are no longer awaiting votes or have reached the maximum number
+// of votes from the vote queues, prunes expired vote sessions and re-enqueues
+// currencies awaiting votes that are missing from the queue. Currencies that
+// reached the maximum number of votes without being finalized are finalized.
+func (self *VoteQueueReconciler) Reconcile() (*ReconcileResult, error) {
+
+	var result = &ReconcileResult{}
+	var maxVotes = config.C.GetInt("max_votes")
+	var batchSize = 100
+	var offset = 0
+
+	// remove stale currencies from the main queue
+	for {
+
+		currencyIds, err := models.GetFromVoteQueue(self.redisPool, "", offset, batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(currencyIds) == 0 {
+			break
+		}
+
+		currencies, err := models.Currency.FindByIds(self.mongoSession, currencyIds)
+		if err != nil {
+			return nil, err
+		}
+
+		currencyMap := make(map[string]*models.CurrencyModel)
+		for i := range currencies {
+			currencyMap[currencies[i].Id.Hex()] = &currencies[i]
+		}
+
+		var removed = 0
+		for _, currencyId := range currencyIds {
+
+			currency, found := currencyMap[currencyId]
+
+			var curCode = ""
+			if found {
+				curCode = currency.CurrencyCode
+			}
+
+			switch {
+			case !found:
+				result.RemovedMissing++
+			case currency.Status != "awaiting_votes" || currency.Hidden || currency.HeldForReview():
+				result.RemovedFinalized++
+			case len(currency.Votes) >= maxVotes:
+				if err = self.finalize(currency, maxVotes, result); err != nil {
+					return nil, err
+				}
+				result.RemovedMaxVotes++
+			default:
+				pruned, err := models.PruneExpiredSessions(self.redisPool, currencyId)
+				if err != nil {
+					return nil, err
+				}
+				result.PrunedSessions += pruned
+				continue
+			}
+
+			if err = models.RemoveFromVoteQueue(self.redisPool, currencyId, curCode); err != nil {
+				return nil, err
+			}
+			removed++
+		}
+
+		offset += len(currencyIds) - removed
+	}
+
+	// remove currencies in sub-queues that are no longer in the main queue
+	subQueues, err := models.GetVoteSubQueues(self.redisPool)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := self.redisPool.Get()
+	defer conn.Close()
+	for _, subQueue := range subQueues {
+		currencyIds, err := redis.Strings(conn.Do("ZRANGE", subQueue, 0, -1))
+		if err != nil {
+			return nil, err
+		}
+		inQueue, err := models.InVoteQueue(self.redisPool, currencyIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, currencyId := range currencyIds {
+			if !inQueue[currencyId] {
+				if err = models.RemoveFromQueue(self.redisPool, subQueue, currencyId); err != nil {
+					return nil, err
+				}
+				result.RemovedOrphaned++
+			}
+		}
+	}
+
+	// re-enqueue currencies awaiting votes that are missing from the queue
+	var currency models.CurrencyModel
+	var batch []models.CurrencyModel
+	iter := models.Currency.IterByStatus(self.mongoSession, "awaiting_votes")
+	for {
+
+		more := iter.Next(&currency)
+		if more {
+
+			// do not carry over fields of the previous document
+			current := currency
+			currency = models.CurrencyModel{}
+
+			if !current.Hidden && !current.HeldForReview() {
+				if len(current.Votes) < maxVotes {
+					batch = append(batch, current)
+				} else if err := self.finalize(&current, maxVotes, result); err != nil {
+					iter.Close()
+					return nil, err
+				}
+			}
+		}
+
+		if len(batch) < batchSize && more {
+			continue
+		}
+
+		requeued, err := self.requeueMissing(batch)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		result.Requeued += requeued
+		batch = batch[:0]
+
+		if !more {
+			break
+		}
+	}
+
+	if err = iter.Close(); err != nil {
+		return nil, err
+	}
+
+	if result.QueueLength, err = models.CountVoteQueue(self.redisPool, ""); err != nil {
+		return nil, err
+	}
+
+	// publish counts
+	voteQueueMetrics.Add("runs", 1)
+	voteQueueMetrics.Add("removed_missing", int64(result.RemovedMissing))
+	voteQueueMetrics.Add("removed_finalized", int64(result.RemovedFinalized))
+	voteQueueMetrics.Add("removed_max_votes", int64(result.RemovedMaxVotes))
+	voteQueueMetrics.Add("finalized", int64(result.Finalized))
+	voteQueueMetrics.Add("removed_orphaned", int64(result.RemovedOrphaned))
+	voteQueueMetrics.Add("requeued", int64(result.Requeued))
+	voteQueueMetrics.Add("pruned_sessions", int64(result.PrunedSessions))
+	queueLength := new(expvar.Int)
+	queueLength.Set(int64(result.QueueLength))
+	voteQueueMetrics.Set("queue_length", queueLength)
+
+	util.Println(fmt.Sprintf("Vote queue reconciled. %+v", *result))
+
+	return result, nil
+}
+
+// Decide the status of a currency that reached the maximum number of votes
+func (self *VoteQueueReconciler) finalize(currency *models.CurrencyModel, maxVotes int, result *ReconcileResult) error {
+	_, finalized, err := FinalizeVoteOutcome(self.mongoSession, self.redisPool, currency, maxVotes)
+	if finalized {
+		result.Finalized++
+	}
+	return err
+}
+
+// Add currencies that are missing from the vote queue to the queue.
+// Returns the number of currencies added.
+func (self *VoteQueueReconciler) requeueMissing(currencies []models.CurrencyModel) (int, error) {
+
+	currencyIds := []string{}
+	for _, currency := range currencies {
+		currencyIds = append(currencyIds, currency.Id.Hex())
+	}
+
+	inQueue, err := models.InVoteQueue(self.redisPool, currencyIds)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, currency := range currencies {
+		if inQueue[currency.Id.Hex()] {
+			continue
+		}
+		if err = models.AddToVoteQueue(self.redisPool, currency.Id.Hex(), currency.CurrencyCode, currency.CreatedAt, 0); err != nil {
+			return requeued, err
+		}
+		requeued++
+	}
+
+	return requeued, nil
+}
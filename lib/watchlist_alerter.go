@@ -0,0 +1,130 @@
+// The watchlist alerter notifies users when a currency
+// matching one of their watchlists is indexed or sighted
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2"
+)
+
+type WatchlistAlerter struct {
+	mongoSession *mgo.Session
+	redisPool    *redis.Pool
+	webhooks     *WebhookDispatcher
+	mailer       Mailer
+}
+
+// Create a new alerter
+func NewWatchlistAlerter(mongoSession *mgo.Session, redisPool *redis.Pool, webhooks *WebhookDispatcher, mailer Mailer) *WatchlistAlerter {
+	return &WatchlistAlerter{mongoSession, redisPool, webhooks, mailer}
+}
+
+// Describe a match of a watchlist. The sighting is nil if the currency was just indexed.
+// Locations are left out so watchlists cannot be used to track where notes are scanned.
+func watchlistMatch(watchlist *models.WatchlistModel, currency *models.CurrencyModel, sighting *models.SightingModel, at time.Time) extend.H {
+	publicCur := publicCurrency(currency)
+	delete(publicCur, "location")
+	match := extend.H{
+		"watchlist": extend.H{
+			"id":   watchlist.Id.Hex(),
+			"name": watchlist.Name,
+			"type": watchlist.Type,
+		},
+		"currency":   publicCur,
+		"matched_at": at,
+	}
+	if sighting != nil {
+		match["sighting"] = extend.H{
+			"id":         sighting.Id.Hex(),
+			"created_at": sighting.CreatedAt,
+		}
+	}
+	return match
+}
+
+// Check a scanned currency against all active watchlists and notify
+// the owners of matching watchlists. The sighting is nil if the
+// currency was just indexed. Hidden currencies are not checked.
+func (self *WatchlistAlerter) Check(currency *models.CurrencyModel, sighting *models.SightingModel) {
+
+	if currency.Hidden {
+		return
+	}
+
+	watchlists, err := models.Watchlist.FindMatching(self.mongoSession, currency.CurrencyCode, currency.Denomination, currency.Serial)
+	if err != nil {
+		util.Println("Failed to find matching watchlists. ", err.Error())
+		return
+	}
+
+	for i := range watchlists {
+		self.notify(&watchlists[i], currency, sighting)
+	}
+}
+
+// Notify the owner of a watchlist of a match through the watchlist's channels
+func (self *WatchlistAlerter) notify(watchlist *models.WatchlistModel, currency *models.CurrencyModel, sighting *models.SightingModel) {
+
+	now := time.Now().UTC()
+	userId := watchlist.UserId.Hex()
+	match := watchlistMatch(watchlist, currency, sighting, now)
+
+	if err := models.Watchlist.RecordMatch(self.mongoSession, watchlist.Id.Hex(), now); err != nil {
+		util.Println("Failed to record watchlist match. ", err.Error())
+	}
+
+	if watchlist.HasChannel(models.WatchlistChannelWebhook) {
+		self.webhooks.Dispatch(userId, models.WebhookWatchlistMatch, match)
+	}
+
+	if watchlist.HasChannel(models.WatchlistChannelEmail) {
+		self.sendEmail(watchlist, currency, sighting)
+	}
+
+	if watchlist.HasChannel(models.WatchlistChannelFeed) {
+		notification := &models.NotificationModel{
+			Id:     models.NewId(),
+			UserId: watchlist.UserId,
+			Type:   models.NotificationWatchlistMatch,
+			Data:   match,
+		}
+		if err := models.Notification.Create(self.mongoSession, notification); err != nil {
+			util.Println("Failed to create notification. ", err.Error())
+			return
+		}
+		if err := models.PublishEvent(self.redisPool, models.NewEvent(models.EventNotification, userId, notification)); err != nil {
+			util.Println("Failed to publish event. ", err.Error())
+		}
+	}
+}
+
+// Email the owner of a watchlist about a match
+func (self *WatchlistAlerter) sendEmail(watchlist *models.WatchlistModel, currency *models.CurrencyModel, sighting *models.SightingModel) {
+
+	user, err := models.User.FindById(self.mongoSession, watchlist.UserId.Hex())
+	if err != nil {
+		util.Println("Failed to find watchlist owner. ", err.Error())
+		return
+	} else if user.Email == "" {
+		return
+	}
+
+	action := "indexed"
+	if sighting != nil {
+		action = "sighted"
+	}
+
+	subject := fmt.Sprintf("Watchlist match: %s %s %s", currency.CurrencyCode, currency.Denomination, currency.Serial)
+	body := fmt.Sprintf("A %s %s note with serial %s matching your watchlist \"%s\" was %s at %s.",
+		currency.CurrencyCode, currency.Denomination, currency.Serial, watchlist.Name, action, time.Now().UTC().Format(time.RFC1123))
+
+	if err = self.mailer.Send(user.Email, subject, body); err != nil {
+		util.Println("Failed to send watchlist email. ", err.Error())
+	}
+}
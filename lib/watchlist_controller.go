@@ -0,0 +1,338 @@
+// This controller manages watchlists of serials a user is alerted about
+package lib
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The maximum number of watchlists of a user
+const WATCHLIST_MAX_PER_USER = 500
+
+// The maximum length of the name of a watchlist
+const WATCHLIST_NAME_MAX_LENGTH = 100
+
+// The minimum length of the prefix of a prefix watchlist
+const WATCHLIST_MIN_PREFIX_LENGTH = 4
+
+// The maximum number of serials a range watchlist can match
+const WATCHLIST_MAX_RANGE_WIDTH = 10000
+
+type createWatchlistBody struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	CurrencyCode string   `json:"currency_code"`
+	Denomination string   `json:"denomination"`
+	Serial       string   `json:"serial"`
+	Prefix       string   `json:"prefix"`
+	From         *uint64  `json:"from"`
+	To           *uint64  `json:"to"`
+	Channels     []string `json:"channels"`
+}
+
+type updateWatchlistBody struct {
+	Name     *string  `json:"name"`
+	Channels []string `json:"channels"`
+	Active   *bool    `json:"active"`
+}
+
+type WatchlistController struct {
+	mongoSession *mgo.Session
+}
+
+// Create a new controller instance
+func NewWatchlistController(mongoSession *mgo.Session) *WatchlistController {
+	return &WatchlistController{mongoSession}
+}
+
+// Find a watchlist owned by the authenticated user. When authenticated
+// with an API key, the watchlist must have been created with the key.
+func (self *WatchlistController) findOwnWatchlist(c *extend.Context) (*models.WatchlistModel, error) {
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e051")
+	}
+
+	watchlist, err := models.Watchlist.FindById(self.mongoSession, id)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, config.NewHTTPError(c.Lang(), 404, "e051")
+		}
+		return nil, config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if watchlist.UserId.Hex() != c.Get("auth_user") {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e051")
+	}
+
+	if apiKeyId := c.Get("auth_api_key"); apiKeyId != "" && watchlist.APIKeyId.Hex() != apiKeyId {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e051")
+	}
+
+	return watchlist, nil
+}
+
+// Validate the name of a watchlist
+func validateWatchlistName(c *extend.Context, name *string) error {
+	*name = strings.TrimSpace(*name)
+	if *name == "" || len(*name) > WATCHLIST_NAME_MAX_LENGTH {
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("name must be between 1 and " + strconv.Itoa(WATCHLIST_NAME_MAX_LENGTH) + " characters").SetCode("invalid_parameter").SetParam("name")
+	}
+	return nil
+}
+
+// Validate and deduplicate the notification channels of a watchlist
+func validateWatchlistChannels(c *extend.Context, channels []string) ([]string, error) {
+	if len(channels) == 0 {
+		return nil, config.NewHTTPError(c.Lang(), 400, "").SetMsg("at least one channel is required").SetCode("invalid_parameter").SetParam("channels")
+	}
+	result := []string{}
+	for _, channel := range channels {
+		if !util.InStringSlice(models.WatchlistChannels, channel) {
+			return nil, config.NewHTTPError(c.Lang(), 400, "").SetMsg("channel must be one of " + strings.Join(models.WatchlistChannels, ", ")).SetCode("invalid_parameter").SetParam("channels")
+		}
+		if !util.InStringSlice(result, channel) {
+			result = append(result, channel)
+		}
+	}
+	return result, nil
+}
+
+// @API: POST /v1/watchlists
+//
+// @Description:
+// 	Create a watchlist. The owner is notified when a matching currency is indexed
+// 	or sighted. An exact watchlist matches a serial, a prefix watchlist matches
+// 	serials starting with a prefix and a range watchlist matches serials made of
+// 	an optional prefix and a number between from and to (e.g AB00001000 - AB00002000).
+// 	Watchlists created with an API key can only be managed with the key or a user session.
+// 	Prefix and range watchlists match many notes and require the watchlist:broad permission.
+// 	Prefixes must have at least 4 characters and ranges can span at most 10000 serials.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	name 			{string}: The name of the watchlist
+// 	type 			{string}: The type of the watchlist (exact, prefix or range)
+// 	currency_code 	{string}: The currency code
+// 	denomination 	{string}: The denomination. All denominations are matched if not set (optional)
+// 	serial 			{string}: The serial of an exact watchlist
+// 	prefix 			{string}: The prefix of a prefix watchlist or of the serials of a range watchlist
+// 	from 			{int}: The lowest number of a range watchlist
+// 	to 				{int}: The highest number of a range watchlist
+// 	channels 		{Array[string]}: How to notify the owner (webhook, email or feed). Default: ["feed"]
+//
+// @Response 201: Returns models.WatchlistModel instance
+func (self *WatchlistController) Create(c *extend.Context) error {
+
+	authUserId := c.Get("auth_user")
+
+	var body createWatchlistBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	if err := validateWatchlistName(c, &body.Name); err != nil {
+		return err
+	}
+
+	body.CurrencyCode = strings.ToUpper(strings.TrimSpace(body.CurrencyCode))
+	if body.CurrencyCode == "" {
+		return config.NewHTTPError(c.Lang(), 400, "e003")
+	} else if !util.InStringSlice(GetDefinedCurrencies(), body.CurrencyCode) {
+		return config.NewHTTPError(c.Lang(), 400, "e009")
+	}
+
+	body.Denomination = strings.TrimSpace(body.Denomination)
+	if body.Denomination != "" && !util.InStringSlice(GetCurrencyDenoms(body.CurrencyCode), body.Denomination) {
+		return config.NewHTTPError(c.Lang(), 400, "e005").SetCode("invalid_parameter").SetParam("denomination")
+	}
+
+	watchlist := &models.WatchlistModel{
+		Id:           models.NewId(),
+		UserId:       bson.ObjectIdHex(authUserId),
+		Name:         body.Name,
+		Type:         body.Type,
+		CurrencyCode: body.CurrencyCode,
+		Denomination: body.Denomination,
+		Prefix:       strings.ToUpper(strings.TrimSpace(body.Prefix)),
+		Channels:     []string{models.WatchlistChannelFeed},
+		Active:       true,
+	}
+
+	if apiKeyId := c.Get("auth_api_key"); apiKeyId != "" {
+		watchlist.APIKeyId = bson.ObjectIdHex(apiKeyId)
+	}
+
+	// the roles of the user are read since API keys are authenticated without roles
+	if body.Type == models.WatchlistPrefix || body.Type == models.WatchlistRange {
+		user, err := models.User.FindById(self.mongoSession, authUserId)
+		if err != nil {
+			return config.NewHTTPError(c.Lang(), 500, "e500")
+		}
+		if !models.RolesHavePermission(user.Roles, models.PermBroadWatchlists) {
+			return config.NewHTTPError(c.Lang(), 403, "e042")
+		}
+	}
+
+	switch body.Type {
+	case models.WatchlistExact:
+		watchlist.Prefix = ""
+		watchlist.Serial = strings.ToUpper(strings.TrimSpace(body.Serial))
+		if watchlist.Serial == "" {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("serial is required").SetCode("invalid_parameter").SetParam("serial")
+		}
+	case models.WatchlistPrefix:
+		if len(watchlist.Prefix) < WATCHLIST_MIN_PREFIX_LENGTH {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("prefix must have at least " + strconv.Itoa(WATCHLIST_MIN_PREFIX_LENGTH) + " characters").SetCode("invalid_parameter").SetParam("prefix")
+		}
+	case models.WatchlistRange:
+		if body.From == nil || body.To == nil {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("from and to are required").SetCode("invalid_parameter").SetParam("from")
+		} else if *body.From > *body.To {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("from must not be greater than to").SetCode("invalid_parameter").SetParam("from")
+		} else if *body.To > math.MaxInt64 {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("to is too large").SetCode("invalid_parameter").SetParam("to")
+		} else if *body.To-*body.From >= WATCHLIST_MAX_RANGE_WIDTH {
+			return config.NewHTTPError(c.Lang(), 400, "").SetMsg("a range must not span more than " + strconv.Itoa(WATCHLIST_MAX_RANGE_WIDTH) + " serials").SetCode("invalid_parameter").SetParam("to")
+		}
+		watchlist.From, watchlist.To = *body.From, *body.To
+	default:
+		return config.NewHTTPError(c.Lang(), 400, "").SetMsg("type must be one of " + strings.Join(models.WatchlistTypes, ", ")).SetCode("invalid_parameter").SetParam("type")
+	}
+
+	if body.Channels != nil {
+		channels, err := validateWatchlistChannels(c, body.Channels)
+		if err != nil {
+			return err
+		}
+		watchlist.Channels = channels
+	}
+
+	count, err := models.Watchlist.CountByUser(self.mongoSession, authUserId)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	} else if count >= WATCHLIST_MAX_PER_USER {
+		return config.NewHTTPError(c.Lang(), 400, "e052")
+	}
+
+	if err = models.Watchlist.Create(self.mongoSession, watchlist); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(201, watchlist)
+}
+
+// @API: GET /v1/watchlists
+//
+// @Description:
+// 	Get the watchlists of the authenticated user, most recent first.
+// 	When authenticated with an API key, only the watchlists created
+// 	with the key are returned.
+func (self *WatchlistController) List(c *extend.Context) error {
+
+	watchlists, err := models.Watchlist.FindByOwner(self.mongoSession, c.Get("auth_user"), c.Get("auth_api_key"))
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, watchlists)
+}
+
+// @API: GET /v1/watchlists/:id
+// @Description: Get a watchlist of the authenticated user
+func (self *WatchlistController) Get(c *extend.Context) error {
+
+	watchlist, err := self.findOwnWatchlist(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, watchlist)
+}
+
+// @API: PATCH /v1/watchlists/:id
+//
+// @Description:
+// 	Rename a watchlist, change how its owner is notified or pause it.
+// 	What a watchlist matches cannot be changed.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	name 		{string}: The name of the watchlist (optional)
+// 	channels 	{Array[string]}: How to notify the owner (webhook, email or feed) (optional)
+// 	active 		{bool}: Whether the watchlist is checked (optional)
+//
+// @Response 200: Returns models.WatchlistModel instance
+func (self *WatchlistController) Update(c *extend.Context) error {
+
+	watchlist, err := self.findOwnWatchlist(c)
+	if err != nil {
+		return err
+	}
+
+	var body updateWatchlistBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	update := bson.M{}
+
+	if body.Name != nil {
+		if err = validateWatchlistName(c, body.Name); err != nil {
+			return err
+		}
+		update["name"] = *body.Name
+		watchlist.Name = *body.Name
+	}
+
+	if body.Channels != nil {
+		channels, err := validateWatchlistChannels(c, body.Channels)
+		if err != nil {
+			return err
+		}
+		update["channels"] = channels
+		watchlist.Channels = channels
+	}
+
+	if body.Active != nil {
+		update["active"] = *body.Active
+		watchlist.Active = *body.Active
+	}
+
+	if len(update) == 0 {
+		return c.JSON(200, watchlist)
+	}
+
+	if err = models.Watchlist.Update(self.mongoSession, watchlist.Id.Hex(), bson.M{"$set": update}); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, watchlist)
+}
+
+// @API: DELETE /v1/watchlists/:id
+// @Description: Delete a watchlist
+func (self *WatchlistController) Delete(c *extend.Context) error {
+
+	watchlist, err := self.findOwnWatchlist(c)
+	if err != nil {
+		return err
+	}
+
+	if err = models.Watchlist.Delete(self.mongoSession, watchlist.Id.Hex()); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, extend.H{"id": watchlist.Id.Hex()})
+}
@@ -0,0 +1,206 @@
+// This controller manages webhook subscriptions
+package lib
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type createWebhookBody struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+type WebhookController struct {
+	mongoSession *mgo.Session
+	dispatcher   *WebhookDispatcher
+}
+
+// Create a new controller instance
+func NewWebhookController(mongoSession *mgo.Session, dispatcher *WebhookDispatcher) *WebhookController {
+	return &WebhookController{mongoSession, dispatcher}
+}
+
+// Check whether a webhook url is an http(s) url. Urls with an ip address
+// or localhost host must point to a public address. Host names are checked
+// again when a webhook is sent, see NewWebhookClient.
+func isValidWebhookURL(webhookURL string) bool {
+	if webhookURL == "" || !govalidator.IsURL(webhookURL) {
+		return false
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicAddress(ip) {
+		return false
+	}
+	return true
+}
+
+// Find a webhook owned by the authenticated user
+func (self *WebhookController) findOwnWebhook(c *extend.Context) (*models.WebhookModel, error) {
+
+	id := c.Param("id")
+	if !models.IsId(id) {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e027")
+	}
+
+	webhook, err := models.Webhook.FindById(self.mongoSession, id)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, config.NewHTTPError(c.Lang(), 404, "e027")
+		}
+		return nil, config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if webhook.UserId.Hex() != c.Get("auth_user") {
+		return nil, config.NewHTTPError(c.Lang(), 404, "e027")
+	}
+
+	return webhook, nil
+}
+
+// @API: POST /v1/webhooks
+//
+// @Description:
+// 	Subscribe a url to currency lifecycle events of currencies submitted by the authenticated user.
+// 	Every delivery is signed with the webhook secret. The hex encoded HMAC-SHA256 signature of the
+// 	request body is sent in the `x-signature` header.
+//
+// @Content-Type: 	application/json
+//
+// @Body Params:
+// 	url 	{string}: The url events are posted to
+// 	secret 	{string}: The secret used to sign deliveries. Generated if not provided.
+// 	events 	{Array[string]}: The events to subscribe to (currency.indexed, currency.verified, currency.rejected, currency.disputed)
+//
+// @Response 201: Returns models.WebhookModel instance including the secret
+func (self *WebhookController) Create(c *extend.Context) error {
+
+	var body createWebhookBody
+	if c.BindJSON(&body) != nil {
+		return config.NewHTTPError(c.Lang(), 400, "e001")
+	}
+
+	body.URL = strings.TrimSpace(body.URL)
+	if !isValidWebhookURL(body.URL) {
+		return config.NewHTTPError(c.Lang(), 400, "e028").SetCode("invalid_parameter").SetParam("url")
+	}
+
+	if len(body.Events) == 0 {
+		return config.NewHTTPError(c.Lang(), 400, "e029").SetCode("invalid_parameter").SetParam("events")
+	}
+
+	for _, event := range body.Events {
+		if !util.InStringSlice(models.WebhookEvents, event) {
+			return config.NewHTTPError(c.Lang(), 400, "e029").SetCode("invalid_parameter").SetParam("events").SetHint(event)
+		}
+	}
+
+	if body.Secret == "" {
+		body.Secret = NewSecret()
+	}
+
+	webhook := &models.WebhookModel{
+		Id:     models.NewId(),
+		UserId: bson.ObjectIdHex(c.Get("auth_user")),
+		URL:    body.URL,
+		Secret: body.Secret,
+		Events: body.Events,
+		Active: true,
+	}
+
+	if err := models.Webhook.Create(self.mongoSession, webhook); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(201, webhook)
+}
+
+// @API: GET /v1/webhooks
+// @Description: Get the webhooks of the authenticated user. Secrets are not included.
+func (self *WebhookController) List(c *extend.Context) error {
+
+	webhooks, err := models.Webhook.FindByUser(self.mongoSession, c.Get("auth_user"))
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return c.JSON(200, webhooks)
+}
+
+// @API: DELETE /v1/webhooks/:id
+// @Description: Delete a webhook and its delivery log
+func (self *WebhookController) Delete(c *extend.Context) error {
+
+	webhook, err := self.findOwnWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	if err = models.Webhook.Delete(self.mongoSession, webhook.Id.Hex()); err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	if err = models.WebhookDelivery.DeleteByWebhook(self.mongoSession, webhook.Id.Hex()); err != nil {
+		util.Println("Failed to delete webhook deliveries. ", err.Error())
+	}
+
+	return c.JSON(200, extend.H{"id": webhook.Id.Hex()})
+}
+
+// @API: POST /v1/webhooks/:id/test
+// @Description: Send a `webhook.test` event to a webhook once and return the delivery
+func (self *WebhookController) Test(c *extend.Context) error {
+
+	webhook, err := self.findOwnWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	delivery, err := self.dispatcher.DispatchOnce(webhook, models.WebhookTest, extend.H{
+		"webhook_id": webhook.Id.Hex(),
+	})
+	if err != nil {
+		util.Println("Failed to send test webhook. ", err.Error())
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, delivery)
+}
+
+// @API: GET /v1/webhooks/:id/deliveries
+// @Description: Get the 50 most recent deliveries of a webhook
+func (self *WebhookController) Deliveries(c *extend.Context) error {
+
+	webhook, err := self.findOwnWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := models.WebhookDelivery.FindByWebhook(self.mongoSession, webhook.Id.Hex(), 50)
+	if err != nil {
+		return config.NewHTTPError(c.Lang(), 500, "e500")
+	}
+
+	return c.JSON(200, deliveries)
+}
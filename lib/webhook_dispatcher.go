@@ -0,0 +1,247 @@
+// The webhook dispatcher delivers currency lifecycle
+// events to the webhooks users have subscribed
+package lib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type WebhookDispatcher struct {
+	mongoSession *mgo.Session
+	client       *http.Client
+	maxAttempts  int
+	baseDelay    time.Duration
+}
+
+// Create a new dispatcher
+func NewWebhookDispatcher(mongoSession *mgo.Session) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		mongoSession: mongoSession,
+		client:       NewWebhookClient(10 * time.Second),
+		maxAttempts:  config.C.GetInt("webhook_max_attempts"),
+		baseDelay:    2 * time.Second,
+	}
+}
+
+// Returned when a webhook url resolves to an address webhooks cannot be sent to
+var ErrWebhookAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// Networks webhooks cannot be sent to: unspecified, loopback,
+// private, shared, link-local and unique local addresses
+var blockedWebhookNetworks = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.168.0.0/16", "::/128", "::1/128", "fc00::/7", "fe80::/10",
+)
+
+// Parse networks in CIDR notation
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("invalid network " + cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Check whether webhooks can be sent to an ip address
+func IsPublicAddress(ip net.IP) bool {
+	if ip == nil || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range blockedWebhookNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Create the http client webhooks are sent with. The client refuses to
+// connect to addresses that are not public. The address is checked when
+// connecting, after the host name is resolved, so host names that resolve
+// to internal addresses and redirects to internal addresses are refused too.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicAddress(net.ParseIP(host)) {
+				return ErrWebhookAddressNotAllowed
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
+
+// Compute the signature of a webhook payload. The signature
+// is the hex encoded HMAC-SHA256 of the payload using the webhook secret.
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check a signature received in the x-signature header against a payload
+func IsValidWebhookSignature(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhookPayload(secret, payload)), []byte(signature))
+}
+
+// Send a signed payload to a webhook url. The signature is set in the
+// x-signature header. Returns the response status code and an error if
+// the request failed or the response status code is not 2xx.
+func SendWebhook(client *http.Client, url, secret, event, deliveryId string, payload []byte) (int, error) {
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Openmint-Webhook")
+	req.Header.Set("x-signature", SignWebhookPayload(secret, payload))
+	req.Header.Set("x-openmint-event", event)
+	req.Header.Set("x-openmint-delivery", deliveryId)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Send an event to all active webhooks of a user that are subscribed to it.
+// Deliveries happen in the background and are retried with exponential backoff.
+func (self *WebhookDispatcher) Dispatch(userId, event string, data interface{}) {
+
+	webhooks, err := models.Webhook.FindSubscribed(self.mongoSession, userId, event)
+	if err != nil {
+		util.Println("Failed to find webhooks. ", err.Error())
+		return
+	}
+
+	for i := range webhooks {
+		delivery, err := self.newDelivery(&webhooks[i], event, data)
+		if err != nil {
+			util.Println("Failed to create webhook delivery. ", err.Error())
+			continue
+		}
+		go self.deliver(&webhooks[i], delivery, self.maxAttempts)
+	}
+}
+
+// Send an event to a single webhook once and wait for the result
+func (self *WebhookDispatcher) DispatchOnce(webhook *models.WebhookModel, event string, data interface{}) (*models.WebhookDeliveryModel, error) {
+	delivery, err := self.newDelivery(webhook, event, data)
+	if err != nil {
+		return nil, err
+	}
+	self.deliver(webhook, delivery, 1)
+	return delivery, nil
+}
+
+// Create and log a new delivery
+func (self *WebhookDispatcher) newDelivery(webhook *models.WebhookModel, event string, data interface{}) (*models.WebhookDeliveryModel, error) {
+
+	deliveryId := models.NewId()
+	payload, err := json.Marshal(extend.H{
+		"id":         deliveryId.Hex(),
+		"event":      event,
+		"data":       data,
+		"created_at": time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &models.WebhookDeliveryModel{
+		Id:        deliveryId,
+		WebhookId: webhook.Id,
+		Event:     event,
+		Payload:   string(payload),
+	}
+
+	if err = models.WebhookDelivery.Create(self.mongoSession, delivery); err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// Attempt to deliver a payload. Failed attempts are retried
+// after 2s, 4s, 8s... until the maximum attempts is reached.
+func (self *WebhookDispatcher) deliver(webhook *models.WebhookModel, delivery *models.WebhookDeliveryModel, maxAttempts int) {
+
+	for delivery.Attempts < maxAttempts {
+
+		if delivery.Attempts > 0 {
+			time.Sleep(self.baseDelay * time.Duration(1<<uint(delivery.Attempts-1)))
+		}
+
+		statusCode, err := SendWebhook(self.client, webhook.URL, webhook.Secret, delivery.Event, delivery.Id.Hex(), []byte(delivery.Payload))
+		delivery.Attempts++
+		delivery.StatusCode = statusCode
+		delivery.LastAttemptAt = time.Now().UTC()
+		delivery.Delivered = err == nil
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		update := bson.M{
+			"attempts":        delivery.Attempts,
+			"status_code":     delivery.StatusCode,
+			"delivered":       delivery.Delivered,
+			"error":           delivery.Error,
+			"last_attempt_at": delivery.LastAttemptAt,
+		}
+
+		if err := models.WebhookDelivery.Update(self.mongoSession, delivery.Id.Hex(), update); err != nil {
+			util.Println("Failed to update webhook delivery. ", err.Error())
+		}
+
+		if delivery.Delivered {
+			return
+		}
+	}
+}
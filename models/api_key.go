@@ -0,0 +1,128 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// API key scopes
+const (
+	ScopeMintCreate = "mint:create"
+	ScopeMintRead   = "mint:read"
+	ScopeVote       = "vote"
+	ScopeWatchlist  = "watchlist"
+)
+
+// Scopes an API key can be granted
+var APIKeyScopes = []string{
+	ScopeMintCreate,
+	ScopeMintRead,
+	ScopeVote,
+	ScopeWatchlist,
+}
+
+// An API key allows a partner system to act on behalf of a user.
+// Only the hash of the key is stored. The prefix is stored in
+// plain text so a key can be identified.
+type APIKeyModel struct {
+	Id         bson.ObjectId `json:"id" bson:"_id"`
+	UserId     bson.ObjectId `json:"user_id" bson:"user_id"`
+	Name       string        `json:"name" bson:"name"`
+	Prefix     string        `json:"prefix" bson:"prefix"`
+	KeyHash    string        `json:"-" bson:"key_hash"`
+	Scopes     []string      `json:"scopes" bson:"scopes"`
+	RateLimit  int           `json:"rate_limit" bson:"rate_limit"`
+	Revoked    bool          `json:"revoked" bson:"revoked"`
+	LastUsedAt time.Time     `json:"last_used_at" bson:"last_used_at"`
+	LastUsedIP string        `json:"last_used_ip" bson:"last_used_ip"`
+	CreatedAt  time.Time     `json:"created_at" bson:"created_at"`
+	Key        string        `json:"key,omitempty" bson:"-"`
+}
+
+var (
+	APIKey = APIKeyModel{}
+)
+
+func (m *APIKeyModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_api_key_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndex(mgo.Index{Key: []string{"key_hash"}, Unique: true}) != nil {
+		panic("failed to ensure unique index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// Check whether the key has a scope
+func (m *APIKeyModel) HasScope(scope string) bool {
+	for _, s := range m.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// find by id
+func (m *APIKeyModel) FindById(ses *mgo.Session, id string) (*APIKeyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_api_key_col"))
+	result := APIKeyModel{}
+	err := c.FindId(bson.ObjectIdHex(id)).One(&result)
+	return &result, err
+}
+
+// find by key hash
+func (m *APIKeyModel) FindByHash(ses *mgo.Session, keyHash string) (*APIKeyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_api_key_col"))
+	result := APIKeyModel{}
+	err := c.Find(bson.M{"key_hash": keyHash}).One(&result)
+	return &result, err
+}
+
+// find all keys of a user
+func (m *APIKeyModel) FindByUser(ses *mgo.Session, userId string) ([]APIKeyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_api_key_col"))
+	results := []APIKeyModel{}
+	err := c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Sort("-created_at").All(&results)
+	return results, err
+}
+
+// add new api key
+func (m *APIKeyModel) Create(ses *mgo.Session, data *APIKeyModel) error {
+	data.CreatedAt = time.Now().UTC()
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_api_key_col"))
+	return c.Insert(data)
+}
+
+// revoke an api key
+func (m *APIKeyModel) Revoke(ses *mgo.Session, id string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_api_key_col"))
+	return c.UpdateId(bson.ObjectIdHex(id), bson.M{"$set": bson.M{"revoked": true}})
+}
+
+// revoke all api keys of a user
+func (m *APIKeyModel) RevokeAllForUser(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_api_key_col"))
+	_, err := c.UpdateAll(bson.M{"user_id": bson.ObjectIdHex(userId)}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+// record the last use of an api key
+func (m *APIKeyModel) UpdateLastUsed(ses *mgo.Session, id, ip string, usedAt time.Time) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_api_key_col"))
+	return c.UpdateId(bson.ObjectIdHex(id), bson.M{"$set": bson.M{"last_used_at": usedAt, "last_used_ip": ip}})
+}
@@ -0,0 +1,322 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Audit log actions
+const (
+	AuditCurrencyCreate     = "currency.create"
+	AuditCurrencyVote       = "currency.vote"
+	AuditCurrencySighted    = "currency.sighted"
+	AuditCurrencyStatus     = "currency.status"
+	AuditCurrencyEdit       = "currency.edit"
+	AuditCurrencyHide       = "currency.hide"
+	AuditCurrencyUnhide     = "currency.unhide"
+	AuditCurrencyDelete     = "currency.delete"
+	AuditCurrencyExport     = "currency.export"
+	AuditCurrencyRiskHold   = "currency.risk_hold"
+	AuditCurrencyRiskReview = "currency.risk_review"
+	AuditUserCreate         = "user.create"
+	AuditUserCredentials    = "user.credentials"
+	AuditUserIdentities     = "user.identities"
+	AuditUserMerge          = "user.merge"
+	AuditUserMergeRefused   = "user.merge_refused"
+	AuditUserBan            = "user.ban"
+	AuditUserUnban          = "user.unban"
+	AuditUserRoles          = "user.roles"
+	AuditUserSettings       = "user.settings"
+	AuditUserDelete         = "user.delete"
+	AuditCounterfeitImport  = "counterfeit.import"
+	AuditCounterfeitDelete  = "counterfeit.delete"
+	AuditSerialRules        = "serial_rules.update"
+)
+
+// Audit log target types
+const (
+	AuditTargetCurrency     = "currency"
+	AuditTargetUser         = "user"
+	AuditTargetCurrencyCode = "currency_code"
+)
+
+// The counter that allocates the sequence numbers of audit log entries
+const AUDIT_LOG_COUNTER = "audit_log"
+
+// A mutation of a currency or user. Changes holds the previous and new value
+// of changed fields. Actions performed by the system have no actor.
+//
+// Entries form a chain: each entry has the next number of a sequence and
+// an HMAC of its content and number. The HMAC key is not stored in the
+// database, so a modified, inserted or reordered entry cannot be given a
+// valid HMAC and a removed entry leaves a gap in the sequence.
+//
+// The actor and ip address are personal data that must be erasable, so the
+// HMAC covers a salted pseudonym of them instead. Erasing them along with
+// the salt leaves the pseudonym unlinkable and the HMAC valid.
+type AuditLogModel struct {
+	Id         bson.ObjectId          `json:"id" bson:"_id"`
+	Seq        int64                  `json:"seq" bson:"seq"`
+	ActorId    bson.ObjectId          `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	Action     string                 `json:"action" bson:"action"`
+	TargetType string                 `json:"target_type" bson:"target_type"`
+	TargetId   string                 `json:"target_id" bson:"target_id"`
+	Changes    map[string]interface{} `json:"changes,omitempty" bson:"changes"`
+	Reason     string                 `json:"reason,omitempty" bson:"reason"`
+	IP         string                 `json:"ip" bson:"ip"`
+	CreatedAt  time.Time              `json:"created_at" bson:"created_at"`
+	Salt       string                 `json:"-" bson:"salt,omitempty"`
+	Pseudonym  string                 `json:"-" bson:"pseudonym"`
+	Hash       string                 `json:"hash" bson:"hash"`
+}
+
+var (
+	AuditLog = AuditLogModel{}
+)
+
+func (m *AuditLogModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_audit_log_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndex(mgo.Index{Key: []string{"seq"}, Unique: true}) != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("target_type", "target_id", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("actor_id", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// Compute the pseudonym of the actor and ip address of the entry
+func (m *AuditLogModel) ComputePseudonym() string {
+	content, _ := json.Marshal([]interface{}{m.Salt, m.ActorId.Hex(), m.IP})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Compute the HMAC of the entry. The HMAC covers every field except
+// the id and the HMAC itself, with the pseudonym in place of the actor,
+// ip address and salt.
+func (m *AuditLogModel) ComputeHash(key []byte) string {
+	changes, _ := json.Marshal(m.Changes)
+	content, _ := json.Marshal([]interface{}{
+		m.Seq,
+		m.Pseudonym,
+		m.Action,
+		m.TargetType,
+		m.TargetId,
+		string(changes),
+		m.Reason,
+		m.CreatedAt.UnixNano() / int64(time.Millisecond),
+	})
+	mac := hmac.New(sha256.New, key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Number an entry and compute its HMAC. Changes are normalized to the values
+// they decode to and the creation time is truncated to the precision mongo
+// stores so the HMAC survives a round trip.
+func (m *AuditLogModel) seal(seq int64, key []byte) error {
+
+	if m.Changes != nil {
+		data, err := json.Marshal(m.Changes)
+		if err != nil {
+			return err
+		}
+		var changes map[string]interface{}
+		if err = json.Unmarshal(data, &changes); err != nil {
+			return err
+		}
+		m.Changes = changes
+	}
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	m.Seq = seq
+	m.CreatedAt = m.CreatedAt.UTC().Truncate(time.Millisecond)
+	m.Salt = hex.EncodeToString(salt)
+	m.Pseudonym = m.ComputePseudonym()
+	m.Hash = m.ComputeHash(key)
+	return nil
+}
+
+// get the key of the audit log HMAC
+func auditLogKey() []byte {
+	return []byte(config.C.GetString("audit_log_key"))
+}
+
+// get the last entry of the chain
+func (m *AuditLogModel) Last(ses *mgo.Session) (*AuditLogModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_audit_log_col"))
+	var result AuditLogModel
+	err := c.Find(nil).Sort("-seq").One(&result)
+	return &result, err
+}
+
+// Move the sequence past the last entry. Needed when the
+// sequence is created after entries were appended.
+func (m *AuditLogModel) SyncSequence(ses *mgo.Session) error {
+	last, err := m.Last(ses)
+	if err == mgo.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return Counter.AtLeast(ses, AUDIT_LOG_COUNTER, last.Seq)
+}
+
+// Append an entry to the chain. The sequence number is allocated
+// atomically so concurrent appends never take the same number. An
+// entry that failed to be inserted keeps its number when appended again.
+func (m *AuditLogModel) Create(ses *mgo.Session, data *AuditLogModel) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_audit_log_col"))
+
+	if data.Seq == 0 {
+		seq, err := Counter.Next(ses, AUDIT_LOG_COUNTER)
+		if err != nil {
+			return err
+		}
+		data.Seq = seq
+	}
+
+	if err := data.seal(data.Seq, auditLogKey()); err != nil {
+		return err
+	}
+
+	return c.Insert(data)
+}
+
+// find entries matching a query, most recent first
+func (m *AuditLogModel) Find(ses *mgo.Session, q bson.M, limit, skip int) ([]AuditLogModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_audit_log_col"))
+	results := []AuditLogModel{}
+	err := c.Find(q).Sort("-seq").Skip(skip).Limit(limit).All(&results)
+	return results, err
+}
+
+// iterate over the entries made by a user or about a user, oldest first
+func (m *AuditLogModel) IterByUser(ses *mgo.Session, userId string) *mgo.Iter {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_audit_log_col"))
+	return c.Find(bson.M{"$or": []bson.M{
+		{"actor_id": bson.ObjectIdHex(userId)},
+		{"target_type": AuditTargetUser, "target_id": userId},
+	}}).Sort("seq").Iter()
+}
+
+// Erase the actor and ip address of the entries made by a user. The salt is
+// removed too so the pseudonym can no longer be linked to the user.
+func (m *AuditLogModel) EraseActor(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_audit_log_col"))
+	_, err := c.UpdateAll(bson.M{"actor_id": bson.ObjectIdHex(userId)}, bson.M{"$unset": bson.M{"actor_id": "", "ip": "", "salt": ""}})
+	return err
+}
+
+// verify the whole chain and return the number of entries verified.
+// Returns an *AuditChainError at the first gap or altered entry.
+func (m *AuditLogModel) VerifyChain(ses *mgo.Session) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_audit_log_col"))
+
+	// entries appended after the last sequence number is read are not verified
+	lastSeq, err := Counter.Get(ses, AUDIT_LOG_COUNTER)
+	if err != nil {
+		return 0, err
+	}
+
+	verifier := &AuditChainVerifier{Key: auditLogKey()}
+	iter := c.Find(bson.M{"seq": bson.M{"$lte": lastSeq}}).Sort("seq").Iter()
+
+	var entry AuditLogModel
+	for iter.Next(&entry) {
+		if err := verifier.Next(&entry); err != nil {
+			iter.Close()
+			return verifier.Count, err
+		}
+		entry = AuditLogModel{}
+	}
+
+	if err = iter.Close(); err != nil {
+		return verifier.Count, err
+	}
+
+	return verifier.Count, verifier.End(lastSeq)
+}
+
+// Describes where and how the audit chain is broken
+type AuditChainError struct {
+	Seq    int64
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit log entry %d: %s", e.Seq, e.Reason)
+}
+
+// Checks entries of the audit chain in sequence order. The last sequence
+// number is kept in the database, so removing the most recent entries and
+// rewinding the sequence is only detectable by comparing the last sequence
+// number with one recorded elsewhere. An entry that failed to be inserted
+// leaves a gap until it is appended from the queue.
+type AuditChainVerifier struct {
+	Key     []byte
+	Count   int
+	lastSeq int64
+}
+
+// check the next entry of the chain
+func (v *AuditChainVerifier) Next(entry *AuditLogModel) error {
+
+	if entry.Seq != v.lastSeq+1 {
+		return &AuditChainError{entry.Seq, fmt.Sprintf("expected sequence number %d (entries are missing)", v.lastSeq+1)}
+	}
+
+	if !hmac.Equal([]byte(entry.ComputeHash(v.Key)), []byte(entry.Hash)) {
+		return &AuditChainError{entry.Seq, "hash does not match the content (entry was modified)"}
+	}
+
+	// the actor and ip address can only be checked until they are erased
+	if entry.Salt != "" && entry.ComputePseudonym() != entry.Pseudonym {
+		return &AuditChainError{entry.Seq, "pseudonym does not match the actor (entry was modified)"}
+	} else if entry.Salt == "" && (entry.ActorId != "" || entry.IP != "") {
+		return &AuditChainError{entry.Seq, "actor has no salt (entry was modified)"}
+	}
+
+	v.Count++
+	v.lastSeq = entry.Seq
+	return nil
+}
+
+// check that no entry is missing after the last entry checked
+func (v *AuditChainVerifier) End(lastSeq int64) error {
+	if v.lastSeq != lastSeq {
+		return &AuditChainError{v.lastSeq + 1, fmt.Sprintf("expected %d entries (entries are missing)", lastSeq)}
+	}
+	return nil
+}
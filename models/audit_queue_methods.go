@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// The list holding audit log entries that could not be appended
+var AUDIT_LOG_QUEUE_NAME = "openmint_audit_log_queue"
+
+// Queue an entry to be appended later
+func QueueAuditEntry(redisPool *redis.Pool, entry *AuditLogModel) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err = conn.Do("RPUSH", AUDIT_LOG_QUEUE_NAME, data)
+	return err
+}
+
+// Take the oldest queued entry. Returns nil if the queue is empty.
+func PopAuditEntry(redisPool *redis.Pool) (*AuditLogModel, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("LPOP", AUDIT_LOG_QUEUE_NAME))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entry AuditLogModel
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Put back an entry that still could not be appended
+func RequeueAuditEntry(redisPool *redis.Pool, entry *AuditLogModel) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err = conn.Do("LPUSH", AUDIT_LOG_QUEUE_NAME, data)
+	return err
+}
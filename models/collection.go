@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A user defined group of the user's currencies. Currencies hold the ids
+// of the collections they belong to. A public collection can be viewed
+// by anyone with its share token.
+type CollectionModel struct {
+	Id          bson.ObjectId `json:"id" bson:"_id"`
+	UserId      bson.ObjectId `json:"user_id" bson:"user_id"`
+	Name        string        `json:"name" bson:"name"`
+	Description string        `json:"description" bson:"description"`
+	Public      bool          `json:"public" bson:"public"`
+	ShareToken  string        `json:"share_token,omitempty" bson:"share_token,omitempty"`
+	CreatedAt   time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+var (
+	Collection = CollectionModel{}
+)
+
+func (m *CollectionModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_collection_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndexKey("user_id", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndex(mgo.Index{Key: []string{"share_token"}, Unique: true, Sparse: true}) != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// find by id
+func (m *CollectionModel) FindById(ses *mgo.Session, id string) (*CollectionModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	result := CollectionModel{}
+	err := c.FindId(bson.ObjectIdHex(id)).One(&result)
+	return &result, err
+}
+
+// find a public collection by its share token
+func (m *CollectionModel) FindByShareToken(ses *mgo.Session, token string) (*CollectionModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	result := CollectionModel{}
+	err := c.Find(bson.M{"share_token": token, "public": true}).One(&result)
+	return &result, err
+}
+
+// find all collections of a user
+func (m *CollectionModel) FindByUser(ses *mgo.Session, userId string) ([]CollectionModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	results := []CollectionModel{}
+	err := c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Sort("-created_at").All(&results)
+	return results, err
+}
+
+// count the collections of a user
+func (m *CollectionModel) CountByUser(ses *mgo.Session, userId string) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	return c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Count()
+}
+
+// add new collection
+func (m *CollectionModel) Create(ses *mgo.Session, data *CollectionModel) error {
+	data.CreatedAt = time.Now().UTC()
+	data.UpdatedAt = data.CreatedAt
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	return c.Insert(data)
+}
+
+// update collection
+func (m *CollectionModel) Update(ses *mgo.Session, id string, value bson.M) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	return c.UpdateId(bson.ObjectIdHex(id), value)
+}
+
+// delete collection
+func (m *CollectionModel) Delete(ses *mgo.Session, id string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	return c.RemoveId(bson.ObjectIdHex(id))
+}
+
+// delete the collections of a user
+func (m *CollectionModel) DeleteByUser(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	_, err := c.RemoveAll(bson.M{"user_id": bson.ObjectIdHex(userId)})
+	return err
+}
+
+// move the collections of a user to another user
+func (m *CollectionModel) ReassignUser(ses *mgo.Session, fromUserId, toUserId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_collection_col"))
+	_, err := c.UpdateAll(bson.M{"user_id": bson.ObjectIdHex(fromUserId)}, bson.M{"$set": bson.M{"user_id": bson.ObjectIdHex(toUserId)}})
+	return err
+}
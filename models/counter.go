@@ -0,0 +1,51 @@
+package models
+
+import (
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A named sequence. Each call to Next returns the next number
+// of the sequence, even when called concurrently.
+type CounterModel struct {
+	Name string `json:"name" bson:"_id"`
+	Seq  int64  `json:"seq" bson:"seq"`
+}
+
+var (
+	Counter = CounterModel{}
+)
+
+// allocate the next number of a sequence. Sequences start at 1.
+func (m *CounterModel) Next(ses *mgo.Session, name string) (int64, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_counter_col"))
+	var counter CounterModel
+	_, err := c.FindId(name).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"seq": 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &counter)
+	return counter.Seq, err
+}
+
+// get the last number allocated by a sequence
+func (m *CounterModel) Get(ses *mgo.Session, name string) (int64, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_counter_col"))
+	var counter CounterModel
+	err := c.FindId(name).One(&counter)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	return counter.Seq, err
+}
+
+// move a sequence forward so the next number is greater than seq
+func (m *CounterModel) AtLeast(ses *mgo.Session, name string, seq int64) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_counter_col"))
+	_, err := c.UpsertId(name, bson.M{"$max": bson.M{"seq": seq}})
+	return err
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A serial known to be used on counterfeit notes. A serial
+// without a denomination applies to every denomination.
+type CounterfeitSerialModel struct {
+	Id           bson.ObjectId `json:"id" bson:"_id"`
+	CurrencyCode string        `json:"currency_code" bson:"currency_code"`
+	Denomination string        `json:"denomination,omitempty" bson:"denomination"`
+	Serial       string        `json:"serial" bson:"serial"`
+	Source       string        `json:"source,omitempty" bson:"source,omitempty"`
+	ImportedBy   bson.ObjectId `json:"imported_by" bson:"imported_by"`
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var (
+	CounterfeitSerial = CounterfeitSerialModel{}
+)
+
+func (m *CounterfeitSerialModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_counterfeit_serial_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndex(mgo.Index{Key: []string{"currency_code", "serial", "denomination"}, Unique: true}) != nil {
+		panic("failed to ensure unique index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("currency_code", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// find the known counterfeit serial matching a currency
+func (m *CounterfeitSerialModel) FindMatching(ses *mgo.Session, currencyCode, denomination, serial string) (*CounterfeitSerialModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_counterfeit_serial_col"))
+	result := CounterfeitSerialModel{}
+	err := c.Find(bson.M{
+		"currency_code": currencyCode,
+		"serial":        serial,
+		"denomination":  bson.M{"$in": []string{"", denomination}},
+	}).One(&result)
+	return &result, err
+}
+
+// find the known counterfeit serials of a currency, most recent first
+func (m *CounterfeitSerialModel) FindByCurrency(ses *mgo.Session, currencyCode string, limit, skip int) ([]CounterfeitSerialModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_counterfeit_serial_col"))
+	results := []CounterfeitSerialModel{}
+	err := c.Find(bson.M{"currency_code": currencyCode}).Sort("-created_at").Skip(skip).Limit(limit).All(&results)
+	return results, err
+}
+
+// add known counterfeit serials. Serials already in the list
+// are kept as they are. Returns the number of serials added.
+func (m *CounterfeitSerialModel) Import(ses *mgo.Session, serials []CounterfeitSerialModel) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_counterfeit_serial_col"))
+	added := 0
+	now := time.Now().UTC()
+	for _, s := range serials {
+		info, err := c.Upsert(bson.M{
+			"currency_code": s.CurrencyCode,
+			"serial":        s.Serial,
+			"denomination":  s.Denomination,
+		}, bson.M{"$setOnInsert": bson.M{
+			"_id":         NewId(),
+			"source":      s.Source,
+			"imported_by": s.ImportedBy,
+			"created_at":  now,
+		}})
+		if err != nil {
+			return added, err
+		}
+		if info.UpsertedId != nil {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// delete a known counterfeit serial of a currency
+func (m *CounterfeitSerialModel) Delete(ses *mgo.Session, currencyCode, id string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_counterfeit_serial_col"))
+	return c.Remove(bson.M{"_id": bson.ObjectIdHex(id), "currency_code": currencyCode})
+}
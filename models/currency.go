@@ -1,35 +1,75 @@
 package models
 
 import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/ellcrys/openmint/config"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-	"time"
 )
 
 type Vote struct {
-	Decision  int           `json:"decision" bson:"decision"`
-	UserId    bson.ObjectId `json:"user_id" bson:"user_id"`
-	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	Decision    int           `json:"decision" bson:"decision"`
+	UserId      bson.ObjectId `json:"user_id" bson:"user_id"`
+	IP          string        `json:"-" bson:"ip"`
+	Fingerprint string        `json:"-" bson:"fingerprint"`
+	CreatedAt   time.Time     `json:"created_at" bson:"created_at"`
+}
+
+// A group of votes cast by different users from the
+// same IP address or device fingerprint
+type VoteCluster struct {
+	Key         string          `json:"key" bson:"_id"`
+	Users       []bson.ObjectId `json:"users" bson:"users"`
+	Currencies  []bson.ObjectId `json:"currencies" bson:"currencies"`
+	NumUsers    int             `json:"num_users" bson:"num_users"`
+	NumVotes    int             `json:"num_votes" bson:"num_votes"`
+	LastVotedAt time.Time       `json:"last_voted_at" bson:"last_voted_at"`
 }
 
 type CurrencyModel struct {
-	Id               bson.ObjectId `json:"id" bson:"_id"`
-	UserId           bson.ObjectId `json:"user_id" bson:"user_id"`
-	ImageURL         string        `json:"image_url" bson:"image_url"`
-	OriginalImageURL string        `json:"original_image_url" bson:"original_image_url"`
-	CurrencyCode     string        `json:"currency_code" bson:"currency_code"`
-	Denomination     string        `json:"denomination" bson:"denomination"`
-	Serial           string        `json:"serial" bson:"serial"`
-	Status           string        `json:"status" bson:"status"`
-	Votes            []Vote        `json:"votes" bson:"votes"`
-	CreatedAt        time.Time     `json:"created_at" bson:"created_at"`
+	Id                  bson.ObjectId     `json:"id" bson:"_id"`
+	UserId              bson.ObjectId     `json:"user_id" bson:"user_id"`
+	ImageURL            string            `json:"image_url" bson:"image_url"`
+	OriginalImageURL    string            `json:"original_image_url" bson:"original_image_url"`
+	CurrencyCode        string            `json:"currency_code" bson:"currency_code"`
+	Denomination        string            `json:"denomination" bson:"denomination"`
+	Serial              string            `json:"serial" bson:"serial"`
+	Status              string            `json:"status" bson:"status"`
+	Votes               []Vote            `json:"votes" bson:"votes"`
+	UploaderIP          string            `json:"-" bson:"uploader_ip"`
+	UploaderFingerprint string            `json:"-" bson:"uploader_fingerprint"`
+	Analysis            map[string]string `json:"-" bson:"analysis"`
+	Hidden              bool              `json:"hidden" bson:"hidden"`
+	SightingCount       int               `json:"sighting_count" bson:"sighting_count"`
+	Location            *GeoPoint         `json:"location,omitempty" bson:"location,omitempty"`
+	LocationSource      string            `json:"-" bson:"location_source,omitempty"`
+	Tags                []string          `json:"tags,omitempty" bson:"tags,omitempty"`
+	Collections         []bson.ObjectId   `json:"collections,omitempty" bson:"collections,omitempty"`
+	SerialPatterns      []string          `json:"serial_patterns,omitempty" bson:"serial_patterns,omitempty"`
+	RiskScore           int               `json:"-" bson:"risk_score"`
+	RiskReasons         []RiskReason      `json:"-" bson:"risk_reasons,omitempty"`
+	RiskReview          string            `json:"-" bson:"risk_review,omitempty"`
+	LastSeenAt          time.Time         `json:"last_seen_at,omitempty" bson:"last_seen_at,omitempty"`
+	CreatedAt           time.Time         `json:"created_at" bson:"created_at"`
 }
 
 var (
 	Currency = CurrencyModel{}
 )
 
+// The statuses of a currency
+var CurrencyStatuses = []string{
+	"awaiting_votes",
+	"verified",
+	"rejected",
+	"disputed",
+}
+
 func (m *CurrencyModel) EnsureIndex(ses *mgo.Session) {
 	ses.SetMode(mgo.Monotonic, true)
 	colName := config.C.GetString("mongo_currency_collection")
@@ -44,7 +84,39 @@ func (m *CurrencyModel) EnsureIndex(ses *mgo.Session) {
 		panic("failed to ensure compound index in " + colName + " collection")
 	}
 
-	if c.EnsureIndexKey("user_id") != nil {
+	if c.EnsureIndexKey("user_id", "-created_at", "-_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id", "status", "-created_at", "-_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id", "currency_code", "denomination", "-created_at", "-_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id", "tags", "-created_at", "-_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("collections", "-created_at", "-_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("serial_patterns", "-created_at", "-_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("risk_review", "-risk_score") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("status") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("$2dsphere:location") != nil {
 		panic("failed to ensure index in " + colName + " collection")
 	}
 }
@@ -57,6 +129,36 @@ func (m *CurrencyModel) FindCurrency(ses *mgo.Session, curCode, denomination, se
 	return &result, err
 }
 
+// Identifies a note
+type CurrencyKey struct {
+	CurrencyCode string
+	Denomination string
+	Serial       string
+}
+
+// find visible currencies matching any of the keys. Only the
+// fields that identify a currency, its status and creation time are loaded.
+func (m *CurrencyModel) FindByKeys(ses *mgo.Session, keys []CurrencyKey) ([]CurrencyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	results := []CurrencyModel{}
+	if len(keys) == 0 {
+		return results, nil
+	}
+	or := []bson.M{}
+	for _, key := range keys {
+		or = append(or, bson.M{"currency_code": key.CurrencyCode, "denomination": key.Denomination, "serial": key.Serial})
+	}
+	err := c.Find(bson.M{"$or": or, "hidden": bson.M{"$ne": true}}).Select(bson.M{
+		"currency_code": 1,
+		"denomination":  1,
+		"serial":        1,
+		"status":        1,
+		"created_at":    1,
+	}).All(&results)
+	return results, err
+}
+
 // find by a field name
 func (m *CurrencyModel) FindByField(ses *mgo.Session, field, value string) (*CurrencyModel, error) {
 	ses.SetMode(mgo.Monotonic, true)
@@ -75,6 +177,28 @@ func (m *CurrencyModel) FindById(ses *mgo.Session, id string) (*CurrencyModel, e
 	return &result, err
 }
 
+// find currencies matching a list of ids
+func (m *CurrencyModel) FindByIds(ses *mgo.Session, ids []string) ([]CurrencyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	objIds := []bson.ObjectId{}
+	for _, id := range ids {
+		if bson.IsObjectIdHex(id) {
+			objIds = append(objIds, bson.ObjectIdHex(id))
+		}
+	}
+	results := []CurrencyModel{}
+	err := c.Find(bson.M{"_id": bson.M{"$in": objIds}}).All(&results)
+	return results, err
+}
+
+// iterate over all currencies with a given status
+func (m *CurrencyModel) IterByStatus(ses *mgo.Session, status string) *mgo.Iter {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	return c.Find(bson.M{"status": status}).Sort("created_at").Iter()
+}
+
 // add new currency entry
 func (m *CurrencyModel) Create(ses *mgo.Session, data *CurrencyModel) error {
 	data.CreatedAt = time.Now().UTC()
@@ -83,6 +207,22 @@ func (m *CurrencyModel) Create(ses *mgo.Session, data *CurrencyModel) error {
 	return c.Insert(data)
 }
 
+// find currencies matching a query
+func (m *CurrencyModel) Find(ses *mgo.Session, q bson.M, sort string, limit, skip int) ([]CurrencyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	results := []CurrencyModel{}
+	err := c.Find(q).Sort(sort).Skip(skip).Limit(limit).All(&results)
+	return results, err
+}
+
+// update a currency
+func (m *CurrencyModel) Update(ses *mgo.Session, id string, value bson.M) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	return c.UpdateId(bson.ObjectIdHex(id), value)
+}
+
 // delete currency
 func (m *CurrencyModel) Delete(ses *mgo.Session, id string) error {
 	ses.SetMode(mgo.Monotonic, true)
@@ -106,10 +246,391 @@ func (m *CurrencyModel) UpdateStatus(ses *mgo.Session, id, newStatus string) err
 	return m.UpdateField(ses, id, "status", newStatus)
 }
 
-func (m *CurrencyModel) FindWithDateSortAndSkip(ses *mgo.Session, userId, sort string, limit, skip int) ([]CurrencyModel, error) {
+// set the status of a currency that is still awaiting votes.
+// Returns mgo.ErrNotFound if the currency is no longer awaiting votes.
+func (m *CurrencyModel) FinalizeStatus(ses *mgo.Session, id, newStatus string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	return c.Update(bson.M{"_id": bson.ObjectIdHex(id), "status": "awaiting_votes"}, bson.M{"$set": bson.M{"status": newStatus}})
+}
+
+// find visible currencies within a distance in meters of a point, nearest first
+func (m *CurrencyModel) FindNear(ses *mgo.Session, point *GeoPoint, maxDistance float64, limit, skip int) ([]CurrencyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	results := []CurrencyModel{}
+	err := c.Find(bson.M{
+		"location": bson.M{"$nearSphere": bson.M{"$geometry": point, "$maxDistance": maxDistance}},
+		"hidden":   bson.M{"$ne": true},
+	}).Skip(skip).Limit(limit).All(&results)
+	return results, err
+}
+
+// find visible currencies within a bounding box, most recent first
+func (m *CurrencyModel) FindWithinBox(ses *mgo.Session, minLng, minLat, maxLng, maxLat float64, limit, skip int) ([]CurrencyModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	results := []CurrencyModel{}
+	box := bson.M{
+		"type": "Polygon",
+		"coordinates": [][][]float64{{
+			{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}, {minLng, minLat},
+		}},
+	}
+	err := c.Find(bson.M{
+		"location": bson.M{"$geoWithin": bson.M{"$geometry": box}},
+		"hidden":   bson.M{"$ne": true},
+	}).Sort("-created_at").Skip(skip).Limit(limit).All(&results)
+	return results, err
+}
+
+// The number of currencies in a region
+type RegionCount struct {
+	Latitude  float64 `json:"lat" bson:"lat"`
+	Longitude float64 `json:"lng" bson:"lng"`
+	Count     int     `json:"count" bson:"count"`
+}
+
+// Count the visible currencies matching a query in regions of cellSize degrees.
+// A region is identified by its south west corner. Regions with most currencies come first.
+func (m *CurrencyModel) CountByRegion(ses *mgo.Session, q bson.M, cellSize float64, limit int) ([]RegionCount, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+
+	match := bson.M{"location": bson.M{"$exists": true}, "hidden": bson.M{"$ne": true}}
+	for k, v := range q {
+		match[k] = v
+	}
+
+	cell := func(index int) bson.M {
+		coordinate := bson.M{"$arrayElemAt": []interface{}{"$location.coordinates", index}}
+		return bson.M{"$multiply": []interface{}{bson.M{"$floor": bson.M{"$divide": []interface{}{coordinate, cellSize}}}, cellSize}}
+	}
+
+	results := []RegionCount{}
+	err := c.Pipe([]bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": bson.M{"lat": cell(1), "lng": cell(0)}, "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.M{"count": -1}},
+		{"$limit": limit},
+		{"$project": bson.M{"_id": 0, "lat": "$_id.lat", "lng": "$_id.lng", "count": 1}},
+	}).All(&results)
+	return results, err
+}
+
+// coarsen the locations of the currencies of a user
+func (m *CurrencyModel) CoarsenUserLocations(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	return coarsenLocations(c, bson.M{"user_id": bson.ObjectIdHex(userId), "location": bson.M{"$exists": true}})
+}
+
+// count a sighting of a currency
+func (m *CurrencyModel) AddSighting(ses *mgo.Session, id string, seenAt time.Time) error {
 	ses.SetMode(mgo.Monotonic, true)
 	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	return c.UpdateId(bson.ObjectIdHex(id), bson.M{"$inc": bson.M{"sighting_count": 1}, "$set": bson.M{"last_seen_at": seenAt}})
+}
+
+// Move the currencies and votes of a user to another user. A user has
+// at most one vote per currency so one positional update per currency suffices.
+func (m *CurrencyModel) ReassignUser(ses *mgo.Session, fromUserId, toUserId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	from, to := bson.ObjectIdHex(fromUserId), bson.ObjectIdHex(toUserId)
+	users := []bson.ObjectId{from, to}
+
+	// a user has one vote per currency. Keep the vote of the user the other
+	// user is reassigned to. The votes of currencies whose outcome was decided
+	// are kept so the recorded outcome still matches its votes.
+	if _, err := c.UpdateAll(bson.M{"status": "awaiting_votes", "votes.user_id": bson.M{"$all": users}}, bson.M{"$pull": bson.M{"votes": bson.M{"user_id": from}}}); err != nil {
+		return err
+	}
+
+	// votes on the currencies of either user become votes on the user's own currencies
+	if _, err := c.UpdateAll(bson.M{"status": "awaiting_votes", "user_id": bson.M{"$in": users}, "votes.user_id": bson.M{"$in": users}}, bson.M{"$pull": bson.M{"votes": bson.M{"user_id": bson.M{"$in": users}}}}); err != nil {
+		return err
+	}
+
+	if _, err := c.UpdateAll(bson.M{"user_id": from}, bson.M{"$set": bson.M{"user_id": to}}); err != nil {
+		return err
+	}
+	_, err := c.UpdateAll(bson.M{"votes.user_id": from}, bson.M{"$set": bson.M{"votes.$.user_id": to}})
+	return err
+}
+
+// Store the currency codes of currencies indexed before codes were
+// normalized in upper case. Returns the number of currencies updated.
+func (m *CurrencyModel) NormalizeCurrencyCodes(ses *mgo.Session) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+
+	var currency CurrencyModel
+	updated := 0
+	iter := c.Find(bson.M{"currency_code": bson.RegEx{Pattern: `[a-z]|^\s|\s$`}}).Select(bson.M{"currency_code": 1}).Iter()
+	for iter.Next(&currency) {
+		code := strings.ToUpper(strings.TrimSpace(currency.CurrencyCode))
+		if err := c.UpdateId(currency.Id, bson.M{"$set": bson.M{"currency_code": code}}); err != nil {
+			iter.Close()
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, iter.Close()
+}
+
+// Filters of a currency listing. Zero values are ignored.
+type CurrencyFilter struct {
+	UserId        string
+	CurrencyCode  string
+	Denomination  string
+	Status        string
+	Tag           string
+	CollectionId  string
+	SerialPattern string
+	ExcludeHidden bool
+	From          time.Time
+	To            time.Time
+}
+
+// get the query of a filter
+func (f *CurrencyFilter) query() bson.M {
+	q := bson.M{}
+	if f.UserId != "" {
+		q["user_id"] = bson.ObjectIdHex(f.UserId)
+	}
+	if f.CurrencyCode != "" {
+		q["currency_code"] = f.CurrencyCode
+	}
+	if f.Denomination != "" {
+		q["denomination"] = f.Denomination
+	}
+	if f.Status != "" {
+		q["status"] = f.Status
+	}
+	if f.Tag != "" {
+		q["tags"] = f.Tag
+	}
+	if f.CollectionId != "" {
+		q["collections"] = bson.ObjectIdHex(f.CollectionId)
+	}
+	if f.SerialPattern != "" {
+		q["serial_patterns"] = f.SerialPattern
+	}
+	if f.ExcludeHidden {
+		q["hidden"] = bson.M{"$ne": true}
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		createdAt := bson.M{}
+		if !f.From.IsZero() {
+			createdAt["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			createdAt["$lt"] = f.To
+		}
+		q["created_at"] = createdAt
+	}
+	return q
+}
+
+// Returned when a listing cursor cannot be decoded
+var ErrInvalidCursor = errors.New("cursor is invalid")
+
+// Create the cursor of the position after a currency in a listing
+// ordered by creation time and id, most recent first.
+func EncodeCurrencyCursor(createdAt time.Time, id bson.ObjectId) string {
+	ms := createdAt.UnixNano() / int64(time.Millisecond)
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(ms, 10) + ":" + id.Hex()))
+}
+
+// Decode a cursor created by EncodeCurrencyCursor
+func DecodeCurrencyCursor(cursor string) (time.Time, bson.ObjectId, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	parts := strings.Split(string(data), ":")
+	if len(parts) != 2 || !bson.IsObjectIdHex(parts[1]) {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC(), bson.ObjectIdHex(parts[1]), nil
+}
+
+// find a page of currencies matching a filter, most recent first. The page starts
+// after the cursor if set. Returns the cursor of the next page or an empty string
+// if there are no more currencies.
+func (m *CurrencyModel) FindPage(ses *mgo.Session, filter *CurrencyFilter, cursor string, limit int) ([]CurrencyModel, string, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+
+	q := filter.query()
+	if cursor != "" {
+		createdAt, id, err := DecodeCurrencyCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		q = bson.M{"$and": []bson.M{q, {"$or": []bson.M{
+			{"created_at": bson.M{"$lt": createdAt}},
+			{"created_at": createdAt, "_id": bson.M{"$lt": id}},
+		}}}}
+	}
+
 	results := []CurrencyModel{}
-	err := c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Limit(limit).Sort(sort).Skip(skip).All(&results)
+	if err := c.Find(q).Sort("-created_at", "-_id").Limit(limit + 1).All(&results); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[limit-1]
+		next = EncodeCurrencyCursor(last.CreatedAt, last.Id)
+	}
+
+	return results, next, nil
+}
+
+// set the tags of a currency
+func (m *CurrencyModel) SetTags(ses *mgo.Session, id string, tags []string) error {
+	return m.Update(ses, id, bson.M{"$set": bson.M{"tags": tags}})
+}
+
+// Check whether the currency is held out of the vote queue for a risk review
+func (m *CurrencyModel) HeldForReview() bool {
+	return m.RiskReview == RiskReviewPending
+}
+
+// Check whether the currency has a risk reason
+func (m *CurrencyModel) HasRiskReason(code string) bool {
+	for _, r := range m.RiskReasons {
+		if r.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// set the risk score, reasons and review state of a currency
+func (m *CurrencyModel) SetRisk(ses *mgo.Session, id string, score int, reasons []RiskReason, review string) error {
+	return m.Update(ses, id, bson.M{"$set": bson.M{"risk_score": score, "risk_reasons": reasons, "risk_review": review}})
+}
+
+// set the serial patterns of a currency
+func (m *CurrencyModel) SetSerialPatterns(ses *mgo.Session, id string, patterns []string) error {
+	if len(patterns) == 0 {
+		return m.Update(ses, id, bson.M{"$unset": bson.M{"serial_patterns": ""}})
+	}
+	return m.Update(ses, id, bson.M{"$set": bson.M{"serial_patterns": patterns}})
+}
+
+// add currencies of a user to a collection. Currencies of other
+// users are ignored. Returns the number of currencies matched.
+func (m *CurrencyModel) AddToCollection(ses *mgo.Session, userId, collectionId string, ids []bson.ObjectId) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	info, err := c.UpdateAll(bson.M{"_id": bson.M{"$in": ids}, "user_id": bson.ObjectIdHex(userId)}, bson.M{"$addToSet": bson.M{"collections": bson.ObjectIdHex(collectionId)}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Matched, nil
+}
+
+// remove currencies from a collection. If no currency
+// is given, all currencies are removed from the collection.
+func (m *CurrencyModel) RemoveFromCollection(ses *mgo.Session, collectionId string, ids []bson.ObjectId) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	collection := bson.ObjectIdHex(collectionId)
+	q := bson.M{"collections": collection}
+	if len(ids) > 0 {
+		q["_id"] = bson.M{"$in": ids}
+	}
+	_, err := c.UpdateAll(q, bson.M{"$pull": bson.M{"collections": collection}})
+	return err
+}
+
+// Anonymize the currencies and votes of a user. They are moved to the deleted
+// user and the ip address, device, tags and collections of the user are removed.
+func (m *CurrencyModel) AnonymizeUser(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	from, to := bson.ObjectIdHex(userId), bson.ObjectIdHex(DELETED_USER_ID)
+	if _, err := c.UpdateAll(bson.M{"user_id": from}, bson.M{"$set": bson.M{"user_id": to, "uploader_ip": "", "uploader_fingerprint": ""}, "$unset": bson.M{"tags": "", "collections": ""}}); err != nil {
+		return err
+	}
+	_, err := c.UpdateAll(bson.M{"votes.user_id": from}, bson.M{"$set": bson.M{"votes.$.user_id": to, "votes.$.ip": "", "votes.$.fingerprint": ""}})
+	return err
+}
+
+// iterate over the votes cast by a user, oldest first
+func (m *CurrencyModel) IterVotesByUser(ses *mgo.Session, userId string) *mgo.Iter {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	id := bson.ObjectIdHex(userId)
+	return c.Pipe([]bson.M{
+		{"$match": bson.M{"votes.user_id": id}},
+		{"$unwind": "$votes"},
+		{"$match": bson.M{"votes.user_id": id}},
+		{"$project": bson.M{
+			"_id":           0,
+			"currency_id":   "$_id",
+			"currency_code": 1,
+			"denomination":  1,
+			"serial":        1,
+			"decision":      "$votes.decision",
+			"ip":            "$votes.ip",
+			"fingerprint":   "$votes.fingerprint",
+			"created_at":    "$votes.created_at",
+		}},
+		{"$sort": bson.M{"created_at": 1}},
+	}).Iter()
+}
+
+// iterate over the currencies matching a filter, oldest first
+func (m *CurrencyModel) Iter(ses *mgo.Session, filter *CurrencyFilter) *mgo.Iter {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	return c.Find(filter.query()).Sort("created_at", "_id").Iter()
+}
+
+// count the currencies matching a filter
+func (m *CurrencyModel) Count(ses *mgo.Session, filter *CurrencyFilter) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	return c.Find(filter.query()).Count()
+}
+
+// Find groups of votes cast by more than one user from the same
+// source. Field is the vote field identifying the source (ip or fingerprint).
+func (m *CurrencyModel) FindVoteClusters(ses *mgo.Session, field string, minUsers, limit int) ([]VoteCluster, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+	results := []VoteCluster{}
+	err := c.Pipe([]bson.M{
+		{"$unwind": "$votes"},
+		{"$match": bson.M{"votes." + field: bson.M{"$nin": []interface{}{"", nil}}}},
+		{"$group": bson.M{
+			"_id":           "$votes." + field,
+			"users":         bson.M{"$addToSet": "$votes.user_id"},
+			"currencies":    bson.M{"$addToSet": "$_id"},
+			"num_votes":     bson.M{"$sum": 1},
+			"last_voted_at": bson.M{"$max": "$votes.created_at"},
+		}},
+		{"$project": bson.M{
+			"users":         1,
+			"currencies":    1,
+			"num_votes":     1,
+			"last_voted_at": 1,
+			"num_users":     bson.M{"$size": "$users"},
+		}},
+		{"$match": bson.M{"num_users": bson.M{"$gte": minUsers}}},
+		{"$sort": bson.M{"num_users": -1}},
+		{"$limit": limit},
+	}).All(&results)
 	return results, err
 }
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The fields indexed currency counts can be grouped by
+var StatsGroupFields = []string{"currency", "denomination", "day"}
+
+// Filters of currency statistics. Zero values are ignored.
+type StatsFilter struct {
+	CurrencyCode string
+	From         time.Time
+	To           time.Time
+}
+
+// get the match stage of a filter. Hidden currencies are never counted.
+func (f *StatsFilter) match() bson.M {
+	q := bson.M{"hidden": bson.M{"$ne": true}}
+	if f.CurrencyCode != "" {
+		q["currency_code"] = f.CurrencyCode
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		createdAt := bson.M{}
+		if !f.From.IsZero() {
+			createdAt["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			createdAt["$lt"] = f.To
+		}
+		q["created_at"] = createdAt
+	}
+	return q
+}
+
+// The number of currencies indexed in a group
+type IndexedCount struct {
+	CurrencyCode string `json:"currency_code,omitempty" bson:"currency_code,omitempty"`
+	Denomination string `json:"denomination,omitempty" bson:"denomination,omitempty"`
+	Day          string `json:"day,omitempty" bson:"day,omitempty"`
+	Count        int    `json:"count" bson:"count"`
+}
+
+// The outcome of votes on the currencies of a currency code
+type VerificationStats struct {
+	CurrencyCode     string  `json:"currency_code" bson:"_id"`
+	Total            int     `json:"total" bson:"total"`
+	AwaitingVotes    int     `json:"awaiting_votes" bson:"awaiting_votes"`
+	Verified         int     `json:"verified" bson:"verified"`
+	Rejected         int     `json:"rejected" bson:"rejected"`
+	Disputed         int     `json:"disputed" bson:"disputed"`
+	VerificationRate float64 `json:"verification_rate" bson:"-"`
+}
+
+// The votes needed to decide the status of the currencies of a currency code
+type ConsensusStats struct {
+	CurrencyCode   string  `json:"currency_code" bson:"_id"`
+	Decided        int     `json:"decided" bson:"decided"`
+	AverageVotes   float64 `json:"average_votes" bson:"average_votes"`
+	AverageSeconds float64 `json:"average_seconds" bson:"average_ms"`
+}
+
+// The currencies indexed by a user
+type ContributorStats struct {
+	UserId   bson.ObjectId `json:"user_id" bson:"_id"`
+	Fullname string        `json:"full_name" bson:"-"`
+	PhotoURL string        `json:"photo_url" bson:"-"`
+	Indexed  int           `json:"indexed" bson:"indexed"`
+	Verified int           `json:"verified" bson:"verified"`
+}
+
+// count a status in a group stage
+func countStatus(status string) bson.M {
+	return bson.M{"$sum": bson.M{"$cond": []interface{}{bson.M{"$eq": []interface{}{"$status", status}}, 1, 0}}}
+}
+
+// count indexed currencies grouped by any of StatsGroupFields
+func (m *CurrencyModel) CountIndexed(ses *mgo.Session, filter *StatsFilter, groupBy []string) ([]IndexedCount, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+
+	id := bson.M{}
+	project := bson.M{"_id": 0, "count": 1}
+	for _, field := range groupBy {
+		switch field {
+		case "currency":
+			id["currency_code"] = "$currency_code"
+			project["currency_code"] = "$_id.currency_code"
+		case "denomination":
+			id["denomination"] = "$denomination"
+			project["denomination"] = "$_id.denomination"
+		case "day":
+			id["day"] = bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created_at"}}
+			project["day"] = "$_id.day"
+		}
+	}
+
+	results := []IndexedCount{}
+	err := c.Pipe([]bson.M{
+		{"$match": filter.match()},
+		{"$group": bson.M{"_id": id, "count": bson.M{"$sum": 1}}},
+		{"$project": project},
+		{"$sort": bson.D{{Name: "day", Value: 1}, {Name: "currency_code", Value: 1}, {Name: "denomination", Value: 1}}},
+	}).All(&results)
+	return results, err
+}
+
+// get the vote outcomes per currency code. The verification rate
+// is the share of decided currencies that were verified.
+func (m *CurrencyModel) VerificationStats(ses *mgo.Session, filter *StatsFilter) ([]VerificationStats, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+
+	results := []VerificationStats{}
+	err := c.Pipe([]bson.M{
+		{"$match": filter.match()},
+		{"$group": bson.M{
+			"_id":            "$currency_code",
+			"total":          bson.M{"$sum": 1},
+			"awaiting_votes": countStatus("awaiting_votes"),
+			"verified":       countStatus("verified"),
+			"rejected":       countStatus("rejected"),
+			"disputed":       countStatus("disputed"),
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}).All(&results)
+
+	for i := range results {
+		if decided := results[i].Verified + results[i].Rejected + results[i].Disputed; decided > 0 {
+			results[i].VerificationRate = float64(results[i].Verified) / float64(decided)
+		}
+	}
+
+	return results, err
+}
+
+// get the average number of votes and time from indexing to the
+// last vote of currencies whose status was decided, per currency code
+func (m *CurrencyModel) ConsensusStats(ses *mgo.Session, filter *StatsFilter) ([]ConsensusStats, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+
+	match := filter.match()
+	match["status"] = bson.M{"$in": []string{"verified", "rejected", "disputed"}}
+	match["votes.0"] = bson.M{"$exists": true}
+
+	results := []ConsensusStats{}
+	err := c.Pipe([]bson.M{
+		{"$match": match},
+		{"$project": bson.M{
+			"currency_code": 1,
+			"num_votes":     bson.M{"$size": "$votes"},
+			"duration":      bson.M{"$subtract": []interface{}{bson.M{"$max": "$votes.created_at"}, "$created_at"}},
+		}},
+		{"$group": bson.M{
+			"_id":           "$currency_code",
+			"decided":       bson.M{"$sum": 1},
+			"average_votes": bson.M{"$avg": "$num_votes"},
+			"average_ms":    bson.M{"$avg": "$duration"},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}).All(&results)
+
+	// durations are in milliseconds
+	for i := range results {
+		results[i].AverageSeconds = results[i].AverageSeconds / 1000
+	}
+
+	return results, err
+}
+
+// get the users who indexed most currencies. Currencies
+// of deleted users are not counted.
+func (m *CurrencyModel) TopContributors(ses *mgo.Session, filter *StatsFilter, limit int) ([]ContributorStats, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_currency_collection"))
+
+	results := []ContributorStats{}
+	err := c.Pipe([]bson.M{
+		{"$match": filter.match()},
+		{"$match": bson.M{"user_id": bson.M{"$ne": bson.ObjectIdHex(DELETED_USER_ID)}}},
+		{"$group": bson.M{
+			"_id":      "$user_id",
+			"indexed":  bson.M{"$sum": 1},
+			"verified": countStatus("verified"),
+		}},
+		{"$sort": bson.D{{Name: "indexed", Value: -1}, {Name: "verified", Value: -1}}},
+		{"$limit": limit},
+	}).All(&results)
+	if err != nil || len(results) == 0 {
+		return results, err
+	}
+
+	ids := []bson.ObjectId{}
+	for _, r := range results {
+		ids = append(ids, r.UserId)
+	}
+
+	users, err := User.FindByIds(ses, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		for _, user := range users {
+			if user.Id == results[i].UserId {
+				results[i].Fullname = user.Fullname
+				results[i].PhotoURL = user.PhotoURL
+			}
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// The redis pub/sub channel events are published to
+var EVENTS_CHANNEL = "openmint_events"
+
+// Event types
+const (
+	EventVoteAdded     = "currency.vote_added"
+	EventStatusChanged = "currency.status_changed"
+	EventVoteQueueItem = "vote_queue.item_added"
+	EventSighting      = "currency.sighted"
+	EventAchievement   = "user.achievement"
+	EventNotification  = "user.notification"
+)
+
+// An event describes something that happened to a currency.
+// Events with a user id are only delivered to that user,
+// all other events are delivered to every listener.
+type Event struct {
+	Type      string      `json:"type"`
+	UserId    string      `json:"user_id,omitempty"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Create a new event
+func NewEvent(eventType, userId string, data interface{}) *Event {
+	return &Event{
+		Type:      eventType,
+		UserId:    userId,
+		Data:      data,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// Publish an event to all server instances
+func PublishEvent(redisPool *redis.Pool, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err = conn.Do("PUBLISH", EVENTS_CHANNEL, payload)
+	return err
+}
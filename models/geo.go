@@ -0,0 +1,86 @@
+package models
+
+import (
+	"math"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The number of decimal places kept in coarse coordinates (about 11km)
+const COARSE_LOCATION_DECIMALS = 1
+
+// Where the location of a scan came from. Form locations are chosen
+// by the client, EXIF locations are read from the uploaded image.
+const (
+	LocationSourceForm = "form"
+	LocationSourceEXIF = "exif"
+)
+
+// The mean radius of the earth in meters
+const EARTH_RADIUS = 6371008.8
+
+// A GeoJSON point. Coordinates are longitude and latitude in decimal degrees.
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// Create a point
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// Check whether a latitude and longitude are within range
+func IsValidCoordinate(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// Get the latitude
+func (p *GeoPoint) Latitude() float64 {
+	return p.Coordinates[1]
+}
+
+// Get the longitude
+func (p *GeoPoint) Longitude() float64 {
+	return p.Coordinates[0]
+}
+
+// Get a copy of the point with its coordinates rounded
+// to COARSE_LOCATION_DECIMALS decimal places
+func (p *GeoPoint) Coarsen() *GeoPoint {
+	scale := math.Pow(10, COARSE_LOCATION_DECIMALS)
+	round := func(v float64) float64 {
+		return math.Floor(v*scale+0.5) / scale
+	}
+	return NewGeoPoint(round(p.Latitude()), round(p.Longitude()))
+}
+
+// Get the great-circle distance between two points in meters
+func (p *GeoPoint) DistanceTo(other *GeoPoint) float64 {
+	toRad := math.Pi / 180
+	lat1, lat2 := p.Latitude()*toRad, other.Latitude()*toRad
+	dLat := lat2 - lat1
+	dLng := (other.Longitude() - p.Longitude()) * toRad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EARTH_RADIUS * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Coarsen the locations of the documents of a collection matching a query
+func coarsenLocations(c *mgo.Collection, q bson.M) error {
+	var doc struct {
+		Id       bson.ObjectId `bson:"_id"`
+		Location *GeoPoint     `bson:"location"`
+	}
+	iter := c.Find(q).Select(bson.M{"location": 1}).Iter()
+	for iter.Next(&doc) {
+		if doc.Location == nil || len(doc.Location.Coordinates) != 2 {
+			continue
+		}
+		if err := c.UpdateId(doc.Id, bson.M{"$set": bson.M{"location": doc.Location.Coarsen()}}); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// The prefix of the redis sorted sets holding leaderboards
+var LEADERBOARD_PREFIX = "openmint_leaderboard_"
+
+// Leaderboards
+const (
+	LeaderboardNotes    = "notes"
+	LeaderboardVotes    = "votes"
+	LeaderboardAccuracy = "accuracy"
+)
+
+// Leaderboard windows
+const (
+	LeaderboardWeekly  = "weekly"
+	LeaderboardMonthly = "monthly"
+	LeaderboardAllTime = "all_time"
+)
+
+var Leaderboards = []string{LeaderboardNotes, LeaderboardVotes, LeaderboardAccuracy}
+var LeaderboardWindows = []string{LeaderboardWeekly, LeaderboardMonthly, LeaderboardAllTime}
+
+// Updates the vote accuracy of a user. The decided and correct votes of
+// users are counted in a hash and the user is only ranked once the
+// number of decided votes reaches the minimum.
+var voteAccuracyScript = redis.NewScript(2, `
+local decided = redis.call("HINCRBY", KEYS[2], ARGV[1] .. "_decided", 1)
+local correct = redis.call("HINCRBY", KEYS[2], ARGV[1] .. "_correct", ARGV[2])
+if decided >= tonumber(ARGV[3]) then
+	redis.call("ZADD", KEYS[1], correct / decided, ARGV[1])
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call("EXPIRE", KEYS[1], ARGV[4])
+	redis.call("EXPIRE", KEYS[2], ARGV[4])
+end
+return decided
+`)
+
+// A user's position in a leaderboard
+type LeaderboardEntry struct {
+	Rank   int     `json:"rank"`
+	UserId string  `json:"user_id"`
+	Score  float64 `json:"score"`
+}
+
+// Get the period of a leaderboard window a time falls in.
+// Weekly periods are ISO weeks (e.g 2016-W18), monthly periods
+// are calendar months (e.g 2016-05).
+func LeaderboardPeriod(window string, t time.Time) string {
+	t = t.UTC()
+	switch window {
+	case LeaderboardWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case LeaderboardMonthly:
+		return t.Format("2006-01")
+	default:
+		return "all"
+	}
+}
+
+// Get the name of the sorted set of a leaderboard window at a time
+func LeaderboardKey(board, window string, t time.Time) string {
+	return LEADERBOARD_PREFIX + board + "_" + LeaderboardPeriod(window, t)
+}
+
+// Get the number of seconds the leaderboard of a window is kept.
+// Previous periods are kept for a period after they end. All time
+// leaderboards do not expire.
+func leaderboardExpiry(window string) int64 {
+	switch window {
+	case LeaderboardWeekly:
+		return int64(14 * 24 * time.Hour / time.Second)
+	case LeaderboardMonthly:
+		return int64(62 * 24 * time.Hour / time.Second)
+	default:
+		return 0
+	}
+}
+
+// Increment the score of a user in every window of a leaderboard.
+// Returns the user's all time score.
+func IncrLeaderboard(redisPool *redis.Pool, board, userId string, by float64, at time.Time) (float64, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	conn.Send("MULTI")
+	for _, window := range LeaderboardWindows {
+		key := LeaderboardKey(board, window, at)
+		conn.Send("ZINCRBY", key, by, userId)
+		if expiry := leaderboardExpiry(window); expiry > 0 {
+			conn.Send("EXPIRE", key, expiry)
+		}
+	}
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+	return redis.Float64(values[len(values)-1], nil)
+}
+
+// Count a vote of a user on a currency whose status has been decided
+// in every window of the accuracy leaderboard. A vote is correct if it
+// matches the outcome. Users are ranked by the share of correct votes
+// once they have at least minVotes decided votes in a window.
+func RecordVoteAccuracy(redisPool *redis.Pool, userId string, correct bool, minVotes int, at time.Time) error {
+	conn := redisPool.Get()
+	defer conn.Close()
+	correctCount := 0
+	if correct {
+		correctCount = 1
+	}
+	for _, window := range LeaderboardWindows {
+		key := LeaderboardKey(LeaderboardAccuracy, window, at)
+		if _, err := voteAccuracyScript.Do(conn, key, key+"_counts", userId, correctCount, minVotes, leaderboardExpiry(window)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the top users of a leaderboard window at a time, highest score first
+func GetLeaderboard(redisPool *redis.Pool, board, window string, at time.Time, limit int) ([]LeaderboardEntry, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	values, err := redis.Values(conn.Do("ZREVRANGE", LeaderboardKey(board, window, at), 0, limit-1, "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+	entries := []LeaderboardEntry{}
+	for i := 0; i+1 < len(values); i += 2 {
+		userId, _ := redis.String(values[i], nil)
+		score, _ := redis.Float64(values[i+1], nil)
+		entries = append(entries, LeaderboardEntry{Rank: len(entries) + 1, UserId: userId, Score: score})
+	}
+	return entries, nil
+}
+
+// Get the position of a user in a leaderboard window at a time.
+// Returns nil if the user is not ranked.
+func GetLeaderboardEntry(redisPool *redis.Pool, board, window string, at time.Time, userId string) (*LeaderboardEntry, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	key := LeaderboardKey(board, window, at)
+	rank, err := redis.Int(conn.Do("ZREVRANK", key, userId))
+	if err != nil && err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	score, err := redis.Float64(conn.Do("ZSCORE", key, userId))
+	if err != nil {
+		return nil, err
+	}
+	return &LeaderboardEntry{Rank: rank + 1, UserId: userId, Score: score}, nil
+}
+
+// Remove a user from every period of every leaderboard window,
+// including the vote counts of the accuracy leaderboard
+func RemoveFromLeaderboards(redisPool *redis.Pool, userId string) error {
+	conn := redisPool.Get()
+	defer conn.Close()
+
+	var cursor = "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", LEADERBOARD_PREFIX+"*", "COUNT", 100))
+		if err != nil {
+			return err
+		}
+
+		cursor, _ = redis.String(values[0], nil)
+		keys, _ := redis.Strings(values[1], nil)
+		for _, key := range keys {
+			if strings.HasSuffix(key, "_counts") {
+				_, err = conn.Do("HDEL", key, userId+"_decided", userId+"_correct")
+			} else {
+				_, err = conn.Do("ZREM", key, userId)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Notification types
+const (
+	NotificationWatchlistMatch = "watchlist.match"
+)
+
+// An entry of a user's in-app notification feed
+type NotificationModel struct {
+	Id        bson.ObjectId `json:"id" bson:"_id"`
+	UserId    bson.ObjectId `json:"-" bson:"user_id"`
+	Type      string        `json:"type" bson:"type"`
+	Data      interface{}   `json:"data" bson:"data"`
+	Read      bool          `json:"read" bson:"read"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var (
+	Notification = NotificationModel{}
+)
+
+func (m *NotificationModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_notification_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndexKey("user_id", "read", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// add new notification
+func (m *NotificationModel) Create(ses *mgo.Session, data *NotificationModel) error {
+	data.CreatedAt = time.Now().UTC()
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_notification_col"))
+	return c.Insert(data)
+}
+
+// find the notifications of a user, most recent first
+func (m *NotificationModel) FindByUser(ses *mgo.Session, userId string, unreadOnly bool, limit, skip int) ([]NotificationModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_notification_col"))
+	q := bson.M{"user_id": bson.ObjectIdHex(userId)}
+	if unreadOnly {
+		q["read"] = false
+	}
+	results := []NotificationModel{}
+	err := c.Find(q).Sort("-created_at").Skip(skip).Limit(limit).All(&results)
+	return results, err
+}
+
+// count the unread notifications of a user
+func (m *NotificationModel) CountUnread(ses *mgo.Session, userId string) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_notification_col"))
+	return c.Find(bson.M{"user_id": bson.ObjectIdHex(userId), "read": false}).Count()
+}
+
+// mark notifications of a user as read. If no notification
+// is given, all notifications of the user are marked as read.
+// Returns the number of notifications matched.
+func (m *NotificationModel) MarkRead(ses *mgo.Session, userId string, ids []bson.ObjectId) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_notification_col"))
+	q := bson.M{"user_id": bson.ObjectIdHex(userId), "read": false}
+	if len(ids) > 0 {
+		q["_id"] = bson.M{"$in": ids}
+	}
+	info, err := c.UpdateAll(q, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Matched, nil
+}
+
+// iterate the notifications of a user, oldest first
+func (m *NotificationModel) IterByUser(ses *mgo.Session, userId string) *mgo.Iter {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_notification_col"))
+	return c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Sort("created_at").Iter()
+}
+
+// delete the notifications of a user
+func (m *NotificationModel) DeleteByUser(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_notification_col"))
+	_, err := c.RemoveAll(bson.M{"user_id": bson.ObjectIdHex(userId)})
+	return err
+}
+
+// move the notifications of a user to another user
+func (m *NotificationModel) ReassignUser(ses *mgo.Session, fromUserId, toUserId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_notification_col"))
+	_, err := c.UpdateAll(bson.M{"user_id": bson.ObjectIdHex(fromUserId)}, bson.M{"$set": bson.M{"user_id": bson.ObjectIdHex(toUserId)}})
+	return err
+}
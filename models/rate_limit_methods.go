@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// The prefix of keys counting requests in a rate limit window
+var RATE_LIMIT_PREFIX = "openmint_rate_"
+
+// Count a request against a rate limit. Requests are counted in fixed
+// windows. Returns the number of requests in the current window
+// and the time the window ends.
+func IncrRateCounter(redisPool *redis.Pool, name string, window time.Duration) (int, time.Time, error) {
+	return IncrRateCounterBy(redisPool, name, 1, window)
+}
+
+// Count a request costing a number of units against a rate limit.
+// Returns the number of units used in the current window.
+func IncrRateCounterBy(redisPool *redis.Pool, name string, units int, window time.Duration) (int, time.Time, error) {
+	now := time.Now().UTC()
+	windowStart := now.Truncate(window)
+	key := fmt.Sprintf("%s%s_%d", RATE_LIMIT_PREFIX, name, windowStart.Unix())
+	conn := redisPool.Get()
+	defer conn.Close()
+	conn.Send("MULTI")
+	conn.Send("INCRBY", key, units)
+	conn.Send("EXPIRE", key, int64(window/time.Second)+1)
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	count, err := redis.Int(values[0], nil)
+	return count, windowStart.Add(window), err
+}
+
+// The prefix of keys marking an action as taken in a window
+var THROTTLE_PREFIX = "openmint_throttle_"
+
+// Mark an action as taken. Returns false if it was
+// already taken within the window ending now.
+func Throttle(redisPool *redis.Pool, name string, window time.Duration) (bool, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err := redis.String(conn.Do("SET", THROTTLE_PREFIX+name, "-", "EX", int64(window/time.Second), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A refresh token allows a client to obtain a new access token.
+// Only the hash of the token is stored. Tokens created by rotating
+// another token share the family id of the token they replaced.
+type RefreshTokenModel struct {
+	Id         bson.ObjectId `json:"id" bson:"_id"`
+	UserId     bson.ObjectId `json:"user_id" bson:"user_id"`
+	TokenHash  string        `json:"-" bson:"token_hash"`
+	FamilyId   string        `json:"family_id" bson:"family_id"`
+	ReplacedBy string        `json:"replaced_by,omitempty" bson:"replaced_by"`
+	Revoked    bool          `json:"revoked" bson:"revoked"`
+	ExpiresAt  time.Time     `json:"expires_at" bson:"expires_at"`
+	CreatedAt  time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var (
+	RefreshToken = RefreshTokenModel{}
+)
+
+func (m *RefreshTokenModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_refresh_token_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndex(mgo.Index{Key: []string{"token_hash"}, Unique: true}) != nil {
+		panic("failed to ensure unique index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	// remove tokens once they expire
+	if c.EnsureIndex(mgo.Index{Key: []string{"expires_at"}, ExpireAfter: time.Second}) != nil {
+		panic("failed to ensure ttl index in " + colName + " collection")
+	}
+}
+
+// find by token hash
+func (m *RefreshTokenModel) FindByHash(ses *mgo.Session, tokenHash string) (*RefreshTokenModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_refresh_token_col"))
+	result := RefreshTokenModel{}
+	err := c.Find(bson.M{"token_hash": tokenHash}).One(&result)
+	return &result, err
+}
+
+// add new refresh token
+func (m *RefreshTokenModel) Create(ses *mgo.Session, data *RefreshTokenModel) error {
+	data.CreatedAt = time.Now().UTC()
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_refresh_token_col"))
+	return c.Insert(data)
+}
+
+// revoke a refresh token and record the token that replaced it.
+// Returns mgo.ErrNotFound if the token has already been revoked.
+func (m *RefreshTokenModel) Revoke(ses *mgo.Session, id, replacedBy string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_refresh_token_col"))
+	return c.Update(bson.M{"_id": bson.ObjectIdHex(id), "revoked": false}, bson.M{"$set": bson.M{"revoked": true, "replaced_by": replacedBy}})
+}
+
+// revoke all refresh tokens of a family
+func (m *RefreshTokenModel) RevokeFamily(ses *mgo.Session, familyId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_refresh_token_col"))
+	_, err := c.UpdateAll(bson.M{"family_id": familyId}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+// revoke all refresh tokens of a user
+func (m *RefreshTokenModel) RevokeAllForUser(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_refresh_token_col"))
+	_, err := c.UpdateAll(bson.M{"user_id": bson.ObjectIdHex(userId)}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
@@ -0,0 +1,62 @@
+package models
+
+// Risk reasons
+const (
+	RiskKnownCounterfeit = "known_counterfeit"
+	RiskSerialFormat     = "serial_format"
+	RiskSerialRange      = "serial_range"
+	RiskDenominationMix  = "denomination_mismatch"
+	RiskDuplicateSerial  = "duplicate_serial"
+	RiskImpossibleTravel = "impossible_travel"
+)
+
+// Risk review states. Currencies pending review are held
+// out of the vote queue until a moderator reviews them.
+const (
+	RiskReviewPending   = "pending"
+	RiskReviewCleared   = "cleared"
+	RiskReviewConfirmed = "confirmed"
+)
+
+// The highest risk score
+const MAX_RISK_SCORE = 100
+
+// A reason a currency may be counterfeit
+type RiskReason struct {
+	Code   string `json:"code" bson:"code"`
+	Score  int    `json:"score" bson:"score"`
+	Detail string `json:"detail" bson:"detail"`
+}
+
+// Get the risk score of a set of reasons
+func RiskScore(reasons []RiskReason) int {
+	score := 0
+	for _, r := range reasons {
+		score += r.Score
+	}
+	if score > MAX_RISK_SCORE {
+		return MAX_RISK_SCORE
+	}
+	return score
+}
+
+// Add reasons that are not in a set of reasons. Returns
+// the combined reasons and the number of reasons added.
+func MergeRiskReasons(reasons, other []RiskReason) ([]RiskReason, int) {
+	merged := append([]RiskReason{}, reasons...)
+	added := 0
+	for _, r := range other {
+		found := false
+		for _, existing := range reasons {
+			if existing.Code == r.Code && existing.Detail == r.Detail {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, r)
+			added++
+		}
+	}
+	return merged, added
+}
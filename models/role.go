@@ -0,0 +1,64 @@
+package models
+
+// User roles
+const (
+	RoleAdmin        = "admin"
+	RoleModerator    = "moderator"
+	RoleInvestigator = "investigator"
+)
+
+// Permissions granted by roles
+const (
+	PermModerateCurrency = "currency:moderate"
+	PermDeleteCurrency   = "currency:delete"
+	PermBanUser          = "user:ban"
+	PermReviewVotes      = "vote:review"
+	PermManageRoles      = "user:roles"
+	PermViewMetrics      = "metrics:view"
+	PermExportCurrencies = "currency:export"
+	PermManageRisk       = "risk:manage"
+	PermBroadWatchlists  = "watchlist:broad"
+)
+
+// Roles a user can be assigned
+var Roles = []string{
+	RoleAdmin,
+	RoleModerator,
+	RoleInvestigator,
+}
+
+// The permissions of each role
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermModerateCurrency,
+		PermDeleteCurrency,
+		PermBanUser,
+		PermReviewVotes,
+		PermManageRoles,
+		PermViewMetrics,
+		PermExportCurrencies,
+		PermManageRisk,
+		PermBroadWatchlists,
+	},
+	RoleModerator: {
+		PermModerateCurrency,
+		PermDeleteCurrency,
+		PermBanUser,
+		PermReviewVotes,
+	},
+	RoleInvestigator: {
+		PermBroadWatchlists,
+	},
+}
+
+// Check whether any of the roles grants a permission
+func RolesHavePermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range RolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A range of serials made of a prefix and a number (e.g AB00001000 - AB00002000)
+type SerialRange struct {
+	Prefix string `json:"prefix" bson:"prefix"`
+	From   uint64 `json:"from" bson:"from"`
+	To     uint64 `json:"to" bson:"to"`
+}
+
+// Check whether a serial is made of a prefix and a number between from and to
+func SerialInRange(serial, prefix string, from, to uint64) bool {
+	if !strings.HasPrefix(serial, prefix) {
+		return false
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(serial, prefix), 10, 64)
+	return err == nil && n >= from && n <= to
+}
+
+// Check whether a serial is in the range
+func (r SerialRange) Contains(serial string) bool {
+	return SerialInRange(serial, r.Prefix, r.From, r.To)
+}
+
+// The serial format and the serial ranges issued for a denomination of a currency.
+// Serials of the denomination must fully match the format and, if ranges are set,
+// fall in one of the ranges.
+type SerialRuleModel struct {
+	Id           bson.ObjectId `json:"id" bson:"_id"`
+	CurrencyCode string        `json:"currency_code" bson:"currency_code"`
+	Denomination string        `json:"denomination" bson:"denomination"`
+	Format       string        `json:"format,omitempty" bson:"format,omitempty"`
+	Ranges       []SerialRange `json:"ranges,omitempty" bson:"ranges,omitempty"`
+	UpdatedAt    time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+var (
+	SerialRule = SerialRuleModel{}
+)
+
+func (m *SerialRuleModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_serial_rule_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndex(mgo.Index{Key: []string{"currency_code", "denomination"}, Unique: true}) != nil {
+		panic("failed to ensure unique index in " + colName + " collection")
+	}
+}
+
+// find the rules of a currency
+func (m *SerialRuleModel) FindByCurrency(ses *mgo.Session, currencyCode string) ([]SerialRuleModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_serial_rule_col"))
+	results := []SerialRuleModel{}
+	err := c.Find(bson.M{"currency_code": currencyCode}).Sort("denomination").All(&results)
+	return results, err
+}
+
+// replace the rules of a currency
+func (m *SerialRuleModel) Replace(ses *mgo.Session, currencyCode string, rules []SerialRuleModel) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_serial_rule_col"))
+	if _, err := c.RemoveAll(bson.M{"currency_code": currencyCode}); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	docs := []interface{}{}
+	for i := range rules {
+		rules[i].Id = NewId()
+		rules[i].CurrencyCode = currencyCode
+		rules[i].UpdatedAt = now
+		docs = append(docs, rules[i])
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	return c.Insert(docs...)
+}
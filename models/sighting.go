@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A scan of a currency that had already been indexed.
+// The user and device that scanned the note are not exposed.
+type SightingModel struct {
+	Id             bson.ObjectId `json:"id" bson:"_id"`
+	CurrencyId     bson.ObjectId `json:"currency_id" bson:"currency_id"`
+	UserId         bson.ObjectId `json:"-" bson:"user_id"`
+	IP             string        `json:"-" bson:"ip"`
+	Fingerprint    string        `json:"-" bson:"fingerprint"`
+	Location       *GeoPoint     `json:"location,omitempty" bson:"location,omitempty"`
+	LocationSource string        `json:"-" bson:"location_source,omitempty"`
+	CreatedAt      time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var (
+	Sighting = SightingModel{}
+)
+
+func (m *SightingModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_sighting_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndexKey("currency_id", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("$2dsphere:location") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// add new sighting
+func (m *SightingModel) Create(ses *mgo.Session, data *SightingModel) error {
+	data.CreatedAt = time.Now().UTC()
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	return c.Insert(data)
+}
+
+// find the sightings of a currency, most recent first
+func (m *SightingModel) FindByCurrency(ses *mgo.Session, currencyId string, limit, skip int) ([]SightingModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	results := []SightingModel{}
+	err := c.Find(bson.M{"currency_id": bson.ObjectIdHex(currencyId)}).Sort("-created_at").Skip(skip).Limit(limit).All(&results)
+	return results, err
+}
+
+// find the most recent sighting of a currency by a user
+func (m *SightingModel) FindLatestByUser(ses *mgo.Session, currencyId, userId string) (*SightingModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	var result SightingModel
+	err := c.Find(bson.M{"currency_id": bson.ObjectIdHex(currencyId), "user_id": bson.ObjectIdHex(userId)}).Sort("-created_at").One(&result)
+	return &result, err
+}
+
+// delete the sightings of a currency
+func (m *SightingModel) DeleteByCurrency(ses *mgo.Session, currencyId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	_, err := c.RemoveAll(bson.M{"currency_id": bson.ObjectIdHex(currencyId)})
+	return err
+}
+
+// coarsen the locations of the sightings of a user
+func (m *SightingModel) CoarsenUserLocations(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	return coarsenLocations(c, bson.M{"user_id": bson.ObjectIdHex(userId), "location": bson.M{"$exists": true}})
+}
+
+// move the sightings of a user to another user
+func (m *SightingModel) ReassignUser(ses *mgo.Session, fromUserId, toUserId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	_, err := c.UpdateAll(bson.M{"user_id": bson.ObjectIdHex(fromUserId)}, bson.M{"$set": bson.M{"user_id": bson.ObjectIdHex(toUserId)}})
+	return err
+}
+
+// delete the sightings of a user
+func (m *SightingModel) DeleteByUser(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	_, err := c.RemoveAll(bson.M{"user_id": bson.ObjectIdHex(userId)})
+	return err
+}
+
+// iterate over the sightings of a user, oldest first
+func (m *SightingModel) IterByUser(ses *mgo.Session, userId string) *mgo.Iter {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_sighting_col"))
+	return c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Sort("created_at").Iter()
+}
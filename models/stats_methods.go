@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// The prefix of keys holding cached statistics
+var STATS_CACHE_PREFIX = "openmint_stats_"
+
+// Get cached statistics. Returns an empty string if
+// the statistics are not cached or have expired.
+func GetCachedStats(redisPool *redis.Pool, key string) (string, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	value, err := redis.String(conn.Do("GET", STATS_CACHE_PREFIX+key))
+	if err != nil && err == redis.ErrNil {
+		return "", nil
+	}
+	return value, err
+}
+
+// Cache statistics for a duration
+func CacheStats(redisPool *redis.Pool, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SETEX", STATS_CACHE_PREFIX+key, int64(ttl/time.Second), value)
+	return err
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// The prefix of keys marking an access token as revoked
+var DENIED_TOKEN_PREFIX = "openmint_denied_jti_"
+
+// The prefix of keys holding the time before which
+// all access tokens of a user are considered revoked
+var USER_TOKENS_REVOKED_PREFIX = "openmint_user_tokens_revoked_"
+
+// Add an access token id to the denylist. The entry
+// expires when the access token would have expired.
+func DenyToken(redisPool *redis.Pool, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SETEX", DENIED_TOKEN_PREFIX+jti, int64(ttl/time.Second)+1, "-")
+	return err
+}
+
+// Check whether an access token id is in the denylist
+func IsTokenDenied(redisPool *redis.Pool, jti string) (bool, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	return redis.Bool(conn.Do("EXISTS", DENIED_TOKEN_PREFIX+jti))
+}
+
+// Revoke all access tokens issued to a user before now. The time is stored
+// in milliseconds. The entry lives as long as the longest living access token.
+func RevokeUserTokens(redisPool *redis.Pool, userId string, ttl time.Duration) error {
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SETEX", USER_TOKENS_REVOKED_PREFIX+userId, int64(ttl/time.Second)+1, UnixMilli(time.Now()))
+	return err
+}
+
+// Get the time before which all access tokens of a user are revoked.
+// Returns a zero time if the user's tokens have not been revoked.
+func GetUserTokensRevokedAt(redisPool *redis.Pool, userId string) (time.Time, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	value, err := redis.String(conn.Do("GET", USER_TOKENS_REVOKED_PREFIX+userId))
+	if err != nil && err == redis.ErrNil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// revocations stored before times were kept in milliseconds
+	if millis < UNIX_MILLI_THRESHOLD {
+		return time.Unix(millis, 0).UTC(), nil
+	}
+	return FromUnixMilli(millis), nil
+}
+
+// Unix times below this value are in seconds rather than milliseconds
+var UNIX_MILLI_THRESHOLD int64 = 100000000000
+
+// Get the number of milliseconds elapsed since the unix epoch
+func UnixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Get the time of a number of milliseconds since the unix epoch
+func FromUnixMilli(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC()
+}
+
+// Check whether a token issued at a time is revoked by a revocation of all
+// tokens of its user. Times are compared in milliseconds, so a session started
+// right after the revocation is kept while tokens issued earlier in the same
+// second are revoked. The token used to revoke all tokens is denied by its id.
+func IsTokenRevokedAt(issuedAt, revokedAt time.Time) bool {
+	return !revokedAt.IsZero() && issuedAt.Before(revokedAt)
+}
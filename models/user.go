@@ -7,20 +7,61 @@ import (
 	"time"
 )
 
+// A social login identity linked to a user
+type Identity struct {
+	Provider       string    `json:"provider" bson:"provider"`
+	ProviderUserId string    `json:"provider_id" bson:"provider_id"`
+	Email          string    `json:"email,omitempty" bson:"email"`
+	EmailVerified  bool      `json:"email_verified" bson:"email_verified"`
+	LinkedAt       time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// Achievements
+const (
+	AchievementFirstNote   = "first_note"
+	AchievementVotes100    = "100_votes"
+	AchievementNewCurrency = "new_currency"
+)
+
+// The id the anonymized currencies and votes of deleted users are moved to
+var DELETED_USER_ID = "000000000000000000000000"
+
+// The number of votes a user must cast to earn AchievementVotes100
+const ACHIEVEMENT_VOTES = 100
+
+// An achievement earned by a user
+type Achievement struct {
+	Name      string    `json:"name" bson:"name"`
+	AwardedAt time.Time `json:"awarded_at" bson:"awarded_at"`
+}
+
 type UserModel struct {
 
 	// Collection attributes
 	Id             bson.ObjectId `json:"id" bson:"_id"`
 	Fullname       string        `json:"full_name" bson:"full_name" valid:"required"`
-	Email          string        `json:"email" bson:"email" valid:"required,email"`
+	Email          string        `json:"email" bson:"email" valid:"email"`
+	EmailVerified  bool          `json:"email_verified" bson:"email_verified"`
 	PhotoURL       string        `json:"photo_url" bson:"photo_url" valid:"required"`
 	Provider       string        `json:"provider" bson:"provider" valid:"required"`
 	ProviderUserId string        `json:"provider_id" bson:"provider_id" valid:"required"`
 	AccessToken    string        `json:"access_token,omitempty" bson:"access_token" valid:"required"`
 	AccessSecret   string        `json:"access_secret,omitempty" bson:"access_secret"` // twitter only
+	Identities     []Identity    `json:"identities" bson:"identities"`
+	Roles          []string      `json:"roles" bson:"roles"`
+	Banned         bool          `json:"banned" bson:"banned"`
+	BanReason      string        `json:"ban_reason,omitempty" bson:"ban_reason"`
+	BannedAt       time.Time     `json:"banned_at" bson:"banned_at"`
+	CoarseLocation bool          `json:"coarse_location" bson:"coarse_location"`
+	Achievements   []Achievement `json:"achievements" bson:"achievements"`
 	CreatedAt      time.Time     `json:"created_at" bson:"created_at"`
+	MergedInto     bson.ObjectId `json:"-" bson:"merged_into,omitempty"`     // set while the user is merged into another user
+	HeldIdentities []Identity    `json:"-" bson:"held_identities,omitempty"` // identities released for a merge
 	Multiplier     float64       `json:"multiplier" bson:"multiplier"`
 	TokenString    string        `json:"session_token,omitempty" bson:"-"`
+	RefreshToken   string        `json:"refresh_token,omitempty" bson:"-"`
+	IdToken        string        `json:"id_token,omitempty" bson:"-"`
+	Nonce          string        `json:"nonce,omitempty" bson:"-"`
 }
 
 var (
@@ -34,6 +75,91 @@ func (m *UserModel) EnsureIndex(ses *mgo.Session) {
 	if c.EnsureIndexKey("email") != nil {
 		panic("failed to ensure index in " + colName + " collection")
 	}
+
+	index := mgo.Index{
+		Key:    []string{"identities.provider", "identities.provider_id"},
+		Unique: true,
+		Sparse: true,
+	}
+
+	if c.EnsureIndex(index) != nil {
+		panic("failed to ensure identities index in " + colName + " collection")
+	}
+}
+
+// Get the identities linked to the user. Users created before
+// identities were introduced only have their primary identity.
+func (m *UserModel) LinkedIdentities() []Identity {
+	for _, identity := range m.Identities {
+		if identity.Provider == m.Provider && identity.ProviderUserId == m.ProviderUserId {
+			return m.Identities
+		}
+	}
+	primary := Identity{Provider: m.Provider, ProviderUserId: m.ProviderUserId, Email: m.Email, LinkedAt: m.CreatedAt}
+	return append([]Identity{primary}, m.Identities...)
+}
+
+// Check whether the user has a permission through one of their roles
+func (m *UserModel) HasPermission(permission string) bool {
+	return RolesHavePermission(m.Roles, permission)
+}
+
+// find the user an identity is linked to
+func (m *UserModel) FindByIdentity(ses *mgo.Session, provider, providerUserId string) (*UserModel, error) {
+	return m.Find(ses, bson.M{"$or": []bson.M{
+		{"provider": provider, "provider_id": providerUserId},
+		{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "provider_id": providerUserId}}},
+	}})
+}
+
+// set the roles of a user
+func (m *UserModel) SetRoles(ses *mgo.Session, id string, roles []string) error {
+	return m.Update(ses, id, bson.M{"$set": bson.M{"roles": roles}})
+}
+
+// set whether the locations of the user's scans are coarsened
+func (m *UserModel) SetCoarseLocation(ses *mgo.Session, id string, coarse bool) error {
+	return m.Update(ses, id, bson.M{"$set": bson.M{"coarse_location": coarse}})
+}
+
+// ban or unban a user
+func (m *UserModel) SetBanned(ses *mgo.Session, id string, banned bool, reason string) error {
+	update := bson.M{"banned": banned, "ban_reason": reason, "banned_at": time.Now().UTC()}
+	if !banned {
+		update = bson.M{"banned": false, "ban_reason": "", "banned_at": time.Time{}}
+	}
+	return m.Update(ses, id, bson.M{"$set": update})
+}
+
+// add an achievement to a user. Returns false if the user already has it.
+func (m *UserModel) AddAchievement(ses *mgo.Session, id string, achievement Achievement) (bool, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_cloudmint_user_col"))
+	err := c.Update(bson.M{"_id": bson.ObjectIdHex(id), "achievements.name": bson.M{"$ne": achievement.Name}}, bson.M{"$push": bson.M{"achievements": achievement}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// replace the linked identities of a user
+func (m *UserModel) SetIdentities(ses *mgo.Session, id string, identities []Identity) error {
+	return m.Update(ses, id, bson.M{"$set": bson.M{"identities": identities}})
+}
+
+// Record that a user is being merged into another user. Returns
+// mgo.ErrNotFound if the user is being merged into a different user.
+func (m *UserModel) StartMerge(ses *mgo.Session, id, intoId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_cloudmint_user_col"))
+	into := bson.ObjectIdHex(intoId)
+	return c.Update(bson.M{"_id": bson.ObjectIdHex(id), "merged_into": bson.M{"$in": []interface{}{nil, into}}}, bson.M{"$set": bson.M{"merged_into": into}})
+}
+
+// Release the identities of a user being merged. The identities are held
+// until the user is deleted so an interrupted merge can be resumed.
+func (m *UserModel) ReleaseIdentities(ses *mgo.Session, id string, identities []Identity) error {
+	return m.Update(ses, id, bson.M{"$unset": bson.M{"identities": ""}, "$set": bson.M{"held_identities": identities}})
 }
 
 // find by arbitrary query
@@ -54,6 +180,11 @@ func (m *UserModel) FindByField(ses *mgo.Session, field, value string) (*UserMod
 	return &asset, err
 }
 
+// find the user whose email was verified by a provider
+func (m *UserModel) FindByVerifiedEmail(ses *mgo.Session, email string) (*UserModel, error) {
+	return m.Find(ses, bson.M{"email": email, "email_verified": true})
+}
+
 // find by id
 func (m *UserModel) FindById(ses *mgo.Session, id string) (*UserModel, error) {
 	ses.SetMode(mgo.Monotonic, true)
@@ -63,6 +194,15 @@ func (m *UserModel) FindById(ses *mgo.Session, id string) (*UserModel, error) {
 	return &asset, err
 }
 
+// find many by id
+func (m *UserModel) FindByIds(ses *mgo.Session, ids []bson.ObjectId) ([]UserModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_cloudmint_user_col"))
+	results := []UserModel{}
+	err := c.Find(bson.M{"_id": bson.M{"$in": ids}}).All(&results)
+	return results, err
+}
+
 // add new app entry
 func (m *UserModel) Create(ses *mgo.Session, data *UserModel) error {
 	data.CreatedAt = time.Now().UTC()
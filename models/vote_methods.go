@@ -3,60 +3,121 @@ package models
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/ellcrys/openmint/config"
 	"github.com/garyburd/redigo/redis"
 )
 
-// The name of the redis list acting as a queue
-var VOTE_QUEUE_NAME = "openmint_vote_queue"
+// The name of the redis sorted set acting as the main vote queue.
+// Every queued currency is a member of this set.
+var VOTE_QUEUE_NAME = "openmint_vote_queue_z"
+
+// The name of the redis list that held the vote queue before
+// it became a sorted set. See DropLegacyVoteQueue.
+var LEGACY_VOTE_QUEUE_NAME = "openmint_vote_queue"
 
 // The vote session prefix
 var VOTE_SESSION_PREFIX = "openmint_vote_session"
 
-// Adds a currency id to the redis list
-// being used as a queue.
-func AddToVoteQueue(redisPool *redis.Pool, currencyId string) error {
+// The number of seconds a single priority level
+// is worth when scoring a currency in the vote queue.
+// A currency with a priority of 1 is served as if it was
+// queued an hour earlier than it actually was.
+var VOTE_QUEUE_PRIORITY_STEP int64 = 3600
+
+// Get the name of the vote queue of a currency code.
+// Each currency code has its own sub-queue that holds
+// only currencies of that code.
+func VoteQueueName(curCode string) string {
+	if curCode == "" {
+		return VOTE_QUEUE_NAME
+	}
+	return VOTE_QUEUE_NAME + "_" + strings.ToUpper(curCode)
+}
+
+// Compute the score of a currency in the vote queue.
+// Older currencies and currencies with higher priority
+// have lower scores and are served first.
+func VoteQueueScore(queuedAt time.Time, priority int) int64 {
+	return queuedAt.Unix() - int64(priority)*VOTE_QUEUE_PRIORITY_STEP
+}
+
+// Delete the list that held the vote queue before it became a sorted set.
+// Returns whether the list existed. The currencies it held are queued
+// again from mongo by the vote queue reconciler.
+func DropLegacyVoteQueue(redisPool *redis.Pool) (bool, error) {
 	conn := redisPool.Get()
 	defer conn.Close()
-	if _, err := redis.Int64(conn.Do("RPUSH", VOTE_QUEUE_NAME, currencyId)); err != nil {
+	keyType, err := redis.String(conn.Do("TYPE", LEGACY_VOTE_QUEUE_NAME))
+	if err != nil || keyType != "list" {
+		return false, err
+	}
+	if _, err = conn.Do("DEL", LEGACY_VOTE_QUEUE_NAME); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Adds a currency id to the main vote queue and the sub-queue
+// of its currency code. The currency keeps its original score
+// if it is already queued so re-adding it does not reset its age.
+func AddToVoteQueue(redisPool *redis.Pool, currencyId, curCode string, queuedAt time.Time, priority int) error {
+	conn := redisPool.Get()
+	defer conn.Close()
+	score := VoteQueueScore(queuedAt, priority)
+	conn.Send("MULTI")
+	conn.Send("ZADD", VOTE_QUEUE_NAME, "NX", score, currencyId)
+	conn.Send("ZADD", VoteQueueName(curCode), "NX", score, currencyId)
+	if _, err := conn.Do("EXEC"); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Gets a currency from the tail of vote queue and also
-// move the returned currency to the head of the vote queue
-// using the RPOPLPUSH command
-func GetFromVoteQueue(redisPool *redis.Pool) (string, error) {
+// Gets a batch of currency ids from the vote queue starting at
+// the given offset. Ids are returned from the lowest score (the oldest
+// or highest priority currency) to the highest. If curCode is set, only
+// the sub-queue of that currency code is read.
+func GetFromVoteQueue(redisPool *redis.Pool, curCode string, offset, count int) ([]string, error) {
 	conn := redisPool.Get()
 	defer conn.Close()
-	currencyId, err := redis.String(conn.Do("RPOPLPUSH", VOTE_QUEUE_NAME, VOTE_QUEUE_NAME))
-	if err != nil {
-		return "", err
-	}
-	return currencyId, nil
+	return redis.Strings(conn.Do("ZRANGE", VoteQueueName(curCode), offset, offset+count-1))
 }
 
-// Remove a currency id from the vote queue list
-func RemoveFromVoteQueue(redisPool *redis.Pool, currencyId string) error {
+// Remove a currency id from the main vote queue and the
+// sub-queue of its currency code
+func RemoveFromVoteQueue(redisPool *redis.Pool, currencyId, curCode string) error {
 	conn := redisPool.Get()
 	defer conn.Close()
-	if _, err := redis.Int64(conn.Do("LREM", VOTE_QUEUE_NAME, 0, currencyId)); err != nil {
+	conn.Send("MULTI")
+	conn.Send("ZREM", VOTE_QUEUE_NAME, currencyId)
+	conn.Send("ZREM", VoteQueueName(curCode), currencyId)
+	if _, err := conn.Do("EXEC"); err != nil {
 		return err
 	}
 	return nil
 }
 
+// Get the key of the set holding the vote sessions of a currency
+func currencySessionKey(currencyId string) string {
+	return VOTE_SESSION_PREFIX + "_" + currencyId
+}
+
+// Get the key that marks a vote session as active
+func voteSessionKey(voteSessionId string) string {
+	return "vote_session_" + voteSessionId
+}
+
 // Count the number of active session
 func CountActiveSessions(redisPool *redis.Pool, currencyId string) (int, error) {
 
-	// var currencySessionKey = VOTE_SESSION_PREFIX + "_" + currencyId
-	var currencySessionKey = "myset"
 	conn := redisPool.Get()
 	defer conn.Close()
 
 	// get active session list
-	voteSessionList, err := redis.Values(conn.Do("SMEMBERS", currencySessionKey))
+	voteSessionList, err := redis.Strings(conn.Do("SMEMBERS", currencySessionKey(currencyId)))
 	if err != nil {
 		return 0, err
 	}
@@ -68,7 +129,7 @@ func CountActiveSessions(redisPool *redis.Pool, currencyId string) (int, error)
 	// get the individual session keys
 	sessionKeys := []interface{}{}
 	for _, sk := range voteSessionList {
-		sessionKeys = append(sessionKeys, "vote_session_"+string(sk.([]byte)))
+		sessionKeys = append(sessionKeys, voteSessionKey(sk))
 	}
 
 	// count how many of the session keys are still alive (not expired)
@@ -90,27 +151,25 @@ func CountActiveSessions(redisPool *redis.Pool, currencyId string) (int, error)
 // Add a new session to a currency session set
 func AddNewSession(redisPool *redis.Pool, currencyId, voteSessionId string) error {
 
-	// var currencySessionKey = VOTE_SESSION_PREFIX + "_" + currencyId
-	var currencySessionKey = "myset"
-	var voteSessionKey = "vote_session_" + voteSessionId
+	var sessionSetKey = currencySessionKey(currencyId)
 	conn := redisPool.Get()
 	defer conn.Close()
 
 	// get session list
-	_, err := redis.Int64(conn.Do("SADD", currencySessionKey, voteSessionId))
+	_, err := redis.Int64(conn.Do("SADD", sessionSetKey, voteSessionId))
 	if err != nil {
 		return err
 	}
 
 	// set EXPIRE time to currency session (we don't want it living for ever)
-	_, err = redis.Int64(conn.Do("EXPIRE", currencySessionKey, 60*30))
+	_, err = redis.Int64(conn.Do("EXPIRE", sessionSetKey, 60*30))
 	if err != nil {
 		return err
 	}
 
 	// set session id and it's expiry time. This indicates the
 	// session is active for the giving time before it's expiry time
-	_, err = redis.String(conn.Do("SETEX", voteSessionKey, config.C.GetInt("vote_session_duration"), "-"))
+	_, err = redis.String(conn.Do("SETEX", voteSessionKey(voteSessionId), config.C.GetInt("vote_session_duration"), "-"))
 	if err != nil {
 		return err
 	}
@@ -121,33 +180,22 @@ func AddNewSession(redisPool *redis.Pool, currencyId, voteSessionId string) erro
 // Checks if a vote session is valid and active
 func IsActiveSession(redisPool *redis.Pool, currencyId, voteSessionId string) (bool, error) {
 
-	var validVoteSessionId = false
-
-	// var currencySessionKey = VOTE_SESSION_PREFIX + "_" + currencyId
-	var currencySessionKey = "myset"
 	conn := redisPool.Get()
 	defer conn.Close()
 
-	// get active session list
-	voteSessionList, err := redis.Values(conn.Do("SMEMBERS", currencySessionKey))
+	// ensure vote session id exists in the session list of the currency
+	isMember, err := redis.Bool(conn.Do("SISMEMBER", currencySessionKey(currencyId), voteSessionId))
 	if err != nil {
 		return false, err
 	}
 
-	// ensure vote session id exists in active session list
-	for _, sk := range voteSessionList {
-		if string(sk.([]byte)) == voteSessionId {
-			validVoteSessionId = true
-		}
-	}
-
-	if !validVoteSessionId {
+	if !isMember {
 		fmt.Println("Vote session id is not known")
 		return false, errors.New("vote session id is unknown")
 	}
 
 	// check if the vote session is still active
-	_, err = redis.String(conn.Do("GET", "vote_session_"+voteSessionId))
+	_, err = redis.String(conn.Do("GET", voteSessionKey(voteSessionId)))
 	if err != nil && err == redis.ErrNil {
 		return false, nil
 	} else if err != nil {
@@ -156,3 +204,167 @@ func IsActiveSession(redisPool *redis.Pool, currencyId, voteSessionId string) (b
 
 	return true, nil
 }
+
+// Get the key of the counter holding the number of
+// votes a user has added on the current (UTC) day
+func dailyVoteCountKey(userId string) string {
+	return "openmint_daily_votes_" + userId + "_" + time.Now().UTC().Format("20060102")
+}
+
+// Increment the number of votes a user has added today.
+// The counter expires a day after the day it counts.
+func IncrDailyVoteCount(redisPool *redis.Pool, userId string) (int, error) {
+	var key = dailyVoteCountKey(userId)
+	conn := redisPool.Get()
+	defer conn.Close()
+	count, err := redis.Int(conn.Do("INCR", key))
+	if err != nil {
+		return 0, err
+	}
+	if _, err = conn.Do("EXPIRE", key, 60*60*48); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Decrement the number of votes a user has added today
+func DecrDailyVoteCount(redisPool *redis.Pool, userId string) (int, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	return redis.Int(conn.Do("DECR", dailyVoteCountKey(userId)))
+}
+
+// Check whether a currency id is a member of the main vote queue
+func IsInVoteQueue(redisPool *redis.Pool, currencyId string) (bool, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err := redis.Int64(conn.Do("ZSCORE", VOTE_QUEUE_NAME, currencyId))
+	if err != nil && err == redis.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Check which of a set of currency ids are members of the main vote
+// queue. The checks are sent in a single round trip.
+func InVoteQueue(redisPool *redis.Pool, currencyIds []string) (map[string]bool, error) {
+	var inQueue = make(map[string]bool)
+	if len(currencyIds) == 0 {
+		return inQueue, nil
+	}
+
+	conn := redisPool.Get()
+	defer conn.Close()
+	conn.Send("MULTI")
+	for _, currencyId := range currencyIds {
+		conn.Send("ZSCORE", VOTE_QUEUE_NAME, currencyId)
+	}
+	scores, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, score := range scores {
+		inQueue[currencyIds[i]] = score != nil
+	}
+	return inQueue, nil
+}
+
+// Count the number of currencies in a vote queue
+func CountVoteQueue(redisPool *redis.Pool, curCode string) (int, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+	return redis.Int(conn.Do("ZCARD", VoteQueueName(curCode)))
+}
+
+// Get the names of all currency code sub-queues
+func GetVoteSubQueues(redisPool *redis.Pool) ([]string, error) {
+	conn := redisPool.Get()
+	defer conn.Close()
+
+	var names []string
+	var cursor = "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", VOTE_QUEUE_NAME+"_*", "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
+
+		cursor, _ = redis.String(values[0], nil)
+		keys, _ := redis.Strings(values[1], nil)
+		names = append(names, keys...)
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	return names, nil
+}
+
+// Remove a currency id from a single queue without touching the others
+func RemoveFromQueue(redisPool *redis.Pool, queueName, currencyId string) error {
+	conn := redisPool.Get()
+	defer conn.Close()
+	_, err := conn.Do("ZREM", queueName, currencyId)
+	return err
+}
+
+// Remove expired vote sessions from the session set of a currency.
+// Returns the number of sessions removed.
+func PruneExpiredSessions(redisPool *redis.Pool, currencyId string) (int, error) {
+
+	conn := redisPool.Get()
+	defer conn.Close()
+
+	voteSessionList, err := redis.Strings(conn.Do("SMEMBERS", currencySessionKey(currencyId)))
+	if err != nil || len(voteSessionList) == 0 {
+		return 0, err
+	}
+
+	sessionKeys := []interface{}{}
+	for _, sk := range voteSessionList {
+		sessionKeys = append(sessionKeys, voteSessionKey(sk))
+	}
+
+	sessionState, err := redis.Values(conn.Do("MGET", sessionKeys...))
+	if err != nil {
+		return 0, err
+	}
+
+	expired := []interface{}{currencySessionKey(currencyId)}
+	for i, state := range sessionState {
+		if state == nil {
+			expired = append(expired, voteSessionList[i])
+		}
+	}
+
+	if len(expired) == 1 {
+		return 0, nil
+	}
+
+	return redis.Int(conn.Do("SREM", expired...))
+}
+
+// Determine the status of a currency from its votes.
+// The majority decision wins, a tie is considered disputed.
+func DetermineVoteOutcome(votes []Vote) string {
+	var yes, no int
+	for _, vote := range votes {
+		if vote.Decision == 1 {
+			yes++
+		} else {
+			no++
+		}
+	}
+	switch {
+	case yes > no:
+		return "verified"
+	case no > yes:
+		return "rejected"
+	default:
+		return "disputed"
+	}
+}
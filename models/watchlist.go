@@ -0,0 +1,220 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Watchlist types
+const (
+	WatchlistExact  = "exact"
+	WatchlistPrefix = "prefix"
+	WatchlistRange  = "range"
+)
+
+var WatchlistTypes = []string{WatchlistExact, WatchlistPrefix, WatchlistRange}
+
+// Watchlist notification channels
+const (
+	WatchlistChannelWebhook = "webhook"
+	WatchlistChannelEmail   = "email"
+	WatchlistChannelFeed    = "feed"
+)
+
+var WatchlistChannels = []string{WatchlistChannelWebhook, WatchlistChannelEmail, WatchlistChannelFeed}
+
+// A watchlist alerts its owner when a matching currency is indexed or sighted.
+// An exact watchlist matches a serial, a prefix watchlist matches serials
+// starting with the prefix and a range watchlist matches serials made of the
+// prefix and a number between From and To (e.g AB00001500). A watchlist
+// created with an API key belongs to the key and the key's user. The prefix
+// and bounds are always stored so matching watchlists can be found by index.
+type WatchlistModel struct {
+	Id            bson.ObjectId `json:"id" bson:"_id"`
+	UserId        bson.ObjectId `json:"user_id" bson:"user_id"`
+	APIKeyId      bson.ObjectId `json:"api_key_id,omitempty" bson:"api_key_id,omitempty"`
+	Name          string        `json:"name" bson:"name"`
+	Type          string        `json:"type" bson:"type"`
+	CurrencyCode  string        `json:"currency_code" bson:"currency_code"`
+	Denomination  string        `json:"denomination,omitempty" bson:"denomination"`
+	Serial        string        `json:"serial,omitempty" bson:"serial,omitempty"`
+	Prefix        string        `json:"prefix,omitempty" bson:"prefix"`
+	From          uint64        `json:"from,omitempty" bson:"from"`
+	To            uint64        `json:"to,omitempty" bson:"to"`
+	Channels      []string      `json:"channels" bson:"channels"`
+	Active        bool          `json:"active" bson:"active"`
+	MatchCount    int           `json:"match_count" bson:"match_count"`
+	LastMatchedAt time.Time     `json:"last_matched_at,omitempty" bson:"last_matched_at,omitempty"`
+	CreatedAt     time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var (
+	Watchlist = WatchlistModel{}
+)
+
+func (m *WatchlistModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_watchlist_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+
+	if c.EnsureIndexKey("currency_code", "active", "type", "serial") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("currency_code", "active", "type", "prefix", "from") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+
+	if c.EnsureIndexKey("user_id", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// Check whether a currency matches the watchlist
+func (m *WatchlistModel) Matches(currencyCode, denomination, serial string) bool {
+
+	if m.CurrencyCode != currencyCode || (m.Denomination != "" && m.Denomination != denomination) {
+		return false
+	}
+
+	switch m.Type {
+	case WatchlistExact:
+		return m.Serial == serial
+	case WatchlistPrefix:
+		return strings.HasPrefix(serial, m.Prefix)
+	case WatchlistRange:
+		return SerialInRange(serial, m.Prefix, m.From, m.To)
+	}
+
+	return false
+}
+
+// Check whether the watchlist notifies through a channel
+func (m *WatchlistModel) HasChannel(channel string) bool {
+	for _, c := range m.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// find by id
+func (m *WatchlistModel) FindById(ses *mgo.Session, id string) (*WatchlistModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	result := WatchlistModel{}
+	err := c.FindId(bson.ObjectIdHex(id)).One(&result)
+	return &result, err
+}
+
+// find the watchlists of a user. If an API key is given, only
+// the watchlists created with the key are returned.
+func (m *WatchlistModel) FindByOwner(ses *mgo.Session, userId, apiKeyId string) ([]WatchlistModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	q := bson.M{"user_id": bson.ObjectIdHex(userId)}
+	if apiKeyId != "" {
+		q["api_key_id"] = bson.ObjectIdHex(apiKeyId)
+	}
+	results := []WatchlistModel{}
+	err := c.Find(q).Sort("-created_at").All(&results)
+	return results, err
+}
+
+// count the watchlists of a user
+func (m *WatchlistModel) CountByUser(ses *mgo.Session, userId string) (int, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	return c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Count()
+}
+
+// find the active watchlists that match a currency. Exact watchlists are
+// matched by serial, prefix watchlists by the prefixes of the serial and
+// range watchlists by every split of the serial into a prefix and a number.
+func (m *WatchlistModel) FindMatching(ses *mgo.Session, currencyCode, denomination, serial string) ([]WatchlistModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+
+	prefixes := []string{}
+	or := []bson.M{{"type": WatchlistExact, "serial": serial}}
+	for i := 0; i < len(serial); i++ {
+		if i > 0 {
+			prefixes = append(prefixes, serial[:i])
+		}
+		n, err := strconv.ParseUint(serial[i:], 10, 64)
+		if err != nil || n > math.MaxInt64 {
+			continue
+		}
+		or = append(or, bson.M{"type": WatchlistRange, "prefix": serial[:i], "from": bson.M{"$lte": n}, "to": bson.M{"$gte": n}})
+	}
+	or = append(or, bson.M{"type": WatchlistPrefix, "prefix": bson.M{"$in": append(prefixes, serial)}})
+
+	candidates := []WatchlistModel{}
+	err := c.Find(bson.M{
+		"currency_code": currencyCode,
+		"active":        true,
+		"denomination":  bson.M{"$in": []string{"", denomination}},
+		"$or":           or,
+	}).All(&candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []WatchlistModel{}
+	for _, w := range candidates {
+		if w.Matches(currencyCode, denomination, serial) {
+			results = append(results, w)
+		}
+	}
+	return results, nil
+}
+
+// add new watchlist
+func (m *WatchlistModel) Create(ses *mgo.Session, data *WatchlistModel) error {
+	data.CreatedAt = time.Now().UTC()
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	return c.Insert(data)
+}
+
+// update watchlist
+func (m *WatchlistModel) Update(ses *mgo.Session, id string, value bson.M) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	return c.UpdateId(bson.ObjectIdHex(id), value)
+}
+
+// count a match of a watchlist
+func (m *WatchlistModel) RecordMatch(ses *mgo.Session, id string, at time.Time) error {
+	return m.Update(ses, id, bson.M{"$inc": bson.M{"match_count": 1}, "$set": bson.M{"last_matched_at": at}})
+}
+
+// delete watchlist
+func (m *WatchlistModel) Delete(ses *mgo.Session, id string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	return c.RemoveId(bson.ObjectIdHex(id))
+}
+
+// delete the watchlists of a user
+func (m *WatchlistModel) DeleteByUser(ses *mgo.Session, userId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	_, err := c.RemoveAll(bson.M{"user_id": bson.ObjectIdHex(userId)})
+	return err
+}
+
+// move the watchlists of a user to another user
+func (m *WatchlistModel) ReassignUser(ses *mgo.Session, fromUserId, toUserId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_watchlist_col"))
+	_, err := c.UpdateAll(bson.M{"user_id": bson.ObjectIdHex(fromUserId)}, bson.M{"$set": bson.M{"user_id": bson.ObjectIdHex(toUserId)}})
+	return err
+}
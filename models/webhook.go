@@ -0,0 +1,173 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Webhook event types
+const (
+	WebhookCurrencyIndexed  = "currency.indexed"
+	WebhookCurrencyVerified = "currency.verified"
+	WebhookCurrencyRejected = "currency.rejected"
+	WebhookCurrencyDisputed = "currency.disputed"
+	WebhookWatchlistMatch   = "watchlist.match"
+	WebhookTest             = "webhook.test"
+)
+
+// Events a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookCurrencyIndexed,
+	WebhookCurrencyVerified,
+	WebhookCurrencyRejected,
+	WebhookCurrencyDisputed,
+	WebhookWatchlistMatch,
+}
+
+type WebhookModel struct {
+	Id        bson.ObjectId `json:"id" bson:"_id"`
+	UserId    bson.ObjectId `json:"user_id" bson:"user_id"`
+	URL       string        `json:"url" bson:"url"`
+	Secret    string        `json:"secret,omitempty" bson:"secret"`
+	Events    []string      `json:"events" bson:"events"`
+	Active    bool          `json:"active" bson:"active"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
+
+type WebhookDeliveryModel struct {
+	Id            bson.ObjectId `json:"id" bson:"_id"`
+	WebhookId     bson.ObjectId `json:"webhook_id" bson:"webhook_id"`
+	Event         string        `json:"event" bson:"event"`
+	Payload       string        `json:"payload" bson:"payload"`
+	Attempts      int           `json:"attempts" bson:"attempts"`
+	StatusCode    int           `json:"status_code" bson:"status_code"`
+	Error         string        `json:"error,omitempty" bson:"error"`
+	Delivered     bool          `json:"delivered" bson:"delivered"`
+	LastAttemptAt time.Time     `json:"last_attempt_at" bson:"last_attempt_at"`
+	CreatedAt     time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var (
+	Webhook         = WebhookModel{}
+	WebhookDelivery = WebhookDeliveryModel{}
+)
+
+func (m *WebhookModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_webhook_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+	if c.EnsureIndexKey("user_id", "events") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// find by id
+func (m *WebhookModel) FindById(ses *mgo.Session, id string) (*WebhookModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_col"))
+	result := WebhookModel{}
+	err := c.FindId(bson.ObjectIdHex(id)).One(&result)
+	return &result, err
+}
+
+// find all webhooks of a user
+func (m *WebhookModel) FindByUser(ses *mgo.Session, userId string) ([]WebhookModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_col"))
+	results := []WebhookModel{}
+	err := c.Find(bson.M{"user_id": bson.ObjectIdHex(userId)}).Sort("-created_at").All(&results)
+	return results, err
+}
+
+// find the active webhooks of a user subscribed to an event
+func (m *WebhookModel) FindSubscribed(ses *mgo.Session, userId, event string) ([]WebhookModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_col"))
+	results := []WebhookModel{}
+	err := c.Find(bson.M{"user_id": bson.ObjectIdHex(userId), "events": event, "active": true}).All(&results)
+	return results, err
+}
+
+// add new webhook
+func (m *WebhookModel) Create(ses *mgo.Session, data *WebhookModel) error {
+	data.CreatedAt = time.Now().UTC()
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_col"))
+	return c.Insert(data)
+}
+
+// delete webhook
+func (m *WebhookModel) Delete(ses *mgo.Session, id string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_col"))
+	return c.RemoveId(bson.ObjectIdHex(id))
+}
+
+// move the webhooks of a user to another user
+func (m *WebhookModel) ReassignUser(ses *mgo.Session, fromUserId, toUserId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_col"))
+	_, err := c.UpdateAll(bson.M{"user_id": bson.ObjectIdHex(fromUserId)}, bson.M{"$set": bson.M{"user_id": bson.ObjectIdHex(toUserId)}})
+	return err
+}
+
+// delete the webhooks of a user and their deliveries
+func (m *WebhookModel) DeleteByUser(ses *mgo.Session, userId string) error {
+	webhooks, err := m.FindByUser(ses, userId)
+	if err != nil {
+		return err
+	}
+	ses.SetMode(mgo.Monotonic, true)
+	db := ses.DB(config.C.GetString("mongo_database"))
+	for _, webhook := range webhooks {
+		if _, err = db.C(config.C.GetString("mongo_webhook_delivery_col")).RemoveAll(bson.M{"webhook_id": webhook.Id}); err != nil {
+			return err
+		}
+	}
+	_, err = db.C(config.C.GetString("mongo_webhook_col")).RemoveAll(bson.M{"user_id": bson.ObjectIdHex(userId)})
+	return err
+}
+
+func (m *WebhookDeliveryModel) EnsureIndex(ses *mgo.Session) {
+	ses.SetMode(mgo.Monotonic, true)
+	colName := config.C.GetString("mongo_webhook_delivery_col")
+	c := ses.DB(config.C.GetString("mongo_database")).C(colName)
+	if c.EnsureIndexKey("webhook_id", "-created_at") != nil {
+		panic("failed to ensure index in " + colName + " collection")
+	}
+}
+
+// find the most recent deliveries of a webhook
+func (m *WebhookDeliveryModel) FindByWebhook(ses *mgo.Session, webhookId string, limit int) ([]WebhookDeliveryModel, error) {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_delivery_col"))
+	results := []WebhookDeliveryModel{}
+	err := c.Find(bson.M{"webhook_id": bson.ObjectIdHex(webhookId)}).Sort("-created_at").Limit(limit).All(&results)
+	return results, err
+}
+
+// add new delivery entry
+func (m *WebhookDeliveryModel) Create(ses *mgo.Session, data *WebhookDeliveryModel) error {
+	data.CreatedAt = time.Now().UTC()
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_delivery_col"))
+	return c.Insert(data)
+}
+
+// update fields of a delivery entry
+func (m *WebhookDeliveryModel) Update(ses *mgo.Session, id string, value bson.M) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_delivery_col"))
+	return c.UpdateId(bson.ObjectIdHex(id), bson.M{"$set": value})
+}
+
+// delete all deliveries of a webhook
+func (m *WebhookDeliveryModel) DeleteByWebhook(ses *mgo.Session, webhookId string) error {
+	ses.SetMode(mgo.Monotonic, true)
+	c := ses.DB(config.C.GetString("mongo_database")).C(config.C.GetString("mongo_webhook_delivery_col"))
+	_, err := c.RemoveAll(bson.M{"webhook_id": bson.ObjectIdHex(webhookId)})
+	return err
+}
@@ -4,8 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
 	"github.com/ellcrys/openmint/www"
 	"github.com/ellcrys/util"
 	"github.com/labstack/echo/engine/standard"
@@ -16,12 +19,52 @@ func main() {
 	// determine appropriate port number
 	var portEnv = util.Env("PORT", "3001")
 	var portFlag = flag.String("port", portEnv, "set port. Default: "+portEnv)
+	var verifyAuditLogFlag = flag.Bool("verify-audit-log", false, "verify the audit log chain and exit")
+	var classifySerialsFlag = flag.Bool("classify-serials", false, "classify the serials of indexed currencies and exit")
+	var grantAdminFlag = flag.String("grant-admin", "", "grant the admin role to the user with this id and exit")
 	flag.Parse()
 
 	if flag.Parsed() {
 
 		// create new router
-		router, _ := www.App(false, false)
+		router, mongoSession := www.App(false, false)
+
+		// check that no audit log entry was modified or removed
+		if *verifyAuditLogFlag {
+			count, err := models.AuditLog.VerifyChain(mongoSession)
+			if err != nil {
+				log.Println(fmt.Sprintf("Audit log verification failed after %d entries: %s", count, err.Error()))
+				os.Exit(1)
+			}
+			log.Println(fmt.Sprintf("Audit log verified: %d entries", count))
+			return
+		}
+
+		// create the first admin. Admins grant roles to other users.
+		if *grantAdminFlag != "" {
+			granted, err := lib.GrantRole(mongoSession, *grantAdminFlag, models.RoleAdmin)
+			if err != nil {
+				log.Println(fmt.Sprintf("Failed to grant admin role: %s", err.Error()))
+				os.Exit(1)
+			}
+			if !granted {
+				log.Println("User is already an admin")
+				return
+			}
+			log.Println("Admin role granted")
+			return
+		}
+
+		// classify serials of currencies indexed before a detector was added
+		if *classifySerialsFlag {
+			count, err := lib.DefaultSerialDetectors().ClassifyAll(mongoSession)
+			if err != nil {
+				log.Println(fmt.Sprintf("Serial classification failed after %d currencies: %s", count, err.Error()))
+				os.Exit(1)
+			}
+			log.Println(fmt.Sprintf("Serials classified: %d currencies updated", count))
+			return
+		}
 		server := standard.New(":" + *portFlag)
 		server.SetHandler(router)
 
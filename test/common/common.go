@@ -12,17 +12,20 @@ import (
 	"github.com/ellcrys/openmint/models"
 	"github.com/ellcrys/openmint/www"
 	"github.com/ellcrys/util"
+	"github.com/garyburd/redigo/redis"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/engine/standard"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var MongoSes *mgo.Session
+var RedisPool *redis.Pool
 
 // Initialize package by setting
 // up the application and a test mongo database
 func InitTestPackage() {
 	_, MongoSes = www.App(true, false)
+	RedisPool = www.GetRedisPool(util.Env("REDIS_URL", "localhost:6379"), util.Env("REDIS_PWD", ""), 0)
 }
 
 // create a context to use for testing with controller methods
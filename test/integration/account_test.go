@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// create a user whose account is deleted or archived
+func createAccountTestUser() *models.UserModel {
+	id := models.NewId()
+	user := &models.UserModel{
+		Id:             id,
+		Fullname:       "Account Test",
+		Provider:       "account_test",
+		ProviderUserId: id.Hex(),
+		AccessToken:    "access-token",
+	}
+	Expect(models.User.Create(common.MongoSes, user)).To(BeNil())
+	return user
+}
+
+// create a currency uploaded by a user with a vote of another user
+func createAccountTestCurrency(userId, voterId bson.ObjectId) *models.CurrencyModel {
+	currency := &models.CurrencyModel{
+		Id:           models.NewId(),
+		UserId:       userId,
+		CurrencyCode: "TQA",
+		Denomination: "100",
+		Serial:       models.NewId().Hex(),
+		Status:       "awaiting_votes",
+		UploaderIP:   "192.0.2.1",
+		Votes:        []models.Vote{{Decision: 1, UserId: voterId, IP: "192.0.2.2"}},
+	}
+	Expect(models.Currency.Create(common.MongoSes, currency)).To(BeNil())
+	return currency
+}
+
+// append an audit log entry made by a user
+func createAccountTestAuditEntry(userId bson.ObjectId) *models.AuditLogModel {
+	entry := &models.AuditLogModel{
+		Id:         models.NewId(),
+		ActorId:    userId,
+		Action:     models.AuditUserSettings,
+		TargetType: models.AuditTargetUser,
+		TargetId:   userId.Hex(),
+		IP:         "192.0.2.3",
+	}
+	Expect(models.AuditLog.Create(common.MongoSes, entry)).To(BeNil())
+	return entry
+}
+
+func TestDeleteAccount(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("DeleteAccount()", func() {
+
+		var user *models.UserModel
+		var own, voted *models.CurrencyModel
+		var entry *models.AuditLogModel
+		other := models.NewId()
+		lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+
+		g.Before(func() {
+			user = createAccountTestUser()
+			own = createAccountTestCurrency(user.Id, other)
+			voted = createAccountTestCurrency(other, user.Id)
+			entry = createAccountTestAuditEntry(user.Id)
+			_, err := models.IncrLeaderboard(common.RedisPool, models.LeaderboardVotes, user.Id.Hex(), 1, lastWeek)
+			Expect(err).To(BeNil())
+			Expect(models.RecordVoteAccuracy(common.RedisPool, user.Id.Hex(), true, 1, lastWeek)).To(BeNil())
+		})
+
+		g.After(func() {
+			models.Currency.Delete(common.MongoSes, own.Id.Hex())
+			models.Currency.Delete(common.MongoSes, voted.Id.Hex())
+		})
+
+		g.It("should reject an unknown currencies option", func() {
+			ctx := common.NewContext("DELETE", "/v1/users/me?currencies=keep", nil, "", nil)
+			ctx.Set("auth_user", user.Id.Hex())
+			err := userCntrl.DeleteAccount(ctx)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).StatusCode).To(Equal(400))
+		})
+
+		g.It("should delete the user and anonymize their currencies, votes and audit log entries", func() {
+			ctx := common.NewContext("DELETE", "/v1/users/me?currencies=anonymize", nil, "", nil)
+			ctx.Set("auth_user", user.Id.Hex())
+			Expect(userCntrl.DeleteAccount(ctx)).To(BeNil())
+
+			_, err := models.User.FindById(common.MongoSes, user.Id.Hex())
+			Expect(err).To(Equal(mgo.ErrNotFound))
+
+			own, _ = models.Currency.FindById(common.MongoSes, own.Id.Hex())
+			Expect(own.UserId.Hex()).To(Equal(models.DELETED_USER_ID))
+			Expect(own.UploaderIP).To(BeEmpty())
+
+			voted, _ = models.Currency.FindById(common.MongoSes, voted.Id.Hex())
+			Expect(voted.Votes[0].UserId.Hex()).To(Equal(models.DELETED_USER_ID))
+			Expect(voted.Votes[0].IP).To(BeEmpty())
+
+			entries, err := models.AuditLog.Find(common.MongoSes, bson.M{"_id": entry.Id}, 1, 0)
+			Expect(err).To(BeNil())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].ActorId).To(BeEmpty())
+			Expect(entries[0].IP).To(BeEmpty())
+			Expect(entries[0].Salt).To(BeEmpty())
+			Expect(entries[0].ComputeHash([]byte(config.C.GetString("audit_log_key")))).To(Equal(entries[0].Hash))
+		})
+
+		g.It("should remove the user from previous leaderboard periods", func() {
+			for _, board := range []string{models.LeaderboardVotes, models.LeaderboardAccuracy} {
+				rank, err := models.GetLeaderboardEntry(common.RedisPool, board, models.LeaderboardWeekly, lastWeek, user.Id.Hex())
+				Expect(err).To(BeNil())
+				Expect(rank).To(BeNil())
+			}
+		})
+	})
+}
+
+func TestGetData(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("GetData()", func() {
+
+		var user *models.UserModel
+		var own, voted *models.CurrencyModel
+		other := models.NewId()
+
+		g.Before(func() {
+			user = createAccountTestUser()
+			own = createAccountTestCurrency(user.Id, other)
+			voted = createAccountTestCurrency(other, user.Id)
+			createAccountTestAuditEntry(user.Id)
+		})
+
+		g.After(func() {
+			models.User.Delete(common.MongoSes, user.Id.Hex())
+			models.Currency.Delete(common.MongoSes, own.Id.Hex())
+			models.Currency.Delete(common.MongoSes, voted.Id.Hex())
+		})
+
+		g.It("should archive the user's data without the data of other users", func() {
+			ctx := common.NewContext("GET", "/v1/users/me/data", nil, "", nil)
+			ctx.Set("auth_user", user.Id.Hex())
+			var buffer bytes.Buffer
+			writer := bufio.NewWriter(&buffer)
+			ctx.Response().SetWriter(writer)
+			Expect(userCntrl.GetData(ctx)).To(BeNil())
+			writer.Flush()
+
+			archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			Expect(err).To(BeNil())
+
+			files := map[string][]byte{}
+			for _, file := range archive.File {
+				r, err := file.Open()
+				Expect(err).To(BeNil())
+				files[file.Name], _ = ioutil.ReadAll(r)
+				r.Close()
+			}
+
+			var archivedUser map[string]interface{}
+			Expect(json.Unmarshal(files["user.json"], &archivedUser)).To(BeNil())
+			Expect(archivedUser["id"]).To(Equal(user.Id.Hex()))
+			Expect(archivedUser["access_token"]).To(BeNil())
+
+			var currency map[string]interface{}
+			Expect(json.Unmarshal(files["currencies.ndjson"], &currency)).To(BeNil())
+			Expect(currency["id"]).To(Equal(own.Id.Hex()))
+			Expect(currency["uploader_ip"]).To(Equal("192.0.2.1"))
+			Expect(string(files["currencies.ndjson"])).ToNot(ContainSubstring(other.Hex()))
+
+			var vote map[string]interface{}
+			Expect(json.Unmarshal(files["votes.ndjson"], &vote)).To(BeNil())
+			Expect(vote["currency_id"]).To(Equal(voted.Id.Hex()))
+			Expect(vote["ip"]).To(Equal("192.0.2.2"))
+
+			Expect(string(files["audit_log.ndjson"])).To(ContainSubstring("192.0.2.3"))
+		})
+	})
+}
@@ -0,0 +1,54 @@
+package integration
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestAuditLogCreate(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("AuditLog.Create()", func() {
+
+		g.It("should give concurrent entries consecutive sequence numbers", func() {
+			entries := make([]*models.AuditLogModel, 20)
+			errs := make([]error, len(entries))
+
+			var wg sync.WaitGroup
+			for i := range entries {
+				entries[i] = &models.AuditLogModel{Id: models.NewId(), Action: models.AuditUserSettings, TargetType: models.AuditTargetUser, TargetId: models.NewId().Hex()}
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					ses := common.MongoSes.Copy()
+					defer ses.Close()
+					errs[i] = models.AuditLog.Create(ses, entries[i])
+				}(i)
+			}
+			wg.Wait()
+
+			seqs := []int{}
+			for i, entry := range entries {
+				Expect(errs[i]).To(BeNil())
+				seqs = append(seqs, int(entry.Seq))
+			}
+			sort.Ints(seqs)
+			Expect(seqs[len(seqs)-1] - seqs[0]).To(Equal(len(seqs) - 1))
+		})
+
+		g.It("should keep the sequence number of an entry appended again", func() {
+			entry := &models.AuditLogModel{Id: models.NewId(), Action: models.AuditUserSettings, TargetType: models.AuditTargetUser, TargetId: models.NewId().Hex()}
+			seq, err := models.Counter.Next(common.MongoSes, models.AUDIT_LOG_COUNTER)
+			Expect(err).To(BeNil())
+			entry.Seq = seq
+			Expect(models.AuditLog.Create(common.MongoSes, entry)).To(BeNil())
+			Expect(entry.Seq).To(Equal(seq))
+		})
+	})
+}
@@ -19,7 +19,7 @@ var testUser *models.UserModel
 
 func init() {
 	var err error
-	authCntrl = lib.NewAuthController(common.MongoSes)
+	authCntrl = lib.NewAuthController(common.MongoSes, common.RedisPool, lib.NewAuthProviderRegistry())
 	testUser, err = common.CreateTestUser()
 	if err != nil {
 		panic("init: could not create test user")
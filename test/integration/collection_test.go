@@ -0,0 +1,185 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/extend"
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// create a collection of a user
+func createTestCollection(userId bson.ObjectId) *models.CollectionModel {
+	collection := &models.CollectionModel{Id: models.NewId(), UserId: userId, Name: "Star notes"}
+	Expect(models.Collection.Create(common.MongoSes, collection)).To(BeNil())
+	return collection
+}
+
+// create a currency of a user
+func createCollectionTestCurrency(userId bson.ObjectId, hidden bool) *models.CurrencyModel {
+	currency := &models.CurrencyModel{
+		Id:           models.NewId(),
+		UserId:       userId,
+		CurrencyCode: "TQC",
+		Denomination: "100",
+		Serial:       models.NewId().Hex(),
+		Status:       "verified",
+		Hidden:       hidden,
+	}
+	Expect(models.Currency.Create(common.MongoSes, currency)).To(BeNil())
+	return currency
+}
+
+// call a collection endpoint as a user and decode the response
+func collectionRequest(handler func(*extend.Context) error, userId bson.ObjectId, params map[string]string, body string) (map[string]interface{}, error) {
+	ctx := common.NewContext("POST", "/v1/collections", params, body, nil)
+	if userId != "" {
+		ctx.Set("auth_user", userId.Hex())
+	}
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	ctx.Response().SetWriter(writer)
+
+	if err := handler(ctx); err != nil {
+		return nil, err
+	}
+
+	writer.Flush()
+	result := map[string]interface{}{}
+	Expect(json.Unmarshal(buffer.Bytes(), &result)).To(BeNil())
+	return result, nil
+}
+
+// share a collection and get its share token
+func shareCollection(cntrl *lib.CollectionController, collection *models.CollectionModel, public bool) string {
+	body := `{ "public": false }`
+	if public {
+		body = `{ "public": true }`
+	}
+	result, err := collectionRequest(cntrl.SetSharing, collection.UserId, map[string]string{"id": collection.Id.Hex()}, body)
+	Expect(err).To(BeNil())
+	token, _ := result["share_token"].(string)
+	return token
+}
+
+func TestCollectionOwnership(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("CollectionController ownership", func() {
+
+		cntrl := lib.NewCollectionController(common.MongoSes)
+		owner, other := models.NewId(), models.NewId()
+		var collection *models.CollectionModel
+		var own, others *models.CurrencyModel
+
+		g.Before(func() {
+			collection = createTestCollection(owner)
+			own = createCollectionTestCurrency(owner, false)
+			others = createCollectionTestCurrency(other, false)
+		})
+
+		g.After(func() {
+			models.Collection.Delete(common.MongoSes, collection.Id.Hex())
+			models.Currency.Delete(common.MongoSes, own.Id.Hex())
+			models.Currency.Delete(common.MongoSes, others.Id.Hex())
+		})
+
+		g.It("should not let other users access a collection", func() {
+			params := map[string]string{"id": collection.Id.Hex(), "currency_id": own.Id.Hex()}
+			handlers := []func(*extend.Context) error{cntrl.Get, cntrl.Update, cntrl.Delete, cntrl.AddCurrencies, cntrl.RemoveCurrency, cntrl.SetSharing}
+			for _, handler := range handlers {
+				_, err := collectionRequest(handler, other, params, `{ "name": "Mine", "currency_ids": ["`+others.Id.Hex()+`"], "public": true }`)
+				Expect(err).ToNot(BeNil())
+				Expect(err.(*config.HTTPError).StatusCode).To(Equal(404))
+			}
+
+			unchanged, err := models.Collection.FindById(common.MongoSes, collection.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(unchanged.Name).To(Equal("Star notes"))
+			Expect(unchanged.Public).To(BeFalse())
+		})
+
+		g.It("should only add currencies of the owner", func() {
+			params := map[string]string{"id": collection.Id.Hex()}
+			result, err := collectionRequest(cntrl.AddCurrencies, owner, params, `{ "currency_ids": ["`+own.Id.Hex()+`", "`+others.Id.Hex()+`"] }`)
+			Expect(err).To(BeNil())
+			Expect(result["added"]).To(Equal(float64(1)))
+
+			own, _ = models.Currency.FindById(common.MongoSes, own.Id.Hex())
+			Expect(own.Collections).To(Equal([]bson.ObjectId{collection.Id}))
+
+			others, _ = models.Currency.FindById(common.MongoSes, others.Id.Hex())
+			Expect(others.Collections).To(BeEmpty())
+		})
+	})
+}
+
+func TestCollectionSharing(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("CollectionController sharing", func() {
+
+		cntrl := lib.NewCollectionController(common.MongoSes)
+		owner := models.NewId()
+		var collection *models.CollectionModel
+		var visible, hidden *models.CurrencyModel
+
+		g.Before(func() {
+			collection = createTestCollection(owner)
+			visible = createCollectionTestCurrency(owner, false)
+			hidden = createCollectionTestCurrency(owner, true)
+			_, err := models.Currency.AddToCollection(common.MongoSes, owner.Hex(), collection.Id.Hex(), []bson.ObjectId{visible.Id, hidden.Id})
+			Expect(err).To(BeNil())
+		})
+
+		g.After(func() {
+			models.Collection.Delete(common.MongoSes, collection.Id.Hex())
+			models.Currency.Delete(common.MongoSes, visible.Id.Hex())
+			models.Currency.Delete(common.MongoSes, hidden.Id.Hex())
+		})
+
+		g.It("should not include hidden currencies in a shared collection", func() {
+			token := shareCollection(cntrl, collection, true)
+			Expect(token).ToNot(BeEmpty())
+
+			result, err := collectionRequest(cntrl.GetShared, "", map[string]string{"token": token}, "")
+			Expect(err).To(BeNil())
+			Expect(result["collection"]).ToNot(HaveKey("user_id"))
+
+			currencies := result["currencies"].([]interface{})
+			Expect(currencies).To(HaveLen(1))
+			Expect(currencies[0].(map[string]interface{})["id"]).To(Equal(visible.Id.Hex()))
+		})
+
+		g.It("should rotate the share token when a collection is shared again", func() {
+			first := shareCollection(cntrl, collection, true)
+			second := shareCollection(cntrl, collection, true)
+			Expect(second).ToNot(Equal(first))
+
+			_, err := models.Collection.FindByShareToken(common.MongoSes, first)
+			Expect(err).To(Equal(mgo.ErrNotFound))
+
+			_, err = collectionRequest(cntrl.GetShared, "", map[string]string{"token": first}, "")
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).StatusCode).To(Equal(404))
+		})
+
+		g.It("should stop sharing a collection made private", func() {
+			token := shareCollection(cntrl, collection, true)
+			Expect(shareCollection(cntrl, collection, false)).To(BeEmpty())
+
+			_, err := collectionRequest(cntrl.GetShared, "", map[string]string{"token": token}, "")
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).StatusCode).To(Equal(404))
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	"github.com/labstack/echo/engine/standard"
+	. "github.com/onsi/gomega"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// get a client address no other test uses
+func newClientAddress() string {
+	return net.IP(append([]byte{0x20, 0x01, 0x0d, 0xb8}, []byte(models.NewId())...)).String()
+}
+
+// create a currency for the lookup tests
+func createLookupTestCurrency(hidden bool) *models.CurrencyModel {
+	currency := &models.CurrencyModel{
+		Id:           models.NewId(),
+		UserId:       models.NewId(),
+		CurrencyCode: "TQL",
+		Denomination: "100",
+		Serial:       "TQ" + models.NewId().Hex(),
+		Status:       "verified",
+		Hidden:       hidden,
+	}
+	Expect(models.Currency.Create(common.MongoSes, currency)).To(BeNil())
+	return currency
+}
+
+// look up notes in bulk from a client address and decode the results
+func bulkLookup(cntrl *lib.CurrencyController, remoteAddr string, notes ...*models.CurrencyModel) ([]map[string]interface{}, error) {
+	body := []map[string]string{}
+	for _, n := range notes {
+		body = append(body, map[string]string{"code": n.CurrencyCode, "denom": n.Denomination, "serial": n.Serial})
+	}
+	data, _ := json.Marshal(map[string]interface{}{"notes": body})
+
+	ctx := common.NewContext("POST", "/v1/currencies/lookup", nil, string(data), nil)
+	ctx.Request().(*standard.Request).Request.RemoteAddr = net.JoinHostPort(remoteAddr, "4000")
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	ctx.Response().SetWriter(writer)
+
+	if err := cntrl.BulkLookup(ctx); err != nil {
+		return nil, err
+	}
+
+	writer.Flush()
+	results := []map[string]interface{}{}
+	Expect(json.Unmarshal(buffer.Bytes(), &results)).To(BeNil())
+	return results, nil
+}
+
+func TestBulkLookup(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("BulkLookup()", func() {
+
+		cntrl := lib.NewCurrencyController(common.MongoSes, common.RedisPool)
+		var visible, hidden *models.CurrencyModel
+		missing := &models.CurrencyModel{CurrencyCode: "TQL", Denomination: "100", Serial: "TQMISSING"}
+
+		g.Before(func() {
+			visible = createLookupTestCurrency(false)
+			hidden = createLookupTestCurrency(true)
+		})
+
+		g.After(func() {
+			models.Currency.Delete(common.MongoSes, visible.Id.Hex())
+			models.Currency.Delete(common.MongoSes, hidden.Id.Hex())
+		})
+
+		g.It("should return the results in the order of the notes and not find hidden notes", func() {
+			results, err := bulkLookup(cntrl, newClientAddress(), missing, hidden, visible, missing)
+			Expect(err).To(BeNil())
+			Expect(results).To(HaveLen(4))
+
+			serials, found := []interface{}{}, []interface{}{}
+			for _, r := range results {
+				serials = append(serials, r["serial"])
+				found = append(found, r["found"])
+			}
+			Expect(serials).To(Equal([]interface{}{missing.Serial, hidden.Serial, visible.Serial, missing.Serial}))
+			Expect(found).To(Equal([]interface{}{false, false, true, false}))
+			Expect(results[1]).ToNot(HaveKey("status"))
+		})
+
+		g.It("should count each note against the rate limit", func() {
+			limit := config.C.GetString("lookup_rate_limit")
+			config.C.Add("lookup_rate_limit", "3")
+			defer config.C.Add("lookup_rate_limit", limit)
+
+			addr := newClientAddress()
+			_, err := bulkLookup(cntrl, addr, visible, visible)
+			Expect(err).To(BeNil())
+			_, err = bulkLookup(cntrl, addr, visible, visible)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).StatusCode).To(Equal(429))
+		})
+	})
+}
+
+func TestNormalizeCurrencyCodes(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Currency.NormalizeCurrencyCodes()", func() {
+
+		cntrl := lib.NewCurrencyController(common.MongoSes, common.RedisPool)
+		var currency *models.CurrencyModel
+
+		g.Before(func() {
+			currency = createLookupTestCurrency(false)
+			Expect(models.Currency.Update(common.MongoSes, currency.Id.Hex(), bson.M{"$set": bson.M{"currency_code": " tql"}})).To(BeNil())
+		})
+
+		g.After(func() {
+			models.Currency.Delete(common.MongoSes, currency.Id.Hex())
+		})
+
+		g.It("should store currency codes in upper case so lookups find them", func() {
+			normalized, err := models.Currency.NormalizeCurrencyCodes(common.MongoSes)
+			Expect(err).To(BeNil())
+			Expect(normalized).To(BeNumerically(">=", 1))
+
+			updated, err := models.Currency.FindById(common.MongoSes, currency.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(updated.CurrencyCode).To(Equal("TQL"))
+
+			results, err := bulkLookup(cntrl, newClientAddress(), currency)
+			Expect(err).To(BeNil())
+			Expect(results[0]["found"]).To(BeTrue())
+		})
+	})
+}
@@ -0,0 +1,157 @@
+package integration
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+// create a user with roles
+func createRoleTestUser(roles ...string) *models.UserModel {
+	id := models.NewId()
+	user := &models.UserModel{
+		Id:             id,
+		Fullname:       "Role Test",
+		Provider:       "role_test",
+		ProviderUserId: id.Hex(),
+		Roles:          roles,
+	}
+	Expect(models.User.Create(common.MongoSes, user)).To(BeNil())
+	return user
+}
+
+// ban a user as another user
+func banAs(cntrl *lib.ModerationController, actor, user *models.UserModel) error {
+	ctx := common.NewContext("PUT", "/v1/moderation/users/"+user.Id.Hex()+"/ban", map[string]string{"id": user.Id.Hex()}, "", nil)
+	ctx.Set("auth_user", actor.Id.Hex())
+	ctx.Set("auth_roles", strings.Join(actor.Roles, ","))
+	return cntrl.BanUser(ctx)
+}
+
+func TestBanUser(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("BanUser()", func() {
+
+		cntrl := lib.NewModerationController(common.MongoSes, common.RedisPool, nil)
+		var admin, moderator, otherModerator, user *models.UserModel
+
+		g.Before(func() {
+			admin = createRoleTestUser(models.RoleAdmin)
+			moderator = createRoleTestUser(models.RoleModerator)
+			otherModerator = createRoleTestUser(models.RoleModerator)
+			user = createRoleTestUser()
+		})
+
+		g.After(func() {
+			for _, u := range []*models.UserModel{admin, moderator, otherModerator, user} {
+				models.User.Delete(common.MongoSes, u.Id.Hex())
+			}
+		})
+
+		g.It("should not let a moderator ban a user with a role", func() {
+			err := banAs(cntrl, moderator, otherModerator)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).StatusCode).To(Equal(403))
+		})
+
+		g.It("should let a moderator ban a user without a role", func() {
+			Expect(banAs(cntrl, moderator, user)).To(BeNil())
+		})
+
+		g.It("should let a user who manages roles ban a user with a role", func() {
+			Expect(banAs(cntrl, admin, otherModerator)).To(BeNil())
+			banned, err := models.User.FindById(common.MongoSes, otherModerator.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(banned.Banned).To(BeTrue())
+		})
+	})
+}
+
+func TestGrantRole(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("GrantRole()", func() {
+
+		var user *models.UserModel
+
+		g.Before(func() {
+			user = createRoleTestUser(models.RoleModerator)
+		})
+
+		g.After(func() {
+			models.User.Delete(common.MongoSes, user.Id.Hex())
+		})
+
+		g.It("should add the role to the roles of the user once", func() {
+			granted, err := lib.GrantRole(common.MongoSes, user.Id.Hex(), models.RoleAdmin)
+			Expect(err).To(BeNil())
+			Expect(granted).To(BeTrue())
+
+			granted, err = lib.GrantRole(common.MongoSes, user.Id.Hex(), models.RoleAdmin)
+			Expect(err).To(BeNil())
+			Expect(granted).To(BeFalse())
+
+			updated, err := models.User.FindById(common.MongoSes, user.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(updated.Roles).To(Equal([]string{models.RoleModerator, models.RoleAdmin}))
+		})
+
+		g.It("should reject unknown roles and users", func() {
+			_, err := lib.GrantRole(common.MongoSes, user.Id.Hex(), "owner")
+			Expect(err).ToNot(BeNil())
+			_, err = lib.GrantRole(common.MongoSes, "not-an-id", models.RoleAdmin)
+			Expect(err).ToNot(BeNil())
+		})
+	})
+}
+
+func TestEditCurrency(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("EditCurrency()", func() {
+
+		risk := lib.NewRiskScorer(common.MongoSes, common.RedisPool, 50)
+		alerter := lib.NewWatchlistAlerter(common.MongoSes, common.RedisPool, nil, lib.LogMailer{})
+		mint := lib.NewMintController(common.MongoSes, common.RedisPool, http.DefaultClient, http.DefaultClient, nil, lib.DefaultSerialDetectors(), alerter, risk)
+		cntrl := lib.NewModerationController(common.MongoSes, common.RedisPool, mint)
+		var moderator *models.UserModel
+		var currency *models.CurrencyModel
+
+		g.Before(func() {
+			moderator = createRoleTestUser(models.RoleModerator)
+			currency = &models.CurrencyModel{Id: models.NewId(), CurrencyCode: "TQE", Denomination: "100", Serial: "QE00000001", Status: "verified"}
+			Expect(models.Currency.Create(common.MongoSes, currency)).To(BeNil())
+			_, err := models.CounterfeitSerial.Import(common.MongoSes, []models.CounterfeitSerialModel{{CurrencyCode: "TQE", Serial: "QE00000002"}})
+			Expect(err).To(BeNil())
+		})
+
+		g.After(func() {
+			models.User.Delete(common.MongoSes, moderator.Id.Hex())
+			models.Currency.Delete(common.MongoSes, currency.Id.Hex())
+			if counterfeit, err := models.CounterfeitSerial.FindMatching(common.MongoSes, "TQE", "100", "QE00000002"); err == nil {
+				models.CounterfeitSerial.Delete(common.MongoSes, "TQE", counterfeit.Id.Hex())
+			}
+		})
+
+		g.It("should score the risk of a currency whose serial was corrected", func() {
+			ctx := common.NewContext("PATCH", "/v1/moderation/currencies/"+currency.Id.Hex(), map[string]string{"id": currency.Id.Hex()}, `{ "serial": "QE00000002" }`, nil)
+			ctx.Set("auth_user", moderator.Id.Hex())
+			ctx.Set("auth_roles", models.RoleModerator)
+			Expect(cntrl.EditCurrency(ctx)).To(BeNil())
+
+			edited, err := models.Currency.FindById(common.MongoSes, currency.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(edited.Serial).To(Equal("QE00000002"))
+			Expect(edited.RiskReasons).ToNot(BeEmpty())
+			Expect(edited.RiskReasons[0].Code).To(Equal(models.RiskKnownCounterfeit))
+		})
+	})
+}
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// create a currency for the statistics tests indexed at a time. Votes
+// are cast the given number of seconds after the currency was indexed.
+func createStatsTestCurrency(status, denomination string, createdAt time.Time, hidden bool, voteSeconds ...int) *models.CurrencyModel {
+	currency := &models.CurrencyModel{
+		Id:           models.NewId(),
+		UserId:       models.NewId(),
+		CurrencyCode: "TQS",
+		Denomination: denomination,
+		Serial:       models.NewId().Hex(),
+		Status:       status,
+		Hidden:       hidden,
+	}
+	for _, seconds := range voteSeconds {
+		currency.Votes = append(currency.Votes, models.Vote{
+			Decision:  1,
+			UserId:    models.NewId(),
+			CreatedAt: createdAt.Add(time.Duration(seconds) * time.Second),
+		})
+	}
+	Expect(models.Currency.Create(common.MongoSes, currency)).To(BeNil())
+	Expect(models.Currency.Update(common.MongoSes, currency.Id.Hex(), bson.M{"$set": bson.M{"created_at": createdAt}})).To(BeNil())
+	return currency
+}
+
+func TestCurrencyStats(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Currency statistics", func() {
+
+		filter := &models.StatsFilter{CurrencyCode: "TQS"}
+		firstDay := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+		secondDay := firstDay.Add(24 * time.Hour)
+		currencies := []*models.CurrencyModel{}
+
+		g.Before(func() {
+			currencies = append(currencies,
+				createStatsTestCurrency("verified", "100", firstDay, false, 60, 120),
+				createStatsTestCurrency("rejected", "200", secondDay, false, 30),
+				createStatsTestCurrency("awaiting_votes", "100", secondDay, false),
+				createStatsTestCurrency("verified", "100", secondDay, true, 10),
+			)
+		})
+
+		g.After(func() {
+			for _, currency := range currencies {
+				models.Currency.Delete(common.MongoSes, currency.Id.Hex())
+			}
+		})
+
+		g.It("should count indexed currencies without hidden currencies", func() {
+			counts, err := models.Currency.CountIndexed(common.MongoSes, filter, []string{"currency"})
+			Expect(err).To(BeNil())
+			Expect(counts).To(Equal([]models.IndexedCount{{CurrencyCode: "TQS", Count: 3}}))
+		})
+
+		g.It("should group indexed currencies by denomination and day", func() {
+			counts, err := models.Currency.CountIndexed(common.MongoSes, filter, []string{"denomination", "day"})
+			Expect(err).To(BeNil())
+			Expect(counts).To(Equal([]models.IndexedCount{
+				{Denomination: "100", Day: "2017-03-01", Count: 1},
+				{Denomination: "100", Day: "2017-03-02", Count: 1},
+				{Denomination: "200", Day: "2017-03-02", Count: 1},
+			}))
+
+			counts, err = models.Currency.CountIndexed(common.MongoSes, &models.StatsFilter{CurrencyCode: "TQS", From: secondDay}, []string{"currency"})
+			Expect(err).To(BeNil())
+			Expect(counts).To(Equal([]models.IndexedCount{{CurrencyCode: "TQS", Count: 2}}))
+		})
+
+		g.It("should get the vote outcomes and the verification rate", func() {
+			stats, err := models.Currency.VerificationStats(common.MongoSes, filter)
+			Expect(err).To(BeNil())
+			Expect(stats).To(Equal([]models.VerificationStats{{
+				CurrencyCode:     "TQS",
+				Total:            3,
+				AwaitingVotes:    1,
+				Verified:         1,
+				Rejected:         1,
+				VerificationRate: 0.5,
+			}}))
+		})
+
+		g.It("should get the average votes and seconds to decide a currency", func() {
+			stats, err := models.Currency.ConsensusStats(common.MongoSes, filter)
+			Expect(err).To(BeNil())
+			Expect(stats).To(HaveLen(1))
+			Expect(stats[0].Decided).To(Equal(2))
+			Expect(stats[0].AverageVotes).To(Equal(1.5))
+			Expect(stats[0].AverageSeconds).To(Equal(75.0))
+		})
+	})
+}
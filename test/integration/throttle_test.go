@@ -0,0 +1,33 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestThrottle(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Throttle()", func() {
+
+		g.It("should only let an action through once per window", func() {
+			name := "test_" + models.NewId().Hex()
+			first, err := models.Throttle(common.RedisPool, name, time.Minute)
+			Expect(err).To(BeNil())
+			Expect(first).To(BeTrue())
+
+			first, err = models.Throttle(common.RedisPool, name, time.Minute)
+			Expect(err).To(BeNil())
+			Expect(first).To(BeFalse())
+
+			first, err = models.Throttle(common.RedisPool, "test_"+models.NewId().Hex(), time.Minute)
+			Expect(err).To(BeNil())
+			Expect(first).To(BeTrue())
+		})
+	})
+}
@@ -13,5 +13,5 @@ import (
 var userCntrl *lib.UserController
 
 func init() {
-	userCntrl = lib.NewUserController(common.MongoSes)
+	userCntrl = lib.NewUserController(common.MongoSes, common.RedisPool, nil)
 }
@@ -0,0 +1,171 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// a provider that accepts any credential of the claimed user
+type mergeTestProvider struct{}
+
+func (p *mergeTestProvider) Name() string {
+	return "merge_test"
+}
+
+func (p *mergeTestProvider) Verify(credential *lib.ProviderCredential) (*lib.ProviderIdentity, error) {
+	return &lib.ProviderIdentity{ProviderUserId: credential.ProviderUserId}, nil
+}
+
+// create a user with an identity of the merge test provider
+func createMergeTestUser() *models.UserModel {
+	id := models.NewId()
+	user := &models.UserModel{
+		Id:             id,
+		Fullname:       "Merge Test",
+		Provider:       "merge_test",
+		ProviderUserId: id.Hex(),
+		Identities:     []models.Identity{{Provider: "merge_test", ProviderUserId: id.Hex()}},
+	}
+	Expect(models.User.Create(common.MongoSes, user)).To(BeNil())
+	return user
+}
+
+// create a currency uploaded by a user with votes of other users
+func createMergeTestCurrency(userId bson.ObjectId, voters ...bson.ObjectId) *models.CurrencyModel {
+	currency := &models.CurrencyModel{
+		Id:           models.NewId(),
+		UserId:       userId,
+		CurrencyCode: "TQM",
+		Denomination: "100",
+		Serial:       models.NewId().Hex(),
+		Status:       "awaiting_votes",
+	}
+	for _, voter := range voters {
+		currency.Votes = append(currency.Votes, models.Vote{Decision: 1, UserId: voter})
+	}
+	Expect(models.Currency.Create(common.MongoSes, currency)).To(BeNil())
+	return currency
+}
+
+// link the identity of the merge test provider of a user to another user
+func linkMergeTestIdentity(cntrl *lib.AuthController, userId, providerUserId string) error {
+	ctx := common.NewContext("POST", "/v1/auth/identities", nil, `{ "provider": "merge_test", "provider_id": "`+providerUserId+`" }`, nil)
+	ctx.Set("auth_user", userId)
+	return cntrl.LinkIdentity(ctx)
+}
+
+func voterIds(currency *models.CurrencyModel) []bson.ObjectId {
+	ids := []bson.ObjectId{}
+	for _, vote := range currency.Votes {
+		ids = append(ids, vote.UserId)
+	}
+	return ids
+}
+
+func TestMergeUsers(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("LinkIdentity() merging users", func() {
+
+		cntrl := lib.NewAuthController(common.MongoSes, common.RedisPool, lib.NewAuthProviderRegistry(&mergeTestProvider{}))
+		other := models.NewId()
+		currencies := []*models.CurrencyModel{}
+
+		g.After(func() {
+			for _, currency := range currencies {
+				models.Currency.Delete(common.MongoSes, currency.Id.Hex())
+			}
+		})
+
+		g.It("should move the identities and currencies of the other user", func() {
+			target, source := createMergeTestUser(), createMergeTestUser()
+			defer models.User.Delete(common.MongoSes, target.Id.Hex())
+
+			ownNote := createMergeTestCurrency(source.Id, target.Id, other)
+			bothVoted := createMergeTestCurrency(other, source.Id, target.Id)
+			sourceVoted := createMergeTestCurrency(other, source.Id)
+			decided := createMergeTestCurrency(other, source.Id, target.Id)
+			Expect(models.Currency.FinalizeStatus(common.MongoSes, decided.Id.Hex(), "verified")).To(BeNil())
+			currencies = append(currencies, ownNote, bothVoted, sourceVoted, decided)
+
+			Expect(linkMergeTestIdentity(cntrl, target.Id.Hex(), source.ProviderUserId)).To(BeNil())
+
+			_, err := models.User.FindById(common.MongoSes, source.Id.Hex())
+			Expect(err).To(Equal(mgo.ErrNotFound))
+
+			merged, err := models.User.FindById(common.MongoSes, target.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(merged.LinkedIdentities()).To(HaveLen(2))
+
+			ownNote, _ = models.Currency.FindById(common.MongoSes, ownNote.Id.Hex())
+			Expect(ownNote.UserId).To(Equal(target.Id))
+			Expect(voterIds(ownNote)).To(Equal([]bson.ObjectId{other}))
+
+			bothVoted, _ = models.Currency.FindById(common.MongoSes, bothVoted.Id.Hex())
+			Expect(voterIds(bothVoted)).To(Equal([]bson.ObjectId{target.Id}))
+
+			sourceVoted, _ = models.Currency.FindById(common.MongoSes, sourceVoted.Id.Hex())
+			Expect(voterIds(sourceVoted)).To(Equal([]bson.ObjectId{target.Id}))
+
+			// the votes of a decided currency are kept
+			decided, _ = models.Currency.FindById(common.MongoSes, decided.Id.Hex())
+			Expect(voterIds(decided)).To(Equal([]bson.ObjectId{target.Id, target.Id}))
+		})
+
+		g.It("should not merge banned users or users with roles", func() {
+			banned, staff, user := createMergeTestUser(), createMergeTestUser(), createMergeTestUser()
+			for _, u := range []*models.UserModel{banned, staff, user} {
+				defer models.User.Delete(common.MongoSes, u.Id.Hex())
+			}
+			Expect(models.User.SetBanned(common.MongoSes, banned.Id.Hex(), true, "spam")).To(BeNil())
+			Expect(models.User.SetRoles(common.MongoSes, staff.Id.Hex(), []string{models.RoleModerator})).To(BeNil())
+
+			for _, pair := range [][]*models.UserModel{{user, banned}, {banned, user}, {user, staff}, {staff, user}} {
+				err := linkMergeTestIdentity(cntrl, pair[0].Id.Hex(), pair[1].ProviderUserId)
+				Expect(err).ToNot(BeNil())
+				Expect(err.(*config.HTTPError).StatusCode).To(Equal(403))
+
+				_, err = models.User.FindById(common.MongoSes, pair[1].Id.Hex())
+				Expect(err).To(BeNil())
+			}
+
+			entries, err := models.AuditLog.Find(common.MongoSes, bson.M{"action": models.AuditUserMergeRefused, "target_id": user.Id.Hex()}, 10, 0)
+			Expect(err).To(BeNil())
+			Expect(entries).To(HaveLen(2))
+		})
+
+		g.It("should resume an interrupted merge", func() {
+			target, source := createMergeTestUser(), createMergeTestUser()
+			defer models.User.Delete(common.MongoSes, target.Id.Hex())
+
+			// the merge stopped after the identities of the source were released
+			Expect(models.User.StartMerge(common.MongoSes, source.Id.Hex(), target.Id.Hex())).To(BeNil())
+			Expect(models.User.ReleaseIdentities(common.MongoSes, source.Id.Hex(), source.Identities)).To(BeNil())
+
+			Expect(linkMergeTestIdentity(cntrl, target.Id.Hex(), source.ProviderUserId)).To(BeNil())
+
+			_, err := models.User.FindById(common.MongoSes, source.Id.Hex())
+			Expect(err).To(Equal(mgo.ErrNotFound))
+
+			owner, err := models.User.FindByIdentity(common.MongoSes, "merge_test", source.ProviderUserId)
+			Expect(err).To(BeNil())
+			Expect(owner.Id).To(Equal(target.Id))
+		})
+
+		g.It("should not merge a user being merged into another user", func() {
+			source := createMergeTestUser()
+			defer models.User.Delete(common.MongoSes, source.Id.Hex())
+			Expect(models.User.StartMerge(common.MongoSes, source.Id.Hex(), other.Hex())).To(BeNil())
+			Expect(models.User.StartMerge(common.MongoSes, source.Id.Hex(), other.Hex())).To(BeNil())
+			Expect(models.User.StartMerge(common.MongoSes, source.Id.Hex(), models.NewId().Hex())).To(Equal(mgo.ErrNotFound))
+		})
+	})
+}
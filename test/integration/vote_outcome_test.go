@@ -0,0 +1,67 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestFinalizeVoteOutcome(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("FinalizeVoteOutcome()", func() {
+
+		var currency *models.CurrencyModel
+
+		g.BeforeEach(func() {
+			currency = createQueueTestCurrency("awaiting_votes", false)
+			Expect(models.AddToVoteQueue(common.RedisPool, currency.Id.Hex(), currency.CurrencyCode, time.Now(), 0)).To(BeNil())
+		})
+
+		g.AfterEach(func() {
+			models.Currency.Delete(common.MongoSes, currency.Id.Hex())
+			models.RemoveFromVoteQueue(common.RedisPool, currency.Id.Hex(), currency.CurrencyCode)
+		})
+
+		g.It("should not decide a currency without the maximum number of votes", func() {
+			currency.Votes = []models.Vote{{Decision: 1}, {Decision: 1}}
+			_, finalized, err := lib.FinalizeVoteOutcome(common.MongoSes, common.RedisPool, currency, 3)
+			Expect(err).To(BeNil())
+			Expect(finalized).To(BeFalse())
+			Expect(currency.Status).To(Equal("awaiting_votes"))
+		})
+
+		g.It("should set the majority decision and remove the currency from the vote queue", func() {
+			currency.Votes = []models.Vote{{Decision: 1}, {Decision: 0}, {Decision: 0}}
+			prevStatus, finalized, err := lib.FinalizeVoteOutcome(common.MongoSes, common.RedisPool, currency, 3)
+			Expect(err).To(BeNil())
+			Expect(finalized).To(BeTrue())
+			Expect(prevStatus).To(Equal("awaiting_votes"))
+
+			stored, err := models.Currency.FindById(common.MongoSes, currency.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(stored.Status).To(Equal("rejected"))
+
+			inQueue, err := models.IsInVoteQueue(common.RedisPool, currency.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(inQueue).To(BeFalse())
+		})
+
+		g.It("should not change a currency decided by another vote", func() {
+			Expect(models.Currency.UpdateStatus(common.MongoSes, currency.Id.Hex(), "verified")).To(BeNil())
+			currency.Votes = []models.Vote{{Decision: 0}, {Decision: 0}, {Decision: 0}}
+			_, finalized, err := lib.FinalizeVoteOutcome(common.MongoSes, common.RedisPool, currency, 3)
+			Expect(err).To(BeNil())
+			Expect(finalized).To(BeFalse())
+
+			stored, err := models.Currency.FindById(common.MongoSes, currency.Id.Hex())
+			Expect(err).To(BeNil())
+			Expect(stored.Status).To(Equal("verified"))
+		})
+	})
+}
@@ -0,0 +1,201 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestVoteQueue(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("VoteQueue", func() {
+
+		now := time.Now()
+		oldest, older, newest, urgent := models.NewId().Hex(), models.NewId().Hex(), models.NewId().Hex(), models.NewId().Hex()
+
+		g.Before(func() {
+			Expect(models.AddToVoteQueue(common.RedisPool, newest, "TQA", now, 0)).To(BeNil())
+			Expect(models.AddToVoteQueue(common.RedisPool, older, "TQA", now.Add(-time.Minute), 0)).To(BeNil())
+			Expect(models.AddToVoteQueue(common.RedisPool, oldest, "TQA", now.Add(-10*time.Minute), 0)).To(BeNil())
+			Expect(models.AddToVoteQueue(common.RedisPool, urgent, "TQB", now, 1)).To(BeNil())
+		})
+
+		g.After(func() {
+			for _, id := range []string{oldest, older, newest} {
+				models.RemoveFromVoteQueue(common.RedisPool, id, "TQA")
+			}
+			models.RemoveFromVoteQueue(common.RedisPool, urgent, "TQB")
+		})
+
+		g.It("should serve the oldest currencies first", func() {
+			ids, err := models.GetFromVoteQueue(common.RedisPool, "TQA", 0, 10)
+			Expect(err).To(BeNil())
+			Expect(ids).To(Equal([]string{oldest, older, newest}))
+		})
+
+		g.It("should serve currencies with a higher priority before older ones", func() {
+			Expect(models.VoteQueueScore(now, 1)).To(BeNumerically("<", models.VoteQueueScore(now.Add(-10*time.Minute), 0)))
+			ids, err := models.GetFromVoteQueue(common.RedisPool, "", 0, 100000)
+			Expect(err).To(BeNil())
+			Expect(indexOf(ids, urgent)).To(BeNumerically("<", indexOf(ids, oldest)))
+		})
+
+		g.It("should keep the original score when a currency is added again", func() {
+			Expect(models.AddToVoteQueue(common.RedisPool, oldest, "TQA", now.Add(time.Hour), 0)).To(BeNil())
+			ids, err := models.GetFromVoteQueue(common.RedisPool, "TQA", 0, 1)
+			Expect(err).To(BeNil())
+			Expect(ids).To(Equal([]string{oldest}))
+		})
+
+		g.It("should only hold currencies of its code in a sub-queue", func() {
+			ids, err := models.GetFromVoteQueue(common.RedisPool, "TQB", 0, 10)
+			Expect(err).To(BeNil())
+			Expect(ids).To(Equal([]string{urgent}))
+			count, err := models.CountVoteQueue(common.RedisPool, "TQA")
+			Expect(err).To(BeNil())
+			Expect(count).To(Equal(3))
+		})
+
+		g.It("should remove a currency from the main queue and its sub-queue", func() {
+			Expect(models.RemoveFromVoteQueue(common.RedisPool, older, "TQA")).To(BeNil())
+			inQueue, err := models.IsInVoteQueue(common.RedisPool, older)
+			Expect(err).To(BeNil())
+			Expect(inQueue).To(BeFalse())
+			ids, err := models.GetFromVoteQueue(common.RedisPool, "TQA", 0, 10)
+			Expect(err).To(BeNil())
+			Expect(ids).To(Equal([]string{oldest, newest}))
+		})
+	})
+}
+
+// create a currency for the vote queue tests
+func createQueueTestCurrency(status string, hidden bool) *models.CurrencyModel {
+	currency := &models.CurrencyModel{
+		Id:           models.NewId(),
+		UserId:       models.NewId(),
+		CurrencyCode: "TQR",
+		Denomination: "100",
+		Serial:       models.NewId().Hex(),
+		Status:       status,
+		Hidden:       hidden,
+	}
+	Expect(models.Currency.Create(common.MongoSes, currency)).To(BeNil())
+	return currency
+}
+
+func TestReconcileVoteQueue(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("VoteQueueReconciler.Reconcile()", func() {
+
+		var missing, verified, hidden, unqueued *models.CurrencyModel
+		var deleted, orphan string
+
+		g.Before(func() {
+			missing = createQueueTestCurrency("awaiting_votes", false)
+			verified = createQueueTestCurrency("verified", false)
+			hidden = createQueueTestCurrency("awaiting_votes", true)
+			unqueued = createQueueTestCurrency("awaiting_votes", false)
+			deleted, orphan = models.NewId().Hex(), models.NewId().Hex()
+
+			Expect(models.AddToVoteQueue(common.RedisPool, missing.Id.Hex(), "TQR", missing.CreatedAt, 0)).To(BeNil())
+			Expect(models.AddToVoteQueue(common.RedisPool, verified.Id.Hex(), "TQR", verified.CreatedAt, 0)).To(BeNil())
+			Expect(models.AddToVoteQueue(common.RedisPool, hidden.Id.Hex(), "TQR", hidden.CreatedAt, 0)).To(BeNil())
+			Expect(models.AddToVoteQueue(common.RedisPool, deleted, "TQR", time.Now(), 0)).To(BeNil())
+			Expect(models.AddToVoteQueue(common.RedisPool, orphan, "TQR", time.Now(), 0)).To(BeNil())
+			Expect(models.RemoveFromQueue(common.RedisPool, models.VOTE_QUEUE_NAME, orphan)).To(BeNil())
+		})
+
+		g.After(func() {
+			for _, currency := range []*models.CurrencyModel{missing, verified, hidden, unqueued} {
+				models.Currency.Delete(common.MongoSes, currency.Id.Hex())
+				models.RemoveFromVoteQueue(common.RedisPool, currency.Id.Hex(), "TQR")
+			}
+		})
+
+		g.It("should bring the vote queue in sync with the currencies", func() {
+			reconciler := lib.NewVoteQueueReconciler(common.MongoSes, common.RedisPool, time.Minute)
+			result, err := reconciler.Reconcile()
+			Expect(err).To(BeNil())
+			Expect(result.RemovedMissing).To(BeNumerically(">=", 1))
+			Expect(result.RemovedFinalized).To(BeNumerically(">=", 2))
+			Expect(result.RemovedOrphaned).To(BeNumerically(">=", 1))
+			Expect(result.Requeued).To(BeNumerically(">=", 1))
+
+			ids, err := models.GetFromVoteQueue(common.RedisPool, "TQR", 0, 10)
+			Expect(err).To(BeNil())
+			Expect(ids).To(ConsistOf(missing.Id.Hex(), unqueued.Id.Hex()))
+
+			inQueue, err := models.InVoteQueue(common.RedisPool, []string{missing.Id.Hex(), verified.Id.Hex(), deleted, unqueued.Id.Hex()})
+			Expect(err).To(BeNil())
+			Expect(inQueue).To(Equal(map[string]bool{
+				missing.Id.Hex():  true,
+				verified.Id.Hex(): false,
+				deleted:           false,
+				unqueued.Id.Hex(): true,
+			}))
+		})
+	})
+}
+
+func TestReconcileMaxVotes(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("VoteQueueReconciler.Reconcile() with fully voted currencies", func() {
+
+		var queued, unqueued *models.CurrencyModel
+
+		g.Before(func() {
+			queued = createQueueTestCurrency("awaiting_votes", false)
+			unqueued = createQueueTestCurrency("awaiting_votes", false)
+			for _, currency := range []*models.CurrencyModel{queued, unqueued} {
+				votes := []models.Vote{}
+				for i := 0; i < config.C.GetInt("max_votes"); i++ {
+					votes = append(votes, models.Vote{Decision: 1, UserId: models.NewId()})
+				}
+				Expect(models.Currency.UpdateVotes(common.MongoSes, currency.Id.Hex(), votes)).To(BeNil())
+			}
+			Expect(models.AddToVoteQueue(common.RedisPool, queued.Id.Hex(), "TQR", queued.CreatedAt, 0)).To(BeNil())
+		})
+
+		g.After(func() {
+			for _, currency := range []*models.CurrencyModel{queued, unqueued} {
+				models.Currency.Delete(common.MongoSes, currency.Id.Hex())
+				models.RemoveFromVoteQueue(common.RedisPool, currency.Id.Hex(), "TQR")
+			}
+		})
+
+		g.It("should finalize currencies that reached the maximum number of votes", func() {
+			reconciler := lib.NewVoteQueueReconciler(common.MongoSes, common.RedisPool, time.Minute)
+			result, err := reconciler.Reconcile()
+			Expect(err).To(BeNil())
+			Expect(result.Finalized).To(BeNumerically(">=", 2))
+
+			for _, currency := range []*models.CurrencyModel{queued, unqueued} {
+				updated, err := models.Currency.FindById(common.MongoSes, currency.Id.Hex())
+				Expect(err).To(BeNil())
+				Expect(updated.Status).To(Equal("verified"))
+			}
+
+			inQueue, err := models.InVoteQueue(common.RedisPool, []string{queued.Id.Hex(), unqueued.Id.Hex()})
+			Expect(err).To(BeNil())
+			Expect(inQueue).To(Equal(map[string]bool{queued.Id.Hex(): false, unqueued.Id.Hex(): false}))
+		})
+	})
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	"github.com/ellcrys/openmint/test/common"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// create an active watchlist
+func createTestWatchlist(watchlist models.WatchlistModel) *models.WatchlistModel {
+	watchlist.Id = models.NewId()
+	watchlist.UserId = models.NewId()
+	watchlist.CurrencyCode = "TQW"
+	watchlist.Channels = []string{models.WatchlistChannelFeed}
+	watchlist.Active = true
+	Expect(models.Watchlist.Create(common.MongoSes, &watchlist)).To(BeNil())
+	return &watchlist
+}
+
+// get the ids of watchlists
+func watchlistIds(watchlists []models.WatchlistModel) []bson.ObjectId {
+	ids := []bson.ObjectId{}
+	for _, w := range watchlists {
+		ids = append(ids, w.Id)
+	}
+	return ids
+}
+
+// create a watchlist as a user
+func createWatchlistAs(cntrl *lib.WatchlistController, user *models.UserModel, body string) error {
+	ctx := common.NewContext("POST", "/v1/watchlists", nil, body, nil)
+	ctx.Set("auth_user", user.Id.Hex())
+	return cntrl.Create(ctx)
+}
+
+func TestWatchlistFindMatching(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("Watchlist.FindMatching()", func() {
+
+		var exact, prefix, rng, unprefixed, otherDenom, inactive *models.WatchlistModel
+
+		g.Before(func() {
+			exact = createTestWatchlist(models.WatchlistModel{Type: models.WatchlistExact, Serial: "QX00001500"})
+			prefix = createTestWatchlist(models.WatchlistModel{Type: models.WatchlistPrefix, Prefix: "QX0000"})
+			rng = createTestWatchlist(models.WatchlistModel{Type: models.WatchlistRange, Prefix: "QX", From: 1000, To: 2000})
+			unprefixed = createTestWatchlist(models.WatchlistModel{Type: models.WatchlistRange, From: 90000000, To: 90000100})
+			otherDenom = createTestWatchlist(models.WatchlistModel{Type: models.WatchlistExact, Denomination: "500", Serial: "QX00001500"})
+			inactive = createTestWatchlist(models.WatchlistModel{Type: models.WatchlistExact, Serial: "QX00001500"})
+			Expect(models.Watchlist.Update(common.MongoSes, inactive.Id.Hex(), bson.M{"$set": bson.M{"active": false}})).To(BeNil())
+		})
+
+		g.After(func() {
+			for _, w := range []*models.WatchlistModel{exact, prefix, rng, unprefixed, otherDenom, inactive} {
+				models.Watchlist.Delete(common.MongoSes, w.Id.Hex())
+			}
+		})
+
+		g.It("should find the active watchlists matching a serial", func() {
+			matches, err := models.Watchlist.FindMatching(common.MongoSes, "TQW", "100", "QX00001500")
+			Expect(err).To(BeNil())
+			Expect(watchlistIds(matches)).To(ConsistOf(exact.Id, prefix.Id, rng.Id))
+
+			matches, err = models.Watchlist.FindMatching(common.MongoSes, "TQW", "500", "QX00001500")
+			Expect(err).To(BeNil())
+			Expect(watchlistIds(matches)).To(ConsistOf(exact.Id, prefix.Id, rng.Id, otherDenom.Id))
+		})
+
+		g.It("should match ranges by the number of the serial", func() {
+			matches, err := models.Watchlist.FindMatching(common.MongoSes, "TQW", "100", "QX00002001")
+			Expect(err).To(BeNil())
+			Expect(watchlistIds(matches)).To(ConsistOf(prefix.Id))
+
+			matches, err = models.Watchlist.FindMatching(common.MongoSes, "TQW", "100", "90000042")
+			Expect(err).To(BeNil())
+			Expect(watchlistIds(matches)).To(ConsistOf(unprefixed.Id))
+		})
+	})
+}
+
+func TestWatchlistCreate(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("WatchlistController.Create()", func() {
+
+		cntrl := lib.NewWatchlistController(common.MongoSes)
+		var user, investigator *models.UserModel
+
+		g.Before(func() {
+			user = createRoleTestUser()
+			investigator = createRoleTestUser(models.RoleInvestigator)
+		})
+
+		g.After(func() {
+			for _, u := range []*models.UserModel{user, investigator} {
+				models.Watchlist.DeleteByUser(common.MongoSes, u.Id.Hex())
+				models.User.Delete(common.MongoSes, u.Id.Hex())
+			}
+		})
+
+		g.It("should let any user watch an exact serial", func() {
+			Expect(createWatchlistAs(cntrl, user, `{ "name": "Stolen", "type": "exact", "currency_code": "NGN", "serial": "AB1234567" }`)).To(BeNil())
+		})
+
+		g.It("should require a permission for prefix and range watchlists", func() {
+			err := createWatchlistAs(cntrl, user, `{ "name": "Stolen", "type": "prefix", "currency_code": "NGN", "prefix": "AB1234" }`)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).StatusCode).To(Equal(403))
+
+			err = createWatchlistAs(cntrl, user, `{ "name": "Stolen", "type": "range", "currency_code": "NGN", "prefix": "AB", "from": 1000, "to": 2000 }`)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).StatusCode).To(Equal(403))
+
+			Expect(createWatchlistAs(cntrl, investigator, `{ "name": "Stolen", "type": "prefix", "currency_code": "NGN", "prefix": "AB1234" }`)).To(BeNil())
+			Expect(createWatchlistAs(cntrl, investigator, `{ "name": "Stolen", "type": "range", "currency_code": "NGN", "prefix": "AB", "from": 1000, "to": 2000 }`)).To(BeNil())
+		})
+
+		g.It("should reject short prefixes and wide ranges", func() {
+			err := createWatchlistAs(cntrl, investigator, `{ "name": "Stolen", "type": "prefix", "currency_code": "NGN", "prefix": "AB" }`)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).Param).To(Equal("prefix"))
+
+			err = createWatchlistAs(cntrl, investigator, `{ "name": "Stolen", "type": "range", "currency_code": "NGN", "prefix": "AB", "from": 0, "to": 10000 }`)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*config.HTTPError).Param).To(Equal("to"))
+		})
+	})
+}
+
+func TestWatchlistAlerter(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("WatchlistAlerter.Check()", func() {
+
+		alerter := lib.NewWatchlistAlerter(common.MongoSes, common.RedisPool, nil, lib.LogMailer{})
+		var watchlist *models.WatchlistModel
+
+		g.Before(func() {
+			watchlist = createTestWatchlist(models.WatchlistModel{Type: models.WatchlistExact, Serial: "QY00000001"})
+		})
+
+		g.After(func() {
+			models.Watchlist.Delete(common.MongoSes, watchlist.Id.Hex())
+			models.Notification.DeleteByUser(common.MongoSes, watchlist.UserId.Hex())
+		})
+
+		g.It("should not alert about hidden currencies", func() {
+			currency := &models.CurrencyModel{Id: models.NewId(), CurrencyCode: "TQW", Denomination: "100", Serial: "QY00000001", Hidden: true}
+			alerter.Check(currency, nil)
+			notifications, err := models.Notification.FindByUser(common.MongoSes, watchlist.UserId.Hex(), false, 10, 0)
+			Expect(err).To(BeNil())
+			Expect(notifications).To(BeEmpty())
+		})
+
+		g.It("should alert without the location of the currency", func() {
+			currency := &models.CurrencyModel{Id: models.NewId(), CurrencyCode: "TQW", Denomination: "100", Serial: "QY00000001", Location: models.NewGeoPoint(6.5, 3.4)}
+			sighting := &models.SightingModel{Id: models.NewId(), CurrencyId: currency.Id, Location: currency.Location}
+			alerter.Check(currency, sighting)
+			notifications, err := models.Notification.FindByUser(common.MongoSes, watchlist.UserId.Hex(), false, 10, 0)
+			Expect(err).To(BeNil())
+			Expect(notifications).To(HaveLen(1))
+			data := notifications[0].Data.(bson.M)
+			Expect(data["currency"]).ToNot(HaveKey("location"))
+			Expect(data["sighting"]).ToNot(HaveKey("location"))
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestAPIKey(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("NewAPIKey()", func() {
+
+		g.It("should return a key identifiable by its prefix", func() {
+			key, prefix := lib.NewAPIKey()
+			Expect(lib.IsAPIKey(key)).To(Equal(true))
+			Expect(key[:len(prefix)]).To(Equal(prefix))
+			Expect(len(prefix)).To(Equal(lib.API_KEY_PREFIX_LENGTH))
+		})
+
+		g.It("should not treat session tokens as keys", func() {
+			Expect(lib.IsAPIKey("eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.e30.abc")).To(Equal(false))
+			Expect(lib.IsAPIKey(lib.API_KEY_MARKER)).To(Equal(false))
+		})
+
+		g.It("should hash keys deterministically", func() {
+			key, _ := lib.NewAPIKey()
+			Expect(lib.HashAPIKey(key)).To(Equal(lib.HashAPIKey(key)))
+			Expect(lib.HashAPIKey(key)).ToNot(Equal(key))
+			Expect(lib.HashAPIKey(key)).To(HaveLen(64))
+		})
+	})
+}
@@ -0,0 +1,118 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+var auditLogKey = []byte("audit-log-key")
+
+// Create a chain of entries
+func newAuditChain(n int) []*models.AuditLogModel {
+	entries := []*models.AuditLogModel{}
+	for i := 1; i <= n; i++ {
+		entry := &models.AuditLogModel{
+			Id:         models.NewId(),
+			Seq:        int64(i),
+			ActorId:    models.NewId(),
+			IP:         "127.0.0.1",
+			Salt:       models.NewId().Hex(),
+			Action:     models.AuditCurrencyStatus,
+			TargetType: models.AuditTargetCurrency,
+			TargetId:   models.NewId().Hex(),
+			Changes:    map[string]interface{}{"status": map[string]interface{}{"from": "awaiting_votes", "to": "disputed"}},
+			CreatedAt:  time.Now().UTC().Truncate(time.Millisecond),
+		}
+		entry.Pseudonym = entry.ComputePseudonym()
+		entry.Hash = entry.ComputeHash(auditLogKey)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Verify entries and return the first error
+func verifyAuditChain(entries []*models.AuditLogModel, lastSeq int64) error {
+	verifier := &models.AuditChainVerifier{Key: auditLogKey}
+	for _, entry := range entries {
+		if err := verifier.Next(entry); err != nil {
+			return err
+		}
+	}
+	return verifier.End(lastSeq)
+}
+
+func TestAuditChainVerifier(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("AuditChainVerifier", func() {
+
+		g.It("should accept an intact chain", func() {
+			Expect(verifyAuditChain(newAuditChain(5), 5)).To(BeNil())
+		})
+
+		g.It("should detect a modified entry", func() {
+			entries := newAuditChain(5)
+			entries[2].Changes["status"] = map[string]interface{}{"from": "awaiting_votes", "to": "genuine"}
+			err := verifyAuditChain(entries, 5)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*models.AuditChainError).Seq).To(Equal(int64(3)))
+		})
+
+		g.It("should detect a removed entry", func() {
+			entries := newAuditChain(5)
+			entries = append(entries[:2], entries[3:]...)
+			err := verifyAuditChain(entries, 5)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*models.AuditChainError).Seq).To(Equal(int64(4)))
+		})
+
+		g.It("should detect removed entries at the end of the chain", func() {
+			err := verifyAuditChain(newAuditChain(5)[:3], 5)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*models.AuditChainError).Seq).To(Equal(int64(4)))
+		})
+
+		g.It("should detect a rewritten entry without the key", func() {
+			entries := newAuditChain(5)
+			entries[1].Reason = "rewritten"
+			entries[1].Hash = entries[1].ComputeHash([]byte("guessed-key"))
+			err := verifyAuditChain(entries, 5)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*models.AuditChainError).Seq).To(Equal(int64(2)))
+		})
+
+		g.It("should accept entries whose actor was erased", func() {
+			entries := newAuditChain(5)
+			entries[1].ActorId, entries[1].IP, entries[1].Salt = "", "", ""
+			Expect(verifyAuditChain(entries, 5)).To(BeNil())
+		})
+
+		g.It("should detect a changed actor or ip address", func() {
+			entries := newAuditChain(5)
+			entries[1].ActorId = models.NewId()
+			err := verifyAuditChain(entries, 5)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*models.AuditChainError).Seq).To(Equal(int64(2)))
+
+			entries = newAuditChain(5)
+			entries[2].Salt = ""
+			entries[2].IP = "10.0.0.1"
+			err = verifyAuditChain(entries, 5)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*models.AuditChainError).Seq).To(Equal(int64(3)))
+		})
+
+		g.It("should detect renumbered entries", func() {
+			entries := newAuditChain(5)
+			entries[3].Seq, entries[4].Seq = entries[4].Seq, entries[3].Seq
+			entries[3], entries[4] = entries[4], entries[3]
+			err := verifyAuditChain(entries, 5)
+			Expect(err).ToNot(BeNil())
+			Expect(err.(*models.AuditChainError).Seq).To(Equal(int64(4)))
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestOAuth2Provider(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("OAuth2Provider", func() {
+
+		// introspection results by access token
+		tokens := map[string]map[string]interface{}{
+			"token-1": {"active": true, "client_id": "client-1"},
+			"token-2": {"active": true, "aud": []string{"api", "client-1"}},
+			"token-3": {"active": true, "client_id": "client-2"},
+			"token-4": {"active": false},
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+			if id, secret, _ := r.BasicAuth(); id != "client-1" || secret != "secret" {
+				w.WriteHeader(401)
+				return
+			}
+			result, ok := tokens[r.PostFormValue("token")]
+			if !ok {
+				result = map[string]interface{}{"active": false}
+			}
+			json.NewEncoder(w).Encode(result)
+		})
+		mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "email": "user@example.com", "email_verified": true})
+		})
+		server := httptest.NewServer(mux)
+
+		g.After(func() {
+			server.Close()
+		})
+
+		newProvider := func() *lib.OAuth2Provider {
+			verifier := &lib.IntrospectionVerifier{URL: server.URL + "/introspect", ClientId: "client-1", ClientSecret: "secret"}
+			return lib.NewOAuth2Provider("acme", server.URL+"/userinfo", verifier)
+		}
+
+		g.It("should verify access tokens issued to the client", func() {
+			for _, token := range []string{"token-1", "token-2"} {
+				identity, err := newProvider().Verify(&lib.ProviderCredential{ProviderUserId: "42", AccessToken: token})
+				Expect(err).To(BeNil())
+				Expect(identity.ProviderUserId).To(Equal("42"))
+				Expect(identity.Email).To(Equal("user@example.com"))
+				Expect(identity.EmailVerified).To(BeTrue())
+			}
+		})
+
+		g.It("should reject access tokens issued to other clients or that are not active", func() {
+			for _, token := range []string{"token-3", "token-4", "unknown"} {
+				_, err := newProvider().Verify(&lib.ProviderCredential{AccessToken: token})
+				Expect(err).To(Equal(lib.ErrInvalidProviderCredential))
+			}
+		})
+
+		g.It("should reject access tokens of other users", func() {
+			_, err := newProvider().Verify(&lib.ProviderCredential{ProviderUserId: "43", AccessToken: "token-1"})
+			Expect(err).To(Equal(lib.ErrInvalidProviderCredential))
+		})
+
+		g.It("should not verify emails the provider does not mark as verified", func() {
+			provider := newProvider()
+			provider.EmailVerifiedField = "verified"
+			identity, err := provider.Verify(&lib.ProviderCredential{AccessToken: "token-1"})
+			Expect(err).To(BeNil())
+			Expect(identity.Email).To(Equal("user@example.com"))
+			Expect(identity.EmailVerified).To(BeFalse())
+		})
+	})
+}
+
+func TestGitHubTokenVerifier(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("GitHubTokenVerifier", func() {
+
+		// the apps tokens were issued to
+		tokens := map[string]string{
+			"token-1": "client-1",
+			"token-2": "client-2",
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/applications/client-1/token", func(w http.ResponseWriter, r *http.Request) {
+			if id, secret, _ := r.BasicAuth(); r.Method != "POST" || id != "client-1" || secret != "secret" {
+				w.WriteHeader(401)
+				return
+			}
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if tokens[body["access_token"]] != "client-1" {
+				w.WriteHeader(404)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"app": map[string]string{"client_id": "client-1"}})
+		})
+		mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "octocat"})
+		})
+		server := httptest.NewServer(mux)
+
+		g.After(func() {
+			server.Close()
+		})
+
+		newProvider := func() *lib.OAuth2Provider {
+			verifier := lib.NewGitHubTokenVerifier("client-1", "secret")
+			verifier.APIURL = server.URL
+			return lib.NewOAuth2Provider("github", server.URL+"/user", verifier)
+		}
+
+		g.It("should verify access tokens issued to the app", func() {
+			identity, err := newProvider().Verify(&lib.ProviderCredential{ProviderUserId: "42", AccessToken: "token-1"})
+			Expect(err).To(BeNil())
+			Expect(identity.ProviderUserId).To(Equal("42"))
+		})
+
+		g.It("should reject access tokens issued to other apps", func() {
+			for _, token := range []string{"token-2", "unknown"} {
+				_, err := newProvider().Verify(&lib.ProviderCredential{AccessToken: token})
+				Expect(err).To(Equal(lib.ErrInvalidProviderCredential))
+			}
+		})
+	})
+}
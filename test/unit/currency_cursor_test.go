@@ -0,0 +1,33 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestCurrencyCursor(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("CurrencyCursor", func() {
+
+		g.It("should decode an encoded cursor with millisecond precision", func() {
+			id := models.NewId()
+			createdAt := time.Date(2016, 5, 1, 10, 30, 15, 123456789, time.UTC)
+			decodedAt, decodedId, err := models.DecodeCurrencyCursor(models.EncodeCurrencyCursor(createdAt, id))
+			Expect(err).To(BeNil())
+			Expect(decodedId).To(Equal(id))
+			Expect(decodedAt).To(Equal(createdAt.Truncate(time.Millisecond)))
+		})
+
+		g.It("should reject invalid cursors", func() {
+			for _, cursor := range []string{"not a cursor", "MTIz", "MTIzOnh5eg"} {
+				_, _, err := models.DecodeCurrencyCursor(cursor)
+				Expect(err).To(Equal(models.ErrInvalidCursor))
+			}
+		})
+	})
+}
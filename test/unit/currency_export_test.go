@@ -0,0 +1,71 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func exportCurrencies(format string, includeUser bool, currencies ...models.CurrencyModel) string {
+	buf := new(bytes.Buffer)
+	writer := lib.NewCurrencyExportWriter(buf, format, includeUser)
+	writer.Begin()
+	for i := range currencies {
+		writer.Write(&currencies[i])
+	}
+	writer.End()
+	return buf.String()
+}
+
+func TestCurrencyExportWriter(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("CurrencyExportWriter", func() {
+
+		currencies := []models.CurrencyModel{
+			{Id: models.NewId(), UserId: models.NewId(), Serial: "AB123", CurrencyCode: "NGN", Denomination: "500", Status: "verified", CreatedAt: time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)},
+			{Id: models.NewId(), UserId: models.NewId(), Serial: "CD456", CurrencyCode: "USD", Denomination: "20", Status: "awaiting_votes", CreatedAt: time.Date(2016, 5, 2, 0, 0, 0, 0, time.UTC)},
+		}
+
+		g.It("should write a csv header and a row per currency", func() {
+			records, err := csv.NewReader(strings.NewReader(exportCurrencies(lib.ExportCSV, false, currencies...))).ReadAll()
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(3))
+			Expect(records[0][1]).To(Equal("serial"))
+			Expect(records[2][1]).To(Equal("CD456"))
+			Expect(records[1][7]).To(Equal("2016-05-01T00:00:00Z"))
+		})
+
+		g.It("should include the uploader when requested", func() {
+			records, err := csv.NewReader(strings.NewReader(exportCurrencies(lib.ExportCSV, true, currencies...))).ReadAll()
+			Expect(err).To(BeNil())
+			Expect(records[0][1]).To(Equal("user_id"))
+			Expect(records[1][1]).To(Equal(currencies[0].UserId.Hex()))
+		})
+
+		g.It("should write a valid json array", func() {
+			var result []map[string]interface{}
+			Expect(json.Unmarshal([]byte(exportCurrencies(lib.ExportJSON, false, currencies...)), &result)).To(BeNil())
+			Expect(result).To(HaveLen(2))
+			_, hasUser := result[0]["user_id"]
+			Expect(hasUser).To(Equal(false))
+			Expect(exportCurrencies(lib.ExportJSON, false)).To(Equal("[]"))
+		})
+
+		g.It("should write a json object per line", func() {
+			lines := strings.Split(strings.TrimSpace(exportCurrencies(lib.ExportNDJSON, false, currencies...)), "\n")
+			Expect(lines).To(HaveLen(2))
+			var result map[string]interface{}
+			Expect(json.Unmarshal([]byte(lines[1]), &result)).To(BeNil())
+			Expect(result["serial"]).To(Equal("CD456"))
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+// Create a JPEG image with an EXIF GPS position. Coordinates
+// are given as degrees, minutes and seconds.
+func newJPEGWithGPS(latRef string, lat [3]uint32, lngRef string, lng [3]uint32) []byte {
+
+	order := binary.LittleEndian
+	tiff := new(bytes.Buffer)
+	write := func(v interface{}) { binary.Write(tiff, order, v) }
+
+	// header, IFD0 at offset 8 with a single GPS pointer entry
+	tiff.WriteString("II")
+	write(uint16(42))
+	write(uint32(8))
+	write(uint16(1))
+	write([]uint16{0x8825, 4})
+	write([]uint32{1, 26})
+	write(uint32(0))
+
+	// GPS IFD at offset 26 with 4 entries. Rationals follow at offset 80.
+	write(uint16(4))
+	write([]uint16{1, 2})
+	write(uint32(2))
+	tiff.WriteString(latRef + "\x00\x00\x00")
+	write([]uint16{2, 5})
+	write([]uint32{3, 80})
+	write([]uint16{3, 2})
+	write(uint32(2))
+	tiff.WriteString(lngRef + "\x00\x00\x00")
+	write([]uint16{4, 5})
+	write([]uint32{3, 104})
+	write(uint32(0))
+	for _, v := range append(lat[:], lng[:]...) {
+		write([]uint32{v, 1})
+	}
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	img := new(bytes.Buffer)
+	jpeg.Encode(img, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+
+	result := append([]byte{0xFF, 0xD8}, segment...)
+	result = append(result, payload...)
+	return append(result, img.Bytes()[2:]...)
+}
+
+func TestReadEXIFLocation(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("ReadEXIFLocation()", func() {
+
+		g.It("should read the GPS position", func() {
+			data := newJPEGWithGPS("N", [3]uint32{6, 27, 36}, "E", [3]uint32{3, 23, 24})
+			lat, lng, err := lib.ReadEXIFLocation(data)
+			Expect(err).To(BeNil())
+			Expect(math.Abs(lat - 6.46)).To(BeNumerically("<", 1e-9))
+			Expect(math.Abs(lng - 3.39)).To(BeNumerically("<", 1e-9))
+		})
+
+		g.It("should negate southern and western coordinates", func() {
+			data := newJPEGWithGPS("S", [3]uint32{33, 52, 0}, "W", [3]uint32{70, 30, 0})
+			lat, lng, err := lib.ReadEXIFLocation(data)
+			Expect(err).To(BeNil())
+			Expect(lat).To(BeNumerically("<", 0))
+			Expect(lng).To(BeNumerically("<", 0))
+		})
+
+		g.It("should return ErrNoEXIFLocation for images without EXIF", func() {
+			img := new(bytes.Buffer)
+			jpeg.Encode(img, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+			_, _, err := lib.ReadEXIFLocation(img.Bytes())
+			Expect(err).To(Equal(lib.ErrNoEXIFLocation))
+		})
+	})
+}
+
+func TestRemoveEXIF(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("RemoveEXIF()", func() {
+
+		g.It("should remove the GPS position and keep the image decodable", func() {
+			data := newJPEGWithGPS("N", [3]uint32{6, 27, 36}, "E", [3]uint32{3, 23, 24})
+			stripped, err := lib.RemoveEXIF(data)
+			Expect(err).To(BeNil())
+			_, _, err = lib.ReadEXIFLocation(stripped)
+			Expect(err).To(Equal(lib.ErrNoEXIFLocation))
+			_, err = jpeg.Decode(bytes.NewReader(stripped))
+			Expect(err).To(BeNil())
+		})
+
+		g.It("should remove EXIF data whose GPS position cannot be read", func() {
+			data := newJPEGWithGPS("N", [3]uint32{6, 27, 36}, "E", [3]uint32{3, 23, 24})
+
+			// point the GPS IFD past the end of the EXIF data
+			gpsOffset := bytes.Index(data, []byte{0x25, 0x88, 4, 0, 1, 0, 0, 0}) + 8
+			binary.LittleEndian.PutUint32(data[gpsOffset:], 0xFFFF)
+			_, _, err := lib.ReadEXIFLocation(data)
+			Expect(err).ToNot(BeNil())
+			Expect(lib.HasEXIF(data)).To(BeTrue())
+
+			stripped, err := lib.RemoveEXIF(data)
+			Expect(err).To(BeNil())
+			Expect(lib.HasEXIF(stripped)).To(BeFalse())
+		})
+	})
+}
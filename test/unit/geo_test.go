@@ -0,0 +1,34 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestGeoPoint(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("GeoPoint", func() {
+
+		g.It("should store coordinates in GeoJSON order", func() {
+			point := models.NewGeoPoint(6.4541, 3.3947)
+			Expect(point.Type).To(Equal("Point"))
+			Expect(point.Coordinates).To(Equal([]float64{3.3947, 6.4541}))
+		})
+
+		g.It("should coarsen coordinates", func() {
+			point := models.NewGeoPoint(6.4541, -3.3947).Coarsen()
+			Expect(point.Latitude()).To(BeNumerically("~", 6.5, 1e-9))
+			Expect(point.Longitude()).To(BeNumerically("~", -3.4, 1e-9))
+		})
+
+		g.It("should reject coordinates out of range", func() {
+			Expect(models.IsValidCoordinate(91, 0)).To(Equal(false))
+			Expect(models.IsValidCoordinate(0, -181)).To(Equal(false))
+			Expect(models.IsValidCoordinate(-90, 180)).To(Equal(true))
+		})
+	})
+}
@@ -0,0 +1,31 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestLeaderboardPeriod(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("LeaderboardPeriod()", func() {
+
+		g.It("should use ISO weeks for weekly leaderboards", func() {
+			Expect(models.LeaderboardPeriod(models.LeaderboardWeekly, time.Date(2016, 5, 4, 10, 0, 0, 0, time.UTC))).To(Equal("2016-W18"))
+			Expect(models.LeaderboardPeriod(models.LeaderboardWeekly, time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC))).To(Equal("2015-W53"))
+		})
+
+		g.It("should use calendar months for monthly leaderboards", func() {
+			Expect(models.LeaderboardPeriod(models.LeaderboardMonthly, time.Date(2016, 5, 31, 23, 59, 0, 0, time.UTC))).To(Equal("2016-05"))
+		})
+
+		g.It("should use a single period for all time leaderboards", func() {
+			key := models.LeaderboardKey(models.LeaderboardNotes, models.LeaderboardAllTime, time.Now())
+			Expect(key).To(Equal(models.LEADERBOARD_PREFIX + "notes_all"))
+		})
+	})
+}
@@ -0,0 +1,118 @@
+package unit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestOIDCProvider(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("OIDCProvider", func() {
+
+		privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		signingKey, _ := lib.NewSigningKey("key-1", privateKey, time.Time{}, time.Time{})
+
+		var issuer string
+		mux := http.NewServeMux()
+		mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/jwks"})
+		})
+		mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(lib.NewKeyRing(signingKey).JWKS(time.Now(), 0))
+		})
+		server := httptest.NewServer(mux)
+		issuer = server.URL
+
+		g.After(func() {
+			server.Close()
+		})
+
+		newIdToken := func(claims jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+			token.Header["kid"] = "key-1"
+			signed, _ := token.SignedString(privateKey)
+			return signed
+		}
+
+		g.It("should verify an ID token issued to the client", func() {
+			provider := lib.NewOIDCProvider("google", issuer, []string{"client-1"})
+			identity, err := provider.Verify(&lib.ProviderCredential{
+				ProviderUserId: "user-1",
+				IdToken: newIdToken(jwt.MapClaims{
+					"iss":            issuer,
+					"aud":            "client-1",
+					"sub":            "user-1",
+					"email":          "user@example.com",
+					"email_verified": "true",
+					"exp":            time.Now().Add(time.Hour).Unix(),
+				}),
+			})
+			Expect(err).To(BeNil())
+			Expect(identity.ProviderUserId).To(Equal("user-1"))
+			Expect(identity.Email).To(Equal("user@example.com"))
+			Expect(identity.EmailVerified).To(Equal(true))
+		})
+
+		g.It("should reject ID tokens issued to other clients, by other issuers or for other users", func() {
+			provider := lib.NewOIDCProvider("google", issuer, []string{"client-1"})
+			claims := []jwt.MapClaims{
+				{"iss": issuer, "aud": "client-2", "sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()},
+				{"iss": "https://example.com", "aud": "client-1", "sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()},
+				{"iss": issuer, "aud": "client-1", "sub": "user-2", "exp": time.Now().Add(time.Hour).Unix()},
+				{"iss": issuer, "aud": "client-1", "sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()},
+			}
+			for _, c := range claims {
+				_, err := provider.Verify(&lib.ProviderCredential{ProviderUserId: "user-1", IdToken: newIdToken(c)})
+				Expect(err).To(Equal(lib.ErrInvalidProviderCredential))
+			}
+		})
+
+		g.It("should check the nonce of an ID token when the client sends one", func() {
+			provider := lib.NewOIDCProvider("google", issuer, []string{"client-1"})
+			idToken := newIdToken(jwt.MapClaims{"iss": issuer, "aud": "client-1", "sub": "user-1", "nonce": "nonce-1", "exp": time.Now().Add(time.Hour).Unix()})
+
+			_, err := provider.Verify(&lib.ProviderCredential{IdToken: idToken, Nonce: "nonce-1"})
+			Expect(err).To(BeNil())
+
+			_, err = provider.Verify(&lib.ProviderCredential{IdToken: idToken, Nonce: "nonce-2"})
+			Expect(err).To(Equal(lib.ErrInvalidProviderCredential))
+
+			withoutNonce := newIdToken(jwt.MapClaims{"iss": issuer, "aud": "client-1", "sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+			_, err = provider.Verify(&lib.ProviderCredential{IdToken: withoutNonce, Nonce: "nonce-1"})
+			Expect(err).To(Equal(lib.ErrInvalidProviderCredential))
+		})
+	})
+}
+
+func TestParsePublicJWK(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("ParsePublicJWK()", func() {
+
+		g.It("should parse a key encoded by PublicJWK()", func() {
+			privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			signingKey, _ := lib.NewSigningKey("key-1", privateKey, time.Time{}, time.Time{})
+			publicKey, err := lib.ParsePublicJWK(signingKey.PublicJWK())
+			Expect(err).To(BeNil())
+			Expect(publicKey.(*ecdsa.PublicKey).X.Cmp(privateKey.X)).To(Equal(0))
+			Expect(publicKey.(*ecdsa.PublicKey).Y.Cmp(privateKey.Y)).To(Equal(0))
+		})
+
+		g.It("should reject unsupported key types", func() {
+			_, err := lib.ParsePublicJWK(map[string]interface{}{"kty": "oct", "k": "c2VjcmV0"})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+}
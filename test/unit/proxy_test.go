@@ -0,0 +1,67 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ellcrys/openmint/extend"
+	. "github.com/franela/goblin"
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/engine/standard"
+	. "github.com/onsi/gomega"
+)
+
+// create a context for a request received from an address
+func newRemoteContext(remoteAddr string, headers map[string]string) *extend.Context {
+	e := echo.New()
+	r := &http.Request{RemoteAddr: remoteAddr, Header: make(http.Header)}
+	r.URL, _ = url.Parse("/")
+	for key, val := range headers {
+		r.Header.Set(key, val)
+	}
+	req := standard.NewRequest(r, e.Logger())
+	return extend.NewContext(e.NewContext(req, standard.NewResponse(httptest.NewRecorder(), e.Logger())))
+}
+
+func TestRealIP(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("RealIP()", func() {
+
+		g.Before(func() {
+			Expect(extend.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})).To(BeNil())
+		})
+
+		g.After(func() {
+			extend.SetTrustedProxies(nil)
+		})
+
+		g.It("should reject invalid proxies", func() {
+			Expect(extend.SetTrustedProxies([]string{"10.0.0.0/33"})).ToNot(BeNil())
+			Expect(extend.SetTrustedProxies([]string{"proxy"})).ToNot(BeNil())
+			Expect(extend.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})).To(BeNil())
+		})
+
+		g.It("should ignore the forwarded headers of untrusted clients", func() {
+			c := newRemoteContext("203.0.113.5:4000", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"})
+			Expect(c.RealIP()).To(Equal("203.0.113.5"))
+		})
+
+		g.It("should use the last address not added by a trusted proxy", func() {
+			c := newRemoteContext("10.0.0.2:4000", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.9, 192.168.1.1"})
+			Expect(c.RealIP()).To(Equal("203.0.113.9"))
+		})
+
+		g.It("should use x-real-ip from a trusted proxy without x-forwarded-for", func() {
+			c := newRemoteContext("192.168.1.1:4000", map[string]string{"X-Real-IP": "198.51.100.2"})
+			Expect(c.RealIP()).To(Equal("198.51.100.2"))
+		})
+
+		g.It("should use the proxy address when the headers are not valid", func() {
+			c := newRemoteContext("10.0.0.2:4000", map[string]string{"X-Forwarded-For": "unknown"})
+			Expect(c.RealIP()).To(Equal("10.0.0.2"))
+		})
+	})
+}
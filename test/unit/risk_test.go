@@ -0,0 +1,137 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func riskCodes(reasons []models.RiskReason) []string {
+	codes := []string{}
+	for _, r := range reasons {
+		codes = append(codes, r.Code)
+	}
+	return codes
+}
+
+func TestRiskScore(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("RiskScore()", func() {
+
+		g.It("should add the scores of the reasons", func() {
+			Expect(models.RiskScore(nil)).To(Equal(0))
+			Expect(models.RiskScore([]models.RiskReason{{Score: 30}, {Score: 40}})).To(Equal(70))
+		})
+
+		g.It("should not exceed the highest risk score", func() {
+			Expect(models.RiskScore([]models.RiskReason{{Score: 100}, {Score: 40}})).To(Equal(models.MAX_RISK_SCORE))
+		})
+	})
+
+	g.Describe("MergeRiskReasons()", func() {
+
+		g.It("should only add reasons that are not in the set", func() {
+			reasons := []models.RiskReason{{Code: models.RiskSerialFormat, Score: 40, Detail: "a"}}
+			merged, added := models.MergeRiskReasons(reasons, []models.RiskReason{
+				{Code: models.RiskSerialFormat, Score: 40, Detail: "a"},
+				{Code: models.RiskDuplicateSerial, Score: 40, Detail: "b"},
+			})
+			Expect(added).To(Equal(1))
+			Expect(riskCodes(merged)).To(Equal([]string{models.RiskSerialFormat, models.RiskDuplicateSerial}))
+			Expect(reasons).To(HaveLen(1))
+		})
+	})
+}
+
+func TestCheckSerialRules(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("CheckSerialRules()", func() {
+
+		rules := []models.SerialRuleModel{
+			{Denomination: "500", Format: "[A-Z]{2}[0-9]{8}", Ranges: []models.SerialRange{{Prefix: "AB", From: 1000, To: 2000}}},
+			{Denomination: "1000", Ranges: []models.SerialRange{{Prefix: "AC", From: 0, To: 5000}}},
+		}
+
+		g.It("should not report a serial that follows the rules", func() {
+			Expect(lib.CheckSerialRules(rules, "500", "AB00001500")).To(BeEmpty())
+		})
+
+		g.It("should report a serial that does not fully match the format", func() {
+			Expect(riskCodes(lib.CheckSerialRules(rules, "500", "AB00001500X"))).To(ContainElement(models.RiskSerialFormat))
+			Expect(riskCodes(lib.CheckSerialRules(rules, "500", "ab00001500"))).To(ContainElement(models.RiskSerialFormat))
+		})
+
+		g.It("should report a serial outside the ranges of its denomination", func() {
+			Expect(riskCodes(lib.CheckSerialRules(rules, "500", "AB00002001"))).To(Equal([]string{models.RiskSerialRange}))
+		})
+
+		g.It("should report a serial in a range of another denomination", func() {
+			Expect(riskCodes(lib.CheckSerialRules(rules, "500", "AC00000042"))).To(Equal([]string{models.RiskDenominationMix}))
+		})
+
+		g.It("should not report denominations without rules", func() {
+			Expect(lib.CheckSerialRules(rules, "200", "ZZ12345678")).To(BeEmpty())
+		})
+	})
+}
+
+func TestSerialInRange(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("SerialInRange()", func() {
+
+		g.It("should check the prefix and the number of a serial", func() {
+			Expect(models.SerialInRange("AB00001000", "AB", 1000, 2000)).To(BeTrue())
+			Expect(models.SerialInRange("AB00002001", "AB", 1000, 2000)).To(BeFalse())
+			Expect(models.SerialInRange("AC00001500", "AB", 1000, 2000)).To(BeFalse())
+			Expect(models.SerialInRange("AB", "AB", 0, 2000)).To(BeFalse())
+		})
+	})
+}
+
+func TestIsImpossibleTravel(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("IsImpossibleTravel()", func() {
+
+		lagos := &models.GeoPoint{Type: "Point", Coordinates: []float64{3.3792, 6.5244}}
+		london := &models.GeoPoint{Type: "Point", Coordinates: []float64{-0.1276, 51.5072}}
+		ikeja := &models.GeoPoint{Type: "Point", Coordinates: []float64{3.3515, 6.6018}}
+		now := time.Now()
+
+		g.It("should measure the distance between two points", func() {
+			Expect(lagos.DistanceTo(london)).To(BeNumerically("~", 5000000, 100000))
+		})
+
+		g.It("should report scans too far apart for the time between them", func() {
+			Expect(lib.IsImpossibleTravel(lagos, now, london, now.Add(time.Hour))).To(BeTrue())
+			Expect(lib.IsImpossibleTravel(lagos, now, london, now.Add(12*time.Hour))).To(BeFalse())
+		})
+
+		g.It("should ignore nearby scans and missing locations", func() {
+			Expect(lib.IsImpossibleTravel(lagos, now, ikeja, now)).To(BeFalse())
+			Expect(lib.IsImpossibleTravel(nil, now, london, now)).To(BeFalse())
+		})
+	})
+}
+
+func TestTravelLocation(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("TravelLocation()", func() {
+
+		lagos := models.NewGeoPoint(6.5244, 3.3792)
+
+		g.It("should only trust locations read from images", func() {
+			Expect(lib.TravelLocation(lagos, models.LocationSourceEXIF)).To(Equal(lagos))
+			Expect(lib.TravelLocation(lagos, models.LocationSourceForm)).To(BeNil())
+			Expect(lib.TravelLocation(lagos, "")).To(BeNil())
+		})
+	})
+}
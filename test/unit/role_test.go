@@ -0,0 +1,32 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestRolesHavePermission(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("RolesHavePermission()", func() {
+
+		g.It("should grant moderation permissions to moderators", func() {
+			Expect(models.RolesHavePermission([]string{models.RoleModerator}, models.PermBanUser)).To(Equal(true))
+			Expect(models.RolesHavePermission([]string{models.RoleModerator}, models.PermManageRoles)).To(Equal(false))
+		})
+
+		g.It("should grant every permission to admins", func() {
+			for _, permission := range models.RolePermissions[models.RoleAdmin] {
+				Expect(models.RolesHavePermission([]string{"", models.RoleAdmin}, permission)).To(Equal(true))
+			}
+		})
+
+		g.It("should not grant permissions to users without roles", func() {
+			Expect(models.RolesHavePermission([]string{""}, models.PermViewMetrics)).To(Equal(false))
+			Expect(models.RolesHavePermission(nil, models.PermViewMetrics)).To(Equal(false))
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package unit
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestNewSecret(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("NewSecret()", func() {
+
+		g.It("should encode the random bytes of a secret without padding", func() {
+			secret := lib.NewSecret()
+			decoded, err := base64.RawURLEncoding.DecodeString(secret)
+			Expect(err).To(BeNil())
+			Expect(decoded).To(HaveLen(lib.SECRET_BYTES))
+		})
+
+		g.It("should not repeat secrets", func() {
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				secret := lib.NewSecret()
+				Expect(seen[secret]).To(BeFalse())
+				seen[secret] = true
+			}
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+type evenSerialDetector struct{}
+
+func (evenSerialDetector) Name() string {
+	return "even"
+}
+
+func (evenSerialDetector) Detect(digits string) bool {
+	return (digits[len(digits)-1]-'0')%2 == 0
+}
+
+func TestSerialPatterns(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("SerialDetectorRegistry.Classify()", func() {
+
+		detectors := lib.DefaultSerialDetectors()
+
+		g.It("should detect radar serials", func() {
+			Expect(detectors.Classify("AB12344321")).To(Equal([]string{lib.SerialRadar}))
+		})
+
+		g.It("should detect repeater serials", func() {
+			Expect(detectors.Classify("12341234")).To(Equal([]string{lib.SerialRepeater}))
+			Expect(detectors.Classify("12121212")).To(Equal([]string{lib.SerialRepeater}))
+		})
+
+		g.It("should detect ascending and descending ladder serials", func() {
+			Expect(detectors.Classify("12345678")).To(Equal([]string{lib.SerialLadder}))
+			Expect(detectors.Classify("87654321X")).To(Equal([]string{lib.SerialLadder}))
+		})
+
+		g.It("should detect solid serials without classifying them as repeaters", func() {
+			Expect(detectors.Classify("77777777")).To(Equal([]string{lib.SerialRadar, lib.SerialSolid}))
+		})
+
+		g.It("should detect low serials", func() {
+			Expect(detectors.Classify("A00000042")).To(Equal([]string{lib.SerialLow}))
+			Expect(detectors.Classify("00000100")).To(Equal([]string{lib.SerialLow}))
+			Expect(detectors.Classify("00000101")).To(BeEmpty())
+			Expect(detectors.Classify("00000000")).To(Equal([]string{lib.SerialRadar, lib.SerialSolid}))
+		})
+
+		g.It("should not classify ordinary or short serials", func() {
+			Expect(detectors.Classify("AB48213907")).To(BeEmpty())
+			Expect(detectors.Classify("121")).To(BeEmpty())
+			Expect(detectors.Classify("ABCD")).To(BeEmpty())
+		})
+
+		g.It("should support custom detectors", func() {
+			registry := lib.NewSerialDetectorRegistry(lib.SolidDetector{}, evenSerialDetector{})
+			Expect(registry.Names()).To(Equal([]string{lib.SerialSolid, "even"}))
+			Expect(registry.Classify("48213906")).To(Equal([]string{"even"}))
+			registry.Register(lib.LowSerialDetector{Max: 1000})
+			Expect(registry.Classify("00000999")).To(Equal([]string{lib.SerialLow}))
+		})
+	})
+}
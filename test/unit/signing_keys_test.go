@@ -0,0 +1,106 @@
+package unit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/config"
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestKeyRing(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("KeyRing", func() {
+
+		now := time.Now().UTC()
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		retired, _ := lib.NewSigningKey("retired", rsaKey, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+		old, _ := lib.NewSigningKey("old", rsaKey, now.Add(-24*time.Hour), now.Add(-time.Minute))
+		current, _ := lib.NewSigningKey("current", ecKey, now.Add(-time.Minute), time.Time{})
+		next, _ := lib.NewSigningKey("next", rsaKey, now.Add(time.Hour), time.Time{})
+		kr := lib.NewKeyRing(next, current, old, retired)
+
+		g.It("should select the most recently activated key for signing", func() {
+			Expect(kr.SigningKey(now).Id).To(Equal("current"))
+			Expect(kr.SigningKey(now.Add(2 * time.Hour)).Id).To(Equal("next"))
+		})
+
+		g.It("should accept retired keys until tokens they signed expire", func() {
+			Expect(kr.VerificationKey("old", now, time.Hour)).ToNot(BeNil())
+			Expect(kr.VerificationKey("retired", now, time.Hour)).To(BeNil())
+			Expect(kr.VerificationKey("unknown", now, time.Hour)).To(BeNil())
+		})
+
+		g.It("should publish keys that are not retired", func() {
+			keys := kr.JWKS(now, time.Hour)["keys"].([]map[string]interface{})
+			Expect(keys).To(HaveLen(3))
+			Expect(keys[0]["kid"]).To(Equal("old"))
+			Expect(keys[1]["kid"]).To(Equal("current"))
+			Expect(keys[2]["kid"]).To(Equal("next"))
+		})
+
+		g.It("should encode RSA and EC public keys as JWK", func() {
+			rsaJWK := old.PublicJWK()
+			Expect(rsaJWK["kty"]).To(Equal("RSA"))
+			Expect(rsaJWK["alg"]).To(Equal("RS256"))
+			Expect(rsaJWK["e"]).To(Equal("AQAB"))
+			ecJWK := current.PublicJWK()
+			Expect(ecJWK["kty"]).To(Equal("EC"))
+			Expect(ecJWK["alg"]).To(Equal("ES256"))
+			Expect(ecJWK["crv"]).To(Equal("P-256"))
+			Expect(ecJWK["x"]).To(HaveLen(43))
+			Expect(ecJWK["y"]).To(HaveLen(43))
+		})
+	})
+}
+
+func TestNewAccessToken(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("NewAccessToken()", func() {
+
+		g.Before(func() {
+			lib.SetKeyRing(nil)
+			config.C.Add("hmac_key", "secret")
+			config.C.Add("access_token_ttl", "3600")
+		})
+
+		g.After(func() {
+			config.C.Add("accept_legacy_tokens", "true")
+		})
+
+		g.It("should sign HS256 tokens without a key ring while legacy tokens are accepted", func() {
+			config.C.Add("accept_legacy_tokens", "true")
+			token, _, err := lib.NewAccessToken("user")
+			Expect(err).To(BeNil())
+			_, err = lib.ParseAccessToken(token)
+			Expect(err).To(BeNil())
+		})
+
+		g.It("should not sign tokens it would reject when legacy tokens are not accepted", func() {
+			config.C.Add("accept_legacy_tokens", "false")
+			_, _, err := lib.NewAccessToken("user")
+			Expect(err).ToNot(BeNil())
+		})
+
+		g.It("should sign with the active key of the key ring", func() {
+			config.C.Add("accept_legacy_tokens", "false")
+			ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			key, _ := lib.NewSigningKey("current", ecKey, time.Now().Add(-time.Minute), time.Time{})
+			lib.SetKeyRing(lib.NewKeyRing(key))
+			defer lib.SetKeyRing(nil)
+			token, _, err := lib.NewAccessToken("user")
+			Expect(err).To(BeNil())
+			_, err = lib.ParseAccessToken(token)
+			Expect(err).To(BeNil())
+		})
+	})
+}
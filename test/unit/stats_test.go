@@ -0,0 +1,73 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestStatsCacheKey(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("StatsCacheKey()", func() {
+
+		from := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC)
+
+		g.It("should include the filter and parameters", func() {
+			key := lib.StatsCacheKey("indexed", &models.StatsFilter{CurrencyCode: "NGN", From: from, To: to}, "currency", "day")
+			Expect(key).To(Equal("indexed|NGN|2017-01-01T00:00:00Z|2017-02-01T00:00:00Z|currency|day"))
+		})
+
+		g.It("should leave out unset filters", func() {
+			Expect(lib.StatsCacheKey("verification", &models.StatsFilter{})).To(Equal("verification|||"))
+		})
+
+		g.It("should not share keys between filters", func() {
+			keys := []string{
+				lib.StatsCacheKey("indexed", &models.StatsFilter{From: from}),
+				lib.StatsCacheKey("indexed", &models.StatsFilter{To: from}),
+				lib.StatsCacheKey("indexed", &models.StatsFilter{CurrencyCode: "NGN"}),
+				lib.StatsCacheKey("consensus", &models.StatsFilter{CurrencyCode: "NGN"}),
+				lib.StatsCacheKey("indexed", &models.StatsFilter{CurrencyCode: "NGN"}, "denomination"),
+			}
+			for i := range keys {
+				for j := range keys {
+					if i != j {
+						Expect(keys[i]).ToNot(Equal(keys[j]))
+					}
+				}
+			}
+		})
+	})
+}
+
+func TestParseStatsGroupBy(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("ParseStatsGroupBy()", func() {
+
+		g.It("should group by currency by default", func() {
+			groupBy, ok := lib.ParseStatsGroupBy("")
+			Expect(ok).To(BeTrue())
+			Expect(groupBy).To(Equal([]string{"currency"}))
+		})
+
+		g.It("should parse the fields without duplicates", func() {
+			groupBy, ok := lib.ParseStatsGroupBy("day, denomination,day")
+			Expect(ok).To(BeTrue())
+			Expect(groupBy).To(Equal([]string{"day", "denomination"}))
+		})
+
+		g.It("should reject unknown fields", func() {
+			for _, value := range []string{"user", "currency,", "currency,serial"} {
+				_, ok := lib.ParseStatsGroupBy(value)
+				Expect(ok).To(BeFalse())
+			}
+		})
+	})
+}
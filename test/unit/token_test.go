@@ -0,0 +1,57 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/ellcrys/openmint/lib"
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestIsTokenRevokedAt(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("IsTokenRevokedAt()", func() {
+
+		revokedAt := time.Unix(1500000000, 500*int64(time.Millisecond))
+
+		g.It("should revoke tokens issued before the revocation", func() {
+			Expect(models.IsTokenRevokedAt(revokedAt.Add(-time.Second), revokedAt)).To(BeTrue())
+		})
+
+		g.It("should revoke tokens issued earlier in the same second as the revocation", func() {
+			Expect(models.IsTokenRevokedAt(revokedAt.Add(-time.Millisecond), revokedAt)).To(BeTrue())
+		})
+
+		g.It("should keep tokens issued in the same millisecond as the revocation or later", func() {
+			Expect(models.IsTokenRevokedAt(revokedAt, revokedAt)).To(BeFalse())
+			Expect(models.IsTokenRevokedAt(revokedAt.Add(time.Millisecond), revokedAt)).To(BeFalse())
+		})
+
+		g.It("should keep tokens of users whose tokens were not revoked", func() {
+			Expect(models.IsTokenRevokedAt(revokedAt, time.Time{})).To(BeFalse())
+		})
+	})
+}
+
+func TestAccessTokenIssuedAt(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("AccessTokenIssuedAt()", func() {
+
+		issuedAt := time.Unix(1500000000, 250*int64(time.Millisecond)).UTC()
+
+		g.It("should get the issue time in milliseconds", func() {
+			claims := jwt.MapClaims{"iat": float64(1500000000), "iat_ms": float64(models.UnixMilli(issuedAt))}
+			Expect(lib.AccessTokenIssuedAt(claims)).To(Equal(issuedAt))
+		})
+
+		g.It("should fall back to the whole second of tokens without milliseconds", func() {
+			claims := jwt.MapClaims{"iat": float64(1500000000)}
+			Expect(lib.AccessTokenIssuedAt(claims)).To(Equal(time.Unix(1500000000, 0).UTC()))
+		})
+	})
+}
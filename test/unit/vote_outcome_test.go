@@ -0,0 +1,37 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func votes(decisions ...int) []models.Vote {
+	result := []models.Vote{}
+	for _, d := range decisions {
+		result = append(result, models.Vote{Decision: d})
+	}
+	return result
+}
+
+func TestDetermineVoteOutcome(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("DetermineVoteOutcome()", func() {
+
+		g.It("should verify a currency most voters accepted", func() {
+			Expect(models.DetermineVoteOutcome(votes(1, 1, 0))).To(Equal("verified"))
+		})
+
+		g.It("should reject a currency most voters rejected", func() {
+			Expect(models.DetermineVoteOutcome(votes(0, 1, 0))).To(Equal("rejected"))
+		})
+
+		g.It("should dispute a tie", func() {
+			Expect(models.DetermineVoteOutcome(votes(1, 0))).To(Equal("disputed"))
+			Expect(models.DetermineVoteOutcome(nil)).To(Equal("disputed"))
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/ellcrys/openmint/models"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestWatchlistMatches(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("WatchlistModel.Matches()", func() {
+
+		g.It("should match an exact serial", func() {
+			w := models.WatchlistModel{Type: models.WatchlistExact, CurrencyCode: "NGN", Serial: "AB1234567"}
+			Expect(w.Matches("NGN", "1000", "AB1234567")).To(BeTrue())
+			Expect(w.Matches("NGN", "1000", "AB1234568")).To(BeFalse())
+			Expect(w.Matches("USD", "1000", "AB1234567")).To(BeFalse())
+		})
+
+		g.It("should only match the denomination when it is set", func() {
+			w := models.WatchlistModel{Type: models.WatchlistExact, CurrencyCode: "NGN", Denomination: "500", Serial: "AB1234567"}
+			Expect(w.Matches("NGN", "500", "AB1234567")).To(BeTrue())
+			Expect(w.Matches("NGN", "1000", "AB1234567")).To(BeFalse())
+		})
+
+		g.It("should match serials starting with a prefix", func() {
+			w := models.WatchlistModel{Type: models.WatchlistPrefix, CurrencyCode: "NGN", Prefix: "AB12"}
+			Expect(w.Matches("NGN", "100", "AB1234567")).To(BeTrue())
+			Expect(w.Matches("NGN", "100", "AC1234567")).To(BeFalse())
+		})
+
+		g.It("should match serials within a range", func() {
+			w := models.WatchlistModel{Type: models.WatchlistRange, CurrencyCode: "NGN", Prefix: "AB", From: 1000, To: 2000}
+			Expect(w.Matches("NGN", "100", "AB00001000")).To(BeTrue())
+			Expect(w.Matches("NGN", "100", "AB00002000")).To(BeTrue())
+			Expect(w.Matches("NGN", "100", "AB00002001")).To(BeFalse())
+			Expect(w.Matches("NGN", "100", "AC00001500")).To(BeFalse())
+			Expect(w.Matches("NGN", "100", "AB0000150X")).To(BeFalse())
+		})
+
+		g.It("should match ranges without a prefix", func() {
+			w := models.WatchlistModel{Type: models.WatchlistRange, CurrencyCode: "USD", From: 0, To: 99}
+			Expect(w.Matches("USD", "20", "00000042")).To(BeTrue())
+			Expect(w.Matches("USD", "20", "L0000042")).To(BeFalse())
+		})
+	})
+}
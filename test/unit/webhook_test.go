@@ -0,0 +1,108 @@
+package unit
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ellcrys/openmint/lib"
+	. "github.com/franela/goblin"
+	. "github.com/onsi/gomega"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("SignWebhookPayload()", func() {
+
+		g.It("should return the hex encoded HMAC-SHA256 of the payload", func() {
+			signature := lib.SignWebhookPayload("key", []byte("The quick brown fox jumps over the lazy dog"))
+			Expect(signature).To(Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"))
+		})
+
+		g.It("should validate a signature", func() {
+			payload := []byte(`{"event":"currency.indexed"}`)
+			signature := lib.SignWebhookPayload("secret", payload)
+			Expect(lib.IsValidWebhookSignature("secret", payload, signature)).To(Equal(true))
+			Expect(lib.IsValidWebhookSignature("other_secret", payload, signature)).To(Equal(false))
+		})
+	})
+}
+
+func TestSendWebhook(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("SendWebhook()", func() {
+
+		g.It("should post a signed payload", func() {
+
+			var received []byte
+			var signature, event, deliveryId string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = ioutil.ReadAll(r.Body)
+				signature = r.Header.Get("x-signature")
+				event = r.Header.Get("x-openmint-event")
+				deliveryId = r.Header.Get("x-openmint-delivery")
+				w.WriteHeader(200)
+			}))
+			defer server.Close()
+
+			payload := []byte(`{"event":"currency.indexed"}`)
+			statusCode, err := lib.SendWebhook(http.DefaultClient, server.URL, "secret", "currency.indexed", "abc", payload)
+			Expect(err).To(BeNil())
+			Expect(statusCode).To(Equal(200))
+			Expect(received).To(Equal(payload))
+			Expect(lib.IsValidWebhookSignature("secret", received, signature)).To(Equal(true))
+			Expect(event).To(Equal("currency.indexed"))
+			Expect(deliveryId).To(Equal("abc"))
+		})
+
+		g.It("should return an error when the response status is not 2xx", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(503)
+			}))
+			defer server.Close()
+
+			statusCode, err := lib.SendWebhook(http.DefaultClient, server.URL, "secret", "currency.indexed", "abc", []byte(`{}`))
+			Expect(err).ToNot(BeNil())
+			Expect(statusCode).To(Equal(503))
+		})
+	})
+}
+
+func TestWebhookClient(t *testing.T) {
+	g := Goblin(t)
+	RegisterFailHandler(func(m string, _ ...int) { g.Fail(m) })
+	g.Describe("IsPublicAddress()", func() {
+
+		g.It("should refuse internal addresses", func() {
+			for _, address := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1", "224.0.0.1"} {
+				Expect(lib.IsPublicAddress(net.ParseIP(address))).To(BeFalse())
+			}
+		})
+
+		g.It("should accept public addresses", func() {
+			Expect(lib.IsPublicAddress(net.ParseIP("93.184.216.34"))).To(BeTrue())
+			Expect(lib.IsPublicAddress(net.ParseIP("2606:2800:220:1:248:1893:25c8:1946"))).To(BeTrue())
+		})
+	})
+
+	g.Describe("NewWebhookClient()", func() {
+
+		g.It("should refuse to connect to internal addresses", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+			}))
+			defer server.Close()
+
+			statusCode, err := lib.SendWebhook(lib.NewWebhookClient(time.Second), server.URL, "secret", "currency.indexed", "abc", []byte(`{}`))
+			Expect(err).ToNot(BeNil())
+			Expect(strings.Contains(err.Error(), lib.ErrWebhookAddressNotAllowed.Error())).To(BeTrue())
+			Expect(statusCode).To(Equal(0))
+		})
+	})
+}
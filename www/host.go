@@ -1,6 +1,7 @@
 package www
 
 import (
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ellcrys/openmint/config"
 	"github.com/ellcrys/openmint/extend"
@@ -15,6 +17,7 @@ import (
 	"github.com/ellcrys/openmint/models"
 	"github.com/ellcrys/util"
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/engine/standard"
 	"github.com/labstack/echo/middleware"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -47,9 +50,21 @@ var (
 	RedisDatabase = util.Env("REDIS_DB", "0")
 
 	// mongo collections
-	CurrencyColName      = util.Env("MONGO_CURRENCY_COL", "currency")
-	CloudMintUserColName = util.Env("MONGO_CLOUDMINT_USER_COL", "cloudmint_user")
-	TwitterAuthColName   = util.Env("MONGO_TWITTER_AUTH_COL", "twitter_auth")
+	CurrencyColName          = util.Env("MONGO_CURRENCY_COL", "currency")
+	CloudMintUserColName     = util.Env("MONGO_CLOUDMINT_USER_COL", "cloudmint_user")
+	TwitterAuthColName       = util.Env("MONGO_TWITTER_AUTH_COL", "twitter_auth")
+	WebhookColName           = util.Env("MONGO_WEBHOOK_COL", "webhook")
+	WebhookDeliveryColName   = util.Env("MONGO_WEBHOOK_DELIVERY_COL", "webhook_delivery")
+	RefreshTokenColName      = util.Env("MONGO_REFRESH_TOKEN_COL", "refresh_token")
+	APIKeyColName            = util.Env("MONGO_API_KEY_COL", "api_key")
+	AuditLogColName          = util.Env("MONGO_AUDIT_LOG_COL", "audit_log")
+	SightingColName          = util.Env("MONGO_SIGHTING_COL", "sighting")
+	CollectionColName        = util.Env("MONGO_COLLECTION_COL", "collection")
+	WatchlistColName         = util.Env("MONGO_WATCHLIST_COL", "watchlist")
+	NotificationColName      = util.Env("MONGO_NOTIFICATION_COL", "notification")
+	SerialRuleColName        = util.Env("MONGO_SERIAL_RULE_COL", "serial_rule")
+	CounterfeitSerialColName = util.Env("MONGO_COUNTERFEIT_SERIAL_COL", "counterfeit_serial")
+	CounterColName           = util.Env("MONGO_COUNTER_COL", "counter")
 
 	// others
 	HMACKey             = util.Env("HMAC_KEY", "")
@@ -57,8 +72,27 @@ var (
 	FBAppToken          = util.Env("FB_APP_TOKEN", "")
 	TwitterConKey       = util.Env("TWITTER_CONSUMER_KEY", "")
 	TwitterConSecret    = util.Env("TWITTER_CONSUMER_SECRET", "")
+	TwitterCallbackURL  = util.Env("TWITTER_CALLBACK_URL", "")
+	AuthProvidersFile   = util.Env("AUTH_PROVIDERS_FILE", "")
 	MaxVotes            = util.Env("MAX_VOTES", "3")
 	VoteSessionDuration = util.Env("VOTE_SESSION_DURATION", "1200")
+	MaxDailyVotes       = util.Env("MAX_DAILY_VOTES", "100")
+	ReconcileInterval   = util.Env("VOTE_QUEUE_RECONCILE_INTERVAL", "300")
+	WebhookMaxAttempts  = util.Env("WEBHOOK_MAX_ATTEMPTS", "5")
+	AccessTokenTTL      = util.Env("ACCESS_TOKEN_TTL", "3600")
+	RefreshTokenTTL     = util.Env("REFRESH_TOKEN_TTL", "2592000")
+	JWTKeysFile         = util.Env("JWT_KEYS_FILE", "")
+	AcceptLegacyTokens  = util.Env("ACCEPT_LEGACY_TOKENS", "true")
+	APIKeyRateLimit     = util.Env("API_KEY_RATE_LIMIT", "60")
+	APIKeyMaxRateLimit  = util.Env("API_KEY_MAX_RATE_LIMIT", "600")
+	LookupRateLimit     = util.Env("LOOKUP_RATE_LIMIT", "60")
+	StatsCacheTTL       = util.Env("STATS_CACHE_TTL", "300")
+	MinAccuracyVotes    = util.Env("LEADERBOARD_MIN_ACCURACY_VOTES", "10")
+	RiskReviewThreshold = util.Env("RISK_REVIEW_THRESHOLD", "50")
+	TrustedProxies      = util.Env("TRUSTED_PROXIES", "")
+	AuditLogKey         = util.Env("AUDIT_LOG_KEY", "")
+	AuditQueueInterval  = util.Env("AUDIT_LOG_QUEUE_INTERVAL", "30")
+	RepeatScanWindow    = util.Env("SIGHTING_REPEAT_WINDOW", "3600")
 )
 
 // fetch application config
@@ -121,13 +155,22 @@ func configRouter(router *echo.Echo, testMode bool) {
 }
 
 // Defines and return an array of policies to pass
-// to routes that require authentication to access
-func UseAuthPolicy(policyCntrl *lib.PolicyController) []echo.MiddlewareFunc {
+// to routes that require authentication to access.
+// Requests made with API keys are only allowed if the key has one of the scopes.
+func UseAuthPolicy(policyCntrl *lib.PolicyController, scopes ...string) []echo.MiddlewareFunc {
 	return []echo.MiddlewareFunc{
 		extend.MiddlewareHandle(policyCntrl.Authenticate),
+		extend.MiddlewareHandle(policyCntrl.RequireScope(scopes...)),
 	}
 }
 
+// Defines and return an array of policies to pass to routes
+// that require the authenticated user to have permissions.
+// Requests made with API keys are rejected.
+func UsePermissionPolicy(policyCntrl *lib.PolicyController, permissions ...string) []echo.MiddlewareFunc {
+	return append(UseAuthPolicy(policyCntrl), extend.MiddlewareHandle(policyCntrl.RequirePermission(permissions...)))
+}
+
 // Creates google cloud storage client
 // and any other client required.
 func CreateGoogleClients() (*http.Client, *http.Client) {
@@ -193,7 +236,20 @@ func App(testMode, runSeed bool) (*echo.Echo, *mgo.Session) {
 
 	// bucket name must be set
 	requiresEnv("BUCKET_NAME")
-	requiresEnv("HMAC_KEY")
+
+	// tokens are signed with HMAC_KEY if no signing keys are provided,
+	// which is only possible while legacy tokens are accepted
+	if JWTKeysFile == "" {
+		if AcceptLegacyTokens != "true" {
+			log.Fatal("JWT_KEYS_FILE environment variable is unset. It is required when legacy tokens are not accepted")
+		}
+		requiresEnv("HMAC_KEY")
+	}
+
+	// the audit log key must not be stored with the audit log
+	if !testMode {
+		requiresEnv("AUDIT_LOG_KEY")
+	}
 
 	// create google service clients
 	gStorageClient, gVisionClient := CreateGoogleClients()
@@ -204,13 +260,58 @@ func App(testMode, runSeed bool) (*echo.Echo, *mgo.Session) {
 	config.C.Add("mongo_currency_collection", CurrencyColName)
 	config.C.Add("mongo_cloudmint_user_col", CloudMintUserColName)
 	config.C.Add("mongo_twitter_auth_col", TwitterAuthColName)
+	config.C.Add("mongo_webhook_col", WebhookColName)
+	config.C.Add("mongo_webhook_delivery_col", WebhookDeliveryColName)
+	config.C.Add("mongo_refresh_token_col", RefreshTokenColName)
+	config.C.Add("mongo_api_key_col", APIKeyColName)
+	config.C.Add("mongo_audit_log_col", AuditLogColName)
+	config.C.Add("mongo_sighting_col", SightingColName)
+	config.C.Add("mongo_collection_col", CollectionColName)
+	config.C.Add("mongo_watchlist_col", WatchlistColName)
+	config.C.Add("mongo_notification_col", NotificationColName)
+	config.C.Add("mongo_serial_rule_col", SerialRuleColName)
+	config.C.Add("mongo_counterfeit_serial_col", CounterfeitSerialColName)
+	config.C.Add("mongo_counter_col", CounterColName)
 	config.C.Add("hmac_key", HMACKey)
+	config.C.Add("audit_log_key", AuditLogKey)
+	config.C.Add("audit_log_queue_interval", AuditQueueInterval)
+	config.C.Add("sighting_repeat_window", RepeatScanWindow)
 	config.C.Add("fb_app_token", FBAppToken)
 	config.C.Add("fb_app_id", FBAppId)
 	config.C.Add("twitter_con_key", TwitterConKey)
 	config.C.Add("twitter_con_secret", TwitterConSecret)
+	config.C.Add("twitter_callback_url", TwitterCallbackURL)
 	config.C.Add("max_votes", MaxVotes)
 	config.C.Add("vote_session_duration", VoteSessionDuration)
+	config.C.Add("max_daily_votes", MaxDailyVotes)
+	config.C.Add("vote_queue_reconcile_interval", ReconcileInterval)
+	config.C.Add("webhook_max_attempts", WebhookMaxAttempts)
+	config.C.Add("access_token_ttl", AccessTokenTTL)
+	config.C.Add("refresh_token_ttl", RefreshTokenTTL)
+	config.C.Add("jwt_keys_file", JWTKeysFile)
+	config.C.Add("accept_legacy_tokens", AcceptLegacyTokens)
+	config.C.Add("api_key_rate_limit", APIKeyRateLimit)
+	config.C.Add("api_key_max_rate_limit", APIKeyMaxRateLimit)
+	config.C.Add("lookup_rate_limit", LookupRateLimit)
+	config.C.Add("stats_cache_ttl", StatsCacheTTL)
+	config.C.Add("leaderboard_min_accuracy_votes", MinAccuracyVotes)
+	config.C.Add("risk_review_threshold", RiskReviewThreshold)
+
+	// proxies allowed to set the client address headers
+	if err := extend.SetTrustedProxies(strings.Split(TrustedProxies, ",")); err != nil {
+		util.Println("failed to set trusted proxies -> ", err)
+		os.Exit(1)
+	}
+
+	// load token signing keys
+	if JWTKeysFile != "" {
+		keyRing, err := lib.LoadKeyRing(JWTKeysFile)
+		if err != nil {
+			util.Println("failed to load signing keys -> ", err)
+			os.Exit(1)
+		}
+		lib.SetKeyRing(keyRing)
+	}
 
 	// mongo connection
 	mongoSession, err := GetMongoSession(MongoDBHosts, MongoDatabase, MongoUsername, MongoPassword)
@@ -220,6 +321,26 @@ func App(testMode, runSeed bool) (*echo.Echo, *mgo.Session) {
 	} else {
 		models.Currency.EnsureIndex(mongoSession)
 		models.User.EnsureIndex(mongoSession)
+		models.Webhook.EnsureIndex(mongoSession)
+		models.WebhookDelivery.EnsureIndex(mongoSession)
+		models.RefreshToken.EnsureIndex(mongoSession)
+		models.APIKey.EnsureIndex(mongoSession)
+		models.AuditLog.EnsureIndex(mongoSession)
+		models.Sighting.EnsureIndex(mongoSession)
+		models.Collection.EnsureIndex(mongoSession)
+		models.Watchlist.EnsureIndex(mongoSession)
+		models.Notification.EnsureIndex(mongoSession)
+		models.SerialRule.EnsureIndex(mongoSession)
+		models.CounterfeitSerial.EnsureIndex(mongoSession)
+		if err = models.AuditLog.SyncSequence(mongoSession); err != nil {
+			util.Println("could not sync the audit log sequence -> ", err)
+			os.Exit(1)
+		}
+		if normalized, err := models.Currency.NormalizeCurrencyCodes(mongoSession); err != nil {
+			util.Println("could not normalize currency codes -> ", err)
+		} else if normalized > 0 {
+			util.Println("normalized the currency codes of", normalized, "currencies")
+		}
 	}
 
 	// redis connection
@@ -233,15 +354,58 @@ func App(testMode, runSeed bool) (*echo.Echo, *mgo.Session) {
 		os.Exit(1)
 	}
 
+	// social login providers
+	authProviders, err := lib.LoadAuthProviders(AuthProvidersFile)
+	if err != nil {
+		util.Println("failed to load auth providers -> ", err)
+		os.Exit(1)
+	}
+
 	// initialize controllers
 	appCntrl := lib.NewAppController()
-	policyCntrl := lib.NewPolicyController(mongoSession)
-	mintCntrl := lib.NewMintController(mongoSession, redisPool, gStorageClient, gVisionClient)
-	userCntrl := lib.NewUserController(mongoSession)
-	authCntrl := lib.NewAuthController(mongoSession)
+	policyCntrl := lib.NewPolicyController(mongoSession, redisPool)
+	webhookDispatcher := lib.NewWebhookDispatcher(mongoSession)
+	watchlistAlerter := lib.NewWatchlistAlerter(mongoSession, redisPool, webhookDispatcher, lib.LogMailer{})
+	riskScorer := lib.NewRiskScorer(mongoSession, redisPool, config.C.GetInt("risk_review_threshold"))
+	mintCntrl := lib.NewMintController(mongoSession, redisPool, gStorageClient, gVisionClient, webhookDispatcher, lib.DefaultSerialDetectors(), watchlistAlerter, riskScorer)
+	userCntrl := lib.NewUserController(mongoSession, redisPool, mintCntrl)
+	authCntrl := lib.NewAuthController(mongoSession, redisPool, authProviders)
+	eventHub := lib.NewEventHub(redisPool)
+	eventCntrl := lib.NewEventController(eventHub)
+	webhookCntrl := lib.NewWebhookController(mongoSession, webhookDispatcher)
+	apiKeyCntrl := lib.NewAPIKeyController(mongoSession)
+	moderationCntrl := lib.NewModerationController(mongoSession, redisPool, mintCntrl)
+	currencyCntrl := lib.NewCurrencyController(mongoSession, redisPool)
+	statsCntrl := lib.NewStatsController(mongoSession, redisPool)
+	leaderboardCntrl := lib.NewLeaderboardController(mongoSession, redisPool)
+	collectionCntrl := lib.NewCollectionController(mongoSession)
+	watchlistCntrl := lib.NewWatchlistController(mongoSession)
+	notificationCntrl := lib.NewNotificationController(mongoSession)
+
+	// start background workers
+	go eventHub.Run()
+	if !testMode {
+		reconcileInterval := time.Duration(config.C.GetInt("vote_queue_reconcile_interval")) * time.Second
+		reconciler := lib.NewVoteQueueReconciler(mongoSession, redisPool, reconcileInterval)
+
+		// move currencies queued in the legacy list to the sorted set queue
+		if dropped, err := models.DropLegacyVoteQueue(redisPool); err != nil {
+			util.Println("failed to drop legacy vote queue -> ", err)
+		} else if dropped {
+			if _, err = reconciler.Reconcile(); err != nil {
+				util.Println("failed to reconcile vote queue -> ", err)
+			}
+		}
+
+		reconciler.Start()
+
+		auditQueueInterval := time.Duration(config.C.GetInt("audit_log_queue_interval")) * time.Second
+		lib.StartAuditLogQueue(mongoSession, redisPool, auditQueueInterval)
+	}
 
 	// app management related route
 	router.GET("/", extend.Handle(appCntrl.Index), UseAuthPolicy(policyCntrl)...)
+	router.GET("/debug/vars", standard.WrapHandler(expvar.Handler()), UsePermissionPolicy(policyCntrl, models.PermViewMetrics)...)
 
 	// auth route
 	var authRoute = v1.Group("/auth")
@@ -250,17 +414,112 @@ func App(testMode, runSeed bool) (*echo.Echo, *mgo.Session) {
 	authRoute.GET("/twitter/cb", extend.Handle(authCntrl.TwitterCallback))
 	authRoute.GET("/twitter/done", extend.Handle(authCntrl.Blank))
 	authRoute.GET("/me", extend.Handle(authCntrl.GetUser), UseAuthPolicy(policyCntrl)...)
+	authRoute.POST("/token/refresh", extend.Handle(authCntrl.RefreshSession))
+	authRoute.POST("/logout", extend.Handle(authCntrl.Logout), UseAuthPolicy(policyCntrl)...)
+	authRoute.POST("/identities", extend.Handle(authCntrl.LinkIdentity), UseAuthPolicy(policyCntrl)...)
+	authRoute.DELETE("/identities/:provider", extend.Handle(authCntrl.UnlinkIdentity), UseAuthPolicy(policyCntrl)...)
+	router.GET("/.well-known/jwks.json", extend.Handle(authCntrl.JWKS))
 
 	// user route
 	var userRoute = v1.Group("/users")
-	userRoute.GET("/currencies", extend.Handle(userCntrl.GetCurrencies), UseAuthPolicy(policyCntrl)...)
+	userRoute.GET("/currencies", extend.Handle(userCntrl.GetCurrencies), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	userRoute.GET("/currencies/export", extend.Handle(userCntrl.ExportCurrencies), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	userRoute.PUT("/currencies/:id/tags", extend.Handle(userCntrl.SetCurrencyTags), UseAuthPolicy(policyCntrl)...)
+	userRoute.PUT("/settings", extend.Handle(userCntrl.UpdateSettings), UseAuthPolicy(policyCntrl)...)
+	userRoute.DELETE("/me", extend.Handle(userCntrl.DeleteAccount), UseAuthPolicy(policyCntrl)...)
+	userRoute.GET("/me/data", extend.Handle(userCntrl.GetData), UseAuthPolicy(policyCntrl)...)
+	userRoute.GET("/notifications", extend.Handle(notificationCntrl.List), UseAuthPolicy(policyCntrl, models.ScopeWatchlist)...)
+	userRoute.PUT("/notifications/read", extend.Handle(notificationCntrl.MarkRead), UseAuthPolicy(policyCntrl, models.ScopeWatchlist)...)
 
 	// currency processing route
 	var mintRoute = v1.Group("/mint")
-	mintRoute.POST("/new", extend.Handle(mintCntrl.Process), UseAuthPolicy(policyCntrl)...)
-	mintRoute.GET("/supported_currencies", extend.Handle(mintCntrl.GetSupportedCurrencies), UseAuthPolicy(policyCntrl)...)
-	mintRoute.GET("/vote", extend.Handle(mintCntrl.GetVoteSession), UseAuthPolicy(policyCntrl)...)
-	mintRoute.PUT("/vote", extend.Handle(mintCntrl.AddVote), UseAuthPolicy(policyCntrl)...)
+	mintRoute.POST("/new", extend.Handle(mintCntrl.Process), UseAuthPolicy(policyCntrl, models.ScopeMintCreate)...)
+	mintRoute.GET("/supported_currencies", extend.Handle(mintCntrl.GetSupportedCurrencies), UseAuthPolicy(policyCntrl, models.ScopeMintCreate, models.ScopeMintRead)...)
+	mintRoute.GET("/vote", extend.Handle(mintCntrl.GetVoteSession), UseAuthPolicy(policyCntrl, models.ScopeVote)...)
+	mintRoute.PUT("/vote", extend.Handle(mintCntrl.AddVote), UseAuthPolicy(policyCntrl, models.ScopeVote)...)
+	mintRoute.GET("/vote/suspicious", extend.Handle(mintCntrl.GetSuspiciousVoteClusters), UsePermissionPolicy(policyCntrl, models.PermReviewVotes)...)
+
+	// public currency routes
+	var currencyRoute = v1.Group("/currencies")
+	currencyRoute.GET("/lookup", extend.Handle(currencyCntrl.Lookup))
+	currencyRoute.POST("/lookup", extend.Handle(currencyCntrl.BulkLookup))
+	currencyRoute.GET("/search", extend.Handle(currencyCntrl.Search), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	currencyRoute.GET("/near", extend.Handle(currencyCntrl.GetNear), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	currencyRoute.GET("/within", extend.Handle(currencyCntrl.GetWithin), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	currencyRoute.GET("/regions", extend.Handle(currencyCntrl.GetRegionCounts), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	currencyRoute.GET("/:id/sightings", extend.Handle(currencyCntrl.GetSightings), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+
+	// statistics routes
+	var statsRoute = v1.Group("/stats")
+	statsRoute.GET("/indexed", extend.Handle(statsCntrl.GetIndexed), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	statsRoute.GET("/verification", extend.Handle(statsCntrl.GetVerification), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	statsRoute.GET("/consensus", extend.Handle(statsCntrl.GetConsensus), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	statsRoute.GET("/contributors", extend.Handle(statsCntrl.GetContributors), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+
+	// collection routes
+	var collectionRoute = v1.Group("/collections")
+	collectionRoute.GET("/shared/:token", extend.Handle(collectionCntrl.GetShared))
+	collectionRoute.POST("", extend.Handle(collectionCntrl.Create), UseAuthPolicy(policyCntrl)...)
+	collectionRoute.GET("", extend.Handle(collectionCntrl.List), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	collectionRoute.GET("/:id", extend.Handle(collectionCntrl.Get), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+	collectionRoute.PATCH("/:id", extend.Handle(collectionCntrl.Update), UseAuthPolicy(policyCntrl)...)
+	collectionRoute.DELETE("/:id", extend.Handle(collectionCntrl.Delete), UseAuthPolicy(policyCntrl)...)
+	collectionRoute.POST("/:id/currencies", extend.Handle(collectionCntrl.AddCurrencies), UseAuthPolicy(policyCntrl)...)
+	collectionRoute.DELETE("/:id/currencies/:currency_id", extend.Handle(collectionCntrl.RemoveCurrency), UseAuthPolicy(policyCntrl)...)
+	collectionRoute.PUT("/:id/sharing", extend.Handle(collectionCntrl.SetSharing), UseAuthPolicy(policyCntrl)...)
+
+	// watchlist routes
+	var watchlistRoute = v1.Group("/watchlists")
+	watchlistRoute.POST("", extend.Handle(watchlistCntrl.Create), UseAuthPolicy(policyCntrl, models.ScopeWatchlist)...)
+	watchlistRoute.GET("", extend.Handle(watchlistCntrl.List), UseAuthPolicy(policyCntrl, models.ScopeWatchlist)...)
+	watchlistRoute.GET("/:id", extend.Handle(watchlistCntrl.Get), UseAuthPolicy(policyCntrl, models.ScopeWatchlist)...)
+	watchlistRoute.PATCH("/:id", extend.Handle(watchlistCntrl.Update), UseAuthPolicy(policyCntrl, models.ScopeWatchlist)...)
+	watchlistRoute.DELETE("/:id", extend.Handle(watchlistCntrl.Delete), UseAuthPolicy(policyCntrl, models.ScopeWatchlist)...)
+
+	// leaderboard routes
+	var leaderboardRoute = v1.Group("/leaderboards")
+	leaderboardRoute.GET("/:board", extend.Handle(leaderboardCntrl.GetLeaderboard), UseAuthPolicy(policyCntrl, models.ScopeMintRead)...)
+
+	// webhook route
+	var webhookRoute = v1.Group("/webhooks")
+	webhookRoute.POST("", extend.Handle(webhookCntrl.Create), UseAuthPolicy(policyCntrl)...)
+	webhookRoute.GET("", extend.Handle(webhookCntrl.List), UseAuthPolicy(policyCntrl)...)
+	webhookRoute.DELETE("/:id", extend.Handle(webhookCntrl.Delete), UseAuthPolicy(policyCntrl)...)
+	webhookRoute.POST("/:id/test", extend.Handle(webhookCntrl.Test), UseAuthPolicy(policyCntrl)...)
+	webhookRoute.GET("/:id/deliveries", extend.Handle(webhookCntrl.Deliveries), UseAuthPolicy(policyCntrl)...)
+
+	// api key route
+	var apiKeyRoute = v1.Group("/api_keys")
+	apiKeyRoute.POST("", extend.Handle(apiKeyCntrl.Create), UseAuthPolicy(policyCntrl)...)
+	apiKeyRoute.GET("", extend.Handle(apiKeyCntrl.List), UseAuthPolicy(policyCntrl)...)
+	apiKeyRoute.DELETE("/:id", extend.Handle(apiKeyCntrl.Revoke), UseAuthPolicy(policyCntrl)...)
+
+	// moderation route
+	var moderationRoute = v1.Group("/moderation")
+	moderationRoute.GET("/currencies", extend.Handle(moderationCntrl.ListCurrencies), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+	moderationRoute.GET("/currencies/:id", extend.Handle(moderationCntrl.GetCurrency), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+	moderationRoute.PATCH("/currencies/:id", extend.Handle(moderationCntrl.EditCurrency), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+	moderationRoute.PUT("/currencies/:id/hidden", extend.Handle(moderationCntrl.SetCurrencyHidden), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+	moderationRoute.PUT("/currencies/:id/status", extend.Handle(moderationCntrl.SetCurrencyStatus), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+	moderationRoute.DELETE("/currencies/:id", extend.Handle(moderationCntrl.DeleteCurrency), UsePermissionPolicy(policyCntrl, models.PermDeleteCurrency)...)
+	moderationRoute.PUT("/users/:id/ban", extend.Handle(moderationCntrl.BanUser), UsePermissionPolicy(policyCntrl, models.PermBanUser)...)
+	moderationRoute.DELETE("/users/:id/ban", extend.Handle(moderationCntrl.UnbanUser), UsePermissionPolicy(policyCntrl, models.PermBanUser)...)
+	moderationRoute.GET("/audit_log", extend.Handle(moderationCntrl.GetAuditLog), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+	moderationRoute.GET("/risk", extend.Handle(moderationCntrl.ListRiskReview), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+	moderationRoute.PUT("/currencies/:id/risk", extend.Handle(moderationCntrl.ReviewRisk), UsePermissionPolicy(policyCntrl, models.PermModerateCurrency)...)
+
+	// admin route
+	var adminRoute = v1.Group("/admin")
+	adminRoute.PUT("/users/:id/roles", extend.Handle(moderationCntrl.SetUserRoles), UsePermissionPolicy(policyCntrl, models.PermManageRoles)...)
+	adminRoute.GET("/currencies/export", extend.Handle(moderationCntrl.ExportCurrencies), UsePermissionPolicy(policyCntrl, models.PermExportCurrencies)...)
+	adminRoute.POST("/counterfeits/:currency_code", extend.Handle(moderationCntrl.ImportCounterfeits), UsePermissionPolicy(policyCntrl, models.PermManageRisk)...)
+	adminRoute.GET("/counterfeits/:currency_code", extend.Handle(moderationCntrl.ListCounterfeits), UsePermissionPolicy(policyCntrl, models.PermManageRisk)...)
+	adminRoute.DELETE("/counterfeits/:currency_code/:id", extend.Handle(moderationCntrl.DeleteCounterfeit), UsePermissionPolicy(policyCntrl, models.PermManageRisk)...)
+	adminRoute.GET("/serial_rules/:currency_code", extend.Handle(moderationCntrl.GetSerialRules), UsePermissionPolicy(policyCntrl, models.PermManageRisk)...)
+	adminRoute.PUT("/serial_rules/:currency_code", extend.Handle(moderationCntrl.SetSerialRules), UsePermissionPolicy(policyCntrl, models.PermManageRisk)...)
+
+	// event streaming route
+	v1.GET("/events", extend.Handle(eventCntrl.Stream), UseAuthPolicy(policyCntrl)...)
 
 	return router, mongoSession
 }